@@ -0,0 +1,156 @@
+package check
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cacheVersion is part of every cache key; bump it when the way results are
+// computed changes, to invalidate all cached results
+const cacheVersion = "1"
+
+// ResultCache stores the findings of a check for a single file
+type ResultCache interface {
+	Get(key string) ([]Error, bool)
+	Set(key string, errs []Error)
+}
+
+// CacheStats counts the files whose cached results were reused (hits) and
+// the files the check had to be run on (misses)
+type CacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// PackageCheck is a check that can be limited to some of a repository's
+// packages, so that results for unchanged files can be reused
+type PackageCheck interface {
+	Check
+	// Version changes whenever the tool or its configuration changes
+	Version() string
+	ForPackages(pkgs, filenames []string) Check
+}
+
+func toolVersion(command []string) string {
+	return cacheVersion + " " + strings.Join(command, " ")
+}
+
+// Cached wraps a PackageCheck with a cache of its findings per file, keyed on
+// the file's name and content hash and the check's version. Only packages
+// with changed files are checked again.
+type Cached struct {
+	PackageCheck
+	Filenames []string
+	Cache     ResultCache
+	Stats     *CacheStats
+}
+
+// cacheKey returns the cache key of a file's results for the check
+func (c Cached) cacheKey(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s|%s|%s|%s", c.Name(), c.Version(), cachedFilename(filename), hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// cachedFilename returns the file name as shown in reports, which does not
+// depend on the downloaded version of the repository
+func cachedFilename(filename string) string {
+	return displayFilename(strings.TrimPrefix(filename, "_repos/src"))
+}
+
+// Percentage returns the check's passing percentage, running it only on the
+// packages containing files without cached results
+func (c Cached) Percentage() (float64, []FileSummary, error) {
+	if c.Cache == nil || len(c.Filenames) < 2 {
+		// single-file repos are scored by line, not by file
+		return c.PackageCheck.Percentage()
+	}
+
+	keys := make(map[string]string, len(c.Filenames))
+	var summaries []FileSummary
+	var stale []string
+	for _, fn := range c.Filenames {
+		key, err := c.cacheKey(fn)
+		if err != nil {
+			return c.PackageCheck.Percentage()
+		}
+		keys[fn] = key
+
+		errs, ok := c.Cache.Get(key)
+		if !ok {
+			stale = append(stale, fn)
+			continue
+		}
+		if len(errs) > 0 {
+			filename := strings.TrimPrefix(fn, "_repos/src")
+			summaries = append(summaries, FileSummary{Filename: displayFilename(filename), FileURL: fileURL(filename), Errors: errs})
+		}
+	}
+
+	c.Stats.Hits = len(c.Filenames) - len(stale)
+	c.Stats.Misses = len(stale)
+	log.Printf("%s: %d cached file result(s), checking %d file(s)", c.Name(), c.Stats.Hits, c.Stats.Misses)
+
+	if len(stale) > 0 {
+		pkgs, filenames := stalePackages(c.Filenames, stale)
+		_, fresh, err := c.ForPackages(pkgs, filenames).Percentage()
+		if err != nil {
+			return 0, fresh, err
+		}
+
+		found := make(map[string]FileSummary, len(fresh))
+		for _, fs := range fresh {
+			found[fs.Filename] = fs
+		}
+		for _, fn := range filenames {
+			fs, ok := found[cachedFilename(fn)]
+			if !ok {
+				fs.Errors = []Error{}
+			}
+			c.Cache.Set(keys[fn], fs.Errors)
+		}
+		summaries = append(summaries, fresh...)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Filename < summaries[j].Filename })
+	if summaries == nil {
+		summaries = []FileSummary{}
+	}
+
+	return float64(len(c.Filenames)-len(summaries)) / float64(len(c.Filenames)), summaries, nil
+}
+
+// stalePackages returns the directories of the changed files, and all files
+// in those directories, since checks run on whole packages
+func stalePackages(all, stale []string) (pkgs, filenames []string) {
+	dirs := make(map[string]bool)
+	for _, fn := range stale {
+		dir := filepath.Dir(fn)
+		if !dirs[dir] {
+			dirs[dir] = true
+			pkgs = append(pkgs, dir)
+		}
+	}
+	for _, fn := range all {
+		if dirs[filepath.Dir(fn)] {
+			filenames = append(filenames, fn)
+		}
+	}
+	return pkgs, filenames
+}
@@ -0,0 +1,89 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type mapCache map[string][]Error
+
+func (m mapCache) Get(key string) ([]Error, bool) { errs, ok := m[key]; return errs, ok }
+func (m mapCache) Set(key string, errs []Error)   { m[key] = errs }
+
+// fakeCheck reports an error in every file named bad.go and records the
+// packages it was run on
+type fakeCheck struct {
+	filenames []string
+	runs      *[][]string
+	pkgs      []string
+}
+
+func (f fakeCheck) Name() string        { return "fake" }
+func (f fakeCheck) Description() string { return "" }
+func (f fakeCheck) Weight() float64     { return 1 }
+func (f fakeCheck) Version() string     { return "1" }
+
+func (f fakeCheck) ForPackages(pkgs, filenames []string) Check {
+	f.pkgs, f.filenames = pkgs, filenames
+	return f
+}
+
+func (f fakeCheck) Percentage() (float64, []FileSummary, error) {
+	*f.runs = append(*f.runs, f.pkgs)
+	var failed []FileSummary
+	for _, fn := range f.filenames {
+		if filepath.Base(fn) == "bad.go" {
+			failed = append(failed, FileSummary{Filename: fn, Errors: []Error{{LineNumber: 1, ErrorString: "bad"}}})
+		}
+	}
+	return 0, failed, nil
+}
+
+func TestCachedPercentage(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a", "bad.go"), filepath.Join(dir, "b", "good.go")
+	for _, fn := range []string{a, b} {
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte("package x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var runs [][]string
+	cache := mapCache{}
+	grade := func() (float64, CacheStats) {
+		stats := &CacheStats{}
+		c := Cached{PackageCheck: fakeCheck{runs: &runs}, Filenames: []string{a, b}, Cache: cache, Stats: stats}
+		p, summaries, err := c.Percentage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(summaries) != 1 || summaries[0].Filename != a {
+			t.Errorf("summaries = %+v, want one for %s", summaries, a)
+		}
+		return p, *stats
+	}
+
+	if p, stats := grade(); p != 0.5 || stats != (CacheStats{Hits: 0, Misses: 2}) {
+		t.Errorf("first run: percentage %v, stats %+v", p, stats)
+	}
+	if p, stats := grade(); p != 0.5 || stats != (CacheStats{Hits: 2, Misses: 0}) {
+		t.Errorf("unchanged run: percentage %v, stats %+v", p, stats)
+	}
+
+	if err := os.WriteFile(b, []byte("package x\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if p, stats := grade(); p != 0.5 || stats != (CacheStats{Hits: 1, Misses: 1}) {
+		t.Errorf("changed run: percentage %v, stats %+v", p, stats)
+	}
+
+	want := [][]string{{filepath.Dir(a), filepath.Dir(b)}, {filepath.Dir(b)}}
+	if !reflect.DeepEqual(runs, want) {
+		t.Errorf("check ran on %v, want %v", runs, want)
+	}
+}
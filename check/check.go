@@ -1,9 +1,11 @@
 package check
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"sort"
+	"strings"
 )
 
 // Check describes what methods various checks (gofmt, go lint, etc.)
@@ -17,6 +19,16 @@ type Check interface {
 	Percentage() (float64, []FileSummary, error)
 }
 
+// Noter is implemented by checks that summarize their findings for the
+// report, such as with totals
+type Noter interface {
+	Note(summaries []FileSummary) string
+}
+
+// ErrSkipped is returned, possibly wrapped with a reason, by checks that do
+// not apply to a repository. Skipped checks do not count towards the grade.
+var ErrSkipped = errors.New("skipped")
+
 // Score represents the result of a single check
 type Score struct {
 	Name          string        `json:"name"`
@@ -25,6 +37,9 @@ type Score struct {
 	Weight        float64       `json:"weight"`
 	Percentage    float64       `json:"percentage"`
 	Error         string        `json:"error"`
+	Skipped       bool          `json:"skipped"`
+	Note          string        `json:"note,omitempty"` // why the check was skipped, or a summary of its findings
+	Cache         *CacheStats   `json:"cache,omitempty"`
 }
 
 // ChecksResult represents the combined result of multiple checks
@@ -35,14 +50,117 @@ type ChecksResult struct {
 	Files    int     `json:"files"`
 	Issues   int     `json:"issues"`
 	DidError bool    `json:"did_error"`
+	Gates    []Gate  `json:"gates"` // tripped gates capping the grade
+}
+
+// CheckState is how far a check has come while a repository is graded
+type CheckState string
+
+// States of a check, reported to Options.Progress in this order
+const (
+	CheckPending CheckState = "pending"
+	CheckRunning CheckState = "running"
+	CheckDone    CheckState = "done"
+)
+
+// Options holds the optional settings of a run
+type Options struct {
+	// Cache reuses the results of files that have not changed since they were checked
+	Cache ResultCache
+	// Complexity caps the grade of repositories with overly complex functions
+	Complexity ComplexityGate
+	// MinFiles caps the grade of repositories with too few Go files
+	MinFiles FileCountGate
+	// ReviveConfig is the revive configuration used for repositories without
+	// a revive.toml of their own
+	ReviveConfig string
+	// Golint grades style with the deprecated golint instead of revive, for
+	// comparing grades during the migration
+	Golint bool
+	// RequiredFiles are the file patterns every repository must have; the
+	// required files check is skipped when there are none
+	RequiredFiles []string
+	// Exclude lists patterns of files to exclude from all checks, in
+	// gitignore syntax, in addition to those of the .goreportcardignore file
+	Exclude []string
+	// Weights replaces the weight of the checks with the given names; a
+	// check with a zero weight does not count towards the grade
+	Weights map[string]float64
+	// Thresholds are the percentages needed for each grade, defaulting to
+	// DefaultThresholds
+	Thresholds Thresholds
+	// Todos configures the todo check, which does not count towards the
+	// grade unless it is given a weight
+	Todos TodoOptions
+	// GofmtGrace is the number of lines a file may need to change for gofmt
+	// before they count against the grade
+	GofmtGrace int
+	// Coverage configures the coverage check, which is skipped unless enabled
+	Coverage CoverageOptions
+	// Progress, if set, is called with the name of each check as it is
+	// pending, starts running and is done. The checks run concurrently, so it
+	// is called from several goroutines.
+	Progress func(name string, state CheckState)
+}
+
+// Validate returns an error if the options name unknown checks, give a
+// check a negative weight or set invalid grade thresholds
+func (opts Options) Validate() error {
+	if _, err := ParseIgnore(strings.Join(opts.Exclude, "\n")); err != nil {
+		return err
+	}
+
+	known := make(map[string]bool)
+	for _, name := range CheckNames() {
+		known[name] = true
+	}
+	for name, w := range opts.Weights {
+		if !known[name] {
+			return fmt.Errorf("unknown check %q", name)
+		}
+		if w < 0 {
+			return fmt.Errorf("weight of %s must not be negative, got %v", name, w)
+		}
+	}
+
+	if opts.Todos.Weight < 0 || opts.Todos.Threshold < 0 {
+		return fmt.Errorf("weight and threshold of the todo check must not be negative")
+	}
+	if opts.GofmtGrace < 0 {
+		return fmt.Errorf("gofmt grace must not be negative, got %d", opts.GofmtGrace)
+	}
+	if opts.Coverage.Min < 0 || opts.Coverage.Min > 100 {
+		return fmt.Errorf("coverage minimum must be a percentage from 0 to 100, got %v", opts.Coverage.Min)
+	}
+	if opts.Coverage.Timeout < 0 {
+		return fmt.Errorf("coverage timeout must not be negative, got %s", opts.Coverage.Timeout)
+	}
+
+	return opts.Thresholds.Validate()
 }
 
 // Run executes all checks on the given directory
 func Run(dir string, cli bool) (ChecksResult, error) {
+	return RunWithCache(dir, cli, nil)
+}
+
+// RunWithCache executes all checks on the given directory like Run, reusing
+// the cached results of files that have not changed since they were checked
+func RunWithCache(dir string, cli bool, cache ResultCache) (ChecksResult, error) {
+	return RunWithOptions(dir, cli, Options{Cache: cache})
+}
+
+// RunWithOptions executes all checks on the given directory like Run, with
+// the given cache and gates
+func RunWithOptions(dir string, cli bool, opts Options) (ChecksResult, error) {
 	filenames, skipped, err := GoFiles(dir)
 	if err != nil {
 		return ChecksResult{}, fmt.Errorf("could not get filenames: %v", err)
 	}
+	filenames, skipped, err = applyIgnoreFile(dir, filenames, skipped, opts.Exclude)
+	if err != nil {
+		return ChecksResult{}, fmt.Errorf("could not read %s: %v", IgnoreFilename, err)
+	}
 	if len(filenames) == 0 {
 		return ChecksResult{}, fmt.Errorf("no .go files found")
 	}
@@ -56,35 +174,63 @@ func Run(dir string, cli bool) (ChecksResult, error) {
 		defer RevertFiles(skipped)
 	}
 
-	checks := []Check{
-		GoFmt{Dir: dir, Filenames: filenames},
-		GoVet{Dir: dir, Filenames: filenames},
-		// GoLint{Dir: dir, Filenames: filenames},
-		GoCyclo{Dir: dir, Filenames: filenames},
-		License{Dir: dir, Filenames: []string{}},
-		Misspell{Dir: dir, Filenames: filenames},
-		IneffAssign{Dir: dir, Filenames: filenames},
-		// Staticcheck{Dir: dir, Filenames: filenames},
-		// ErrCheck{Dir: dir, Filenames: filenames}, // disable errcheck for now, too slow and not finalized
+	checks := checksFor(dir, filenames, opts)
+
+	gaters := make(map[string]Gater)
+	for _, c := range checks {
+		if g, ok := c.(Gater); ok {
+			gaters[c.Name()] = g
+		}
+	}
+
+	stats := make(map[string]*CacheStats)
+	if opts.Cache != nil {
+		for i, c := range checks {
+			if pc, ok := c.(PackageCheck); ok {
+				stats[c.Name()] = &CacheStats{}
+				checks[i] = Cached{PackageCheck: pc, Filenames: filenames, Cache: opts.Cache, Stats: stats[c.Name()]}
+			}
+		}
+	}
+
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(string, CheckState) {}
+	}
+	for _, c := range checks {
+		progress(c.Name(), CheckPending)
 	}
 
 	ch := make(chan Score)
 	for _, c := range checks {
 		go func(c Check) {
+			progress(c.Name(), CheckRunning)
 			p, summaries, err := c.Percentage()
-			errMsg := ""
-			if err != nil {
+			errMsg, note := "", ""
+			skipped := errors.Is(err, ErrSkipped)
+			switch {
+			case skipped:
+				note = err.Error()
+			case err != nil:
 				log.Printf("ERROR: (%s) %v", c.Name(), err)
 				errMsg = err.Error()
+			default:
+				if n, ok := c.(Noter); ok {
+					note = n.Note(summaries)
+				}
 			}
 			s := Score{
 				Name:          c.Name(),
 				Description:   c.Description(),
 				FileSummaries: summaries,
-				Weight:        c.Weight(),
+				Weight:        weight(c, opts.Weights),
 				Percentage:    p,
 				Error:         errMsg,
+				Skipped:       skipped,
+				Note:          note,
+				Cache:         stats[c.Name()],
 			}
+			progress(c.Name(), CheckDone)
 			ch <- s
 		}(c)
 	}
@@ -98,25 +244,97 @@ func Run(dir string, cli bool) (ChecksResult, error) {
 	for i := 0; i < len(checks); i++ {
 		s := <-ch
 		resp.Checks = append(resp.Checks, s)
+		if s.Skipped {
+			continue
+		}
 		total += s.Percentage * s.Weight
 		totalWeight += s.Weight
-		for _, fs := range s.FileSummaries {
-			issues[fs.Filename] = true
+		// checks without weight, such as todo by default, are informational
+		if s.Weight > 0 {
+			for _, fs := range s.FileSummaries {
+				issues[fs.Filename] = true
+			}
 		}
 		if s.Error != "" {
 			resp.DidError = true
 		}
+		if g, ok := gaters[s.Name]; ok {
+			if gate := g.Gate(s.FileSummaries); gate != nil {
+				resp.Gates = append(resp.Gates, *gate)
+			}
+		}
+	}
+	if totalWeight > 0 {
+		total /= totalWeight
+	}
+	if gate := opts.MinFiles.Gate(len(filenames)); gate != nil {
+		resp.Gates = append(resp.Gates, *gate)
 	}
-	total /= totalWeight
 
 	sort.Sort(ByWeight(resp.Checks))
 	resp.Average = total
 	resp.Issues = len(issues)
-	resp.Grade = GradeFromPercentage(total * 100)
+	resp.Grade = CapGrade(opts.Thresholds.Grade(total*100), resp.Gates)
 
 	return resp, nil
 }
 
+// checksFor returns the checks run on the files of dir
+func checksFor(dir string, filenames []string, opts Options) []Check {
+	return []Check{
+		GoFmt{Dir: dir, Filenames: filenames, Grace: opts.GofmtGrace},
+		GoVet{Dir: dir, Filenames: filenames},
+		styleCheck(dir, filenames, opts),
+		GoCyclo{Dir: dir, Filenames: filenames, Limit: opts.Complexity},
+		License{Dir: dir, Filenames: []string{}},
+		RequiredFiles{Dir: dir, Patterns: opts.RequiredFiles},
+		Misspell{Dir: dir, Filenames: filenames},
+		IneffAssign{Dir: dir, Filenames: filenames},
+		GoMod{Dir: dir, Filenames: filenames},
+		Todos{Dir: dir, Filenames: filenames, Options: opts.Todos},
+		&Coverage{Dir: dir, Options: opts.Coverage},
+		// Staticcheck{Dir: dir, Filenames: filenames},
+		// ErrCheck{Dir: dir, Filenames: filenames}, // disable errcheck for now, too slow and not finalized
+	}
+}
+
+// CheckNames returns the names of the checks that may be run, for options
+// referring to them
+func CheckNames() []string {
+	var names []string
+	for _, c := range checksFor("", nil, Options{}) {
+		names = append(names, c.Name())
+	}
+	return append(names, GoLint{}.Name())
+}
+
+// DefaultWeights returns the weight of each check, unless Options.Weights
+// replaces it
+func DefaultWeights() map[string]float64 {
+	weights := make(map[string]float64)
+	for _, c := range append(checksFor("", nil, Options{}), GoLint{}) {
+		weights[c.Name()] = c.Weight()
+	}
+	return weights
+}
+
+// weight returns the weight of c, unless weights replaces it
+func weight(c Check, weights map[string]float64) float64 {
+	if w, ok := weights[c.Name()]; ok {
+		return w
+	}
+	return c.Weight()
+}
+
+// styleCheck returns the check grading code style: revive, or golint when
+// the options ask for it
+func styleCheck(dir string, filenames []string, opts Options) Check {
+	if opts.Golint {
+		return GoLint{Dir: dir, Filenames: filenames}
+	}
+	return Revive{Dir: dir, Filenames: filenames, Config: opts.ReviveConfig}
+}
+
 // ByWeight implements sorting for checks by weight descending
 type ByWeight []Score
 
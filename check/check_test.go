@@ -14,3 +14,22 @@ func TestRun(t *testing.T) {
 		t.Errorf("got cr.Issues = %d, want %d", cr.Issues, 2)
 	}
 }
+
+func TestOptionsValidate(t *testing.T) {
+	var tests = []struct {
+		opts    Options
+		wantErr bool
+	}{
+		{Options{}, false},
+		{Options{Exclude: []string{"gen/", "*.pb.go"}, Weights: map[string]float64{"gofmt": 0.5, "golint": 0}}, false},
+		{Options{Weights: map[string]float64{"gofmt": -1}}, true},
+		{Options{Weights: map[string]float64{"spelling": 1}}, true},
+		{Options{Thresholds: Thresholds{GradeB: 99}}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v.Validate() = %v, wantErr %v", tt.opts, err, tt.wantErr)
+		}
+	}
+}
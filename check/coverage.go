@@ -0,0 +1,276 @@
+package check
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCoverageMin is the percentage of statements each package's tests
+// must cover before the coverage check counts it against the grade
+const DefaultCoverageMin = 60
+
+// DefaultCoverageTimeout is how long the coverage check lets the tests run
+const DefaultCoverageTimeout = 5 * time.Minute
+
+// CoverageOptions configures the coverage check
+type CoverageOptions struct {
+	// Enabled runs the check. Running a repository's tests is slow, so it is
+	// skipped unless enabled.
+	Enabled bool
+	// Min is the percentage of statements each package must have covered,
+	// DefaultCoverageMin when 0
+	Min float64
+	// Profile is a coverage profile to read, relative to the repository root,
+	// instead of running the tests
+	Profile string
+	// Timeout bounds how long the tests may run, DefaultCoverageTimeout when 0
+	Timeout time.Duration
+}
+
+// Coverage is the check for the share of statements the tests cover, by
+// package. It is used by pointer, so that the note can report the coverage
+// Percentage read without running the tests again.
+type Coverage struct {
+	Dir     string
+	Options CoverageOptions
+
+	pkgs []packageCoverage // coverage read by Percentage
+}
+
+// Name returns the name of the display name of the command
+func (g *Coverage) Name() string {
+	return "coverage"
+}
+
+// Weight returns the weight this check has in the overall average
+func (g *Coverage) Weight() float64 {
+	return .10
+}
+
+func (g *Coverage) min() float64 {
+	if g.Options.Min > 0 {
+		return g.Options.Min
+	}
+	return DefaultCoverageMin
+}
+
+func (g *Coverage) timeout() time.Duration {
+	if g.Options.Timeout > 0 {
+		return g.Options.Timeout
+	}
+	return DefaultCoverageTimeout
+}
+
+// packageCoverage is the number of statements of a package and how many of
+// them the tests cover
+type packageCoverage struct {
+	pkg                 string
+	statements, covered int
+}
+
+func (c packageCoverage) percent() float64 {
+	if c.statements == 0 {
+		return 100
+	}
+	return float64(c.covered) * 100 / float64(c.statements)
+}
+
+// parseCoverProfile returns the coverage of each package in a profile written
+// by go test -coverprofile, sorted by package. A block listed more than once,
+// as in profiles merged from several runs, counts as covered if any run
+// covered it.
+func parseCoverProfile(r io.Reader) ([]packageCoverage, error) {
+	type block struct {
+		statements int
+		covered    bool
+	}
+	blocks := make(map[string]block)
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// file.go:12.2,14.16 3 1
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.Contains(fields[0], ":") {
+			return nil, fmt.Errorf("line %d: invalid coverage block %q", n, line)
+		}
+		statements, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("line %d: invalid coverage block %q", n, line)
+		}
+		b := blocks[fields[0]]
+		b.statements = statements
+		b.covered = b.covered || count > 0
+		blocks[fields[0]] = b
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	byPkg := make(map[string]*packageCoverage)
+	for key, b := range blocks {
+		file := key[:strings.LastIndex(key, ":")]
+		pkg := path.Dir(file)
+		c, ok := byPkg[pkg]
+		if !ok {
+			c = &packageCoverage{pkg: pkg}
+			byPkg[pkg] = c
+		}
+		c.statements += b.statements
+		if b.covered {
+			c.covered += b.statements
+		}
+	}
+
+	pkgs := make([]packageCoverage, 0, len(byPkg))
+	for _, c := range byPkg {
+		pkgs = append(pkgs, *c)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].pkg < pkgs[j].pkg })
+	return pkgs, nil
+}
+
+// runTests runs the repository's tests with coverage and returns the profile
+// they wrote. Tests that fail still report their coverage; tests that cannot
+// be built, or do not finish in time, skip the check.
+func (g *Coverage) runTests() ([]packageCoverage, error) {
+	profile, err := os.CreateTemp("", "goreportcard-cover-*.out")
+	if err != nil {
+		return nil, err
+	}
+	profile.Close()
+	defer os.Remove(profile.Name())
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", "test", "-covermode=set", "-coverprofile="+profile.Name(), "./...")
+	cmd.Dir = g.Dir
+	cmd.WaitDelay = 10 * time.Second
+	out, runErr := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: tests did not finish within %s", ErrSkipped, g.timeout())
+	}
+
+	f, err := os.Open(profile.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pkgs, err := parseCoverProfile(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 0 && runErr != nil {
+		return nil, fmt.Errorf("%w: tests could not be built: %s", ErrSkipped, firstLine(string(out)))
+	}
+	return pkgs, nil
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// coverage returns the coverage of each package, read from the profile or
+// from running the tests
+func (g *Coverage) coverage() ([]packageCoverage, error) {
+	if g.Options.Profile == "" {
+		return g.runTests()
+	}
+
+	p := g.Options.Profile
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(g.Dir, p)
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: coverage profile %s not found", ErrSkipped, g.Options.Profile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseCoverProfile(f)
+}
+
+// Percentage returns the share of packages whose tests cover at least the
+// minimum share of their statements, listing those below it, the least
+// covered first. The check is skipped unless it is enabled.
+func (g *Coverage) Percentage() (float64, []FileSummary, error) {
+	if !g.Options.Enabled {
+		return 0, []FileSummary{}, fmt.Errorf("%w: coverage is not enabled", ErrSkipped)
+	}
+
+	pkgs, err := g.coverage()
+	if err != nil {
+		return 0, []FileSummary{}, err
+	}
+	if len(pkgs) == 0 {
+		return 0, []FileSummary{}, fmt.Errorf("%w: no packages with statements to cover", ErrSkipped)
+	}
+	g.pkgs = pkgs
+
+	var below []packageCoverage
+	for _, c := range pkgs {
+		if c.percent() < g.min() {
+			below = append(below, c)
+		}
+	}
+	sort.SliceStable(below, func(i, j int) bool { return below[i].percent() < below[j].percent() })
+
+	summaries := make([]FileSummary, 0, len(below))
+	for _, c := range below {
+		summaries = append(summaries, FileSummary{
+			Filename: c.pkg,
+			Errors: []Error{{
+				ErrorString: fmt.Sprintf("%.1f%% of %d statements covered, below the minimum of %g%%", c.percent(), c.statements, g.min()),
+			}},
+		})
+	}
+
+	return 1 - float64(len(below))/float64(len(pkgs)), summaries, nil
+}
+
+// Note returns the overall coverage and that of each package, which the
+// summaries only list for the packages below the minimum
+func (g *Coverage) Note(summaries []FileSummary) string {
+	if len(g.pkgs) == 0 {
+		return ""
+	}
+
+	var statements, covered int
+	parts := make([]string, 0, len(g.pkgs))
+	for _, c := range g.pkgs {
+		statements += c.statements
+		covered += c.covered
+		parts = append(parts, fmt.Sprintf("%s %.1f%%", c.pkg, c.percent()))
+	}
+	overall := packageCoverage{statements: statements, covered: covered}
+	return fmt.Sprintf("%.1f%% of %d statements covered overall, %d of %d packages below the minimum of %g%%. By package: %s.",
+		overall.percent(), statements, len(summaries), len(g.pkgs), g.min(), strings.Join(parts, ", "))
+}
+
+// Description returns the description of Coverage
+func (g *Coverage) Description() string {
+	return `Runs <code>go test -cover</code>, or reads a supplied coverage profile, and lists the packages whose tests cover less than the minimum share of their statements.`
+}
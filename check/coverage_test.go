@@ -0,0 +1,113 @@
+package check
+
+import (
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testProfile = `mode: set
+example.com/m/a/a.go:3.14,5.2 2 1
+example.com/m/a/a.go:7.14,9.2 2 0
+example.com/m/a/a.go:7.14,9.2 2 1
+example.com/m/b/b.go:3.14,5.2 1 0
+example.com/m/b/b.go:7.14,9.2 3 1
+`
+
+func TestParseCoverProfile(t *testing.T) {
+	pkgs, err := parseCoverProfile(strings.NewReader(testProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || pkgs[0].pkg != "example.com/m/a" || pkgs[1].pkg != "example.com/m/b" {
+		t.Fatalf("got packages %+v, want a and b", pkgs)
+	}
+	// a block covered by any run of a merged profile counts as covered
+	if pkgs[0].percent() != 100 || pkgs[1].percent() != 75 {
+		t.Errorf("got coverage %v and %v, want 100 and 75", pkgs[0].percent(), pkgs[1].percent())
+	}
+
+	if _, err := parseCoverProfile(strings.NewReader("mode: set\nnot a block\n")); err == nil {
+		t.Error("got no error for an invalid profile")
+	}
+}
+
+func TestCoveragePercentage(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cover.out"), []byte(testProfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := (&Coverage{Dir: dir}).Percentage(); !errors.Is(err, ErrSkipped) {
+		t.Errorf("got %v for a check that is not enabled, want it skipped", err)
+	}
+	if _, _, err := (&Coverage{Dir: dir, Options: CoverageOptions{Enabled: true, Profile: "missing.out"}}).Percentage(); !errors.Is(err, ErrSkipped) {
+		t.Errorf("got %v for a missing profile, want it skipped", err)
+	}
+
+	c := &Coverage{Dir: dir, Options: CoverageOptions{Enabled: true, Min: 80, Profile: "cover.out"}}
+	p, summaries, err := c.Percentage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(p-0.5) > 0.001 {
+		t.Errorf("got percentage %v, want 0.5", p)
+	}
+	if len(summaries) != 1 || summaries[0].Filename != "example.com/m/b" || summaries[0].Errors[0].ErrorString != "75.0% of 4 statements covered, below the minimum of 80%" {
+		t.Errorf("got summaries %+v, want package b below the minimum", summaries)
+	}
+
+	want := "87.5% of 8 statements covered overall, 1 of 2 packages below the minimum of 80%. By package: example.com/m/a 100.0%, example.com/m/b 75.0%."
+	if note := c.Note(summaries); note != want {
+		t.Errorf("got note %q, want %q", note, want)
+	}
+}
+
+func TestCoverageRunTests(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":      "module example.com/m\n\ngo 1.21\n",
+		"a/a.go":      "package a\n\nfunc A(x int) int {\n\tif x > 0 {\n\t\treturn x\n\t}\n\treturn -x\n}\n",
+		"a/a_test.go": "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {\n\tif A(1) != 1 {\n\t\tt.Fatal()\n\t}\n}\n",
+		"b/b.go":      "package b\n\nfunc B() int { return 1 }\n",
+	}
+	for name, content := range files {
+		fn := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &Coverage{Dir: dir, Options: CoverageOptions{Enabled: true, Timeout: time.Minute}}
+	_, summaries, err := c.Percentage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range summaries {
+		if s.Filename == "example.com/m/a" {
+			t.Errorf("got package a below the minimum: %v", s.Errors)
+		}
+	}
+
+	// tests that do not build skip the check
+	if err := os.WriteFile(filepath.Join(dir, "a/a.go"), []byte("package a\n\nfunc A(x int) int { return y }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := (&Coverage{Dir: dir, Options: CoverageOptions{Enabled: true}}).Percentage(); !errors.Is(err, ErrSkipped) {
+		t.Errorf("got %v for tests that do not build, want the check skipped", err)
+	}
+}
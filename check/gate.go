@@ -0,0 +1,130 @@
+package check
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Gate is a hard cap on the grade, imposed by a check whose threshold was
+// violated regardless of how well the other checks did
+type Gate struct {
+	Check    string `json:"check"`
+	MaxGrade Grade  `json:"max_grade"`
+	Reason   string `json:"reason"`
+}
+
+// Gater is implemented by checks that can cap the grade
+type Gater interface {
+	// Gate returns the gate tripped by the check's findings, or nil
+	Gate(summaries []FileSummary) *Gate
+}
+
+// gradeOrder lists the grades from highest to lowest
+var gradeOrder = []Grade{GradeAPlus, GradeA, GradeB, GradeC, GradeD, GradeE, GradeF}
+
+// ParseGrade returns the grade named s, such as "A+" or "C"
+func ParseGrade(s string) (Grade, error) {
+	for _, g := range gradeOrder {
+		if string(g) == s {
+			return g, nil
+		}
+	}
+	return "", fmt.Errorf("unknown grade %q", s)
+}
+
+func gradeRank(g Grade) int {
+	for i, o := range gradeOrder {
+		if o == g {
+			return i
+		}
+	}
+	return len(gradeOrder)
+}
+
+// AtLeast reports whether g is min or a higher grade
+func (g Grade) AtLeast(min Grade) bool {
+	return gradeRank(g) <= gradeRank(min)
+}
+
+// CapGrade returns grade, lowered to the lowest maximum grade of the gates
+func CapGrade(grade Grade, gates []Gate) Grade {
+	for _, g := range gates {
+		if gradeRank(g.MaxGrade) > gradeRank(grade) {
+			grade = g.MaxGrade
+		}
+	}
+	return grade
+}
+
+// ComplexityGate caps the grade of repositories with a function whose
+// cyclomatic complexity is over Max. A zero Max disables the gate. Only the
+// functions gocyclo warns about, those over 15, are considered, so a Max
+// below 15 acts like 15.
+type ComplexityGate struct {
+	Max      int
+	MaxGrade Grade
+}
+
+var complexityRe = regexp.MustCompile(`cyclomatic complexity (\d+) of function (\S+)`)
+
+// Gate returns the gate tripped by the most complex function over the limit
+func (g ComplexityGate) Gate(summaries []FileSummary) *Gate {
+	if g.Max <= 0 {
+		return nil
+	}
+
+	worst, where := 0, ""
+	for _, fs := range summaries {
+		for _, e := range fs.Errors {
+			m := complexityRe.FindStringSubmatch(e.ErrorString)
+			if m == nil {
+				continue
+			}
+			c, err := strconv.Atoi(m[1])
+			if err != nil || c <= g.Max || c <= worst {
+				continue
+			}
+			worst, where = c, fmt.Sprintf("%s in %s:%d", m[2], fs.Filename, e.LineNumber)
+		}
+	}
+	if worst == 0 {
+		return nil
+	}
+
+	return &Gate{
+		Check:    "gocyclo",
+		MaxGrade: g.MaxGrade,
+		Reason:   fmt.Sprintf("%s has cyclomatic complexity %d, over the limit of %d", where, worst, g.Max),
+	}
+}
+
+// DefaultMinFiles is the number of Go files a repository needs for its grade
+// not to be capped by the file count gate
+const DefaultMinFiles = 3
+
+// FileCountGate caps the grade of repositories with fewer than Min Go files,
+// which have too little code for the checks to say much, so that a trivial
+// repository cannot score a perfect grade. A zero Min disables the gate.
+type FileCountGate struct {
+	Min      int
+	MaxGrade Grade
+}
+
+// Gate returns the gate tripped by a repository with the given number of Go
+// files, or nil
+func (g FileCountGate) Gate(files int) *Gate {
+	if g.Min <= 0 || files >= g.Min {
+		return nil
+	}
+
+	noun := "files"
+	if files == 1 {
+		noun = "file"
+	}
+	return &Gate{
+		Check:    "files",
+		MaxGrade: g.MaxGrade,
+		Reason:   fmt.Sprintf("insufficient data, only %d Go %s checked, fewer than the minimum of %d", files, noun, g.Min),
+	}
+}
@@ -0,0 +1,103 @@
+package check
+
+import "testing"
+
+func TestComplexityGate(t *testing.T) {
+	summaries := []FileSummary{
+		{Filename: "download/download.go", Errors: []Error{
+			{LineNumber: 22, ErrorString: "warning: cyclomatic complexity 17 of function download() is high (> 15) (gocyclo)"},
+			{LineNumber: 80, ErrorString: "warning: cyclomatic complexity 31 of function parse() is high (> 15) (gocyclo)"},
+		}},
+		{Filename: "main.go", Errors: []Error{
+			{LineNumber: 7, ErrorString: "warning: cyclomatic complexity 24 of function main() is high (> 15) (gocyclo)"},
+		}},
+	}
+
+	var tests = []struct {
+		gate ComplexityGate
+		want string
+	}{
+		{ComplexityGate{}, ""},
+		{ComplexityGate{Max: 40, MaxGrade: GradeC}, ""},
+		{ComplexityGate{Max: 20, MaxGrade: GradeC}, "parse() in download/download.go:80 has cyclomatic complexity 31, over the limit of 20"},
+		{ComplexityGate{Max: 31, MaxGrade: GradeC}, ""},
+	}
+
+	for _, tt := range tests {
+		g := tt.gate.Gate(summaries)
+		got := ""
+		if g != nil {
+			got = g.Reason
+			if g.MaxGrade != tt.gate.MaxGrade || g.Check != "gocyclo" {
+				t.Errorf("%+v: got gate %+v", tt.gate, g)
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%+v: got reason %q, want %q", tt.gate, got, tt.want)
+		}
+	}
+}
+
+func TestFileCountGate(t *testing.T) {
+	var tests = []struct {
+		gate  FileCountGate
+		files int
+		want  string
+	}{
+		{FileCountGate{}, 1, ""},
+		{FileCountGate{Min: 3, MaxGrade: GradeB}, 3, ""},
+		{FileCountGate{Min: 3, MaxGrade: GradeB}, 1, "insufficient data, only 1 Go file checked, fewer than the minimum of 3"},
+		{FileCountGate{Min: 5, MaxGrade: GradeB}, 2, "insufficient data, only 2 Go files checked, fewer than the minimum of 5"},
+	}
+
+	for _, tt := range tests {
+		g := tt.gate.Gate(tt.files)
+		got := ""
+		if g != nil {
+			got = g.Reason
+			if g.Check != "files" || g.MaxGrade != tt.gate.MaxGrade {
+				t.Errorf("Gate(%d) = %+v, want the files check capping at %s", tt.files, g, tt.gate.MaxGrade)
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%+v.Gate(%d) reason = %q, want %q", tt.gate, tt.files, got, tt.want)
+		}
+	}
+}
+
+func TestCapGrade(t *testing.T) {
+	var tests = []struct {
+		grade Grade
+		gates []Gate
+		want  Grade
+	}{
+		{GradeAPlus, nil, GradeAPlus},
+		{GradeAPlus, []Gate{{MaxGrade: GradeC}}, GradeC},
+		{GradeD, []Gate{{MaxGrade: GradeC}}, GradeD},
+		{GradeA, []Gate{{MaxGrade: GradeB}, {MaxGrade: GradeE}}, GradeE},
+	}
+
+	for _, tt := range tests {
+		if got := CapGrade(tt.grade, tt.gates); got != tt.want {
+			t.Errorf("CapGrade(%s, %v) = %s, want %s", tt.grade, tt.gates, got, tt.want)
+		}
+	}
+}
+
+func TestGradeAtLeast(t *testing.T) {
+	var tests = []struct {
+		grade, min Grade
+		want       bool
+	}{
+		{GradeAPlus, GradeC, true},
+		{GradeC, GradeC, true},
+		{GradeD, GradeC, false},
+		{GradeF, GradeAPlus, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.grade.AtLeast(tt.min); got != tt.want {
+			t.Errorf("%s.AtLeast(%s) = %v, want %v", tt.grade, tt.min, got, tt.want)
+		}
+	}
+}
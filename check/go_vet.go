@@ -1,9 +1,12 @@
 package check
 
+var goVetCommand = []string{"gometalinter", "--deadline=180s", "--disable-all", "--enable=vet"}
+
 // GoVet is the check for the go vet command
 type GoVet struct {
 	Dir       string
 	Filenames []string
+	Packages  []string // package directories to run on instead of all of Dir
 }
 
 // Name returns the name of the display name of the command
@@ -18,10 +21,21 @@ func (g GoVet) Weight() float64 {
 
 // Percentage returns the percentage of .go files that pass go vet
 func (g GoVet) Percentage() (float64, []FileSummary, error) {
-	return GoTool(g.Dir, g.Filenames, []string{"gometalinter", "--deadline=180s", "--disable-all", "--enable=vet"})
+	return goToolPackages(g.Dir, g.Packages, g.Filenames, goVetCommand)
 }
 
 // Description returns the description of go lint
 func (g GoVet) Description() string {
 	return `<code>go vet</code> examines Go source code and reports suspicious constructs, such as Printf calls whose arguments do not align with the format string.`
 }
+
+// Version identifies the tool configuration, for caching results
+func (g GoVet) Version() string {
+	return toolVersion(goVetCommand)
+}
+
+// ForPackages returns the check limited to the given package directories and their files
+func (g GoVet) ForPackages(pkgs, filenames []string) Check {
+	g.Packages, g.Filenames = pkgs, filenames
+	return g
+}
@@ -1,9 +1,13 @@
 package check
 
+var gocycloCommand = []string{"gometalinter", "--deadline=180s", "--disable-all", "--enable=gocyclo", "--cyclo-over=15"}
+
 // GoCyclo is the check for the go cyclo command
 type GoCyclo struct {
 	Dir       string
 	Filenames []string
+	Packages  []string // package directories to run on instead of all of Dir
+	Limit     ComplexityGate
 }
 
 // Name returns the name of the display name of the command
@@ -18,7 +22,12 @@ func (g GoCyclo) Weight() float64 {
 
 // Percentage returns the percentage of .go files that pass gofmt
 func (g GoCyclo) Percentage() (float64, []FileSummary, error) {
-	return GoTool(g.Dir, g.Filenames, []string{"gometalinter", "--deadline=180s", "--disable-all", "--enable=gocyclo", "--cyclo-over=15"})
+	return goToolPackages(g.Dir, g.Packages, g.Filenames, gocycloCommand)
+}
+
+// Gate returns the gate tripped by functions over the complexity limit, if any
+func (g GoCyclo) Gate(summaries []FileSummary) *Gate {
+	return g.Limit.Gate(summaries)
 }
 
 // Description returns the description of GoCyclo
@@ -32,3 +41,14 @@ The cyclomatic complexity of a function is calculated according to the following
 
 Go Report Card warns on functions with cyclomatic complexity > 15.`
 }
+
+// Version identifies the tool configuration, for caching results
+func (g GoCyclo) Version() string {
+	return toolVersion(gocycloCommand)
+}
+
+// ForPackages returns the check limited to the given package directories and their files
+func (g GoCyclo) ForPackages(pkgs, filenames []string) Check {
+	g.Packages, g.Filenames = pkgs, filenames
+	return g
+}
@@ -1,9 +1,31 @@
 package check
 
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var gofmtCommand = []string{"gofmt", "-s", "-d"}
+
+// gofmtBatch is the number of files passed to each gofmt run
+const gofmtBatch = 100
+
+// gofmtCount is the first entry of each file gofmt would change
+const gofmtCount = "%d lines need formatting (+%d -%d)"
+
 // GoFmt is the check for the go fmt command
 type GoFmt struct {
 	Dir       string
 	Filenames []string
+	// Grace is the number of lines a file may need to change before they
+	// count against the grade. Files within the grace are still listed.
+	Grace int
 }
 
 // Name returns the name of the display name of the command
@@ -16,13 +38,180 @@ func (g GoFmt) Weight() float64 {
 	return .30
 }
 
-// Percentage returns the percentage of .go files that pass gofmt
+// gofmtFile is the difference between a file and its gofmt -s output
+type gofmtFile struct {
+	filename string
+	added    int
+	removed  int
+	hunks    []Error // first changed line and size of each hunk
+	err      string  // why gofmt could not format the file
+}
+
+// changed returns the number of lines of the file that gofmt would change
+func (f gofmtFile) changed() int {
+	return max(f.added, f.removed)
+}
+
+// gofmtDiffs runs gofmt -s -d on the files and returns those it would change
+// or could not parse, by name
+func gofmtDiffs(filenames []string) (map[string]*gofmtFile, error) {
+	diffs := make(map[string]*gofmtFile)
+	for start := 0; start < len(filenames); start += gofmtBatch {
+		batch := filenames[start:min(start+gofmtBatch, len(filenames))]
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(gofmtCommand[0], append(gofmtCommand[1:], batch...)...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil && stderr.Len() == 0 {
+			// gofmt exits with 2 after reporting files it cannot parse
+			return nil, err
+		}
+
+		parseGofmtDiff(&stdout, diffs)
+		for _, l := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+			// filename:line:column: message
+			parts := strings.SplitN(l, ":", 4)
+			if len(parts) < 4 {
+				continue
+			}
+			f := diffs[parts[0]]
+			if f == nil {
+				f = &gofmtFile{filename: parts[0]}
+				diffs[parts[0]] = f
+			}
+			if f.err == "" {
+				f.err = strings.TrimSpace(parts[3])
+				line, _ := strconv.Atoi(parts[1])
+				f.hunks = append(f.hunks, Error{LineNumber: line, ErrorString: "gofmt could not parse the file: " + f.err})
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// parseGofmtDiff adds the files, hunks and line counts of gofmt -d output to diffs
+func parseGofmtDiff(out *bytes.Buffer, diffs map[string]*gofmtFile) {
+	var f *gofmtFile
+	var hunk *Error
+	var line, added, removed int
+	endHunk := func() {
+		if hunk != nil {
+			hunk.ErrorString = fmt.Sprintf("formatting changes +%d -%d lines", added, removed)
+			f.hunks = append(f.hunks, *hunk)
+		}
+		hunk, added, removed = nil, 0, 0
+	}
+
+	s := bufio.NewScanner(out)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		l := s.Text()
+		switch {
+		case strings.HasPrefix(l, "diff "):
+			endHunk()
+			fields := strings.Fields(l)
+			name := fields[len(fields)-1]
+			f = &gofmtFile{filename: name}
+			diffs[name] = f
+		case f == nil, strings.HasPrefix(l, "--- "), strings.HasPrefix(l, "+++ "):
+		case strings.HasPrefix(l, "@@ "):
+			endHunk()
+			// @@ -start,count +start,count @@
+			start := strings.TrimPrefix(strings.Fields(l)[1], "-")
+			line, _ = strconv.Atoi(strings.SplitN(start, ",", 2)[0])
+			hunk = &Error{}
+		case hunk == nil:
+		case strings.HasPrefix(l, "-"), strings.HasPrefix(l, "+"):
+			if hunk.LineNumber == 0 {
+				hunk.LineNumber = line
+			}
+			if l[0] == '-' {
+				removed++
+				f.removed++
+				line++
+			} else {
+				added++
+				f.added++
+			}
+		default:
+			line++
+		}
+	}
+	endHunk()
+}
+
+// Percentage returns the share of lines that gofmt -s leaves as they are,
+// leaving out the changes to files within the grace, and lists the files it
+// would change, those with the most changes first. Files gofmt cannot parse
+// count as unformatted.
 func (g GoFmt) Percentage() (float64, []FileSummary, error) {
-	return GoTool(g.Dir, g.Filenames, []string{"gometalinter", "--deadline=180s", "--disable-all", "--enable=gofmt"})
-	// return GoFmtNative(g.Dir, g.Filenames)
+	if len(g.Filenames) == 0 {
+		return 1, []FileSummary{}, nil
+	}
+
+	diffs, err := gofmtDiffs(g.Filenames)
+	if err != nil {
+		return 0, []FileSummary{}, err
+	}
+
+	var total, unformatted int
+	var files []*gofmtFile
+	for _, fn := range g.Filenames {
+		src, err := os.ReadFile(fn)
+		if err != nil {
+			return 0, []FileSummary{}, err
+		}
+		lines := bytes.Count(src, []byte("\n"))
+		total += lines
+
+		f, ok := diffs[fn]
+		if !ok {
+			continue
+		}
+		files = append(files, f)
+		switch {
+		case f.err != "":
+			unformatted += lines
+		case f.changed() > g.Grace:
+			unformatted += min(f.changed(), lines)
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].changed() > files[j].changed() })
+	summaries := make([]FileSummary, 0, len(files))
+	for _, f := range files {
+		filename := strings.TrimPrefix(f.filename, "_repos/src")
+		summary := FileSummary{Filename: displayFilename(filename), FileURL: fileURL(filename)}
+		if f.err == "" {
+			summary.Errors = append(summary.Errors, Error{ErrorString: fmt.Sprintf(gofmtCount, f.changed(), f.added, f.removed)})
+		}
+		summary.Errors = append(summary.Errors, f.hunks...)
+		summaries = append(summaries, summary)
+	}
+
+	if total == 0 {
+		return 1, summaries, nil
+	}
+	return max(0, 1-float64(unformatted)/float64(total)), summaries, nil
+}
+
+// Note returns the number of files gofmt would change and the size of the diff
+func (g GoFmt) Note(summaries []FileSummary) string {
+	if len(summaries) == 0 {
+		return ""
+	}
+	diff := 0
+	for _, fs := range summaries {
+		var changed, added, removed int
+		if len(fs.Errors) > 0 {
+			if _, err := fmt.Sscanf(fs.Errors[0].ErrorString, gofmtCount, &changed, &added, &removed); err == nil {
+				diff += added + removed
+			}
+		}
+	}
+	return fmt.Sprintf("%d file(s) need formatting, %d diff line(s)", len(summaries), diff)
 }
 
 // Description returns the description of gofmt
 func (g GoFmt) Description() string {
-	return `Gofmt formats Go programs. We run <code>gofmt -s</code> on your code, where <code>-s</code> is for the <a href="https://golang.org/cmd/gofmt/#hdr-The_simplify_command">"simplify" command</a>`
+	return `Gofmt formats Go programs. We run <code>gofmt -s</code> on your code, where <code>-s</code> is for the <a href="https://golang.org/cmd/gofmt/#hdr-The_simplify_command">"simplify" command</a>. The score is the share of lines gofmt leaves unchanged.`
 }
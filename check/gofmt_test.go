@@ -0,0 +1,66 @@
+package check
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoFmtPercentage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"clean.go":  "package a\n\nfunc A() {}\n" + strings.Repeat("\nvar _ = 1\n", 10),
+		"space.go":  "package a\n\nfunc B() {\n  return\n}\n" + strings.Repeat("\nvar _ = 1\n", 10),
+		"messy.go":  "package a\nfunc C() {\n x := []int{1}\n_ = x\n}\n",
+		"broken.go": "package a\n\nfunc D( {\n",
+	}
+	var filenames []string
+	for name, content := range files {
+		fn := filepath.Join(dir, name)
+		if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, fn)
+	}
+
+	p, summaries, err := GoFmt{Dir: dir, Filenames: filenames}.Percentage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 changed lines in messy.go, 1 in space.go and the 3 lines of broken.go,
+	// out of 23+25+5+3 lines
+	if want := 1 - 7.0/56; math.Abs(p-want) > 0.001 {
+		t.Errorf("got percentage %v, want %v", p, want)
+	}
+	if len(summaries) != 3 {
+		t.Fatalf("got %d files, want 3: %v", len(summaries), summaries)
+	}
+
+	messy := summaries[0]
+	if !strings.HasSuffix(messy.Filename, "messy.go") || len(messy.Errors) != 2 {
+		t.Fatalf("got %s with %v first, want messy.go with a count and a hunk", messy.Filename, messy.Errors)
+	}
+	if got := messy.Errors[0].ErrorString; got != "3 lines need formatting (+3 -2)" {
+		t.Errorf("got count %q", got)
+	}
+	if messy.Errors[1].LineNumber != 2 {
+		t.Errorf("hunk on line %d, want 2", messy.Errors[1].LineNumber)
+	}
+	if !strings.HasSuffix(summaries[2].Filename, "broken.go") || !strings.Contains(summaries[2].Errors[0].ErrorString, "could not parse") {
+		t.Errorf("got %v last, want broken.go with the parse error", summaries[2])
+	}
+
+	if note := (GoFmt{}).Note(summaries); note != "3 file(s) need formatting, 7 diff line(s)" {
+		t.Errorf("got note %q", note)
+	}
+
+	p, summaries, err = GoFmt{Dir: dir, Filenames: filenames, Grace: 3}.Percentage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 1 - 3.0/56; math.Abs(p-want) > 0.001 || len(summaries) != 3 {
+		t.Errorf("with a grace of 3 lines: got %v with %d files, want %v with all 3 listed", p, len(summaries), want)
+	}
+}
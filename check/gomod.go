@@ -0,0 +1,124 @@
+package check
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// GoMod is the check for go.mod presence and module hygiene
+type GoMod struct {
+	Dir       string
+	Filenames []string
+}
+
+// Name returns the name of the display name of the command
+func (g GoMod) Name() string {
+	return "go.mod"
+}
+
+// Weight returns the weight this check has in the overall average
+func (g GoMod) Weight() float64 {
+	return .05
+}
+
+// Percentage returns the share of module hygiene rules that go.mod passes:
+// a go directive, a go.sum entry for every requirement and no replace
+// directives pointing at local paths. Repositories without a go.mod are
+// skipped.
+func (g GoMod) Percentage() (float64, []FileSummary, error) {
+	path := filepath.Join(g.Dir, "go.mod")
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, []FileSummary{}, fmt.Errorf("%w: no go.mod found, this looks like a GOPATH-style repository", ErrSkipped)
+	}
+	if err != nil {
+		return 0, []FileSummary{}, err
+	}
+
+	f, err := modfile.Parse(path, content, nil)
+	if err != nil {
+		return 0, []FileSummary{}, fmt.Errorf("could not parse go.mod: %v", err)
+	}
+
+	sums, err := goSumEntries(filepath.Join(g.Dir, "go.sum"))
+	if err != nil {
+		return 0, []FileSummary{}, err
+	}
+
+	filename := strings.TrimPrefix(path, "_repos/src")
+	fs := FileSummary{Filename: displayFilename(filename), FileURL: fileURL(filename)}
+	rules := 1 + len(f.Require) + len(f.Replace)
+
+	if f.Go == nil {
+		fs.Errors = append(fs.Errors, Error{LineNumber: 1, ErrorString: "missing go directive"})
+	}
+
+	if sums == nil && len(f.Require) > 0 {
+		fs.Errors = append(fs.Errors, Error{LineNumber: 1, ErrorString: "go.sum is missing"})
+	} else {
+		for _, r := range f.Require {
+			if !sums[r.Mod.Path+" "+r.Mod.Version] {
+				fs.Errors = append(fs.Errors, Error{
+					LineNumber:  r.Syntax.Start.Line,
+					ErrorString: fmt.Sprintf("go.sum has no entry for %s %s", r.Mod.Path, r.Mod.Version),
+				})
+			}
+		}
+	}
+
+	for _, r := range f.Replace {
+		if modfile.IsDirectoryPath(r.New.Path) {
+			fs.Errors = append(fs.Errors, Error{
+				LineNumber:  r.Syntax.Start.Line,
+				ErrorString: fmt.Sprintf("replace directive with local path %s", r.New.Path),
+			})
+		}
+	}
+
+	if len(fs.Errors) == 0 {
+		return 1, []FileSummary{}, nil
+	}
+
+	p := 1 - float64(len(fs.Errors))/float64(rules)
+	if p < 0 {
+		p = 0
+	}
+
+	return p, []FileSummary{fs}, nil
+}
+
+// goSumEntries returns the set of "path version" pairs listed in a go.sum
+// file, counting entries for either the module or only its go.mod. A missing
+// go.sum yields nil.
+func goSumEntries(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		entries[fields[0]+" "+strings.TrimSuffix(fields[1], "/go.mod")] = true
+	}
+
+	return entries, scanner.Err()
+}
+
+// Description returns the description of GoMod
+func (g GoMod) Description() string {
+	return `Checks that your project is a Go module: <code>go.mod</code> has a go directive, <code>go.sum</code> lists every requirement, and no replace directive points at a local path.`
+}
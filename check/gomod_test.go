@@ -0,0 +1,54 @@
+package check
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoModPercentage(t *testing.T) {
+	cases := []struct {
+		gomod   string
+		gosum   string
+		want    float64
+		finding string
+	}{
+		{"module example.com/a\n\ngo 1.21\n", "", 1, ""},
+		{"module example.com/a\n\ngo 1.21\n\nrequire example.com/b v1.0.0\n", "example.com/b v1.0.0/go.mod h1:abc=\n", 1, ""},
+		{"module example.com/a\n\ngo 1.21\n\nrequire example.com/b v1.0.0\n", "", 0.5, "go.sum is missing"},
+		{"module example.com/a\n\ngo 1.21\n\nrequire example.com/b v1.0.0\n\nreplace example.com/b => ../b\n", "example.com/b v1.0.0 h1:abc=\n", 0.667, "replace directive with local path ../b"},
+	}
+
+	for _, tt := range cases {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(tt.gomod), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if tt.gosum != "" {
+			if err := os.WriteFile(filepath.Join(dir, "go.sum"), []byte(tt.gosum), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		p, summaries, err := GoMod{Dir: dir}.Percentage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(p-tt.want) > 0.001 {
+			t.Errorf("%q: percentage = %v, want %v", tt.gomod, p, tt.want)
+		}
+		if tt.finding != "" && (len(summaries) != 1 || !strings.Contains(summaries[0].Errors[0].ErrorString, tt.finding)) {
+			t.Errorf("%q: summaries = %+v, want finding %q", tt.gomod, summaries, tt.finding)
+		}
+	}
+}
+
+func TestGoModSkipped(t *testing.T) {
+	_, _, err := GoMod{Dir: "testdata/testfiles"}.Percentage()
+	if !errors.Is(err, ErrSkipped) {
+		t.Errorf("got err = %v, want ErrSkipped", err)
+	}
+}
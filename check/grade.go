@@ -1,5 +1,7 @@
 package check
 
+import "fmt"
+
 // Grade represents a grade returned by the server, which is normally
 // somewhere between A+ (highest) and F (lowest).
 type Grade string
@@ -16,22 +18,59 @@ const (
 	GradeF     = "F"
 )
 
-// GradeFromPercentage gets the Grade for a percentage
-func GradeFromPercentage(percentage float64) Grade {
-	switch {
-	case percentage > 90:
-		return GradeAPlus
-	case percentage > 80:
-		return GradeA
-	case percentage > 70:
-		return GradeB
-	case percentage > 60:
-		return GradeC
-	case percentage > 50:
-		return GradeD
-	case percentage > 40:
-		return GradeE
-	default:
-		return GradeF
+// Thresholds maps grades above F to the percentage a score must exceed to
+// earn them. Grades left out use their DefaultThresholds.
+type Thresholds map[Grade]float64
+
+// DefaultThresholds are the thresholds used unless others are configured
+var DefaultThresholds = Thresholds{
+	GradeAPlus: 90,
+	GradeA:     80,
+	GradeB:     70,
+	GradeC:     60,
+	GradeD:     50,
+	GradeE:     40,
+}
+
+// threshold returns the percentage a score must exceed to earn g
+func (t Thresholds) threshold(g Grade) float64 {
+	if p, ok := t[g]; ok {
+		return p
+	}
+	return DefaultThresholds[g]
+}
+
+// Grade gets the Grade for a percentage
+func (t Thresholds) Grade(percentage float64) Grade {
+	for _, g := range gradeOrder[:len(gradeOrder)-1] {
+		if percentage > t.threshold(g) {
+			return g
+		}
 	}
+	return GradeF
+}
+
+// Validate returns an error if a threshold is for an unknown grade or F, is
+// outside 0 to 100, or is not lower than the threshold of the grade above it
+func (t Thresholds) Validate() error {
+	for g, p := range t {
+		if _, err := ParseGrade(string(g)); err != nil || g == GradeF {
+			return fmt.Errorf("no threshold can be set for grade %q", g)
+		}
+		if p < 0 || p > 100 {
+			return fmt.Errorf("threshold of grade %s must be between 0 and 100, got %v", g, p)
+		}
+	}
+	for i := 1; i < len(gradeOrder)-1; i++ {
+		above, g := gradeOrder[i-1], gradeOrder[i]
+		if t.threshold(g) >= t.threshold(above) {
+			return fmt.Errorf("threshold of grade %s (%v) must be lower than that of %s (%v)", g, t.threshold(g), above, t.threshold(above))
+		}
+	}
+	return nil
+}
+
+// GradeFromPercentage gets the Grade for a percentage with the DefaultThresholds
+func GradeFromPercentage(percentage float64) Grade {
+	return DefaultThresholds.Grade(percentage)
 }
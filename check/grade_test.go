@@ -0,0 +1,46 @@
+package check
+
+import "testing"
+
+func TestThresholdsGrade(t *testing.T) {
+	strict := Thresholds{GradeAPlus: 95, GradeA: 90}
+	var tests = []struct {
+		thresholds Thresholds
+		percentage float64
+		want       Grade
+	}{
+		{nil, 91, GradeAPlus},
+		{nil, 90, GradeA},
+		{nil, 40, GradeF},
+		{strict, 93, GradeA},
+		{strict, 89, GradeB},
+		{strict, 96, GradeAPlus},
+		{strict, 75, GradeB},
+	}
+
+	for _, tt := range tests {
+		if got := tt.thresholds.Grade(tt.percentage); got != tt.want {
+			t.Errorf("%v.Grade(%v) = %s, want %s", tt.thresholds, tt.percentage, got, tt.want)
+		}
+	}
+}
+
+func TestThresholdsValidate(t *testing.T) {
+	var tests = []struct {
+		thresholds Thresholds
+		wantErr    bool
+	}{
+		{nil, false},
+		{Thresholds{GradeAPlus: 95, GradeA: 85}, false},
+		{Thresholds{GradeA: 95}, true},
+		{Thresholds{GradeF: 10}, true},
+		{Thresholds{"Z": 10}, true},
+		{Thresholds{GradeAPlus: 101}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.thresholds.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%v.Validate() = %v, wantErr %v", tt.thresholds, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package check
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFilename is the file in a repository's root listing files to exclude
+// from all checks, in gitignore syntax
+const IgnoreFilename = ".goreportcardignore"
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreList holds the patterns of a .goreportcardignore file
+type IgnoreList struct {
+	patterns []ignorePattern
+}
+
+// ParseIgnore parses gitignore-style patterns: blank lines and lines starting
+// with # are skipped, a leading ! re-includes files excluded by an earlier
+// pattern, a trailing / matches directories only, and a pattern containing a
+// / is relative to the repository root. * and ? do not match /, while **
+// matches any number of directories.
+func ParseIgnore(content string) (*IgnoreList, error) {
+	l := &IgnoreList{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var p ignorePattern
+		if strings.HasPrefix(text, "!") {
+			p.negate = true
+			text = text[1:]
+		} else if strings.HasPrefix(text, `\`) {
+			text = text[1:] // escaped leading ! or #
+		}
+		if strings.HasSuffix(text, "/") {
+			p.dirOnly = true
+			text = strings.TrimRight(text, "/")
+		}
+
+		anchored := strings.Contains(text, "/")
+		text = strings.TrimPrefix(text, "/")
+		if text == "" {
+			continue
+		}
+
+		expr := globToRegexp(text)
+		if anchored {
+			expr = "^" + expr + "$"
+		} else {
+			expr = "^(?:.*/)?" + expr + "$"
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %q: %v", IgnoreFilename, line, scanner.Text(), err)
+		}
+		p.re = re
+		l.patterns = append(l.patterns, p)
+	}
+
+	return l, scanner.Err()
+}
+
+// globToRegexp translates a gitignore glob to a regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// LoadIgnoreFile reads the .goreportcardignore file in dir.
+// A missing file is not an error and ignores nothing.
+func LoadIgnoreFile(dir string) (*IgnoreList, error) {
+	content, err := os.ReadFile(filepath.Join(dir, IgnoreFilename))
+	if os.IsNotExist(err) {
+		return &IgnoreList{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseIgnore(string(content))
+}
+
+// Match reports whether the file at path, relative to the repository root,
+// is ignored. The last matching pattern wins; a pattern matching one of the
+// file's parent directories matches the file.
+func (l *IgnoreList) Match(path string) bool {
+	path = filepath.ToSlash(path)
+	parts := strings.Split(path, "/")
+
+	ignored := false
+	for _, p := range l.patterns {
+		matched := !p.dirOnly && p.re.MatchString(path)
+		for i := 1; i < len(parts) && !matched; i++ {
+			matched = p.re.MatchString(strings.Join(parts[:i], "/"))
+		}
+		if matched {
+			ignored = !p.negate
+		}
+	}
+
+	return ignored
+}
+
+// applyIgnoreFile moves the files in filenames matched by dir's
+// .goreportcardignore file, or by one of the extra patterns, to skipped
+func applyIgnoreFile(dir string, filenames, skipped, extra []string) ([]string, []string, error) {
+	l, err := LoadIgnoreFile(dir)
+	if err != nil {
+		return filenames, skipped, err
+	}
+	if len(extra) > 0 {
+		e, err := ParseIgnore(strings.Join(extra, "\n"))
+		if err != nil {
+			return filenames, skipped, err
+		}
+		l.patterns = append(l.patterns, e.patterns...)
+	}
+	if len(l.patterns) == 0 {
+		return filenames, skipped, nil
+	}
+
+	kept := filenames[:0]
+	for _, fn := range filenames {
+		rel, err := filepath.Rel(dir, fn)
+		if err == nil && l.Match(rel) {
+			skipped = append(skipped, fn)
+			continue
+		}
+		kept = append(kept, fn)
+	}
+
+	return kept, skipped, nil
+}
@@ -0,0 +1,82 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnoreListMatch(t *testing.T) {
+	cases := []struct {
+		patterns string
+		path     string
+		want     bool
+	}{
+		{"*.go", "a.go", true},
+		{"*.go", "x/y/a.go", true},
+		{"/a.go", "a.go", true},
+		{"/a.go", "x/a.go", false},
+		{"x/a.go", "x/a.go", true},
+		{"x/a.go", "y/x/a.go", false},
+		{"gen/", "gen/a.go", true},
+		{"gen/", "x/gen/a.go", true},
+		{"gen/", "gen", false},
+		{"gen", "x/gen/a.go", true},
+		{"docs/**/*.go", "docs/a.go", true},
+		{"docs/**/*.go", "docs/x/y/a.go", true},
+		{"docs/**/*.go", "x/docs/a.go", false},
+		{"**/mock_*.go", "mock_a.go", true},
+		{"**/mock_*.go", "x/mock_a.go", true},
+		{"internal/**", "internal/x/a.go", true},
+		{"*_gen.go\n!keep_gen.go", "keep_gen.go", false},
+		{"*_gen.go\n!keep_gen.go", "x/other_gen.go", true},
+		{"!a.go\n*.go", "a.go", true},
+		{"# comment\n\n", "# comment", false},
+		{`\#a.go`, "#a.go", true},
+		{"a?c.go", "abc.go", true},
+		{"a?c.go", "a/c.go", false},
+		{"[ab].go", "b.go", true},
+		{"[!ab].go", "b.go", false},
+		{"*.go", "a.gox", false},
+		{"a*.go", "x/b.go", false},
+	}
+
+	for _, tt := range cases {
+		l, err := ParseIgnore(tt.patterns)
+		if err != nil {
+			t.Fatalf("ParseIgnore(%q): %v", tt.patterns, err)
+		}
+		if got := l.Match(tt.path); got != tt.want {
+			t.Errorf("patterns %q: Match(%q) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestApplyIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, IgnoreFilename), []byte("gen/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, g := filepath.Join(dir, "a.go"), filepath.Join(dir, "gen", "b.go")
+	filenames, skipped, err := applyIgnoreFile(dir, []string{a, g}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(filenames, []string{a}) || !reflect.DeepEqual(skipped, []string{g}) {
+		t.Errorf("got filenames %v, skipped %v; want [%s], [%s]", filenames, skipped, a, g)
+	}
+}
+
+func TestApplyIgnoreFileExtraPatterns(t *testing.T) {
+	dir := t.TempDir()
+	a, g, p := filepath.Join(dir, "a.go"), filepath.Join(dir, "gen", "b.go"), filepath.Join(dir, "api", "c.pb.go")
+	filenames, skipped, err := applyIgnoreFile(dir, []string{a, g, p}, nil, []string{"gen/", "*.pb.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(filenames, []string{a}) || !reflect.DeepEqual(skipped, []string{g, p}) {
+		t.Errorf("got filenames %v, skipped %v; want [%s], [%s %s]", filenames, skipped, a, g, p)
+	}
+}
@@ -1,9 +1,12 @@
 package check
 
+var ineffAssignCommand = []string{"gometalinter", "--deadline=180s", "--disable-all", "--enable=ineffassign"}
+
 // IneffAssign is the check for the ineffassign command
 type IneffAssign struct {
 	Dir       string
 	Filenames []string
+	Packages  []string // package directories to run on instead of all of Dir
 }
 
 // Name returns the name of the display name of the command
@@ -18,10 +21,21 @@ func (g IneffAssign) Weight() float64 {
 
 // Percentage returns the percentage of .go files that pass gofmt
 func (g IneffAssign) Percentage() (float64, []FileSummary, error) {
-	return GoTool(g.Dir, g.Filenames, []string{"gometalinter", "--deadline=180s", "--disable-all", "--enable=ineffassign"})
+	return goToolPackages(g.Dir, g.Packages, g.Filenames, ineffAssignCommand)
 }
 
 // Description returns the description of IneffAssign
 func (g IneffAssign) Description() string {
 	return `<a href="https://github.com/gordonklaus/ineffassign">IneffAssign</a> detects ineffectual assignments in Go code.`
 }
+
+// Version identifies the tool configuration, for caching results
+func (g IneffAssign) Version() string {
+	return toolVersion(ineffAssignCommand)
+}
+
+// ForPackages returns the check limited to the given package directories and their files
+func (g IneffAssign) ForPackages(pkgs, filenames []string) Check {
+	g.Packages, g.Filenames = pkgs, filenames
+	return g
+}
@@ -1,9 +1,12 @@
 package check
 
+var misspellCommand = []string{"gometalinter", "--deadline=180s", "--disable-all", "--enable=misspell"}
+
 // Misspell is the check for the misspell command
 type Misspell struct {
 	Dir       string
 	Filenames []string
+	Packages  []string // package directories to run on instead of all of Dir
 }
 
 // Name returns the name of the display name of the command
@@ -18,10 +21,21 @@ func (g Misspell) Weight() float64 {
 
 // Percentage returns the percentage of .go files that pass gofmt
 func (g Misspell) Percentage() (float64, []FileSummary, error) {
-	return GoTool(g.Dir, g.Filenames, []string{"gometalinter", "--deadline=180s", "--disable-all", "--enable=misspell"})
+	return goToolPackages(g.Dir, g.Packages, g.Filenames, misspellCommand)
 }
 
 // Description returns the description of Misspell
 func (g Misspell) Description() string {
 	return `<a href="https://github.com/client9/misspell">Misspell</a> Finds commonly misspelled English words`
 }
+
+// Version identifies the tool configuration, for caching results
+func (g Misspell) Version() string {
+	return toolVersion(misspellCommand)
+}
+
+// ForPackages returns the check limited to the given package directories and their files
+func (g Misspell) ForPackages(pkgs, filenames []string) Check {
+	g.Packages, g.Filenames = pkgs, filenames
+	return g
+}
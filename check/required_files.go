@@ -0,0 +1,80 @@
+package check
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// RequiredFiles is the check for the existence of files an organization
+// requires in every repository, such as a README or CODEOWNERS
+type RequiredFiles struct {
+	Dir string
+	// Patterns are filepath.Match globs relative to the repository root; a
+	// pattern may list alternatives separated by |, any of which satisfies it
+	Patterns []string
+}
+
+// ParseRequiredFiles parses a comma-separated list of required file patterns
+func ParseRequiredFiles(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// Name returns the name of the display name of the command
+func (g RequiredFiles) Name() string {
+	return "required_files"
+}
+
+// Weight returns the weight this check has in the overall average
+func (g RequiredFiles) Weight() float64 {
+	return .05
+}
+
+// exists reports whether any alternative of the pattern matches a file
+func (g RequiredFiles) exists(pattern string) (bool, error) {
+	for _, alt := range strings.Split(pattern, "|") {
+		matches, err := filepath.Glob(filepath.Join(g.Dir, strings.TrimSpace(alt)))
+		if err != nil {
+			return false, fmt.Errorf("invalid required file pattern %q: %v", alt, err)
+		}
+		if len(matches) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Percentage returns the share of required files that exist, listing the
+// missing ones. Without any required files the check is skipped.
+func (g RequiredFiles) Percentage() (float64, []FileSummary, error) {
+	if len(g.Patterns) == 0 {
+		return 0, []FileSummary{}, fmt.Errorf("%w: no required files configured", ErrSkipped)
+	}
+
+	fs := FileSummary{}
+	for _, p := range g.Patterns {
+		ok, err := g.exists(p)
+		if err != nil {
+			return 0, []FileSummary{}, err
+		}
+		if !ok {
+			fs.Errors = append(fs.Errors, Error{ErrorString: fmt.Sprintf("required file %s is missing", p)})
+		}
+	}
+
+	if len(fs.Errors) == 0 {
+		return 1, []FileSummary{}, nil
+	}
+	return 1 - float64(len(fs.Errors))/float64(len(g.Patterns)), []FileSummary{fs}, nil
+}
+
+// Description returns the description of RequiredFiles
+func (g RequiredFiles) Description() string {
+	return "Checks whether your project has the files your organization requires, such as a README, a LICENSE or CODEOWNERS."
+}
@@ -0,0 +1,66 @@
+package check
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseRequiredFiles(t *testing.T) {
+	got := ParseRequiredFiles(" README*, LICENSE ,,CODEOWNERS|.github/CODEOWNERS")
+	want := []string{"README*", "LICENSE", "CODEOWNERS|.github/CODEOWNERS"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := ParseRequiredFiles(""); got != nil {
+		t.Errorf("got %q for an empty list, want none", got)
+	}
+}
+
+func TestRequiredFilesPercentage(t *testing.T) {
+	dir := t.TempDir()
+	for _, fn := range []string{"README.md", "LICENSE", ".github/CODEOWNERS"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, fn)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fn), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		patterns []string
+		want     float64
+		missing  []string
+	}{
+		{[]string{"README*", "LICENSE"}, 1, nil},
+		{[]string{"README*", "LICENSE", "CODEOWNERS|.github/CODEOWNERS", "Makefile"}, 0.75, []string{"required file Makefile is missing"}},
+		{[]string{"CONTRIBUTING*", "Makefile"}, 0, []string{"required file CONTRIBUTING* is missing", "required file Makefile is missing"}},
+	}
+
+	for _, tt := range cases {
+		p, summaries, err := RequiredFiles{Dir: dir, Patterns: tt.patterns}.Percentage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(p-tt.want) > 0.001 {
+			t.Errorf("%q: got percentage %v, want %v", tt.patterns, p, tt.want)
+		}
+		var missing []string
+		for _, s := range summaries {
+			for _, e := range s.Errors {
+				missing = append(missing, e.ErrorString)
+			}
+		}
+		if !reflect.DeepEqual(missing, tt.missing) {
+			t.Errorf("%q: got missing %q, want %q", tt.patterns, missing, tt.missing)
+		}
+	}
+
+	if _, _, err := (RequiredFiles{Dir: dir}).Percentage(); !errors.Is(err, ErrSkipped) {
+		t.Errorf("got err %v without patterns, want %v", err, ErrSkipped)
+	}
+}
@@ -0,0 +1,81 @@
+package check
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReviveConfigFilename is the revive configuration read from the root of a
+// repository, so that teams can enable, disable and tune the style rules
+// their code is graded on
+const ReviveConfigFilename = "revive.toml"
+
+var reviveCommand = []string{"revive", "-formatter", "default"}
+
+// Revive is the check for the revive command, which replaces golint
+type Revive struct {
+	Dir       string
+	Filenames []string
+	Packages  []string // package directories to run on instead of all of Dir
+	// Config is the revive configuration used when the repository has no
+	// revive.toml of its own; revive's defaults, which match golint, are
+	// used when both are empty
+	Config string
+}
+
+// Name returns the name of the display name of the command
+func (g Revive) Name() string {
+	return "revive"
+}
+
+// Weight returns the weight this check has in the overall average
+func (g Revive) Weight() float64 {
+	return .10
+}
+
+// config returns the revive configuration file to use, if any
+func (g Revive) config() string {
+	fn := filepath.Join(g.Dir, ReviveConfigFilename)
+	if _, err := os.Stat(fn); err == nil {
+		return fn
+	}
+	return g.Config
+}
+
+// command returns the revive command line, without the directories to check
+func (g Revive) command() []string {
+	command := append([]string{}, reviveCommand...)
+	if cfg := g.config(); cfg != "" {
+		command = append(command, "-config", cfg)
+	}
+	return command
+}
+
+// Percentage returns the percentage of .go files that pass revive
+func (g Revive) Percentage() (float64, []FileSummary, error) {
+	return goToolPackages(g.Dir, g.Packages, g.Filenames, g.command())
+}
+
+// Description returns the description of Revive
+func (g Revive) Description() string {
+	return `<a href="https://revive.run">Revive</a> is a configurable linter for Go source code, replacing golint. Rules can be tuned with a revive.toml file in the root of the repository.`
+}
+
+// Version identifies the tool configuration, for caching results
+func (g Revive) Version() string {
+	v := toolVersion(reviveCommand)
+	if cfg := g.config(); cfg != "" {
+		// the results change with the rules, not with where they are kept
+		b, _ := os.ReadFile(cfg)
+		v += fmt.Sprintf(" config %x", sha256.Sum256(b))
+	}
+	return v
+}
+
+// ForPackages returns the check limited to the given package directories and their files
+func (g Revive) ForPackages(pkgs, filenames []string) Check {
+	g.Packages, g.Filenames = pkgs, filenames
+	return g
+}
@@ -0,0 +1,61 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReviveCommand(t *testing.T) {
+	withConfig := t.TempDir()
+	repoConfig := filepath.Join(withConfig, ReviveConfigFilename)
+	if err := os.WriteFile(repoConfig, []byte("[rule.exported]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	without := t.TempDir()
+
+	cases := []struct {
+		check Revive
+		want  []string
+	}{
+		{Revive{Dir: without}, []string{"revive", "-formatter", "default"}},
+		{Revive{Dir: without, Config: "/etc/revive.toml"}, []string{"revive", "-formatter", "default", "-config", "/etc/revive.toml"}},
+		{Revive{Dir: withConfig, Config: "/etc/revive.toml"}, []string{"revive", "-formatter", "default", "-config", repoConfig}},
+	}
+
+	for _, tt := range cases {
+		if got := tt.check.command(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("command() in %s = %q, want %q", tt.check.Dir, got, tt.want)
+		}
+	}
+}
+
+func TestReviveVersion(t *testing.T) {
+	dir := t.TempDir()
+	g := Revive{Dir: dir}
+	defaults := g.Version()
+
+	fn := filepath.Join(dir, ReviveConfigFilename)
+	if err := os.WriteFile(fn, []byte("[rule.exported]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exported := g.Version()
+	if err := os.WriteFile(fn, []byte("[rule.var-naming]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	naming := g.Version()
+
+	if defaults == exported || exported == naming {
+		t.Errorf("got versions %q, %q and %q, want a different version for each config", defaults, exported, naming)
+	}
+}
+
+func TestStyleCheck(t *testing.T) {
+	if got := styleCheck("d", nil, Options{}).Name(); got != "revive" {
+		t.Errorf("got style check %q, want %q", got, "revive")
+	}
+	if got := styleCheck("d", nil, Options{Golint: true}).Name(); got != "golint" {
+		t.Errorf("got style check %q with Golint, want %q", got, "golint")
+	}
+}
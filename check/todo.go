@@ -0,0 +1,154 @@
+package check
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultTodoThreshold is the number of TODO comments per thousand lines a
+// file may have before the todo check counts it against the grade
+const DefaultTodoThreshold = 10
+
+// todoMarker matches the markers of comments about unfinished work
+var todoMarker = regexp.MustCompile(`\b(TODO|FIXME|XXX|HACK)\b`)
+
+// TodoOptions configures the todo check
+type TodoOptions struct {
+	// Weight is the weight of the check in the overall average. At 0, the
+	// default, the comments are listed without affecting the grade.
+	Weight float64
+	// Threshold is the number of TODO comments per thousand lines a file may
+	// have, DefaultTodoThreshold when 0
+	Threshold float64
+}
+
+// Todos is the check for the density of TODO, FIXME, XXX and HACK comments,
+// a signal of unfinished or fragile code
+type Todos struct {
+	Dir       string
+	Filenames []string
+	Options   TodoOptions
+}
+
+// Name returns the name of the display name of the command
+func (g Todos) Name() string {
+	return "todo"
+}
+
+// Weight returns the weight this check has in the overall average
+func (g Todos) Weight() float64 {
+	return g.Options.Weight
+}
+
+func (g Todos) threshold() float64 {
+	if g.Options.Threshold > 0 {
+		return g.Options.Threshold
+	}
+	return DefaultTodoThreshold
+}
+
+// todoFile is the TODO comments of a file and its density
+type todoFile struct {
+	summary FileSummary
+	perKLOC float64
+}
+
+// todos returns the TODO comments of a Go file, found by scanning its
+// comments so that markers in strings are not counted, and its number of
+// non-blank lines
+func todos(filename string) ([]Error, int, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	lines := 0
+	for _, l := range strings.Split(string(src), "\n") {
+		if strings.TrimSpace(l) != "" {
+			lines++
+		}
+	}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile(filename, -1, len(src))
+	var s scanner.Scanner
+	// syntax errors are reported by other checks; scanning goes on past them
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	var errs []Error
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.COMMENT {
+			continue
+		}
+		start := fset.Position(pos).Line
+		for i, l := range strings.Split(lit, "\n") {
+			if m := todoMarker.FindString(l); m != "" {
+				errs = append(errs, Error{LineNumber: start + i, ErrorString: fmt.Sprintf("%s comment: %s", m, commentText(l))})
+			}
+		}
+	}
+	return errs, lines, nil
+}
+
+// commentText returns a comment line without its markers, shortened for display
+func commentText(l string) string {
+	l = strings.TrimSpace(l)
+	l = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(l, "//"), "/*"), "*/"))
+	if len(l) > 80 {
+		l = l[:77] + "..."
+	}
+	return l
+}
+
+// Percentage returns the share of files with at most the threshold of TODO
+// comments per thousand lines, listing the files over it, worst first, with
+// their counts
+func (g Todos) Percentage() (float64, []FileSummary, error) {
+	if len(g.Filenames) == 0 {
+		return 1, []FileSummary{}, nil
+	}
+
+	var over []todoFile
+	for _, fn := range g.Filenames {
+		errs, lines, err := todos(fn)
+		if err != nil {
+			return 0, []FileSummary{}, err
+		}
+		if len(errs) == 0 || lines == 0 {
+			continue
+		}
+
+		perKLOC := float64(len(errs)) * 1000 / float64(lines)
+		if perKLOC <= g.threshold() {
+			continue
+		}
+		filename := strings.TrimPrefix(fn, "_repos/src")
+		summary := FileSummary{Filename: displayFilename(filename), FileURL: fileURL(filename)}
+		summary.Errors = append([]Error{{
+			ErrorString: fmt.Sprintf("%d TODO comments in %d lines, %.1f per 1000 lines (threshold %g)", len(errs), lines, perKLOC, g.threshold()),
+		}}, errs...)
+		over = append(over, todoFile{summary: summary, perKLOC: perKLOC})
+	}
+
+	sort.SliceStable(over, func(i, j int) bool { return over[i].perKLOC > over[j].perKLOC })
+	summaries := make([]FileSummary, 0, len(over))
+	for _, f := range over {
+		summaries = append(summaries, f.summary)
+	}
+
+	return 1 - float64(len(over))/float64(len(g.Filenames)), summaries, nil
+}
+
+// Description returns the description of Todos
+func (g Todos) Description() string {
+	return `Counts TODO, FIXME, XXX and HACK comments. Files with more than the allowed number per thousand lines are listed, those with the most first.`
+}
@@ -0,0 +1,54 @@
+package check
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTodosPercentage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"busy.go":  "package a\n\n// TODO: split this up\nfunc A() {}\n\n/* FIXME handle errors\n   XXX and retries */\nfunc B() {}\n",
+		"quiet.go": "package a\n\n// Todo lists are fine, as are todos\nfunc C() string {\n\treturn \"TODO in a string\"\n}\n",
+		"ok.go":    "package a\n\n// HACK: one marker\n" + strings.Repeat("var _ = 1\n", 200),
+	}
+	var filenames []string
+	for name, content := range files {
+		fn := filepath.Join(dir, name)
+		if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, fn)
+	}
+
+	p, summaries, err := Todos{Dir: dir, Filenames: filenames, Options: TodoOptions{Threshold: 10}}.Percentage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2.0 / 3; math.Abs(p-want) > 0.001 {
+		t.Errorf("got percentage %v, want %v", p, want)
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("got %d files over the threshold, want 1: %v", len(summaries), summaries)
+	}
+
+	errs := summaries[0].Errors
+	if !strings.HasSuffix(summaries[0].Filename, "busy.go") || len(errs) != 4 {
+		t.Fatalf("got %s with %d entries, want busy.go with a count and 3 comments", summaries[0].Filename, len(errs))
+	}
+	if !strings.HasPrefix(errs[0].ErrorString, "3 TODO comments in 6 lines") {
+		t.Errorf("got count %q", errs[0].ErrorString)
+	}
+	for i, want := range []int{3, 6, 7} {
+		if errs[i+1].LineNumber != want {
+			t.Errorf("comment %d on line %d, want %d", i, errs[i+1].LineNumber, want)
+		}
+	}
+
+	if w := (Todos{}).Weight(); w != 0 {
+		t.Errorf("default weight %v, want 0", w)
+	}
+}
@@ -335,6 +335,12 @@ outer:
 // GoTool runs a given go command (for example gofmt, go tool vet)
 // on a directory
 func GoTool(dir string, filenames, command []string) (float64, []FileSummary, error) {
+	return goToolPackages(dir, nil, filenames, command)
+}
+
+// goToolPackages runs a go command like GoTool, but only on the given package
+// directories within dir when pkgs is not empty
+func goToolPackages(dir string, pkgs, filenames, command []string) (float64, []FileSummary, error) {
 	var enabledCheck = command[0]
 	if command[0] == "gometalinter" {
 		enabledCheck = command[len(command)-1]
@@ -359,10 +365,12 @@ func GoTool(dir string, filenames, command []string) (float64, []FileSummary, er
 	}
 
 	switch {
-	case strings.Contains(enabledCheck, "cyclo"):
-		params = append(params, dir)
 	case strings.Contains(enabledCheck, "staticcheck"):
 		params[len(params)-1] = "./..."
+	case len(pkgs) > 0:
+		params = append(params, pkgs...)
+	case strings.Contains(enabledCheck, "cyclo"):
+		params = append(params, dir)
 	default:
 		params = append(params, dir+"/...")
 	}
@@ -16,6 +16,27 @@ var (
 	verbose = flag.Bool("v", false, "Verbose output")
 	th      = flag.Float64("t", 0, "Threshold of failure command")
 	jsn     = flag.Bool("j", false, "JSON output. The binary will always exit with code 0")
+
+	maxComplexity      = flag.Int("max-complexity", 0, "Cap the grade if a function's cyclomatic complexity is over this (0 disables the gate)")
+	maxComplexityGrade = flag.String("max-complexity-grade", check.GradeC, "Highest grade when the complexity gate trips")
+
+	minFiles      = flag.Int("min-files", check.DefaultMinFiles, "Cap the grade of repositories with fewer Go files than this (0 disables the gate)")
+	minFilesGrade = flag.String("min-files-grade", check.GradeB, "Highest grade when the file count gate trips")
+
+	reviveConfig = flag.String("revive-config", "", "revive configuration to use when the repository has no "+check.ReviveConfigFilename)
+	golint       = flag.Bool("golint", false, "Grade style with the deprecated golint instead of revive")
+
+	requiredFiles = flag.String("required-files", "", "Comma-separated globs of files every repository must have, such as README*,LICENSE*")
+
+	todoWeight    = flag.Float64("todo-weight", 0, "Weight of the TODO comment check in the grade (0 lists TODO comments without grading them)")
+	todoThreshold = flag.Float64("todo-threshold", check.DefaultTodoThreshold, "TODO comments per 1000 lines a file may have")
+
+	gofmtGrace = flag.Int("gofmt-grace", 0, "Lines a file may need to change for gofmt before they count against the grade")
+
+	coverage        = flag.Bool("coverage", false, "Run the tests and grade the share of statements they cover")
+	coverageMin     = flag.Float64("coverage-min", check.DefaultCoverageMin, "Percentage of statements each package's tests must cover")
+	coverageProfile = flag.String("coverage-profile", "", "Coverage profile to read instead of running the tests, implies -coverage")
+	coverageTimeout = flag.Duration("coverage-timeout", check.DefaultCoverageTimeout, "How long the tests may run for the coverage check")
 )
 
 // dotPrintf fills in the blank space between two strings with dots. The total
@@ -34,7 +55,30 @@ func dotPrintf(fullLen int, lfStr, rtFmtStr string, args ...interface{}) {
 func main() {
 	flag.Parse()
 
-	result, err := check.Run(*dir, true)
+	grade, err := check.ParseGrade(*maxComplexityGrade)
+	if err != nil {
+		log.Fatalf("Invalid -max-complexity-grade: %s", err.Error())
+	}
+	filesGrade, err := check.ParseGrade(*minFilesGrade)
+	if err != nil {
+		log.Fatalf("Invalid -min-files-grade: %s", err.Error())
+	}
+
+	result, err := check.RunWithOptions(*dir, true, check.Options{
+		Complexity:    check.ComplexityGate{Max: *maxComplexity, MaxGrade: grade},
+		MinFiles:      check.FileCountGate{Min: *minFiles, MaxGrade: filesGrade},
+		ReviveConfig:  *reviveConfig,
+		Golint:        *golint,
+		RequiredFiles: check.ParseRequiredFiles(*requiredFiles),
+		Todos:         check.TodoOptions{Weight: *todoWeight, Threshold: *todoThreshold},
+		GofmtGrace:    *gofmtGrace,
+		Coverage: check.CoverageOptions{
+			Enabled: *coverage || *coverageProfile != "",
+			Min:     *coverageMin,
+			Profile: *coverageProfile,
+			Timeout: *coverageTimeout,
+		},
+	})
 	if err != nil {
 		log.Fatalf("Fatal error checking %s: %s", *dir, err.Error())
 	}
@@ -48,8 +92,15 @@ func main() {
 	dotPrintf(24, "Grade", "%s %.1f%%", result.Grade, result.Average*100)
 	dotPrintf(24, "Files", "%d", result.Files)
 	dotPrintf(24, "Issues", "%d", result.Issues)
+	for _, g := range result.Gates {
+		fmt.Printf("Grade capped at %s by the %s gate: %s\n", g.MaxGrade, g.Check, g.Reason)
+	}
 
 	for _, c := range result.Checks {
+		if c.Skipped {
+			dotPrintf(24, c.Name, "skipped (%s)", c.Note)
+			continue
+		}
 		dotPrintf(24, c.Name, "%d%%", int64(c.Percentage*100))
 		if *verbose && len(c.FileSummaries) > 0 {
 			for _, f := range c.FileSummaries {
@@ -61,7 +112,7 @@ func main() {
 		}
 	}
 
-	if result.Average*100 < *th {
+	if result.Average*100 < *th || len(result.Gates) > 0 {
 		os.Exit(1)
 	}
 }
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 )
 
@@ -9,14 +8,14 @@ import (
 func (gh *GRCHandler) AboutHandler(w http.ResponseWriter, r *http.Request) {
 	t, err := gh.loadTemplate("templates/about.html")
 	if err != nil {
-		log.Println("ERROR: could not get about template: ", err)
-		http.Error(w, err.Error(), 500)
+		requestLog(r).Println("ERROR: could not get about template: ", err)
+		gh.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	if err := t.ExecuteTemplate(w, "base", map[string]interface{}{
 		"google_analytics_key": googleAnalyticsKey,
 	}); err != nil {
-		log.Println("ERROR:", err)
+		requestLog(r).Println("ERROR:", err)
 	}
 }
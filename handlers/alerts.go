@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// AlertedPrefix is the badger prefix marking the transactions already
+	// sent to the alert webhook, keyed by account and transaction ID
+	AlertedPrefix string = "bookkeeping-alerted-"
+)
+
+// alertWebhook posts newly ingested transactions over an amount to a URL
+type alertWebhook struct {
+	URL       string
+	MinAmount vault.Money   // smallest absolute amount alerted about
+	Retries   int           // retries after a failed delivery
+	Delay     time.Duration // delay before the first retry, doubling after every retry
+	client    *http.Client
+}
+
+// alertWebhookFromEnv returns the webhook configured with ALERT_WEBHOOK_URL,
+// ALERT_MIN_AMOUNT, ALERT_RETRIES (default 3) and ALERT_RETRY_DELAY (default
+// 1s), and false if alerts are disabled because URL or amount are missing
+func alertWebhookFromEnv() (alertWebhook, bool) {
+	url := getEnvOrDefault("ALERT_WEBHOOK_URL", "")
+	if url == "" {
+		return alertWebhook{}, false
+	}
+	min, _, err := vault.ParseAmount(getEnvOrDefault("ALERT_MIN_AMOUNT", ""), amountLocale())
+	if err != nil || min < 0 {
+		log.Printf("Invalid ALERT_MIN_AMOUNT, transaction alerts are disabled: %v", err)
+		return alertWebhook{}, false
+	}
+
+	w := alertWebhook{URL: url, MinAmount: min, Retries: 3, Delay: time.Second, client: &http.Client{Timeout: 10 * time.Second}}
+	if n, err := strconv.Atoi(getEnvOrDefault("ALERT_RETRIES", "3")); err == nil && n >= 0 {
+		w.Retries = n
+	} else {
+		log.Printf("Invalid ALERT_RETRIES, using %d", w.Retries)
+	}
+	if d, err := time.ParseDuration(getEnvOrDefault("ALERT_RETRY_DELAY", "1s")); err == nil && d >= 0 {
+		w.Delay = d
+	} else {
+		log.Printf("Invalid ALERT_RETRY_DELAY, using %s", w.Delay)
+	}
+	return w, true
+}
+
+// transactionAlert is the JSON body posted to the webhook
+type transactionAlert struct {
+	Account     string            `json:"account"`
+	MinAmount   vault.Money       `json:"min_amount"`
+	Transaction vault.Transaction `json:"transaction"`
+}
+
+// alertKey identifies a transaction in the alerted marks. Transactions
+// without an ID are identified by their date, amount and description.
+func alertKey(acct account, txn vault.Transaction) string {
+	id := txn.TransactionID
+	if id == "" {
+		id = fmt.Sprintf("%s|%s|%s", txn.Date, txn.Amount, txn.Description)
+	}
+	return AlertedPrefix + acct.Name + "-" + id
+}
+
+// send posts the alert, retrying with backoff after network errors and
+// server errors
+func (w alertWebhook) send(ctx context.Context, alert transactionAlert) error {
+	body, err := json.Marshal(roundAmounts(alert, moneyDecimals))
+	if err != nil {
+		return err
+	}
+
+	delay := w.Delay
+	for attempt := 0; ; attempt++ {
+		err = w.post(ctx, body)
+		if err == nil || attempt >= w.Retries || !isRetryable(err) {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// webhookError is a delivery refused by the webhook with status Status
+type webhookError struct {
+	Status int
+}
+
+func (e webhookError) Error() string {
+	return fmt.Sprintf("webhook responded with status %d", e.Status)
+}
+
+// isRetryable reports whether a failed delivery may succeed when retried:
+// anything but a client error other than 429 Too Many Requests
+func isRetryable(err error) bool {
+	if e, ok := err.(webhookError); ok {
+		return e.Status >= 500 || e.Status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+func (w alertWebhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return webhookError{Status: resp.StatusCode}
+	}
+	return nil
+}
+
+// alertJob delivers one alert and marks it as delivered
+type alertJob struct {
+	db    *badger.DB
+	w     alertWebhook
+	key   string // alert mark of the transaction
+	alert transactionAlert
+}
+
+// alertQueue delivers alerts in the background, at most workers at once, so
+// that processing does not wait on the webhook. An alert that is already
+// queued or being delivered is not queued again.
+type alertQueue struct {
+	workers int
+
+	mu      sync.Mutex
+	running int
+	pending map[string]bool // marks of the queued and running jobs
+	queued  []alertJob
+	wg      sync.WaitGroup // done when every queued job has run
+}
+
+func newAlertQueue(workers int) *alertQueue {
+	return &alertQueue{workers: workers, pending: make(map[string]bool)}
+}
+
+// alertJobs is the queue of all webhook deliveries, sized with ALERT_WORKERS
+// (default 4)
+var alertJobs = newAlertQueue(positiveIntFromEnv("ALERT_WORKERS", 4))
+
+// submit queues job, and returns false if its alert is already pending
+func (q *alertQueue) submit(job alertJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending[job.key] {
+		return false
+	}
+	q.pending[job.key] = true
+	q.wg.Add(1)
+	if q.running < q.workers {
+		q.running++
+		go q.work(job)
+	} else {
+		q.queued = append(q.queued, job)
+	}
+	return true
+}
+
+// work delivers job, then the queued jobs in turn until there are none left
+func (q *alertQueue) work(job alertJob) {
+	for {
+		job.deliver()
+
+		q.mu.Lock()
+		delete(q.pending, job.key)
+		q.wg.Done()
+		if len(q.queued) == 0 {
+			q.running--
+			q.mu.Unlock()
+			return
+		}
+		job, q.queued = q.queued[0], q.queued[1:]
+		q.mu.Unlock()
+	}
+}
+
+// wait blocks until every queued alert has been delivered or has failed
+func (q *alertQueue) wait() {
+	q.wg.Wait()
+}
+
+// deliver sends the alert, unrelated to the request that queued it, and
+// marks it as delivered. Failed alerts are left unmarked, so that the next
+// processing run queues them again.
+func (job alertJob) deliver() {
+	if err := job.w.send(context.Background(), job.alert); err != nil {
+		log.Printf("ERROR: could not send alert for transaction %s: %v", job.alert.Transaction.TransactionID, err)
+		return
+	}
+	err := job.db.Update(func(txn *badger.Txn) error {
+		return setJSON(txn, job.key, true)
+	})
+	if err != nil {
+		log.Println("ERROR: could not save alert mark:", err)
+	}
+}
+
+// queueAlerts queues alerts for the account's transactions whose absolute
+// amount is at least the webhook's minimum, skipping those in previous, the
+// transactions stored by the last processing run, and those already alerted
+// about. Delivered alerts are marked, so reprocessing the vault does not
+// send them again. It returns the number of alerts queued.
+func queueAlerts(db *badger.DB, w alertWebhook, acct account, previous, transactions []vault.Transaction) int {
+	seen := make(map[string]bool, len(previous))
+	for _, txn := range previous {
+		seen[alertKey(acct, txn)] = true
+	}
+
+	queued := 0
+	for _, txn := range transactions {
+		key := alertKey(acct, txn)
+		if seen[key] || txn.Amount.Abs() < w.MinAmount {
+			continue
+		}
+		seen[key] = true
+
+		var alerted bool
+		if found, err := getJSON(db, key, &alerted); err != nil || found {
+			if err != nil {
+				log.Println("ERROR: could not read alert mark:", err)
+			}
+			continue
+		}
+
+		job := alertJob{db: db, w: w, key: key, alert: transactionAlert{Account: acct.Name, MinAmount: w.MinAmount, Transaction: txn}}
+		if alertJobs.submit(job) {
+			queued++
+		}
+	}
+	return queued
+}
+
+// seedAlerts marks the account's transactions over the webhook's minimum as
+// alerted without sending them, so that the first processing run of a vault
+// does not post its whole history and later runs only alert about new ones
+func seedAlerts(db *badger.DB, w alertWebhook, acct account, transactions []vault.Transaction) error {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, txn := range transactions {
+		if txn.Amount.Abs() < w.MinAmount {
+			continue
+		}
+		if err := wb.Set([]byte(alertKey(acct, txn)), []byte("true")); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// Methods of anomaly detection
+const (
+	anomalyStddev = "stddev" // distance from the mean in standard deviations
+	anomalyMAD    = "mad"    // distance from the median in median absolute deviations, robust to skew
+)
+
+// minAnomalySample is the number of transactions a category needs before its
+// outliers are flagged; with fewer, every amount is far from the others
+const minAnomalySample = 3
+
+// madScale makes the median absolute deviation comparable to the standard
+// deviation of normally distributed amounts
+const madScale = 0.6745
+
+// anomalyOptions configures the detection of outlying amounts
+type anomalyOptions struct {
+	Method string
+	K      float64 // smallest absolute z-score flagged
+}
+
+// categoryStats is how a category's amounts are spread
+type categoryStats struct {
+	Category vault.TransactionType `json:"category"`
+	Count    int                   `json:"count"`
+	Center   vault.Money           `json:"center"` // mean, or median for mad
+	Spread   vault.Money           `json:"spread"` // standard deviation, or scaled median absolute deviation for mad
+}
+
+// anomaly is a transaction whose amount is far from the others of its category
+type anomaly struct {
+	Transaction vault.Transaction `json:"transaction"`
+	ZScore      float64           `json:"z_score"`
+}
+
+type anomaliesResponse struct {
+	Method     string          `json:"method"`
+	K          float64         `json:"k"`
+	Categories []categoryStats `json:"categories"`
+	Anomalies  []anomaly       `json:"anomalies"`
+}
+
+// anomalyOptionsFromRequest reads the k and method parameters, defaulting to
+// ANOMALY_K (3) and ANOMALY_METHOD (stddev)
+func anomalyOptionsFromRequest(r *http.Request) (anomalyOptions, error) {
+	k := r.URL.Query().Get("k")
+	if k == "" {
+		k = getEnvOrDefault("ANOMALY_K", "3")
+	}
+	f, err := parseDecimal(k)
+	if err != nil || f <= 0 {
+		return anomalyOptions{}, fmt.Errorf("invalid k %q, expected a positive number", k)
+	}
+
+	method := r.URL.Query().Get("method")
+	if method == "" {
+		method = getEnvOrDefault("ANOMALY_METHOD", anomalyStddev)
+	}
+	if method != anomalyStddev && method != anomalyMAD {
+		return anomalyOptions{}, fmt.Errorf("unknown method %q, expected %s or %s", method, anomalyStddev, anomalyMAD)
+	}
+	return anomalyOptions{Method: method, K: f}, nil
+}
+
+// median returns the median of sorted values
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// centerAndSpread returns the center and spread of amounts by the given method
+func centerAndSpread(amounts []float64, method string) (center, spread float64) {
+	if method == anomalyMAD {
+		sorted := append([]float64(nil), amounts...)
+		sort.Float64s(sorted)
+		center = median(sorted)
+		deviations := make([]float64, len(sorted))
+		for i, a := range sorted {
+			deviations[i] = math.Abs(a - center)
+		}
+		sort.Float64s(deviations)
+		return center, median(deviations) / madScale
+	}
+
+	for _, a := range amounts {
+		center += a
+	}
+	center /= float64(len(amounts))
+	var variance float64
+	for _, a := range amounts {
+		variance += (a - center) * (a - center)
+	}
+	return center, math.Sqrt(variance / float64(len(amounts)))
+}
+
+// detectAnomalies flags the transactions whose amount is at least k spreads
+// away from the center of their category, the largest z-scores first.
+// Categories with fewer than minAnomalySample transactions, or whose amounts
+// do not vary, are not checked.
+func detectAnomalies(categorized map[vault.TransactionType][]vault.Transaction, opts anomalyOptions) anomaliesResponse {
+	resp := anomaliesResponse{Method: opts.Method, K: opts.K, Categories: []categoryStats{}, Anomalies: []anomaly{}}
+	for _, t := range vault.TransactionTypes {
+		transactions := categorized[t]
+		if len(transactions) < minAnomalySample {
+			continue
+		}
+		amounts := make([]float64, len(transactions))
+		for i, txn := range transactions {
+			amounts[i] = txn.Amount.Float()
+		}
+
+		center, s := centerAndSpread(amounts, opts.Method)
+		resp.Categories = append(resp.Categories, categoryStats{Category: t, Count: len(transactions), Center: vault.MoneyFromFloat(center), Spread: vault.MoneyFromFloat(s)})
+		if s == 0 {
+			continue
+		}
+		for i, txn := range transactions {
+			z := (amounts[i] - center) / s
+			if math.Abs(z) >= opts.K {
+				txn.Type = t
+				resp.Anomalies = append(resp.Anomalies, anomaly{Transaction: txn, ZScore: math.Round(z*100) / 100})
+			}
+		}
+	}
+
+	sort.SliceStable(resp.Anomalies, func(i, j int) bool {
+		return math.Abs(resp.Anomalies[i].ZScore) > math.Abs(resp.Anomalies[j].ZScore)
+	})
+	return resp
+}
+
+// AnomaliesHandler returns the account's transactions with amounts that are
+// statistical outliers within their category
+func AnomaliesHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	opts, err := anomalyOptionsFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	_, categorized, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, detectAnomalies(categorized, opts))
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path"
+	"strconv"
+)
+
+// assetsPrefix is the URL path the assets are served under
+const assetsPrefix = "/assets/"
+
+// fingerprintLength is the number of hex digits of a file's SHA-256 used as
+// its fingerprint
+const fingerprintLength = 12
+
+// FingerprintAssets hashes the static assets, so that templates can link to
+// them with [[ asset "/assets/goreportcard.css" ]] and a query string that
+// changes with their contents, and browsers fetch them again after a deploy.
+// It is meant to be called once at startup, before serving; without it, or
+// with ASSET_FINGERPRINTS=false, asset links are left as they are.
+func (gh *GRCHandler) FingerprintAssets() error {
+	if enabled, err := strconv.ParseBool(getEnvOrDefault("ASSET_FINGERPRINTS", "true")); err == nil && !enabled {
+		gh.fingerprints = nil
+		return nil
+	}
+
+	fingerprints := make(map[string]string)
+	if err := gh.fingerprintDir("/", fingerprints); err != nil {
+		return err
+	}
+	gh.fingerprints = fingerprints
+	return nil
+}
+
+// fingerprintDir adds the fingerprints of the files under dir, by URL path.
+// The templates are not served and are skipped.
+func (gh *GRCHandler) fingerprintDir(dir string, fingerprints map[string]string) error {
+	d, err := gh.AssetsFS.Open(dir)
+	if err != nil {
+		return err
+	}
+	infos, err := d.Readdir(-1)
+	d.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range infos {
+		name := path.Join(dir, fi.Name())
+		if fi.IsDir() {
+			if name == "/templates" {
+				continue
+			}
+			if err := gh.fingerprintDir(name, fingerprints); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, err := gh.AssetsFS.Open(name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.New()
+		_, err = io.Copy(sum, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		fingerprints[path.Join(assetsPrefix, name)] = hex.EncodeToString(sum.Sum(nil))[:fingerprintLength]
+	}
+	return nil
+}
+
+// assetURL returns the URL of the asset at p with its fingerprint as the v
+// query parameter, or p unchanged if it has none
+func (gh *GRCHandler) assetURL(p string) string {
+	if v, ok := gh.fingerprints[p]; ok {
+		return p + "?v=" + v
+	}
+	return p
+}
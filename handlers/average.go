@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// averageComparison compares a category's total in the latest month with its
+// average over the months before it. Like insights, it compares the absolute
+// totals, so that growing fees deviate upwards.
+type averageComparison struct {
+	Category vault.TransactionType `json:"category"`
+	Month    string                `json:"month"`
+	Current  vault.Money           `json:"current"`
+	Months   int                   `json:"months"` // earlier months averaged, 0 for the first month
+	// Average, Deviation and DeviationPercent are nil when no earlier month
+	// is available to compare with, and DeviationPercent also when the
+	// average is zero
+	Average          *vault.Money `json:"average"`
+	Deviation        *vault.Money `json:"deviation"`
+	DeviationPercent *float64     `json:"deviation_percent"`
+}
+
+// averageMonths returns how many months before the latest are averaged,
+// configured with SUMMARY_AVERAGE_MONTHS (default 6)
+func averageMonths() int {
+	n, err := strconv.Atoi(getEnvOrDefault("SUMMARY_AVERAGE_MONTHS", "6"))
+	if err != nil || n < 1 {
+		log.Printf("Invalid SUMMARY_AVERAGE_MONTHS, using 6: %v", err)
+		return 6
+	}
+	return n
+}
+
+// monthlyTotals sums dated transactions per category for each month in the
+// reporting time zone
+type monthlyTotals map[time.Time]map[vault.TransactionType]vault.Money
+
+// add counts the transaction towards its month as one of type t
+func (m monthlyTotals) add(t vault.TransactionType, txn vault.Transaction, loc *time.Location) {
+	if txn.Timestamp.IsZero() {
+		return
+	}
+	start := periodStart(reportingTime(txn).In(loc), "month")
+	if m[start] == nil {
+		m[start] = make(map[vault.TransactionType]vault.Money)
+	}
+	m[start][t] = addMoney(m[start][t], txn.Amount)
+}
+
+// compareToAverage compares each category's total in the latest month with
+// its average over up to n months before it. Months without any transactions
+// between the first and the latest count as zero.
+func (m monthlyTotals) compareToAverage(n int) []averageComparison {
+	var latest, first time.Time
+	for start := range m {
+		if start.After(latest) {
+			latest = start
+		}
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+	}
+	if latest.IsZero() {
+		return nil
+	}
+
+	var history []time.Time
+	for start := latest.AddDate(0, -1, 0); !start.Before(first) && len(history) < n; start = start.AddDate(0, -1, 0) {
+		history = append(history, start)
+	}
+
+	var comparisons []averageComparison
+	for _, t := range vault.TransactionTypes {
+		c := averageComparison{
+			Category: t,
+			Month:    periodLabel(latest, "month"),
+			Current:  m[latest][t].Abs(),
+			Months:   len(history),
+		}
+		if len(history) > 0 {
+			var sum vault.Money
+			for _, start := range history {
+				sum = addMoney(sum, m[start][t].Abs())
+			}
+			avg := sum.Div(len(history))
+			deviation := addMoney(c.Current, -avg)
+			c.Average, c.Deviation = &avg, &deviation
+			if avg != 0 {
+				percent := deviation.Float() / avg.Float() * 100
+				c.DeviationPercent = &percent
+			}
+		}
+		comparisons = append(comparisons, c)
+	}
+	return comparisons
+}
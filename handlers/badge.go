@@ -3,7 +3,9 @@ package handlers
 import (
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strings"
 
 	"github.com/dgraph-io/badger/v2"
 	"github.com/gojp/goreportcard/check"
@@ -11,6 +13,11 @@ import (
 
 // BadgeHandler handles fetching the badge images
 func BadgeHandler(w http.ResponseWriter, r *http.Request, db *badger.DB, repo string) {
+	if deniedRepo(r, repo) {
+		writeJSONError(w, http.StatusForbidden, errRepoDenied.Error())
+		return
+	}
+
 	resp, err := newChecksResp(db, repo, false)
 
 	// See: http://shields.io/#styles
@@ -20,16 +27,55 @@ func BadgeHandler(w http.ResponseWriter, r *http.Request, db *badger.DB, repo st
 	}
 
 	if err != nil || resp.DidError {
-		log.Printf("ERROR: fetching badge for %s: %v", repo, err)
+		requestLog(r).Printf("ERROR: fetching badge for %s: %v", repo, err)
 		url := "https://img.shields.io/badge/go%20report-error-lightgrey.svg?style=" + style
 		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 		return
 	}
 
-	http.Redirect(w, r, badgeURL(resp.Grade, style), http.StatusTemporaryRedirect)
+	if r.URL.Query().Get("mode") == "status" {
+		http.Redirect(w, r, badgeStatusURL(resp.Grade.AtLeast(badgePassingGrade()), style), http.StatusTemporaryRedirect)
+		return
+	}
+
+	text := badgeText(r.URL.Query().Get("text"), resp.Grade, resp.Average)
+	http.Redirect(w, r, badgeURL(resp.Grade, text, style), http.StatusTemporaryRedirect)
+}
+
+// badgePassingGrade is the lowest grade a status badge shows as passing,
+// configured with BADGE_PASSING_GRADE (default C). The grade itself follows
+// the repo's grade thresholds.
+func badgePassingGrade() check.Grade {
+	grade, err := check.ParseGrade(getEnvOrDefault("BADGE_PASSING_GRADE", check.GradeC))
+	if err != nil {
+		log.Printf("Invalid BADGE_PASSING_GRADE, using %s: %v", check.GradeC, err)
+		return check.GradeC
+	}
+	return grade
+}
+
+// badgeText returns what the badge shows for the text query parameter:
+// the grade (the default), the score as a percentage, or both
+func badgeText(text string, grade check.Grade, average float64) string {
+	score := fmt.Sprintf("%d%%", int(math.Round(average*100)))
+	switch text {
+	case "score":
+		return score
+	case "both":
+		return fmt.Sprintf("%s %s", grade, score)
+	default:
+		return string(grade)
+	}
 }
 
-func badgeURL(grade check.Grade, style string) string {
+// badgeEscaper escapes the characters that shields.io treats specially in
+// the badge path. shields.io sizes the badge to its text, so longer texts are
+// not clipped.
+var badgeEscaper = strings.NewReplacer("-", "--", "_", "__", " ", "%20", "%", "%25")
+
+// badgeURL returns the shields.io URL for a badge showing text, colored
+// according to the grade
+func badgeURL(grade check.Grade, text, style string) string {
 	var color string
 	switch grade {
 	case check.GradeAPlus:
@@ -47,5 +93,15 @@ func badgeURL(grade check.Grade, style string) string {
 	case check.GradeF:
 		color = "red"
 	}
-	return fmt.Sprintf("https://img.shields.io/badge/go%%20report-%s-%s.svg?style=%s", grade, color, style)
+	return fmt.Sprintf("https://img.shields.io/badge/go%%20report-%s-%s.svg?style=%s", badgeEscaper.Replace(text), color, style)
+}
+
+// badgeStatusURL returns the shields.io URL for a badge showing whether the
+// repo is passing, in green, or failing, in red
+func badgeStatusURL(passing bool, style string) string {
+	text, color := "failing", "red"
+	if passing {
+		text, color = "passing", "brightgreen"
+	}
+	return fmt.Sprintf("https://img.shields.io/badge/go%%20report-%s-%s.svg?style=%s", text, color, style)
 }
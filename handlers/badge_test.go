@@ -20,10 +20,57 @@ func TestBadgeURL(t *testing.T) {
 		expectedURL := expectedURL
 		t.Run(string(grade), func(t *testing.T) {
 			t.Parallel()
-			got := badgeURL(grade, "for-the-badge")
+			got := badgeURL(grade, string(grade), "for-the-badge")
 			if got != expectedURL {
 				t.Errorf("expected %s, got %s", expectedURL, got)
 			}
 		})
 	}
 }
+
+func TestBadgeText(t *testing.T) {
+	cases := []struct {
+		text    string
+		grade   check.Grade
+		average float64
+		want    string
+		wantURL string
+	}{
+		{"", check.GradeAPlus, 0.97, "A+", "https://img.shields.io/badge/go%20report-A+-brightgreen.svg?style=flat"},
+		{"grade", check.GradeB, 0.72, "B", "https://img.shields.io/badge/go%20report-B-yellowgreen.svg?style=flat"},
+		{"score", check.GradeA, 0.871, "87%", "https://img.shields.io/badge/go%20report-87%25-green.svg?style=flat"},
+		{"both", check.GradeC, 0.6, "C 60%", "https://img.shields.io/badge/go%20report-C%2060%25-yellow.svg?style=flat"},
+		{"unknown", check.GradeF, 0.1, "F", "https://img.shields.io/badge/go%20report-F-red.svg?style=flat"},
+	}
+	for _, tt := range cases {
+		got := badgeText(tt.text, tt.grade, tt.average)
+		if got != tt.want {
+			t.Errorf("badgeText(%q, %s, %v) = %q, want %q", tt.text, tt.grade, tt.average, got, tt.want)
+		}
+		if gotURL := badgeURL(tt.grade, got, "flat"); gotURL != tt.wantURL {
+			t.Errorf("badgeURL(%s, %q) = %s, want %s", tt.grade, got, gotURL, tt.wantURL)
+		}
+	}
+}
+
+func TestBadgeStatusURL(t *testing.T) {
+	t.Setenv("BADGE_PASSING_GRADE", "B")
+	cases := []struct {
+		grade   check.Grade
+		wantURL string
+	}{
+		{check.GradeA, "https://img.shields.io/badge/go%20report-passing-brightgreen.svg?style=flat"},
+		{check.GradeB, "https://img.shields.io/badge/go%20report-passing-brightgreen.svg?style=flat"},
+		{check.GradeC, "https://img.shields.io/badge/go%20report-failing-red.svg?style=flat"},
+	}
+	for _, tt := range cases {
+		if got := badgeStatusURL(tt.grade.AtLeast(badgePassingGrade()), "flat"); got != tt.wantURL {
+			t.Errorf("status badge of %s = %s, want %s", tt.grade, got, tt.wantURL)
+		}
+	}
+
+	t.Setenv("BADGE_PASSING_GRADE", "Z")
+	if got := badgePassingGrade(); got != check.GradeC {
+		t.Errorf("badgePassingGrade with an invalid grade = %s, want %s", got, check.GradeC)
+	}
+}
@@ -0,0 +1,985 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// SummaryStats contains the totals shown on the bookkeeping dashboard
+type SummaryStats struct {
+	TotalTransactions     int         `json:"total_transactions"`
+	TotalPayments         int         `json:"total_payments"`
+	TotalTransfers        int         `json:"total_transfers"`
+	TotalFees             int         `json:"total_fees"`
+	TotalUncategorized    int         `json:"total_uncategorized"`
+	PaymentsSum           vault.Money `json:"payments_sum"`
+	TransfersSum          vault.Money `json:"transfers_sum"`
+	FeesSum               vault.Money `json:"fees_sum"`
+	UncategorizedSum      vault.Money `json:"uncategorized_sum"`
+	NetLiquidity          vault.Money `json:"net_liquidity"` // excludes internal transfers
+	TotalReconciled       int         `json:"total_reconciled"`
+	TotalUnreconciled     int         `json:"total_unreconciled"`
+	InternalTransferCount int         `json:"internal_transfer_count"` // transfers between the user's own accounts, counted in their category
+	// VsAverage compares each category's total in the latest month with
+	// its trailing monthly average
+	VsAverage []averageComparison `json:"vs_average"`
+	// FeesToPaymentsRatio is the total of the fees as a share of the total of
+	// the payments, null when there are no payments
+	FeesToPaymentsRatio *float64 `json:"fees_to_payments_ratio"`
+	// FeesOverThreshold reports whether the ratio exceeds FEE_RATIO_MAX_PERCENT
+	FeesOverThreshold bool `json:"fees_over_threshold"`
+	// GrossPayments is the total of the payments and NetPayments the same
+	// total less the fees associated with them by FEE_ASSOCIATION. Fees with
+	// no payment are left out of both, and summed in UnassociatedFeesSum;
+	// FeesSum still counts every fee.
+	GrossPayments       vault.Money `json:"gross_payments"`
+	NetPayments         vault.Money `json:"net_payments"`
+	UnassociatedFeesSum vault.Money `json:"unassociated_fees_sum"`
+	// FeeTiers counts and sums the fees in each tier of FEE_TIERS, listing
+	// every tier, with or without fees
+	FeeTiers []feeTierSummary `json:"fee_tiers"`
+	// Categories counts and sums the transactions in each category path,
+	// at its full depth unless rolled up with the level parameter
+	Categories []categoryPathTotal `json:"categories"`
+	// ZeroExcludedCount is the number of transactions left out for an amount
+	// of zero, with include_zero=false
+	ZeroExcludedCount int `json:"zero_excluded_count"`
+	// AmountOverflow reports whether a sum was too large to hold, and was
+	// capped at the largest amount; see vault.Money.Add
+	AmountOverflow bool `json:"amount_overflow"`
+}
+
+type bookkeepingResponse struct {
+	Transactions map[string][]vault.BalancedTransaction `json:"transactions"`
+	Summary      SummaryStats                           `json:"summary"`
+	Count        int                                    `json:"count"`
+	HiddenCount  int                                    `json:"hidden_count"` // transactions left out by hide_below
+	HiddenSum    vault.Money                            `json:"hidden_sum"`
+	// Period is the default reporting period the transactions are limited to
+	// when the request gives neither from nor to
+	Period *reportingPeriod `json:"period,omitempty"`
+	// Total is the number of transactions listed over every page, as Count,
+	// and TotalPages the number of pages of PageSize transactions. Without
+	// page or page_size, the whole listing is page 1.
+	Total      int `json:"total"`
+	Page       int `json:"page"`
+	PageSize   int `json:"page_size"`
+	TotalPages int `json:"total_pages"`
+}
+
+func getEnvOrDefault(name, def string) string {
+	got := os.Getenv(name)
+	if got == "" {
+		return def
+	}
+	return got
+}
+
+func vaultDir() string {
+	return getEnvOrDefault("VAULT_DIR", "vault")
+}
+
+func ledgerDir() string {
+	return getEnvOrDefault("LEDGER_DIR", "ledger")
+}
+
+func rulesFile() string {
+	return getEnvOrDefault("RULES_FILE", "vault/rules.json")
+}
+
+func normalizationFile() string {
+	return getEnvOrDefault("NORMALIZATION_FILE", "vault/normalization.json")
+}
+
+// requestTimeout is how long a bookkeeping request may spend reading the
+// vault, configured with BOOKKEEPING_TIMEOUT (a duration such as "30s")
+func requestTimeout() time.Duration {
+	d, err := time.ParseDuration(getEnvOrDefault("BOOKKEEPING_TIMEOUT", "30s"))
+	if err != nil || d <= 0 {
+		log.Printf("Invalid BOOKKEEPING_TIMEOUT, using 30s: %v", err)
+		return 30 * time.Second
+	}
+	return d
+}
+
+// requestContext returns the request's context limited to the request timeout
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), requestTimeout())
+}
+
+func newBookkeepingProcessor(acct account, opts ...vault.Option) (*vault.TransactionProcessor, error) {
+	rules, err := vault.LoadRules(rulesFile())
+	if err != nil {
+		return nil, err
+	}
+	normalizer, err := vault.LoadNormalizer(normalizationFile())
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := vaultIgnore()
+	if err != nil {
+		return nil, err
+	}
+	opening, err := openingBalance()
+	if err != nil {
+		return nil, err
+	}
+
+	// opts come last, so that they can replace the configured ones
+	return vault.NewTransactionProcessor(acct.VaultDir, acct.LedgerDir, append([]vault.Option{
+		vault.WithRules(rules),
+		vault.WithNormalizer(normalizer),
+		vault.WithSourceLocation(locationFromEnv("SOURCE_TIMEZONE")),
+		vault.WithLedgerHistory(ledgerHistory()),
+		vault.WithRetryPolicy(retryPolicy()),
+		vault.WithCSVDialect(csvDialect()),
+		vault.WithSignPolicy(signPolicy()),
+		vault.WithStrictness(parseStrictness()),
+		vault.WithAmountColumns(amountColumns()),
+		vault.WithNumberFormat(amountLocale()),
+		vault.WithOpeningBalance(opening),
+		vault.WithDefaultType(defaultTransactionType()),
+		vault.WithIgnore(ignore),
+	}, opts...)...)
+}
+
+// vaultIgnore returns the patterns of the vault files to skip: those of
+// VAULT_IGNORE, separated by commas, and of the file named by
+// VAULT_IGNORE_FILE, one per line
+func vaultIgnore() ([]string, error) {
+	patterns, err := vault.ParseIgnorePatterns(getEnvOrDefault("VAULT_IGNORE", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAULT_IGNORE: %w", err)
+	}
+	if path := getEnvOrDefault("VAULT_IGNORE_FILE", ""); path != "" {
+		fromFile, err := vault.LoadIgnorePatterns(path)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, fromFile...)
+	}
+	return patterns, nil
+}
+
+// defaultTransactionType is the type of the transactions no rule or heuristic
+// classifies, configured with DEFAULT_TRANSACTION_TYPE
+func defaultTransactionType() vault.TransactionType {
+	t, err := vault.ParseTransactionType(getEnvOrDefault("DEFAULT_TRANSACTION_TYPE", string(vault.UncategorizedTransaction)))
+	if err != nil {
+		log.Printf("Invalid DEFAULT_TRANSACTION_TYPE, using %s: %v", vault.UncategorizedTransaction, err)
+		return vault.UncategorizedTransaction
+	}
+	return t
+}
+
+// retryPolicy returns how vault reads are retried after transient errors,
+// configured with VAULT_READ_RETRIES, VAULT_READ_RETRY_DELAY and
+// VAULT_READ_RETRY_MAX_DELAY
+func retryPolicy() vault.RetryPolicy {
+	p := vault.DefaultRetryPolicy
+	if v := getEnvOrDefault("VAULT_READ_RETRIES", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			p.Retries = n
+		} else {
+			log.Printf("Invalid VAULT_READ_RETRIES, using %d", p.Retries)
+		}
+	}
+	for name, d := range map[string]*time.Duration{"VAULT_READ_RETRY_DELAY": &p.Delay, "VAULT_READ_RETRY_MAX_DELAY": &p.MaxDelay} {
+		v := getEnvOrDefault(name, "")
+		if v == "" {
+			continue
+		}
+		if parsed, err := time.ParseDuration(v); err == nil && parsed >= 0 {
+			*d = parsed
+		} else {
+			log.Printf("Invalid %s, using %s", name, *d)
+		}
+	}
+	return p
+}
+
+// csvDialect is how the vault's CSV files separate and quote fields,
+// configured with CSV_DELIMITER (auto, comma, semicolon, tab or a character),
+// CSV_QUOTE_ESCAPE (doubled or backslash), CSV_LAZY_QUOTES and CSV_KEEP_NEWLINES
+func csvDialect() vault.CSVDialect {
+	d := vault.CSVDialect{Escape: vault.EscapeDoubled}
+	if delim, err := vault.ParseDelimiter(getEnvOrDefault("CSV_DELIMITER", "auto")); err == nil {
+		d.Delimiter = delim
+	} else {
+		log.Printf("Invalid CSV_DELIMITER, detecting the delimiter of each file: %v", err)
+	}
+	if e, err := vault.ParseQuoteEscape(getEnvOrDefault("CSV_QUOTE_ESCAPE", string(vault.EscapeDoubled))); err == nil {
+		d.Escape = e
+	} else {
+		log.Printf("Invalid CSV_QUOTE_ESCAPE, using %s: %v", vault.EscapeDoubled, err)
+	}
+	for name, b := range map[string]*bool{"CSV_LAZY_QUOTES": &d.LazyQuotes, "CSV_KEEP_NEWLINES": &d.KeepNewlines} {
+		v := getEnvOrDefault(name, "false")
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Printf("Invalid %s, using false", name)
+			continue
+		}
+		*b = parsed
+	}
+	return d
+}
+
+// signPolicy is the expected sign of each transaction type's amounts,
+// configured with SIGN_EXPECTATIONS, such as "Fees=outflow,Payments=inflow",
+// and SIGN_STRICT, which drops the transactions that break it
+func signPolicy() vault.SignPolicy {
+	expect, err := vault.ParseSignExpectations(getEnvOrDefault("SIGN_EXPECTATIONS", ""))
+	if err != nil {
+		log.Printf("Invalid SIGN_EXPECTATIONS, not checking signs: %v", err)
+		return vault.SignPolicy{}
+	}
+	strict, err := strconv.ParseBool(getEnvOrDefault("SIGN_STRICT", "false"))
+	if err != nil {
+		log.Printf("Invalid SIGN_STRICT, using false")
+	}
+	return vault.SignPolicy{Expect: expect, Strict: strict}
+}
+
+// parseStrictness is how malformed rows are handled, configured with
+// PARSE_STRICTNESS: lenient warns and carries on, strict fails the read
+func parseStrictness() vault.Strictness {
+	s, err := vault.ParseStrictness(getEnvOrDefault("PARSE_STRICTNESS", string(vault.StrictnessLenient)))
+	if err != nil {
+		log.Printf("Invalid PARSE_STRICTNESS, using %s: %v", vault.StrictnessLenient, err)
+		return vault.StrictnessLenient
+	}
+	return s
+}
+
+// amountColumns is the layout of the amounts in the CSV files, configured with
+// AMOUNT_COLUMNS (auto, signed or debit-credit) and the headers of the debit
+// and credit columns, DEBIT_COLUMN and CREDIT_COLUMN
+func amountColumns() vault.AmountColumns {
+	c := vault.AmountColumns{
+		Mode:   vault.AmountAuto,
+		Debit:  getEnvOrDefault("DEBIT_COLUMN", ""),
+		Credit: getEnvOrDefault("CREDIT_COLUMN", ""),
+	}
+	if m, err := vault.ParseAmountMode(getEnvOrDefault("AMOUNT_COLUMNS", string(vault.AmountAuto))); err == nil {
+		c.Mode = m
+	} else {
+		log.Printf("Invalid AMOUNT_COLUMNS, using %s: %v", vault.AmountAuto, err)
+	}
+	return c
+}
+
+// ledgerHistory is the number of previous ledgers kept, configured with LEDGER_HISTORY
+func ledgerHistory() int {
+	n, err := strconv.Atoi(getEnvOrDefault("LEDGER_HISTORY", strconv.Itoa(vault.DefaultLedgerHistory)))
+	if err != nil || n < 0 {
+		log.Printf("Invalid LEDGER_HISTORY, keeping %d previous ledgers", vault.DefaultLedgerHistory)
+		return vault.DefaultLedgerHistory
+	}
+	return n
+}
+
+// locationFromEnv loads the time zone named by an environment variable,
+// falling back to UTC when it is unset or invalid
+func locationFromEnv(name string) *time.Location {
+	zone := getEnvOrDefault(name, "UTC")
+	if loc, ok := locations.Load(zone); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		log.Printf("Invalid %s, using UTC: %v", name, err)
+		return time.UTC
+	}
+	locations.Store(zone, loc)
+	return loc
+}
+
+// locations caches the time zones of locationFromEnv by name, since loading
+// one reads the time zone database and the date filters look one up for
+// every transaction
+var locations sync.Map
+
+// amountLocale is the number format amounts are written in, configured with
+// AMOUNT_LOCALE: auto (the default), point or comma, or a locale such as us,
+// ch or eu
+func amountLocale() vault.NumberFormat {
+	f, err := vault.ParseNumberFormat(getEnvOrDefault("AMOUNT_LOCALE", string(vault.FormatAuto)))
+	if err != nil {
+		log.Printf("Invalid AMOUNT_LOCALE, using %s: %v", vault.FormatAuto, err)
+		return vault.FormatAuto
+	}
+	return f
+}
+
+// openingBalance is the balance of each account before its first
+// transaction, which the running balances start from, configured with
+// OPENING_BALANCE in the AMOUNT_LOCALE number format
+func openingBalance() (vault.Money, error) {
+	m, _, err := vault.ParseAmount(getEnvOrDefault("OPENING_BALANCE", "0"), amountLocale())
+	if err != nil {
+		return 0, fmt.Errorf("invalid OPENING_BALANCE: %w", err)
+	}
+	return m, nil
+}
+
+// parseDecimal parses a number written with either a decimal point or a
+// decimal comma, such as "0.5" or "0,5"
+func parseDecimal(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, ".") && strings.Count(s, ",") == 1 {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+		return 0, fmt.Errorf("%q is not a finite number", s)
+	}
+	return v, err
+}
+
+// hideBelow returns the hide_below parameter of the request, defaulting to
+// BOOKKEEPING_HIDE_BELOW; transactions with a smaller absolute amount are left
+// out of listings. Zero hides nothing.
+func hideBelow(r *http.Request) (vault.Money, error) {
+	v := r.URL.Query().Get("hide_below")
+	if v == "" {
+		v = getEnvOrDefault("BOOKKEEPING_HIDE_BELOW", "0")
+	}
+	threshold, _, err := vault.ParseAmount(v, amountLocale())
+	if err != nil || threshold < 0 {
+		return 0, fmt.Errorf("invalid hide_below %q, expected a non-negative amount", v)
+	}
+	return threshold, nil
+}
+
+// defaultPageSize is the number of transactions of a page of the listing when
+// only page is given, and maxPageSize the most page_size can be
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// pageFromRequest returns the page of the listing requested with page,
+// counted from 1, and page_size, capped at maxPageSize, or 0 and 0 when
+// neither is given
+func pageFromRequest(r *http.Request) (int, int, error) {
+	q := r.URL.Query()
+	pageParam, sizeParam := strings.TrimSpace(q.Get("page")), strings.TrimSpace(q.Get("page_size"))
+	if pageParam == "" && sizeParam == "" {
+		return 0, 0, nil
+	}
+	page, size := 1, defaultPageSize
+	if pageParam != "" {
+		n, err := strconv.Atoi(pageParam)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer, got %q", pageParam)
+		}
+		page = n
+	}
+	if sizeParam != "" {
+		n, err := strconv.Atoi(sizeParam)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("page_size must be a positive integer, got %q", sizeParam)
+		}
+		size = min(n, maxPageSize)
+	}
+	return page, size, nil
+}
+
+// loadTransactions returns the account's transactions stored by the last
+// processing run, or reads its vault directory if nothing has been processed
+// yet, and categorizes them after applying the category overrides and
+// reconciliation marks stored in badger
+func loadTransactions(ctx context.Context, db *badger.DB, acct account) ([]vault.Transaction, map[vault.TransactionType][]vault.Transaction, error) {
+	transactions, err := loadAccountTransactions(ctx, db, acct)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := markInternalTransfers(ctx, db, acct, transactions); err != nil {
+		return nil, nil, err
+	}
+
+	return transactions, groupByType(transactions), nil
+}
+
+// loadAccountTransactions returns the account's stored transactions, or
+// those in its vault files when nothing has been processed yet, with the
+// stored splits, category overrides and reconciliation marks applied
+func loadAccountTransactions(ctx context.Context, db *badger.DB, acct account) ([]vault.Transaction, error) {
+	transactions, err := accountTransactions(ctx, db, acct)
+	if err != nil {
+		return nil, err
+	}
+
+	return applyStoredState(db, transactions)
+}
+
+// accountTransactions returns the account's stored transactions, or those in
+// its vault files when nothing has been processed yet, as they were read
+func accountTransactions(ctx context.Context, db *badger.DB, acct account) ([]vault.Transaction, error) {
+	transactions, found, err := storedTransactions(db, acct)
+	if err != nil {
+		return nil, fmt.Errorf("could not load stored transactions: %v", err)
+	}
+
+	if !found {
+		tp, err := newBookkeepingProcessor(acct)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions, err = tp.ReadCSVFiles(ctx)
+		if err != nil && !errors.Is(err, vault.ErrNoFiles) {
+			return nil, err
+		}
+	}
+
+	return transactions, nil
+}
+
+// calculateSummary computes counts and sums for each transaction category
+func calculateSummary(categorized map[vault.TransactionType][]vault.Transaction) SummaryStats {
+	var a summaryAccumulator
+	for _, t := range vault.TransactionTypes {
+		for _, txn := range categorized[t] {
+			a.add(t, txn)
+		}
+	}
+	return a.summary()
+}
+
+// summaryAccumulator builds a summary one transaction at a time, so that it
+// can be calculated while transactions are streamed
+type summaryAccumulator struct {
+	s        SummaryStats
+	sums     map[vault.TransactionType]vault.Money
+	internal vault.Money // sum of the internal transfers, left out of the net
+	months   monthlyTotals
+	loc      *time.Location
+	fees     []vault.Transaction // payments and fees, associated by summary
+	tiers    []feeTier
+	feeTiers []feeTierSummary
+	cats     categoryPathTotals
+	overflow bool // whether a sum was capped
+}
+
+// sum returns sum+n, noting when it overflows and is capped
+func (a *summaryAccumulator) sum(sum, n vault.Money) vault.Money {
+	s, err := sum.Add(n)
+	if err != nil {
+		a.overflow = true
+	}
+	return s
+}
+
+// add counts the transaction towards the summary as one of type t;
+// transactions of unknown types are ignored
+func (a *summaryAccumulator) add(t vault.TransactionType, txn vault.Transaction) {
+	if !t.Valid() {
+		return
+	}
+	if a.sums == nil {
+		a.sums = make(map[vault.TransactionType]vault.Money)
+		a.months = make(monthlyTotals)
+		a.loc = reportingLocation()
+		a.tiers = feeTiersFromEnv()
+		a.feeTiers = newFeeTierSummaries(a.tiers)
+		a.cats = make(categoryPathTotals)
+	}
+	amount := txn.Amount
+	a.sums[t] = a.sum(a.sums[t], amount)
+	a.months.add(t, txn, a.loc)
+	a.cats.add(t, txn)
+	if txn.Internal {
+		a.s.InternalTransferCount++
+		a.internal = a.sum(a.internal, amount)
+	}
+	if txn.Reconciled {
+		a.s.TotalReconciled++
+	} else {
+		a.s.TotalUnreconciled++
+	}
+
+	if t == vault.PaymentTransaction || t == vault.FeeTransaction {
+		txn.Type = t
+		a.fees = append(a.fees, txn)
+	}
+	if t == vault.FeeTransaction {
+		if i := feeTierIndex(a.tiers, amount); i >= 0 {
+			a.feeTiers[i].Count++
+			a.feeTiers[i].Sum = a.sum(a.feeTiers[i].Sum, amount)
+		}
+	}
+
+	switch t {
+	case vault.PaymentTransaction:
+		a.s.TotalPayments++
+	case vault.TransferTransaction:
+		a.s.TotalTransfers++
+	case vault.FeeTransaction:
+		a.s.TotalFees++
+	case vault.UncategorizedTransaction:
+		a.s.TotalUncategorized++
+	}
+	a.s.TotalTransactions++
+}
+
+// summary returns the summary of the transactions added so far
+func (a *summaryAccumulator) summary() SummaryStats {
+	s := a.s
+	s.PaymentsSum = a.sums[vault.PaymentTransaction]
+	s.TransfersSum = a.sums[vault.TransferTransaction]
+	s.FeesSum = a.sums[vault.FeeTransaction]
+	s.UncategorizedSum = a.sums[vault.UncategorizedTransaction]
+	for _, t := range vault.TransactionTypes {
+		s.NetLiquidity = a.sum(s.NetLiquidity, a.sums[t])
+	}
+	s.NetLiquidity = a.sum(s.NetLiquidity, -a.internal)
+	s.VsAverage = a.months.compareToAverage(averageMonths())
+	if s.PaymentsSum > 0 {
+		ratio := math.Round(math.Abs(s.FeesSum.Float())/s.PaymentsSum.Float()*10000) / 10000
+		s.FeesToPaymentsRatio = &ratio
+		if limit, ok := feeRatioLimit(); ok {
+			s.FeesOverThreshold = ratio*100 > limit
+		}
+	}
+	n := feeAssociationFromEnv().netOfFees(a.fees)
+	s.GrossPayments, s.NetPayments, s.UnassociatedFeesSum = n.Gross, n.Net, n.Unassociated
+	s.FeeTiers = a.feeTiers
+	if s.FeeTiers == nil {
+		s.FeeTiers = newFeeTierSummaries(feeTiersFromEnv())
+	}
+	s.Categories = a.cats.sorted()
+	s.AmountOverflow = a.overflow
+	return s
+}
+
+// feeRatioLimit returns the percentage of the payments the fees may reach,
+// configured with FEE_RATIO_MAX_PERCENT, and false if there is no limit
+func feeRatioLimit() (float64, bool) {
+	v := getEnvOrDefault("FEE_RATIO_MAX_PERCENT", "")
+	if v == "" {
+		return 0, false
+	}
+	limit, err := parseDecimal(v)
+	if err != nil || limit < 0 {
+		log.Printf("Invalid FEE_RATIO_MAX_PERCENT, not checking the fees: %v", err)
+		return 0, false
+	}
+	return limit, true
+}
+
+// feeAlert returns the warning shown on the dashboard when the fees exceed
+// their limit, or an empty string
+func feeAlert(s SummaryStats) string {
+	limit, ok := feeRatioLimit()
+	if !ok || !s.FeesOverThreshold || s.FeesToPaymentsRatio == nil {
+		return ""
+	}
+	return fmt.Sprintf("Fees are %.2f%% of payments, over the limit of %s%%.",
+		*s.FeesToPaymentsRatio*100, strconv.FormatFloat(limit, 'f', -1, 64))
+}
+
+// transactionData converts the categorized map to the string-keyed map used
+// in responses, with a key for each of the given types, or every type if
+// types is empty, and the balance after each transaction
+func transactionData(categorized map[vault.TransactionType][]vault.Transaction, types []vault.TransactionType, balances transactionBalances) map[string][]vault.BalancedTransaction {
+	if len(types) == 0 {
+		types = vault.TransactionTypes
+	}
+	data := make(map[string][]vault.BalancedTransaction, len(types))
+	for _, t := range types {
+		txns := make([]vault.BalancedTransaction, 0, len(categorized[t]))
+		for _, txn := range categorized[t] {
+			txns = append(txns, vault.BalancedTransaction{Transaction: txn, Balance: balances.take(txn)})
+		}
+		data[string(t)] = txns
+	}
+	return data
+}
+
+// transactionBalances looks up the running balance after each transaction by
+// its ledgerKey, in chronological order for transactions with the same key
+type transactionBalances map[string][]vault.Money
+
+func (b transactionBalances) add(txn vault.BalancedTransaction) {
+	key := ledgerKey(txn.Transaction)
+	b[key] = append(b[key], txn.Balance)
+}
+
+// take returns the balance after txn, and removes it so that the next
+// transaction with the same key gets the one after it
+func (b transactionBalances) take(txn vault.Transaction) vault.Money {
+	key := ledgerKey(txn)
+	balances := b[key]
+	if len(balances) == 0 {
+		return 0
+	}
+	b[key] = balances[1:]
+	return balances[0]
+}
+
+// vaultErrorStatus maps errors from the vault package to an HTTP status and a
+// message that is safe to show to clients
+func vaultErrorStatus(err error) (int, string) {
+	var parseErr *vault.ParseError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable, "timed out reading the vault, try again later"
+	case errors.Is(err, context.Canceled):
+		return http.StatusRequestTimeout, "request cancelled while reading the vault"
+	case errors.Is(err, vault.ErrVaultDirMissing):
+		return http.StatusServiceUnavailable, "vault directory is not available"
+	case errors.Is(err, vault.ErrOverlappingDirs):
+		return http.StatusServiceUnavailable, "vault and ledger directories overlap"
+	case errors.As(err, &parseErr):
+		return http.StatusUnprocessableEntity, "could not parse transactions: " + parseErr.Error()
+	default:
+		return http.StatusInternalServerError, "could not load transactions"
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(roundAmounts(v, moneyDecimals)); err != nil {
+		log.Println("ERROR: could not encode JSON response:", err)
+	}
+}
+
+// BookkeepingAPIHandler returns the categorized transactions and summary as
+// JSON. With ?reconciled=false only outstanding transactions are listed; the
+// summary covers all of the account's transactions of the selected types,
+// in the from, to and query filter or the default reporting period, less
+// those removed with exclude_type and exclude_q. With page and page_size
+// only one page of the listing is returned, while Count and the summary
+// still cover every page. Each transaction has the running balance of the
+// account after it, from OPENING_BALANCE or opening, over all of its
+// transactions in chronological order, which is the order of the listing.
+func BookkeepingAPIHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var reconciled *bool
+	if v := r.URL.Query().Get("reconciled"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "reconciled must be true or false")
+			return
+		}
+		reconciled = &b
+	}
+
+	filter, period, err := filterWithPeriod(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	types, err := typesFromQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	exclusions, err := exclusionsFromQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	threshold, err := hideBelow(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var net bool
+	if v := r.URL.Query().Get("net"); v != "" {
+		if net, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "net must be true or false")
+			return
+		}
+	}
+
+	level, err := levelFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, pageSize, err := pageFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var opts []vault.Option
+	if r.URL.Query().Get("opening") != "" {
+		opening, err := openingFromRequest(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts = append(opts, vault.WithOpeningBalance(opening))
+	}
+	tp, err := newBookkeepingProcessor(acct, opts...)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not create processor:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, categorized, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+	// balances and fees are calculated over all transactions, before any
+	// are filtered out, which are then listed in chronological order
+	balanced := tp.WithRunningBalance(transactions)
+	balances := make(transactionBalances, len(balanced))
+	transactions = make([]vault.Transaction, len(balanced))
+	for i, b := range balanced {
+		transactions[i] = b.Transaction
+		balances.add(b)
+	}
+	if net {
+		setNetAmounts(transactions)
+	}
+	categorized = groupByType(transactions)
+
+	var summary SummaryStats
+	zeroExcluded := filter.zeroExcluded(ofTypes(transactions, types))
+	if len(types) == 0 && filter == (transactionFilter{}) {
+		summary = summaryFor(db, acct, categorized)
+	} else {
+		transactions = ofTypes(filter.apply(transactions), types)
+		categorized = groupByType(transactions)
+		summary = calculateSummary(categorized)
+	}
+
+	// exclusions apply after the types are selected, and the summary covers
+	// what is left
+	if !exclusions.empty() {
+		transactions = exclusions.apply(transactions)
+		categorized = groupByType(transactions)
+		summary = calculateSummary(categorized)
+	}
+
+	if reconciled != nil {
+		var filtered []vault.Transaction
+		for _, t := range transactions {
+			if t.Reconciled == *reconciled {
+				filtered = append(filtered, t)
+			}
+		}
+		transactions, categorized = filtered, groupByType(filtered)
+	}
+
+	if level > 0 {
+		summary.Categories = rollUpCategories(summary.Categories, level)
+	}
+	summary.ZeroExcludedCount = zeroExcluded
+
+	resp := bookkeepingResponse{Summary: summary, Period: period}
+	if threshold > 0 {
+		var shown []vault.Transaction
+		for _, t := range transactions {
+			if t.Amount.Abs() < threshold {
+				resp.HiddenCount++
+				resp.HiddenSum = addMoney(resp.HiddenSum, t.Amount)
+				continue
+			}
+			shown = append(shown, t)
+		}
+		transactions, categorized = shown, groupByType(shown)
+	}
+
+	resp.Count, resp.Total = len(transactions), len(transactions)
+	resp.Page, resp.PageSize = 1, len(transactions)
+	if page > 0 {
+		// the page is cut from the listing in its order, then grouped
+		start := min((page-1)*pageSize, len(transactions))
+		end := min(start+pageSize, len(transactions))
+		categorized = groupByType(transactions[start:end])
+		resp.Page, resp.PageSize = page, pageSize
+	}
+	if resp.PageSize > 0 {
+		resp.TotalPages = (resp.Total + resp.PageSize - 1) / resp.PageSize
+	}
+
+	resp.Transactions = transactionData(categorized, types, balances)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// SummaryHandler returns only the summary of the account's transactions. With
+// from, to, query or type parameters the summary covers the matching
+// transactions; without from and to, those of the default reporting period.
+// With level, its categories are rolled up to that depth.
+// Until the vault has been processed, the summary is calculated while the
+// vault files are streamed, without loading every transaction into memory.
+func SummaryHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	filter, _, err := filterWithPeriod(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	types, err := typesFromQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	level, err := levelFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s, err := filteredSummary(r, db, acct, filter, types)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+	if level > 0 {
+		s.Categories = rollUpCategories(s.Categories, level)
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+// filteredSummary returns the summary of the account's transactions matching
+// the filter and types, from the cached summary when nothing is filtered
+func filteredSummary(r *http.Request, db *badger.DB, acct account, filter transactionFilter, types []vault.TransactionType) (SummaryStats, error) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	if filter == (transactionFilter{}) && len(types) == 0 {
+		s, found, err := cachedSummary(db, acct)
+		if err != nil {
+			requestLog(r).Println("ERROR: could not read cached summary:", err)
+		}
+		if found && err == nil {
+			return s, nil
+		}
+	}
+
+	found, err := isProcessed(db, acct)
+	if err != nil {
+		return SummaryStats{}, fmt.Errorf("could not load stored transactions: %v", err)
+	}
+	if !found && !internalTransferMatching().enabled() {
+		// nothing has been processed, so summarize the vault files as they are
+		// read; matching internal transfers takes every account's transactions
+		zeroExcluded := 0
+		s, err := streamSummary(ctx, db, acct, func(txn vault.Transaction) bool {
+			if !hasType(types, txn.Type) {
+				return false
+			}
+			zeroExcluded += filter.zeroExcluded([]vault.Transaction{txn})
+			return filter.matches(txn)
+		})
+		s.ZeroExcludedCount = zeroExcluded
+		return s, err
+	}
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		return SummaryStats{}, err
+	}
+	transactions = ofTypes(transactions, types)
+	s := calculateSummary(groupByType(filter.apply(transactions)))
+	s.ZeroExcludedCount = filter.zeroExcluded(transactions)
+	return s, nil
+}
+
+type bookkeepingSection struct {
+	Name         vault.TransactionType
+	Transactions []vault.Transaction
+}
+
+// BookkeepingHandler handles the bookkeeping dashboard page
+func (gh *GRCHandler) BookkeepingHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		gh.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if setPageCacheHeaders(w, r, bookkeepingModTime(db, acct)) {
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, categorized, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions: ", err)
+		status, msg := vaultErrorStatus(err)
+		gh.errorPage(w, status, msg)
+		return
+	}
+
+	t, err := gh.loadTemplate("/templates/bookkeeping.html")
+	if err != nil {
+		requestLog(r).Println("ERROR: could not get bookkeeping template: ", err)
+		gh.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var sections []bookkeepingSection
+	for _, txnType := range vault.TransactionTypes {
+		if len(categorized[txnType]) > 0 {
+			sections = append(sections, bookkeepingSection{Name: txnType, Transactions: categorized[txnType]})
+		}
+	}
+
+	summary := summaryFor(db, acct, categorized)
+	if err := t.ExecuteTemplate(w, "base", map[string]interface{}{
+		"google_analytics_key": googleAnalyticsKey,
+		"Account":              acct.Name,
+		"Accounts":             accounts(),
+		"Summary":              summary,
+		"FeeAlert":             feeAlert(summary),
+		"Sections":             sections,
+		"Colors":               categoryColors(),
+		"Suggestions":          vault.SuggestCategories(transactions),
+		"ReadOnly":             db == nil,
+	}); err != nil {
+		requestLog(r).Println("ERROR:", err)
+	}
+}
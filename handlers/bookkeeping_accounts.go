@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// account is a vault directory whose transactions are read and summarized
+// separately from the others, for example one per entity
+type account struct {
+	Name      string
+	VaultDir  string
+	LedgerDir string
+}
+
+// accounts returns the configured accounts. VAULT_DIR may hold several
+// directories or s3:// URLs separated by the OS path list separator (":" on
+// Unix); each is an account named after its base name, with its ledger
+// written to a subdirectory of LEDGER_DIR of the same name.
+func accounts() []account {
+	dirs := splitVaultDirs(vaultDir())
+	if len(dirs) <= 1 {
+		return []account{{Name: filepath.Base(vaultDir()), VaultDir: vaultDir(), LedgerDir: ledgerDir()}}
+	}
+
+	accts := make([]account, 0, len(dirs))
+	for _, dir := range dirs {
+		name := filepath.Base(dir)
+		accts = append(accts, account{Name: name, VaultDir: dir, LedgerDir: filepath.Join(ledgerDir(), name)})
+	}
+	return accts
+}
+
+// splitVaultDirs splits a list of vault locations like filepath.SplitList,
+// keeping the scheme of s3:// URLs with the rest of the URL
+func splitVaultDirs(list string) []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(list) {
+		if n := len(dirs); n > 0 && dirs[n-1] == "s3" && strings.HasPrefix(dir, "//") {
+			dirs[n-1] += ":" + dir
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// CheckBookkeepingDirs returns an error if the vault and ledger directories
+// of any account overlap, so that a misconfiguration is caught at startup
+// rather than by overwriting the source files
+func CheckBookkeepingDirs() error {
+	for _, acct := range accounts() {
+		if vault.IsRemote(acct.VaultDir) {
+			continue
+		}
+		if err := vault.CheckDirs(acct.VaultDir, acct.LedgerDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accountFromRequest returns the account selected with the account (or
+// entity) query parameter, defaulting to the first configured account
+func accountFromRequest(r *http.Request) (account, error) {
+	name := r.URL.Query().Get("account")
+	if name == "" {
+		name = r.URL.Query().Get("entity")
+	}
+
+	accts := accounts()
+	if name == "" {
+		return accts[0], nil
+	}
+
+	for _, a := range accts {
+		if a.Name == name {
+			return a, nil
+		}
+	}
+
+	return account{}, fmt.Errorf("unknown account %q", name)
+}
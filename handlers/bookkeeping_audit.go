@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+const (
+	// AuditPrefix is the badger prefix for the audit log of transaction
+	// changes, keyed by time so that iterating returns events in order
+	AuditPrefix string = "bookkeeping-audit-"
+)
+
+// Audit log actions
+const (
+	auditRecategorize = "recategorize"
+	auditReconcile    = "reconcile"
+	auditUnreconcile  = "unreconcile"
+	auditSplit        = "split"
+	auditUnsplit      = "unsplit"
+	auditTag          = "tag"
+	auditUntag        = "untag"
+)
+
+// auditEvent records a single change to a transaction
+type auditEvent struct {
+	Time          time.Time `json:"time"`
+	Account       string    `json:"account"`
+	Action        string    `json:"action"`
+	TransactionID string    `json:"transaction_id"`
+	OldValue      string    `json:"old_value"`
+	NewValue      string    `json:"new_value"`
+	Caller        string    `json:"caller,omitempty"` // the authenticated user, if any
+}
+
+// auditLog collects the events of one request, which are written in the same
+// badger transaction as the changes they describe
+type auditLog struct {
+	time    time.Time
+	account string
+	caller  string
+	events  []auditEvent
+}
+
+func newAuditLog(r *http.Request, acct account) *auditLog {
+	caller, _, _ := r.BasicAuth()
+	return &auditLog{time: time.Now().UTC(), account: acct.Name, caller: caller}
+}
+
+func (l *auditLog) add(action, transactionID, oldValue, newValue string) {
+	l.events = append(l.events, auditEvent{
+		Time:          l.time,
+		Account:       l.account,
+		Action:        action,
+		TransactionID: transactionID,
+		OldValue:      oldValue,
+		NewValue:      newValue,
+		Caller:        l.caller,
+	})
+}
+
+// write appends the events to the audit log. Events are only ever added
+// under new keys; nothing in the application updates or deletes them.
+func (l *auditLog) write(txn *badger.Txn) error {
+	for i, e := range l.events {
+		key := fmt.Sprintf("%s%020d-%06d", AuditPrefix, e.Time.UnixNano(), i)
+		if err := setJSON(txn, key, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditFilter selects audit events by account, action, transaction and date
+type auditFilter struct {
+	account       string
+	action        string
+	transactionID string
+	from, to      string // inclusive YYYY-MM-DD bounds on the UTC date of the event
+}
+
+func (f auditFilter) matches(e auditEvent) bool {
+	date := e.Time.UTC().Format(dateLayout)
+	switch {
+	case e.Account != f.account:
+		return false
+	case f.action != "" && e.Action != f.action:
+		return false
+	case f.transactionID != "" && e.TransactionID != f.transactionID:
+		return false
+	case f.from != "" && date < f.from:
+		return false
+	case f.to != "" && date > f.to:
+		return false
+	}
+	return true
+}
+
+// loadAuditEvents returns the audit events matching the filter, oldest first
+func loadAuditEvents(db *badger.DB, f auditFilter) ([]auditEvent, error) {
+	events := []auditEvent{}
+	var decodeErr error
+	err := forEachWithPrefix(db, AuditPrefix, func(id string, val []byte) {
+		var e auditEvent
+		if err := json.Unmarshal(val, &e); err != nil {
+			decodeErr = fmt.Errorf("could not parse audit event %s: %v", id, err)
+			return
+		}
+		if f.matches(e) {
+			events = append(events, e)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, decodeErr
+}
+
+// AuditHandler lists the account's audit log, optionally filtered by action,
+// transaction_id and a from/to date range
+func AuditHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	q := r.URL.Query()
+	dates := transactionFilter{From: q.Get("from"), To: q.Get("to")}
+	if err := dates.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, err := loadAuditEvents(db, auditFilter{
+		account:       acct.Name,
+		action:        q.Get("action"),
+		transactionID: q.Get("transaction_id"),
+		from:          dates.From,
+		to:            dates.To,
+	})
+	if err != nil {
+		requestLog(r).Println("ERROR: could not read audit log:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not read audit log")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// dateLayout is the format of transaction dates and of date filter parameters
+const dateLayout = "2006-01-02"
+
+// transactionFilter selects transactions by date range and description
+type transactionFilter struct {
+	From  string `json:"from"`  // inclusive lower bound, YYYY-MM-DD
+	To    string `json:"to"`    // inclusive upper bound, YYYY-MM-DD
+	Query string `json:"query"` // case-insensitive substring of the description
+	// ExcludeZero leaves out transactions with an amount of zero, such as
+	// informational bank entries; only read from query parameters
+	ExcludeZero bool `json:"-"`
+}
+
+func (f transactionFilter) validate() error {
+	for _, d := range []string{f.From, f.To} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", d)
+		}
+	}
+
+	if f.From != "" && f.To != "" && f.From > f.To {
+		return fmt.Errorf("from date %s is after to date %s", f.From, f.To)
+	}
+
+	return nil
+}
+
+func (f transactionFilter) matches(txn vault.Transaction) bool {
+	day := transactionDay(txn)
+	if f.From != "" && day < f.From {
+		return false
+	}
+	if f.To != "" && day > f.To {
+		return false
+	}
+	if f.Query != "" && !strings.Contains(strings.ToLower(txn.Description), strings.ToLower(f.Query)) {
+		return false
+	}
+	if f.ExcludeZero && isZeroAmount(txn) {
+		return false
+	}
+	return true
+}
+
+// transactionDay returns the day a transaction is reported on, YYYY-MM-DD, as
+// the date filters compare it: the day of its reporting time in the reporting
+// time zone, which the breakdowns put it in too, or the date as written when
+// it could not be parsed
+func transactionDay(txn vault.Transaction) string {
+	if t := reportingTime(txn); !t.IsZero() {
+		return t.In(reportingLocation()).Format(dateLayout)
+	}
+	return txn.Date
+}
+
+// isZeroAmount reports whether the transaction's amount is zero
+func isZeroAmount(txn vault.Transaction) bool {
+	return txn.Amount == 0
+}
+
+// zeroExcluded returns the number of transactions that match the filter but
+// for their amount of zero, when it excludes them
+func (f transactionFilter) zeroExcluded(transactions []vault.Transaction) int {
+	if !f.ExcludeZero {
+		return 0
+	}
+	all := f
+	all.ExcludeZero = false
+	n := 0
+	for _, txn := range transactions {
+		if isZeroAmount(txn) && all.matches(txn) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f transactionFilter) apply(transactions []vault.Transaction) []vault.Transaction {
+	var filtered []vault.Transaction
+	for _, txn := range transactions {
+		if f.matches(txn) {
+			filtered = append(filtered, txn)
+		}
+	}
+	return filtered
+}
+
+// filterFromQuery reads a transaction filter from the from, to, query and
+// include_zero parameters of a request. include_zero defaults to
+// INCLUDE_ZERO_AMOUNTS, or true.
+func filterFromQuery(r *http.Request) (transactionFilter, error) {
+	q := r.URL.Query()
+	f := transactionFilter{From: q.Get("from"), To: q.Get("to"), Query: q.Get("query")}
+	v := q.Get("include_zero")
+	if v == "" {
+		v = getEnvOrDefault("INCLUDE_ZERO_AMOUNTS", "true")
+	}
+	include, err := strconv.ParseBool(v)
+	if err != nil {
+		return transactionFilter{}, fmt.Errorf("include_zero must be true or false")
+	}
+	f.ExcludeZero = !include
+	return f, f.validate()
+}
+
+// typesFromQuery returns the transaction types selected with repeated type
+// parameters, matched case-insensitively, or nil when none are given
+func typesFromQuery(r *http.Request) ([]vault.TransactionType, error) {
+	return parseTypes(r.URL.Query()["type"])
+}
+
+// parseTypes returns the transaction types named by values, matched
+// case-insensitively
+func parseTypes(values []string) ([]vault.TransactionType, error) {
+	var types []vault.TransactionType
+	for _, v := range values {
+		found := false
+		for _, t := range vault.TransactionTypes {
+			if strings.EqualFold(v, string(t)) {
+				types = append(types, t)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown transaction type %q", v)
+		}
+	}
+	return types, nil
+}
+
+// ofTypes returns the transactions of the given types, or all of them when
+// types is empty
+func ofTypes(transactions []vault.Transaction, types []vault.TransactionType) []vault.Transaction {
+	if len(types) == 0 {
+		return transactions
+	}
+
+	var selected []vault.Transaction
+	for _, txn := range transactions {
+		if hasType(types, txn.Type) {
+			selected = append(selected, txn)
+		}
+	}
+	return selected
+}
+
+// hasType reports whether t is one of types, or types is empty
+func hasType(types []vault.TransactionType, t vault.TransactionType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, want := range types {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
+
+// transactionExclusions removes transactions of the given types, or whose
+// description contains any of the queries, case-insensitively
+type transactionExclusions struct {
+	Types   []vault.TransactionType
+	Queries []string // lower case
+}
+
+// exclusionsFromQuery reads the exclusions from the repeated exclude_type and
+// exclude_q parameters of a request
+func exclusionsFromQuery(r *http.Request) (transactionExclusions, error) {
+	q := r.URL.Query()
+	types, err := parseTypes(q["exclude_type"])
+	if err != nil {
+		return transactionExclusions{}, err
+	}
+
+	e := transactionExclusions{Types: types}
+	for _, v := range q["exclude_q"] {
+		if v = strings.TrimSpace(v); v != "" {
+			e.Queries = append(e.Queries, strings.ToLower(v))
+		}
+	}
+	return e, nil
+}
+
+func (e transactionExclusions) empty() bool {
+	return len(e.Types) == 0 && len(e.Queries) == 0
+}
+
+func (e transactionExclusions) excludes(txn vault.Transaction) bool {
+	if len(e.Types) > 0 && hasType(e.Types, txn.Type) {
+		return true
+	}
+	description := strings.ToLower(txn.Description)
+	for _, q := range e.Queries {
+		if strings.Contains(description, q) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e transactionExclusions) apply(transactions []vault.Transaction) []vault.Transaction {
+	var kept []vault.Transaction
+	for _, txn := range transactions {
+		if !e.excludes(txn) {
+			kept = append(kept, txn)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// CategoryOverridePrefix is the badger prefix for manual category overrides,
+	// keyed by transaction ID
+	CategoryOverridePrefix string = "bookkeeping-category-"
+)
+
+// loadCategoryOverrides returns the stored category of every overridden transaction
+func loadCategoryOverrides(db *badger.DB) (map[string]vault.TransactionType, error) {
+	overrides := make(map[string]vault.TransactionType)
+	err := forEachWithPrefix(db, CategoryOverridePrefix, func(id string, val []byte) {
+		overrides[id] = vault.TransactionType(val)
+	})
+
+	return overrides, err
+}
+
+// applyCategoryOverrides replaces the automatic category of overridden transactions
+func applyCategoryOverrides(transactions []vault.Transaction, overrides map[string]vault.TransactionType) {
+	for i := range transactions {
+		if t, ok := overrides[transactions[i].TransactionID]; ok {
+			transactions[i].Type = t
+		}
+	}
+}
+
+type recategorizeRequest struct {
+	transactionFilter
+	Type vault.TransactionType `json:"type"`
+}
+
+type categoryChange struct {
+	TransactionID string                `json:"transaction_id"`
+	OldType       vault.TransactionType `json:"old_type"`
+	NewType       vault.TransactionType `json:"new_type"`
+}
+
+type recategorizeResponse struct {
+	Changed int              `json:"changed"`
+	Skipped int              `json:"skipped"` // matches without a transaction ID, which cannot be overridden
+	Changes []categoryChange `json:"changes"`
+}
+
+// RecategorizeHandler reassigns the category of every transaction matching a
+// filter. Transactions already in the target category are left alone, so
+// repeating a request changes nothing, and every change is reported with its
+// previous category so it can be undone.
+func RecategorizeHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireDB(w, db) {
+		return
+	}
+
+	var req recategorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "request body must be JSON")
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.transactionFilter == (transactionFilter{}) {
+		writeJSONError(w, http.StatusBadRequest, "at least one of from, to or query is required")
+		return
+	}
+	if !req.Type.Valid() {
+		writeJSONError(w, http.StatusBadRequest, "unknown transaction type "+string(req.Type))
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	audit := newAuditLog(r, acct)
+	resp := recategorizeResponse{Changes: []categoryChange{}}
+	err = db.Update(func(txn *badger.Txn) error {
+		if err := invalidateSummaries(txn); err != nil {
+			return err
+		}
+
+		for _, t := range req.apply(transactions) {
+			if t.Type == req.Type {
+				continue
+			}
+			if t.TransactionID == "" {
+				resp.Skipped++
+				continue
+			}
+
+			if err := txn.Set([]byte(CategoryOverridePrefix+t.TransactionID), []byte(req.Type)); err != nil {
+				return err
+			}
+			resp.Changes = append(resp.Changes, categoryChange{
+				TransactionID: t.TransactionID,
+				OldType:       t.Type,
+				NewType:       req.Type,
+			})
+			audit.add(auditRecategorize, t.TransactionID, string(t.Type), string(req.Type))
+		}
+
+		return audit.write(txn)
+	})
+	if err != nil {
+		requestLog(r).Println("ERROR: could not save category overrides:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not save category overrides")
+		return
+	}
+
+	resp.Changed = len(resp.Changes)
+	requestLog(r).Printf("Recategorized %d transaction(s) as %s", resp.Changed, req.Type)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// transactionPath is the path of the endpoint for a single transaction,
+// followed by its ID
+const transactionPath = "/api/bookkeeping/transaction/"
+
+type overrideRequest struct {
+	Type vault.TransactionType `json:"type"`
+}
+
+// TransactionHandler overrides the category of the transaction whose ID
+// follows transactionPath. The override is stored by transaction ID, apart
+// from the rules file, so it is applied after automatic categorization and
+// survives reprocessing the vault.
+func TransactionHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodPatch {
+		w.Header().Set("Allow", "PATCH")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireDB(w, db) {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, transactionPath)
+	if id == "" || strings.Contains(id, "/") {
+		writeJSONError(w, http.StatusNotFound, "transaction ID is required")
+		return
+	}
+
+	var req overrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "request body must be JSON")
+		return
+	}
+	if !req.Type.Valid() {
+		writeJSONError(w, http.StatusBadRequest, "unknown transaction type "+string(req.Type))
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	var found *vault.Transaction
+	for i := range transactions {
+		if transactions[i].TransactionID == id {
+			found = &transactions[i]
+			break
+		}
+	}
+	if found == nil {
+		writeJSONError(w, http.StatusNotFound, "unknown transaction "+id)
+		return
+	}
+
+	change := categoryChange{TransactionID: id, OldType: found.Type, NewType: req.Type}
+	if change.OldType != change.NewType {
+		audit := newAuditLog(r, acct)
+		err = db.Update(func(txn *badger.Txn) error {
+			if err := invalidateSummaries(txn); err != nil {
+				return err
+			}
+			if err := txn.Set([]byte(CategoryOverridePrefix+id), []byte(req.Type)); err != nil {
+				return err
+			}
+			audit.add(auditRecategorize, id, string(change.OldType), string(change.NewType))
+			return audit.write(txn)
+		})
+		if err != nil {
+			requestLog(r).Println("ERROR: could not save category override:", err)
+			writeJSONError(w, http.StatusInternalServerError, "could not save category override")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, change)
+}
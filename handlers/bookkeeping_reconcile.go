@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// ReconciledPrefix is the badger prefix marking transactions as reconciled,
+	// keyed by transaction ID. Marks are kept across processing runs.
+	ReconciledPrefix string = "bookkeeping-reconciled-"
+)
+
+// loadReconciled returns the IDs of the transactions marked as reconciled
+func loadReconciled(db *badger.DB) (map[string]bool, error) {
+	reconciled := make(map[string]bool)
+	err := forEachWithPrefix(db, ReconciledPrefix, func(id string, val []byte) {
+		reconciled[id] = true
+	})
+
+	return reconciled, err
+}
+
+// applyReconciled sets the Reconciled flag of the marked transactions
+func applyReconciled(transactions []vault.Transaction, reconciled map[string]bool) {
+	for i := range transactions {
+		transactions[i].Reconciled = reconciled[transactions[i].TransactionID]
+	}
+}
+
+type reconcileRequest struct {
+	TransactionIDs []string `json:"transaction_ids"`
+}
+
+type reconcileResponse struct {
+	Changed int      `json:"changed"`
+	Unknown []string `json:"unknown"` // IDs not found among the account's transactions
+}
+
+// ReconcileHandler marks transactions as reconciled on POST and removes the
+// mark on DELETE. Marking an already reconciled transaction changes nothing.
+func ReconcileHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "POST, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireDB(w, db) {
+		return
+	}
+
+	reconcile := r.Method == http.MethodPost
+
+	var req reconcileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.TransactionIDs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "request body must be JSON with transaction_ids")
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	byID := make(map[string]vault.Transaction, len(transactions))
+	for _, t := range transactions {
+		if t.TransactionID != "" {
+			byID[t.TransactionID] = t
+		}
+	}
+
+	audit := newAuditLog(r, acct)
+	action := auditUnreconcile
+	if reconcile {
+		action = auditReconcile
+	}
+
+	resp := reconcileResponse{Unknown: []string{}}
+	err = db.Update(func(txn *badger.Txn) error {
+		if err := invalidateSummaries(txn); err != nil {
+			return err
+		}
+
+		for _, id := range req.TransactionIDs {
+			t, ok := byID[id]
+			if !ok {
+				resp.Unknown = append(resp.Unknown, id)
+				continue
+			}
+			if t.Reconciled == reconcile {
+				continue
+			}
+
+			key := []byte(ReconciledPrefix + id)
+			if reconcile {
+				err = txn.Set(key, []byte{1})
+			} else {
+				err = txn.Delete(key)
+			}
+			if err != nil {
+				return err
+			}
+
+			audit.add(action, id, strconv.FormatBool(t.Reconciled), strconv.FormatBool(reconcile))
+			t.Reconciled = reconcile
+			byID[id] = t
+			resp.Changed++
+		}
+
+		return audit.write(txn)
+	})
+	if err != nil {
+		requestLog(r).Println("ERROR: could not save reconciliation marks:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not save reconciliation marks")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
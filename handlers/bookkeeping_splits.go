@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// SplitPrefix is the badger prefix for the parts transactions are split
+	// into, keyed by the transaction ID of the split transaction
+	SplitPrefix string = "bookkeeping-split-"
+)
+
+// splitPath is the path of the endpoint splitting a transaction, followed by its ID
+const splitPath = "/api/bookkeeping/split/"
+
+// splitPart is one of the parts a transaction is split into
+type splitPart struct {
+	Amount      vault.Money           `json:"amount"`
+	Type        vault.TransactionType `json:"type"`
+	Description string                `json:"description,omitempty"` // the split transaction's when empty
+}
+
+// splitID returns the transaction ID of the i-th part of a split transaction
+func splitID(parent string, i int) string {
+	return parent + "-" + strconv.Itoa(i+1)
+}
+
+// loadSplits returns the stored parts of every split transaction
+func loadSplits(db *badger.DB) (map[string][]splitPart, error) {
+	splits := make(map[string][]splitPart)
+	var decodeErr error
+	err := forEachWithPrefix(db, SplitPrefix, func(id string, val []byte) {
+		var parts []splitPart
+		if err := json.Unmarshal(val, &parts); err != nil {
+			decodeErr = fmt.Errorf("could not parse split of %s: %v", id, err)
+			return
+		}
+		splits[id] = parts
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return splits, decodeErr
+}
+
+// checkSplitSum returns an error unless the parts sum to amount, to within
+// half a cent
+func checkSplitSum(parts []splitPart, amount vault.Money) error {
+	var sum vault.Money
+	for _, p := range parts {
+		var err error
+		if sum, err = sum.Add(p.Amount); err != nil {
+			return fmt.Errorf("summing the parts: %w", err)
+		}
+	}
+	if diff, err := sum.Add(-amount); err != nil || diff.Abs() >= vault.MoneyFromFloat(0.005) {
+		return fmt.Errorf("the parts sum to %s, not %s", sum, amount)
+	}
+	return nil
+}
+
+// splitTransaction returns the parts of a split transaction, each a copy of
+// it with the part's amount, type and description
+func splitTransaction(parent vault.Transaction, parts []splitPart) []vault.Transaction {
+	children := make([]vault.Transaction, 0, len(parts))
+	for i, p := range parts {
+		child := parent
+		child.TransactionID = splitID(parent.TransactionID, i)
+		child.Amount, child.AmountText = p.Amount, ""
+		child.Type = p.Type
+		child.SplitFrom = parent.TransactionID
+		if p.Description != "" {
+			child.Description = p.Description
+			child.NormalizedDescription = ""
+		}
+		children = append(children, child)
+	}
+	return children
+}
+
+// applySplits replaces split transactions with their parts. A transaction
+// whose amount no longer matches the sum of its parts, such as after its file
+// was corrected, is kept whole.
+func applySplits(transactions []vault.Transaction, splits map[string][]splitPart) []vault.Transaction {
+	if len(splits) == 0 {
+		return transactions
+	}
+
+	out := make([]vault.Transaction, 0, len(transactions))
+	for _, t := range transactions {
+		parts, ok := splits[t.TransactionID]
+		if !ok || t.TransactionID == "" {
+			out = append(out, t)
+			continue
+		}
+		if err := checkSplitSum(parts, t.Amount); err != nil {
+			log.Printf("Not splitting transaction %s: %v", t.TransactionID, err)
+			out = append(out, t)
+			continue
+		}
+		out = append(out, splitTransaction(t, parts)...)
+	}
+	return out
+}
+
+type splitRequest struct {
+	Parts []splitPartRequest `json:"parts"`
+}
+
+// splitPartRequest is a splitPart as requested
+type splitPartRequest struct {
+	Amount      requestAmount         `json:"amount"`
+	Type        vault.TransactionType `json:"type"`
+	Description string                `json:"description,omitempty"`
+}
+
+// validate checks that there are at least two parts of known types with
+// amounts that sum to amount, and returns the parts with their amounts
+// rounded to moneyDecimals places
+func (req splitRequest) validate(amount vault.Money) ([]splitPart, error) {
+	if len(req.Parts) < 2 {
+		return nil, errors.New("a split needs at least two parts")
+	}
+	parts := make([]splitPart, len(req.Parts))
+	for i, p := range req.Parts {
+		if !p.Type.Valid() {
+			return nil, fmt.Errorf("part %d: unknown transaction type %s", i+1, p.Type)
+		}
+		parts[i] = splitPart{Amount: vault.Money(p.Amount).Round(moneyDecimals), Type: p.Type, Description: p.Description}
+	}
+	return parts, checkSplitSum(parts, amount)
+}
+
+type splitResponse struct {
+	TransactionID string              `json:"transaction_id"`
+	Parts         []vault.Transaction `json:"parts"` // none once the split is removed
+}
+
+// SplitHandler splits the transaction whose ID follows splitPath into parts
+// with their own amounts and categories on POST, replacing an earlier split,
+// and removes its split on DELETE. Splits are stored by transaction ID, so
+// they survive reprocessing the vault. Listings and summaries show the parts
+// in place of the transaction, for as long as they sum to its amount.
+func SplitHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "POST, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireDB(w, db) {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, splitPath)
+	if id == "" || strings.Contains(id, "/") {
+		writeJSONError(w, http.StatusNotFound, "transaction ID is required")
+		return
+	}
+
+	var req splitRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "request body must be JSON with parts")
+			return
+		}
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	// the transaction is looked up as read, before any split applies
+	transactions, err := accountTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	var found *vault.Transaction
+	for i := range transactions {
+		if transactions[i].TransactionID == id {
+			found = &transactions[i]
+			break
+		}
+	}
+	if found == nil {
+		writeJSONError(w, http.StatusNotFound, "unknown transaction "+id)
+		return
+	}
+
+	splits, err := loadSplits(db)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load splits:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not load splits")
+		return
+	}
+	previous, split := splits[id]
+	if r.Method == http.MethodDelete && !split {
+		writeJSONError(w, http.StatusNotFound, "transaction "+id+" is not split")
+		return
+	}
+	var parts []splitPart
+	if r.Method == http.MethodPost {
+		if parts, err = req.validate(found.Amount); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	resp := splitResponse{TransactionID: id, Parts: []vault.Transaction{}}
+	audit := newAuditLog(r, acct)
+	err = db.Update(func(txn *badger.Txn) error {
+		if err := invalidateSummaries(txn); err != nil {
+			return err
+		}
+
+		if r.Method == http.MethodDelete {
+			audit.add(auditUnsplit, id, describeSplit(previous), "")
+			if err := txn.Delete([]byte(SplitPrefix + id)); err != nil {
+				return err
+			}
+			return audit.write(txn)
+		}
+
+		audit.add(auditSplit, id, describeSplit(previous), describeSplit(parts))
+		if err := setJSON(txn, SplitPrefix+id, parts); err != nil {
+			return err
+		}
+		return audit.write(txn)
+	})
+	if err != nil {
+		requestLog(r).Println("ERROR: could not save split:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not save split")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		resp.Parts = splitTransaction(*found, parts)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// describeSplit describes the parts of a split for the audit log, such as
+// "-40.00 Fees, -60.00 Payments"; a transaction that is not split is ""
+func describeSplit(parts []splitPart) string {
+	s := make([]string, 0, len(parts))
+	for _, p := range parts {
+		s = append(s, p.Amount.String()+" "+string(p.Type))
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,612 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// TransactionsPrefix is the badger prefix for the transactions ingested by the
+	// last processing run, keyed by account and transaction ID
+	TransactionsPrefix string = "bookkeeping-transactions-"
+	// ProcessedPrefix is the badger prefix for the time of the last processing
+	// run, keyed by account
+	ProcessedPrefix string = "bookkeeping-processed-"
+	// SummaryPrefix is the badger prefix for the cached summary of the ingested
+	// transactions, keyed by account
+	SummaryPrefix string = "bookkeeping-summary-"
+)
+
+// errDatabaseLocked is returned by endpoints that need to write to badger
+// when the database could not be opened because another process holds its lock
+var errDatabaseLocked = errors.New("database locked by another process, changes cannot be saved")
+
+// IsDatabaseLocked reports whether err, returned by badger.Open, means that
+// another process is using the database directory
+func IsDatabaseLocked(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Another process is using this Badger database")
+}
+
+// requireDB writes a database locked error and returns false when the server
+// runs without badger
+func requireDB(w http.ResponseWriter, db *badger.DB) bool {
+	if db != nil {
+		return true
+	}
+	writeJSONError(w, http.StatusServiceUnavailable, errDatabaseLocked.Error())
+	return false
+}
+
+// getJSON reads the JSON value stored at key into v. Without a database
+// nothing is found.
+func getJSON(db *badger.DB, key string, v interface{}) (bool, error) {
+	if db == nil {
+		return false, nil
+	}
+	found := false
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		found = true
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, v)
+		})
+	})
+
+	return found, err
+}
+
+func setJSON(txn *badger.Txn, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %v", key, err)
+	}
+	return txn.Set([]byte(key), b)
+}
+
+// forEachWithPrefix calls fn with the key suffix and value of every key with the given prefix
+func forEachWithPrefix(db *badger.DB, prefix string, fn func(id string, val []byte)) error {
+	if db == nil {
+		return nil
+	}
+	return db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		p := []byte(prefix)
+		for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+			item := it.Item()
+			id := string(item.Key()[len(p):])
+			err := item.Value(func(val []byte) error {
+				fn(id, val)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// applyStoredState applies the splits, category overrides, reconciliation
+// marks and tags stored in badger to transactions read from the vault. Splits apply
+// first, so that the parts of a split transaction can be recategorized and
+// reconciled on their own.
+func applyStoredState(db *badger.DB, transactions []vault.Transaction) ([]vault.Transaction, error) {
+	splits, err := loadSplits(db)
+	if err != nil {
+		return nil, fmt.Errorf("could not load splits: %v", err)
+	}
+	transactions = applySplits(transactions, splits)
+
+	overrides, err := loadCategoryOverrides(db)
+	if err != nil {
+		return nil, fmt.Errorf("could not load category overrides: %v", err)
+	}
+	applyCategoryOverrides(transactions, overrides)
+	for i := range transactions {
+		transactions[i].Category = transactions[i].CategoryPath()
+	}
+
+	reconciled, err := loadReconciled(db)
+	if err != nil {
+		return nil, fmt.Errorf("could not load reconciliation marks: %v", err)
+	}
+	applyReconciled(transactions, reconciled)
+
+	tags, err := loadTags(db)
+	if err != nil {
+		return nil, fmt.Errorf("could not load tags: %v", err)
+	}
+	applyTags(transactions, tags)
+	applyTaxTags(transactions)
+	applyFeeTiers(transactions, feeTiersFromEnv())
+	applyBusinessDayShift(transactions, businessDayShiftFromEnv(), reportingLocation())
+
+	return transactions, nil
+}
+
+// storedTransaction is a transaction stored under its own key. Keys sort by
+// transaction ID, so its position in the vault files is kept with it.
+type storedTransaction struct {
+	Seq int `json:"seq"`
+	vault.Transaction
+}
+
+// transactionsPrefix returns the prefix of the keys of the account's stored
+// transactions, which end in the transaction ID. Account names are file
+// names, which cannot hold the NUL byte separating them from the ID.
+func transactionsPrefix(acct account) string {
+	return TransactionsPrefix + acct.Name + "\x00"
+}
+
+// forEachStoredTransaction calls fn with the key and value of each of the
+// account's stored transactions, in key order
+func forEachStoredTransaction(txn *badger.Txn, acct account, fn func(key []byte, t storedTransaction) error) error {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	p := []byte(transactionsPrefix(acct))
+	for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+		item := it.Item()
+		var t storedTransaction
+		err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &t)
+		})
+		if err != nil {
+			return fmt.Errorf("could not unmarshal %q: %v", item.Key(), err)
+		}
+		if err := fn(item.KeyCopy(nil), t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storedTransactions returns the account's transactions ingested by the last
+// processing run, and false if nothing has been ingested yet
+func storedTransactions(db *badger.DB, acct account) ([]vault.Transaction, bool, error) {
+	if db == nil {
+		return nil, false, nil
+	}
+	var stored []storedTransaction
+	found := false
+	err := db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get([]byte(ProcessedPrefix + acct.Name)); err == badger.ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		found = true
+		return forEachStoredTransaction(txn, acct, func(_ []byte, t storedTransaction) error {
+			stored = append(stored, t)
+			return nil
+		})
+	})
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Seq < stored[j].Seq })
+	transactions := make([]vault.Transaction, len(stored))
+	for i, t := range stored {
+		transactions[i] = t.Transaction
+	}
+	return transactions, true, nil
+}
+
+// isProcessed reports whether the account's vault has been processed, without
+// reading its stored transactions
+func isProcessed(db *badger.DB, acct account) (bool, error) {
+	var processedAt time.Time
+	return getJSON(db, ProcessedPrefix+acct.Name, &processedAt)
+}
+
+// storeTransactions replaces the account's stored transactions, one key per
+// transaction. Transactions without an ID, or with the ID of an earlier one,
+// are keyed by their position as well. The keys are written in batches, as a
+// vault holds more transactions than fit in one badger transaction, so the
+// account is marked as not processed first; the caller marks it again with
+// ProcessedPrefix once the rest of the run is stored.
+func storeTransactions(db *badger.DB, acct account, transactions []vault.Transaction) error {
+	err := db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete([]byte(ProcessedPrefix + acct.Name)); err != nil {
+			return err
+		}
+		// earlier versions stored all of the account's transactions in one value
+		return txn.Delete([]byte(TransactionsPrefix + acct.Name))
+	})
+	if err != nil {
+		return err
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	keys := make(map[string]bool, len(transactions))
+	for i, t := range transactions {
+		id := t.TransactionID
+		if id == "" || keys[transactionsPrefix(acct)+id] {
+			id += "#" + strconv.Itoa(i)
+		}
+		key := transactionsPrefix(acct) + id
+		keys[key] = true
+
+		b, err := json.Marshal(storedTransaction{Seq: i, Transaction: t})
+		if err != nil {
+			return fmt.Errorf("could not marshal transaction %s: %v", t.TransactionID, err)
+		}
+		if err := wb.Set([]byte(key), b); err != nil {
+			return err
+		}
+	}
+
+	// the transactions of the previous run that are not stored again
+	err = db.View(func(txn *badger.Txn) error {
+		return forEachStoredTransaction(txn, acct, func(key []byte, _ storedTransaction) error {
+			if keys[string(key)] {
+				return nil
+			}
+			return wb.Delete(key)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return wb.Flush()
+}
+
+// deleteKeys removes keys in batches, which unlike a single badger
+// transaction holds any number of them
+func deleteKeys(db *badger.DB, keys [][]byte) error {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, key := range keys {
+		if err := wb.Delete(key); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// cachedSummary returns the account's cached summary, and false if there is none
+func cachedSummary(db *badger.DB, acct account) (SummaryStats, bool, error) {
+	var s SummaryStats
+	found, err := getJSON(db, SummaryPrefix+acct.Name, &s)
+	return s, found, err
+}
+
+// invalidateSummary removes the account's cached summary, so that it is
+// recomputed, and records that the account's state changed
+func invalidateSummary(txn *badger.Txn, acct account) error {
+	if err := txn.Delete([]byte(SummaryPrefix + acct.Name)); err != nil {
+		return err
+	}
+	return touchAccount(txn, acct)
+}
+
+// invalidateSummaries removes the cached summaries of all accounts
+func invalidateSummaries(txn *badger.Txn) error {
+	for _, acct := range accounts() {
+		if err := invalidateSummary(txn, acct); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summaryFor returns the account's cached summary if there is one, and computes it otherwise
+func summaryFor(db *badger.DB, acct account, categorized map[vault.TransactionType][]vault.Transaction) SummaryStats {
+	s, found, err := cachedSummary(db, acct)
+	if err != nil {
+		log.Println("ERROR: could not read cached summary:", err)
+	}
+	if found && err == nil {
+		return s
+	}
+	return calculateSummary(categorized)
+}
+
+// streamSummary summarizes the account's vault files as they are read,
+// without holding every transaction in memory, counting only the transactions
+// include accepts. Stored splits, category overrides and reconciliation marks
+// apply as they do to loadTransactions.
+func streamSummary(ctx context.Context, db *badger.DB, acct account, include func(vault.Transaction) bool) (SummaryStats, error) {
+	splits, err := loadSplits(db)
+	if err != nil {
+		return SummaryStats{}, fmt.Errorf("could not load splits: %v", err)
+	}
+	overrides, err := loadCategoryOverrides(db)
+	if err != nil {
+		return SummaryStats{}, fmt.Errorf("could not load category overrides: %v", err)
+	}
+	reconciled, err := loadReconciled(db)
+	if err != nil {
+		return SummaryStats{}, fmt.Errorf("could not load reconciliation marks: %v", err)
+	}
+
+	tp, err := newBookkeepingProcessor(acct)
+	if err != nil {
+		return SummaryStats{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	transactions := make(chan vault.Transaction, 64)
+	errc := make(chan error, 1)
+	go func() { errc <- tp.StreamCSVFiles(ctx, transactions) }()
+
+	var a summaryAccumulator
+	for parent := range transactions {
+		for _, txn := range applySplits([]vault.Transaction{parent}, splits) {
+			if t, ok := overrides[txn.TransactionID]; ok {
+				txn.Type = t
+			}
+			txn.Reconciled = reconciled[txn.TransactionID]
+			if include(txn) {
+				a.add(txn.Type, txn)
+			}
+		}
+	}
+	if err := <-errc; err != nil && !errors.Is(err, vault.ErrNoFiles) {
+		return SummaryStats{}, err
+	}
+
+	return a.summary(), nil
+}
+
+// rebuildSummary recomputes and caches the summary of the account's stored transactions
+func rebuildSummary(ctx context.Context, db *badger.DB, acct account) (SummaryStats, error) {
+	transactions, found, err := storedTransactions(db, acct)
+	if err != nil {
+		return SummaryStats{}, err
+	}
+	if !found {
+		return SummaryStats{}, errNotProcessed
+	}
+
+	if transactions, err = applyStoredState(db, transactions); err != nil {
+		return SummaryStats{}, err
+	}
+	if err := markInternalTransfers(ctx, db, acct, transactions); err != nil {
+		return SummaryStats{}, err
+	}
+
+	s := calculateSummary(groupByType(transactions))
+	err = db.Update(func(txn *badger.Txn) error {
+		return setJSON(txn, SummaryPrefix+acct.Name, s)
+	})
+
+	return s, err
+}
+
+// groupByType groups transactions by type, like vault.TransactionProcessor.CategorizeTransactions,
+// giving those stored without a known type the default one
+func groupByType(transactions []vault.Transaction) map[vault.TransactionType][]vault.Transaction {
+	categorized := make(map[vault.TransactionType][]vault.Transaction)
+	defaultType := defaultTransactionType()
+	for _, txn := range transactions {
+		if !txn.Type.Valid() {
+			txn.Type = defaultType
+		}
+		txn.Category = txn.CategoryPath()
+		categorized[txn.Type] = append(categorized[txn.Type], txn)
+	}
+	return categorized
+}
+
+var errNotProcessed = errors.New("no transactions have been processed yet")
+
+type processResponse struct {
+	Transactions int          `json:"transactions"`
+	Summary      SummaryStats `json:"summary"`
+	Took         string       `json:"took"`
+	Alerts       int          `json:"alerts,omitempty"` // new transactions queued for the alert webhook
+}
+
+// ProcessHandler reads the vault directory, regenerates the ledger and stores
+// the transactions in badger, so that later requests do not re-read the files
+func ProcessHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireDB(w, db) {
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	start := time.Now()
+	tp, err := newBookkeepingProcessor(acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not create processor:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, err := tp.ReadCSVFiles(ctx)
+	if err != nil && !errors.Is(err, vault.ErrNoFiles) {
+		requestLog(r).Println("ERROR: could not read transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	if len(transactions) > 0 {
+		if err := tp.GenerateLedger(transactions, ledgerFilename); err != nil {
+			requestLog(r).Println("ERROR: could not generate ledger:", err)
+			writeJSONError(w, http.StatusInternalServerError, "could not generate ledger")
+			return
+		}
+	}
+
+	// transactions archived by the retention policy are not stored again
+	cutoff, archived, err := archivedBefore(db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not read retention cutoff:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not read retention cutoff")
+		return
+	}
+	if archived {
+		transactions, _ = splitByCutoff(transactions, cutoff)
+	}
+
+	if transactions == nil {
+		transactions = []vault.Transaction{}
+	}
+
+	webhook, alerting := alertWebhookFromEnv()
+	var previous []vault.Transaction
+	var processedBefore bool
+	if alerting {
+		if previous, processedBefore, err = storedTransactions(db, acct); err != nil {
+			requestLog(r).Println("ERROR: could not read stored transactions:", err)
+			writeJSONError(w, http.StatusInternalServerError, "could not read stored transactions")
+			return
+		}
+	}
+
+	// file counts are recorded even while the check is off, so that a
+	// baseline exists once it is enabled
+	warnings := tp.Warnings()
+	fileCounts := make(map[string]int)
+	if _, err := getJSON(db, FileCountsPrefix+acct.Name, &fileCounts); err != nil {
+		requestLog(r).Println("ERROR: could not read file counts:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not read file counts")
+		return
+	}
+	if c, ok := rowCountCheckFromEnv(); ok {
+		for _, anomaly := range c.anomalies(fileCounts, tp.FileCounts()) {
+			requestLog(r).Printf("Warning: %s", anomaly)
+			warnings = append(warnings, anomaly)
+		}
+	}
+	for file, n := range tp.FileCounts() {
+		fileCounts[file] = n
+	}
+
+	if err := storeTransactions(db, acct, transactions); err != nil {
+		requestLog(r).Println("ERROR: could not store transactions:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not store transactions")
+		return
+	}
+
+	err = db.Update(func(txn *badger.Txn) error {
+		if err := setJSON(txn, ProcessedPrefix+acct.Name, start.UTC()); err != nil {
+			return err
+		}
+		if err := setJSON(txn, WarningsPrefix+acct.Name, warningsResponse{ProcessedAt: start.UTC(), Warnings: warnings}); err != nil {
+			return err
+		}
+		if err := setJSON(txn, FileCountsPrefix+acct.Name, fileCounts); err != nil {
+			return err
+		}
+		if err := setJSON(txn, ChecksumsPrefix+acct.Name, tp.FileChecksums()); err != nil {
+			return err
+		}
+		if internalTransferMatching().enabled() {
+			// the other accounts' transfers may be matched differently now
+			return invalidateSummaries(txn)
+		}
+		return invalidateSummary(txn, acct)
+	})
+	if err != nil {
+		requestLog(r).Println("ERROR: could not store transactions:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not store transactions")
+		return
+	}
+
+	s, err := rebuildSummary(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not rebuild summary:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not rebuild summary")
+		return
+	}
+
+	resp := processResponse{Transactions: len(transactions), Summary: s}
+	switch {
+	case alerting && processedBefore:
+		resp.Alerts = queueAlerts(db, webhook, acct, previous, transactions)
+	case alerting:
+		if err := seedAlerts(db, webhook, acct, transactions); err != nil {
+			requestLog(r).Println("ERROR: could not save alert marks:", err)
+		}
+	}
+	resp.Took = time.Since(start).String()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// RecalculateHandler recomputes the cached summary from the transactions
+// already stored in badger, without reading the vault directory
+func RecalculateHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireDB(w, db) {
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	start := time.Now()
+	s, err := rebuildSummary(ctx, db, acct)
+	if errors.Is(err, errNotProcessed) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		requestLog(r).Println("ERROR: could not rebuild summary:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not rebuild summary")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, processResponse{
+		Transactions: s.TotalTransactions,
+		Summary:      s,
+		Took:         time.Since(start).String(),
+	})
+}
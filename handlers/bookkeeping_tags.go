@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// TagsPrefix is the badger prefix for the tags of transactions, keyed by
+	// transaction ID
+	TagsPrefix string = "bookkeeping-tags-"
+)
+
+// maxTagLength is the longest tag accepted, in bytes
+const maxTagLength = 64
+
+// loadTags returns the stored tags of every tagged transaction
+func loadTags(db *badger.DB) (map[string][]string, error) {
+	tags := make(map[string][]string)
+	var decodeErr error
+	err := forEachWithPrefix(db, TagsPrefix, func(id string, val []byte) {
+		var t []string
+		if err := json.Unmarshal(val, &t); err != nil {
+			decodeErr = fmt.Errorf("could not parse tags of %s: %v", id, err)
+			return
+		}
+		tags[id] = t
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, decodeErr
+}
+
+// applyTags sets the tags of the tagged transactions
+func applyTags(transactions []vault.Transaction, tags map[string][]string) {
+	for i := range transactions {
+		transactions[i].Tags = tags[transactions[i].TransactionID]
+	}
+}
+
+// hasTag reports whether tags contains tag
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// withTag returns tags with tag added, keeping them sorted
+func withTag(tags []string, tag string) []string {
+	tags = append(append([]string{}, tags...), tag)
+	sort.Strings(tags)
+	return tags
+}
+
+// withoutTag returns tags with tag removed
+func withoutTag(tags []string, tag string) []string {
+	var kept []string
+	for _, t := range tags {
+		if t != tag {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+type tagRequest struct {
+	transactionFilter
+	MinAmount *vault.Money `json:"min_amount"` // inclusive bounds on the signed amount
+	MaxAmount *vault.Money `json:"max_amount"`
+	Tag       string       `json:"tag"`
+}
+
+func (req *tagRequest) validate() error {
+	if err := req.transactionFilter.validate(); err != nil {
+		return err
+	}
+	if req.transactionFilter == (transactionFilter{}) && req.MinAmount == nil && req.MaxAmount == nil {
+		return errors.New("at least one of from, to, query, min_amount or max_amount is required")
+	}
+	if req.MinAmount != nil && req.MaxAmount != nil && *req.MinAmount > *req.MaxAmount {
+		return fmt.Errorf("min_amount %v is above max_amount %v", *req.MinAmount, *req.MaxAmount)
+	}
+
+	req.Tag = strings.TrimSpace(req.Tag)
+	switch {
+	case req.Tag == "":
+		return errors.New("tag is required")
+	case len(req.Tag) > maxTagLength:
+		return fmt.Errorf("tag must be at most %d bytes long", maxTagLength)
+	case strings.Contains(req.Tag, ","):
+		return errors.New("tag must not contain commas")
+	}
+	return nil
+}
+
+func (req tagRequest) matches(txn vault.Transaction) bool {
+	if !req.transactionFilter.matches(txn) {
+		return false
+	}
+	if req.MinAmount != nil && txn.Amount < *req.MinAmount {
+		return false
+	}
+	if req.MaxAmount != nil && txn.Amount > *req.MaxAmount {
+		return false
+	}
+	return true
+}
+
+type tagResponse struct {
+	Tag            string   `json:"tag"`
+	Changed        int      `json:"changed"`
+	Skipped        int      `json:"skipped"`         // matches without a transaction ID, which cannot be tagged
+	TransactionIDs []string `json:"transaction_ids"` // transactions whose tags changed
+}
+
+// TagsHandler adds a tag to every transaction matching a filter on POST and
+// removes it on DELETE. Tags are stored by transaction ID, so they survive
+// reprocessing the vault. Transactions that already have the tag, or do not
+// have it when it is removed, are left alone, so repeating a request changes
+// nothing, and the IDs of the changed transactions are reported so that the
+// change can be undone.
+func TagsHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "POST, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireDB(w, db) {
+		return
+	}
+
+	add := r.Method == http.MethodPost
+
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "request body must be JSON")
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	audit := newAuditLog(r, acct)
+	action, oldValue, newValue := auditTag, "", req.Tag
+	if !add {
+		action, oldValue, newValue = auditUntag, req.Tag, ""
+	}
+
+	resp := tagResponse{Tag: req.Tag, TransactionIDs: []string{}}
+	err = db.Update(func(txn *badger.Txn) error {
+		for _, t := range transactions {
+			if !req.matches(t) || hasTag(t.Tags, req.Tag) == add {
+				continue
+			}
+			if t.TransactionID == "" {
+				resp.Skipped++
+				continue
+			}
+
+			tags := withoutTag(t.Tags, req.Tag)
+			if add {
+				tags = withTag(t.Tags, req.Tag)
+			}
+			key := TagsPrefix + t.TransactionID
+			if len(tags) == 0 {
+				err = txn.Delete([]byte(key))
+			} else {
+				err = setJSON(txn, key, tags)
+			}
+			if err != nil {
+				return err
+			}
+
+			resp.TransactionIDs = append(resp.TransactionIDs, t.TransactionID)
+			audit.add(action, t.TransactionID, oldValue, newValue)
+		}
+
+		// tags do not change summaries, only the pages listing transactions
+		if len(resp.TransactionIDs) > 0 {
+			for _, a := range accounts() {
+				if err := touchAccount(txn, a); err != nil {
+					return err
+				}
+			}
+		}
+		return audit.write(txn)
+	})
+	if err != nil {
+		requestLog(r).Println("ERROR: could not save tags:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not save tags")
+		return
+	}
+
+	resp.Changed = len(resp.TransactionIDs)
+	writeJSON(w, http.StatusOK, resp)
+}
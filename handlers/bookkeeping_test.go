@@ -0,0 +1,3392 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/check"
+	"github.com/gojp/goreportcard/vault"
+)
+
+func TestCalculateSummary(t *testing.T) {
+	categorized := map[vault.TransactionType][]vault.Transaction{
+		vault.PaymentTransaction:       {{Amount: vault.MoneyFromFloat(100.50)}, {Amount: vault.MoneyFromFloat(250.00)}},
+		vault.TransferTransaction:      {{Amount: vault.MoneyFromFloat(-50.00)}},
+		vault.FeeTransaction:           {{Amount: vault.MoneyFromFloat(-2.50)}},
+		vault.UncategorizedTransaction: {{Amount: vault.MoneyFromFloat(-8.00)}},
+	}
+
+	s := calculateSummary(categorized)
+	if s.TotalTransactions != 5 {
+		t.Errorf("TotalTransactions = %d, want 5", s.TotalTransactions)
+	}
+	if s.TotalUncategorized != 1 {
+		t.Errorf("TotalUncategorized = %d, want 1", s.TotalUncategorized)
+	}
+	if s.PaymentsSum != vault.MoneyFromFloat(350.50) {
+		t.Errorf("PaymentsSum = %v, want 350.50", s.PaymentsSum)
+	}
+	if s.NetLiquidity != vault.MoneyFromFloat(290) {
+		t.Errorf("NetLiquidity = %v, want 290", s.NetLiquidity)
+	}
+}
+
+func TestCalculateSummaryFormattedAmounts(t *testing.T) {
+	summary := func(csv string) SummaryStats {
+		t.Helper()
+		db := setupBookkeeping(t, csv)
+		_, categorized, err := loadTransactions(context.Background(), db, accounts()[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return calculateSummary(categorized)
+	}
+
+	s := summary("Date,Type,Amount,Description,Transaction ID\n" +
+		"2024-01-15,Payment,\"$1,234.56\",Sale,TXN001\n" +
+		"2024-01-16,Payment,CHF 1'000.00,Sale,TXN002\n" +
+		"2024-01-17,Fee,(4.56),Processing fee,TXN003\n")
+	if s.PaymentsSum != vault.MoneyFromFloat(2234.56) || s.NetLiquidity != vault.MoneyFromFloat(2230) {
+		t.Errorf("PaymentsSum = %v and NetLiquidity = %v, want 2234.56 and 2230", s.PaymentsSum, s.NetLiquidity)
+	}
+
+	t.Setenv("AMOUNT_LOCALE", "eu")
+	s = summary("Date,Type,Amount,Description,Transaction ID\n" +
+		"2024-01-15,Payment,\"1.234,56 €\",Sale,TXN001\n" +
+		"2024-01-16,Payment,\"1,5\",Sale,TXN002\n")
+	if s.PaymentsSum != vault.MoneyFromFloat(1236.06) {
+		t.Errorf("AMOUNT_LOCALE=eu: PaymentsSum = %v, want 1236.06", s.PaymentsSum)
+	}
+}
+
+func TestSummaryVsAverage(t *testing.T) {
+	t.Setenv("REPORTING_TIMEZONE", "UTC")
+	t.Setenv("SUMMARY_AVERAGE_MONTHS", "2")
+	month := func(m time.Month) time.Time { return time.Date(2024, m, 10, 0, 0, 0, 0, time.UTC) }
+
+	first := calculateSummary(map[vault.TransactionType][]vault.Transaction{
+		vault.FeeTransaction: {{Amount: vault.MoneyFromFloat(-10.00), Timestamp: month(time.January)}},
+	})
+	for _, c := range first.VsAverage {
+		if c.Months != 0 || c.Average != nil || c.Deviation != nil || c.DeviationPercent != nil {
+			t.Errorf("first month %s comparison = %+v, want it unavailable", c.Category, c)
+		}
+	}
+
+	// February has no fees and counts as zero; January falls outside the window
+	s := calculateSummary(map[vault.TransactionType][]vault.Transaction{
+		vault.FeeTransaction: {
+			{Amount: vault.MoneyFromFloat(-100.00), Timestamp: month(time.January)},
+			{Amount: vault.MoneyFromFloat(-20.00), Timestamp: month(time.March)},
+			{Amount: vault.MoneyFromFloat(-15.00), Timestamp: month(time.April)},
+		},
+		vault.PaymentTransaction: {{Amount: vault.MoneyFromFloat(50.00), Timestamp: month(time.March)}},
+	})
+	got := make(map[vault.TransactionType]averageComparison)
+	for _, c := range s.VsAverage {
+		got[c.Category] = c
+	}
+
+	fees := got[vault.FeeTransaction]
+	if fees.Month != "2024-04" || fees.Months != 2 || fees.Current != vault.MoneyFromFloat(15) || *fees.Average != vault.MoneyFromFloat(10) || *fees.Deviation != vault.MoneyFromFloat(5) || *fees.DeviationPercent != 50 {
+		t.Errorf("fees comparison = %+v, want 15 in 2024-04, 5 (50%%) above the average of 10", fees)
+	}
+	payments := got[vault.PaymentTransaction]
+	if *payments.Average != vault.MoneyFromFloat(25) || *payments.Deviation != vault.MoneyFromFloat(-25) || *payments.DeviationPercent != -100 {
+		t.Errorf("payments comparison = %+v, want 25 (100%%) below the average of 25", payments)
+	}
+	transfers := got[vault.TransferTransaction]
+	if transfers.Average == nil || *transfers.Average != 0 || transfers.DeviationPercent != nil {
+		t.Errorf("transfers comparison = %+v, want a zero average without a percentage", transfers)
+	}
+}
+
+func TestCategoryColors(t *testing.T) {
+	t.Setenv("CATEGORY_COLORS", "Fees=#E74C3C, Travel=#f80")
+
+	colors := categoryColors()
+	if colors["Fees"] != "#e74c3c" || colors["Travel"] != "#f80" {
+		t.Errorf("colors = %v, want the configured Fees and Travel colors", colors)
+	}
+	for _, c := range []string{"Payments", "Transfers", "Uncategorized"} {
+		if colors[c] != paletteColor(c) || !hexColor.MatchString(colors[c]) {
+			t.Errorf("%s color = %q, want the generated %q", c, colors[c], paletteColor(c))
+		}
+	}
+	if colors["Payments"] == colors["Transfers"] {
+		t.Errorf("Payments and Transfers share the color %s", colors["Payments"])
+	}
+
+	if got := hslColor(0, 1, 0.5); got != "#ff0000" {
+		t.Errorf("hslColor(0, 1, 0.5) = %s, want #ff0000", got)
+	}
+	for _, spec := range []string{"Fees", "Fees=red", "=#fff"} {
+		if _, err := parseCategoryColors(spec); err == nil {
+			t.Errorf("parseCategoryColors(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestEffectiveConfigHandler(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("REPORTING_TIMEZONE", "Europe/Oslo")
+	t.Setenv("LEDGER_HISTORY", "many")
+	t.Setenv("ALERT_WEBHOOK_URL", "https://hooks.example.com/T000/secret")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI")
+	t.Setenv("RULES_FILE", filepath.Join(dir, "rules.json"))
+	t.Setenv("NORMALIZATION_FILE", filepath.Join(dir, "normalization.json"))
+	if err := os.WriteFile(filepath.Join(dir, "rules.json"), []byte(`[{"pattern": "^hosting", "type": "Fees"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	EffectiveConfigHandler(rec, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "secret") || strings.Contains(body, "wJalrXUtnFEMI") {
+		t.Errorf("response includes a secret: %s", body)
+	}
+
+	var resp struct {
+		Settings []configSetting `json:"settings"`
+		Files    []configFile    `json:"files"`
+		Grading  gradingConfig   `json:"grading"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	settings := make(map[string]configSetting)
+	for _, s := range resp.Settings {
+		settings[s.Name] = s
+	}
+	for _, tt := range []struct {
+		name   string
+		value  interface{}
+		source string
+	}{
+		{"REPORTING_TIMEZONE", "Europe/Oslo", configFromEnv},
+		{"SOURCE_TIMEZONE", "UTC", configFromDefault},
+		{"LEDGER_HISTORY", float64(ledgerHistory()), configFromEnv}, // invalid, so the default is in effect
+		{"ALERT_WEBHOOK_URL", redacted, configFromEnv},
+		{"AWS_SECRET_ACCESS_KEY", redacted, configFromEnv},
+		{"AWS_SESSION_TOKEN", "", configFromDefault},
+	} {
+		s := settings[tt.name]
+		if s.Value != tt.value || s.Source != tt.source {
+			t.Errorf("%s = %v from %s, want %v from %s", tt.name, s.Value, s.Source, tt.value, tt.source)
+		}
+	}
+	if s := settings["LEDGER_HISTORY"]; s.Raw != "many" {
+		t.Errorf("LEDGER_HISTORY raw = %q, want the value as set", s.Raw)
+	}
+
+	if len(resp.Files) != 2 || resp.Files[0].Source != configFromFile || resp.Files[1].Source != configFromDefault {
+		t.Errorf("files = %+v, want the rules from their file and the default normalization", resp.Files)
+	}
+	if resp.Grading.Weights["gofmt"] <= 0 || resp.Grading.Thresholds[check.GradeA] != check.DefaultThresholds[check.GradeA] {
+		t.Errorf("grading = %+v, want the default weights and thresholds", resp.Grading)
+	}
+}
+
+// TestRoundAmounts tests that amounts are rounded to the configured number
+// of decimal places in the JSON API, and only there.
+func TestRoundAmounts(t *testing.T) {
+	amount := vault.MoneyFromFloat(1.23456)
+	resp := struct {
+		Summary      SummaryStats
+		Transactions []vault.Transaction
+		Totals       map[vault.TransactionType]vault.Money
+		Balance      *vault.Money
+	}{
+		Summary:      SummaryStats{PaymentsSum: amount},
+		Transactions: []vault.Transaction{{Amount: -amount, Timestamp: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}},
+		Totals:       map[vault.TransactionType]vault.Money{vault.FeeTransaction: amount},
+		Balance:      &amount,
+	}
+
+	for decimals, want := range map[int]string{0: "1.00", 2: "1.23", 3: "1.235", 8: "1.23456"} {
+		b, err := json.Marshal(roundAmounts(resp, decimals))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range []string{`"payments_sum":"` + want + `"`, `"amount":"-` + want + `"`, `"Fees":"` + want + `"`, `"Balance":"` + want + `"`, `"timestamp":"2024-01-15T00:00:00Z"`} {
+			if !strings.Contains(string(b), field) {
+				t.Errorf("with %d decimals, %s does not contain %s", decimals, b, field)
+			}
+		}
+	}
+	if resp.Summary.PaymentsSum != amount || resp.Transactions[0].Amount != -amount || *resp.Balance != amount {
+		t.Errorf("roundAmounts changed its argument: %+v", resp)
+	}
+}
+
+// TestMoneySums tests that sums of amounts are exact, unlike those of float64.
+func TestMoneySums(t *testing.T) {
+	var txns []vault.Transaction
+	for i := 0; i < 1000; i++ {
+		txns = append(txns, vault.Transaction{Amount: vault.MoneyFromFloat(0.10)}, vault.Transaction{Amount: vault.MoneyFromFloat(0.20)})
+	}
+	txns = append(txns, vault.Transaction{Amount: vault.MoneyFromFloat(-300.000001)}, vault.Transaction{Amount: vault.MoneyFromFloat(9999999999.99)}, vault.Transaction{Amount: vault.MoneyFromFloat(-9999999999.99)})
+	s := calculateSummary(map[vault.TransactionType][]vault.Transaction{vault.PaymentTransaction: txns})
+	if s.PaymentsSum != -1 || s.NetLiquidity != -1 {
+		t.Errorf("PaymentsSum = %v (%d), want exactly -0.000001", s.PaymentsSum, int64(s.PaymentsSum))
+	}
+	if s.AmountOverflow {
+		t.Error("AmountOverflow = true, want false")
+	}
+
+	// a sum too large to hold is capped, not wrapped around to a negative
+	big := vault.Transaction{Amount: vault.MoneyFromFloat(9e12)}
+	s = calculateSummary(map[vault.TransactionType][]vault.Transaction{vault.PaymentTransaction: {big, big}})
+	if s.PaymentsSum != math.MaxInt64 || s.NetLiquidity != math.MaxInt64 || !s.AmountOverflow {
+		t.Errorf("PaymentsSum = %d, NetLiquidity = %d, AmountOverflow = %t, want both %d and true", s.PaymentsSum, s.NetLiquidity, s.AmountOverflow, int64(math.MaxInt64))
+	}
+}
+
+// setupBookkeeping points the bookkeeping handlers at a temporary vault
+// containing the given CSV and returns an in-memory badger database
+func setupBookkeeping(t testing.TB, csv string) *badger.DB {
+	t.Helper()
+
+	dir := t.TempDir()
+	vaultPath := filepath.Join(dir, "vault")
+	if err := os.MkdirAll(vaultPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultPath, "transactions.csv"), []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("VAULT_DIR", vaultPath)
+	t.Setenv("LEDGER_DIR", filepath.Join(dir, "ledger"))
+	t.Setenv("RULES_FILE", filepath.Join(dir, "rules.json"))
+	t.Setenv("NORMALIZATION_FILE", filepath.Join(dir, "normalization.json"))
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+const testCSV = `Date,Type,Amount,Description,Transaction ID
+2024-01-15,Payment,100.50,Product sale payment,TXN001
+2024-01-16,Transfer,-50.00,Bank transfer,TXN002
+2024-01-17,Fee,-2.99,PayPal processing fee,TXN003
+2024-02-03,Other,-12.00,Hosting invoice,TXN004
+2024-03-03,Other,-12.00,Hosting invoice,TXN005
+`
+
+func TestRecategorizeHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	recategorize := func(body string) (int, recategorizeResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/bookkeeping/recategorize", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		RecategorizeHandler(rec, req, db)
+
+		var resp recategorizeResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := recategorize(`{"from": "2024-02-01", "query": "hosting", "type": "Fees"}`)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if resp.Changed != 2 {
+		t.Errorf("changed = %d, want 2", resp.Changed)
+	}
+	for _, c := range resp.Changes {
+		if c.OldType != vault.UncategorizedTransaction || c.NewType != vault.FeeTransaction {
+			t.Errorf("unexpected change %+v", c)
+		}
+	}
+
+	_, resp = recategorize(`{"query": "hosting", "type": "Fees"}`)
+	if resp.Changed != 0 {
+		t.Errorf("repeated request changed = %d, want 0", resp.Changed)
+	}
+
+	_, categorized, err := loadTransactions(context.Background(), db, accounts()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(categorized[vault.FeeTransaction]); got != 3 {
+		t.Errorf("fees after recategorization = %d, want 3", got)
+	}
+
+	for _, body := range []string{
+		`{"type": "Fees"}`,
+		`{"query": "hosting", "type": "Snacks"}`,
+		`{"from": "2024-03-01", "to": "2024-02-01", "type": "Fees"}`,
+		`{"from": "03/01/2024", "type": "Fees"}`,
+	} {
+		if code, _ := recategorize(body); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", body, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestTransactionHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	patch := func(id, body string) (int, categoryChange) {
+		req := httptest.NewRequest(http.MethodPatch, transactionPath+id, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		TransactionHandler(rec, req, db)
+
+		var change categoryChange
+		json.Unmarshal(rec.Body.Bytes(), &change)
+		return rec.Code, change
+	}
+
+	code, change := patch("TXN004", `{"type": "Fees"}`)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if change.OldType != vault.UncategorizedTransaction || change.NewType != vault.FeeTransaction {
+		t.Errorf("change = %+v, want Uncategorized to Fees", change)
+	}
+
+	rec := httptest.NewRecorder()
+	ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("process status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var processed processResponse
+	json.Unmarshal(rec.Body.Bytes(), &processed)
+	if s := processed.Summary; s.TotalFees != 2 || s.FeesSum != vault.MoneyFromFloat(-14.99) || s.TotalUncategorized != 1 {
+		t.Errorf("summary after reprocessing = %+v, want the override applied", s)
+	}
+
+	for _, tt := range []struct {
+		id, body string
+		want     int
+	}{
+		{"TXN999", `{"type": "Fees"}`, http.StatusNotFound},
+		{"", `{"type": "Fees"}`, http.StatusNotFound},
+		{"TXN004", `{"type": "Snacks"}`, http.StatusBadRequest},
+		{"TXN004", `not json`, http.StatusBadRequest},
+	} {
+		if code, _ := patch(tt.id, tt.body); code != tt.want {
+			t.Errorf("PATCH %s %s: status = %d, want %d", tt.id, tt.body, code, tt.want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	TransactionHandler(rec, httptest.NewRequest(http.MethodPost, transactionPath+"TXN004", nil), db)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestSplitHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	split := func(method, id, body string) (int, splitResponse) {
+		rec := httptest.NewRecorder()
+		SplitHandler(rec, httptest.NewRequest(method, splitPath+id, strings.NewReader(body)), db)
+		var resp splitResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := split(http.MethodPost, "TXN004", `{"parts": [{"amount": "-9,00", "type": "Fees", "description": "Hosting fee"}, {"amount": "-3.00", "type": "Uncategorized"}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if len(resp.Parts) != 2 || resp.Parts[0].TransactionID != "TXN004-1" || resp.Parts[0].Amount != vault.MoneyFromFloat(-9.00) || resp.Parts[1].Description != "Hosting invoice" || resp.Parts[1].SplitFrom != "TXN004" {
+		t.Errorf("parts = %+v, want TXN004-1 and TXN004-2", resp.Parts)
+	}
+
+	rec := httptest.NewRecorder()
+	ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("process status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var processed processResponse
+	json.Unmarshal(rec.Body.Bytes(), &processed)
+	if s := processed.Summary; s.TotalFees != 2 || s.FeesSum != vault.MoneyFromFloat(-11.99) || s.TotalUncategorized != 2 || s.UncategorizedSum != vault.MoneyFromFloat(-15) {
+		t.Errorf("summary after reprocessing = %+v, want the split applied", s)
+	}
+
+	// the parts are listed in place of the transaction
+	transactions, _, err := loadTransactions(context.Background(), db, accounts()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, txn := range transactions {
+		ids = append(ids, txn.TransactionID)
+	}
+	if want := []string{"TXN001", "TXN002", "TXN003", "TXN004-1", "TXN004-2", "TXN005"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("transactions = %v, want %v", ids, want)
+	}
+
+	for _, tt := range []struct {
+		method, id, body string
+		want             int
+	}{
+		{http.MethodPost, "TXN004", `{"parts": [{"amount": "-9.00", "type": "Fees"}, {"amount": "-2.00", "type": "Fees"}]}`, http.StatusBadRequest},
+		{http.MethodPost, "TXN004", `{"parts": [{"amount": "-12.00", "type": "Fees"}]}`, http.StatusBadRequest},
+		{http.MethodPost, "TXN004", `{"parts": [{"amount": "-9.00", "type": "Snacks"}, {"amount": "-3.00", "type": "Fees"}]}`, http.StatusBadRequest},
+		{http.MethodPost, "TXN999", `{"parts": []}`, http.StatusNotFound},
+		{http.MethodDelete, "TXN005", "", http.StatusNotFound},
+		{http.MethodGet, "TXN004", "", http.StatusMethodNotAllowed},
+	} {
+		if code, _ := split(tt.method, tt.id, tt.body); code != tt.want {
+			t.Errorf("%s %s %s: status = %d, want %d", tt.method, tt.id, tt.body, code, tt.want)
+		}
+	}
+
+	if code, _ := split(http.MethodDelete, "TXN004", ""); code != http.StatusOK {
+		t.Fatalf("DELETE status = %d, want %d", code, http.StatusOK)
+	}
+	s, err := rebuildSummary(context.Background(), db, accounts()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TotalFees != 1 || s.TotalUncategorized != 2 || s.UncategorizedSum != vault.MoneyFromFloat(-24) {
+		t.Errorf("summary after removing the split = %+v, want TXN004 whole again", s)
+	}
+}
+
+const feesCSV = `Date,Type,Amount,Description,Transaction ID,Reference Txn ID
+2024-01-15,Payment,100.00,Product sale payment,PAY1,
+2024-01-15,Fee,-3.20,PayPal processing fee,FEE1,PAY1
+2024-01-20,Payment,50.00,Product sale payment,PAY2,
+2024-01-20,Fee,-1.75,PayPal processing fee,FEE2,
+2024-02-10,Fee,-5.00,PayPal monthly fee,FEE3,
+`
+
+func TestFeeAssociation(t *testing.T) {
+	db := setupBookkeeping(t, feesCSV)
+
+	summary := func() SummaryStats {
+		_, categorized, err := loadTransactions(context.Background(), db, accounts()[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return calculateSummary(categorized)
+	}
+
+	// by default only the fee referring to its payment is associated
+	s := summary()
+	if s.GrossPayments != vault.MoneyFromFloat(150) || s.NetPayments != vault.MoneyFromFloat(146.80) || s.UnassociatedFeesSum != vault.MoneyFromFloat(-6.75) {
+		t.Errorf("gross, net, unassociated = %v, %v, %v, want 150, 146.80, -6.75", s.GrossPayments, s.NetPayments, s.UnassociatedFeesSum)
+	}
+	if s.FeesSum != vault.MoneyFromFloat(-9.95) {
+		t.Errorf("fees sum = %v, want -9.95 with the unassociated fees", s.FeesSum)
+	}
+
+	// the fee on the day of the second payment is associated by proximity,
+	// the monthly fee is too far from any payment
+	t.Setenv("FEE_ASSOCIATION", "reference,proximity")
+	s = summary()
+	if s.NetPayments != vault.MoneyFromFloat(145.05) || s.UnassociatedFeesSum != vault.MoneyFromFloat(-5) {
+		t.Errorf("net, unassociated = %v, %v, want 145.05, -5", s.NetPayments, s.UnassociatedFeesSum)
+	}
+
+	rec := httptest.NewRecorder()
+	BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping?net=true", nil), db)
+	var resp bookkeepingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	net := make(map[string]string)
+	for _, txn := range resp.Transactions[string(vault.PaymentTransaction)] {
+		if txn.NetAmount != nil {
+			net[txn.TransactionID] = txn.NetAmount.String()
+		}
+	}
+	if want := map[string]string{"PAY1": "96.80", "PAY2": "48.25"}; !reflect.DeepEqual(net, want) {
+		t.Errorf("net amounts = %v, want %v", net, want)
+	}
+
+	t.Setenv("FEE_ASSOCIATION", "none")
+	if s := summary(); s.NetPayments != s.GrossPayments {
+		t.Errorf("net payments = %v without association, want the gross %v", s.NetPayments, s.GrossPayments)
+	}
+}
+
+func TestFeeTiers(t *testing.T) {
+	for _, s := range []string{"small:1,large:10", "micro:0,small", "micro:0,micro:1", "micro:0,small:1,large:1", "micro:0,small:-1"} {
+		if _, err := parseFeeTiers(s); err == nil {
+			t.Errorf("parseFeeTiers(%q) succeeded, want an error", s)
+		}
+	}
+
+	db := setupBookkeeping(t, testCSV)
+	// the fee of 2.99 is on the lower bound of small, which includes it
+	t.Setenv("FEE_TIERS", "large:10,small:2.99,micro:0")
+
+	transactions, categorized, err := loadTransactions(context.Background(), db, accounts()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range transactions {
+		want := ""
+		if txn.TransactionID == "TXN003" {
+			want = "small"
+		}
+		if txn.FeeTier != want {
+			t.Errorf("tier of %s = %q, want %q", txn.TransactionID, txn.FeeTier, want)
+		}
+	}
+
+	var got []string
+	for _, tier := range calculateSummary(categorized).FeeTiers {
+		got = append(got, fmt.Sprintf("%s %v %d %v", tier.Name, tier.Min, tier.Count, tier.Sum))
+	}
+	// tiers without fees are listed too, in order
+	if want := []string{"micro 0.00 0 0.00", "small 2.99 1 -2.99", "large 10.00 0 0.00"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fee tiers = %v, want %v", got, want)
+	}
+}
+
+func TestSheetsExportHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	var written [][]interface{}
+	var cleared bool
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			parts := strings.Split(r.FormValue("assertion"), ".")
+			sig, _ := base64.RawURLEncoding.DecodeString(parts[len(parts)-1])
+			sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if len(parts) != 3 || rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig) != nil {
+				http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "token-1", "expires_in": 3600}`)
+		case r.Header.Get("Authorization") != "Bearer token-1":
+			http.Error(w, `{"error": "unauthenticated"}`, http.StatusUnauthorized)
+		case r.Method == http.MethodPost && r.URL.Path == "/v4/spreadsheets/sheet-1/values/'Finance':clear":
+			cleared = true
+			fmt.Fprint(w, `{}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/v4/spreadsheets/sheet-1/values/'Finance'!A1":
+			var body struct {
+				Values [][]interface{} `json:"values"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			written = body.Values
+			fmt.Fprintf(w, `{"updatedRows": %d}`, len(body.Values))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	export := func(query string) (int, sheetsExportResponse) {
+		rec := httptest.NewRecorder()
+		SheetsExportHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/sheets"+query, nil), db)
+		var resp sheetsExportResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	// a dry run needs no credentials
+	code, resp := export("?dry_run=true")
+	if code != http.StatusOK || !resp.DryRun || len(resp.Rows) != 15 {
+		t.Fatalf("dry run = %d with %d rows, want %d with 15: %+v", code, len(resp.Rows), http.StatusOK, resp.Rows)
+	}
+	if got := fmt.Sprint(resp.Rows[12]); got != "[2024-01 100.5 -50 -2.99 0 47.51]" {
+		t.Errorf("first month = %s, want its totals per category", got)
+	}
+	if code, _ := export(""); code != http.StatusConflict {
+		t.Errorf("export without credentials = %d, want %d", code, http.StatusConflict)
+	}
+
+	creds, _ := json.Marshal(map[string]string{"client_email": "export@example.iam.gserviceaccount.com", "private_key": privateKey, "token_uri": api.URL + "/token"})
+	t.Setenv("GOOGLE_SHEETS_CREDENTIALS", string(creds))
+	t.Setenv("GOOGLE_SHEETS_SPREADSHEET_ID", "sheet-1")
+	t.Setenv("GOOGLE_SHEETS_SHEET", "Finance")
+	t.Setenv("GOOGLE_SHEETS_ENDPOINT", api.URL)
+
+	code, resp = export("")
+	if code != http.StatusOK || resp.UpdatedRows != 15 || !cleared || len(written) != 15 {
+		t.Fatalf("export = %d %+v, cleared %v, wrote %d rows, want 15 rows written to a cleared sheet", code, resp, cleared, len(written))
+	}
+	if got := fmt.Sprint(written[9]); got != "[Net liquidity 5 23.51]" {
+		t.Errorf("net liquidity row = %s", got)
+	}
+
+	t.Setenv("GOOGLE_SHEETS_CREDENTIALS", `{"client_email": "export@example.com", "private_key": "not a key"}`)
+	rec := httptest.NewRecorder()
+	SheetsExportHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/sheets", nil), db)
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "not a key") {
+		t.Errorf("export with an invalid key = %d %s, want an error without the key", rec.Code, rec.Body)
+	}
+}
+
+func TestTagsHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	tag := func(method, body string) (int, tagResponse) {
+		rec := httptest.NewRecorder()
+		TagsHandler(rec, httptest.NewRequest(method, "/api/bookkeeping/tags", strings.NewReader(body)), db)
+		var resp tagResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+	tagsOf := func() map[string][]string {
+		transactions, _, err := loadTransactions(context.Background(), db, accounts()[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags := make(map[string][]string)
+		for _, txn := range transactions {
+			if len(txn.Tags) > 0 {
+				tags[txn.TransactionID] = txn.Tags
+			}
+		}
+		return tags
+	}
+
+	code, resp := tag(http.MethodPost, `{"query": "hosting", "tag": "infra"}`)
+	if code != http.StatusOK || resp.Changed != 2 || !reflect.DeepEqual(resp.TransactionIDs, []string{"TXN004", "TXN005"}) {
+		t.Fatalf("tag = %d %+v, want TXN004 and TXN005 tagged", code, resp)
+	}
+	if _, resp := tag(http.MethodPost, `{"query": "hosting", "tag": "infra"}`); resp.Changed != 0 {
+		t.Errorf("tagging again changed %v, want nothing", resp.TransactionIDs)
+	}
+	if _, resp := tag(http.MethodPost, `{"min_amount": -20, "max_amount": -2, "tag": "small"}`); !reflect.DeepEqual(resp.TransactionIDs, []string{"TXN003", "TXN004", "TXN005"}) {
+		t.Errorf("tagging by amount changed %v, want TXN003, TXN004 and TXN005", resp.TransactionIDs)
+	}
+
+	// tags survive reprocessing
+	rec := httptest.NewRecorder()
+	ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("process status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	want := map[string][]string{"TXN003": {"small"}, "TXN004": {"infra", "small"}, "TXN005": {"infra", "small"}}
+	if got := tagsOf(); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags after reprocessing = %v, want %v", got, want)
+	}
+
+	if _, resp := tag(http.MethodDelete, `{"from": "2024-03-01", "tag": "infra"}`); !reflect.DeepEqual(resp.TransactionIDs, []string{"TXN005"}) {
+		t.Errorf("untag changed %v, want TXN005", resp.TransactionIDs)
+	}
+	want["TXN005"] = []string{"small"}
+	if got := tagsOf(); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags after untagging = %v, want %v", got, want)
+	}
+
+	for _, body := range []string{`{"tag": "infra"}`, `{"query": "hosting"}`, `{"query": "hosting", "tag": "a,b"}`, `{"min_amount": 5, "max_amount": 1, "tag": "x"}`, `not json`} {
+		if code, _ := tag(http.MethodPost, body); code != http.StatusBadRequest {
+			t.Errorf("POST %s: status = %d, want %d", body, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestApplySplitsMismatch(t *testing.T) {
+	transactions := []vault.Transaction{{TransactionID: "TXN001", Amount: vault.MoneyFromFloat(-10.00)}}
+	parts := map[string][]splitPart{"TXN001": {{Amount: vault.MoneyFromFloat(-6.00), Type: vault.FeeTransaction}, {Amount: vault.MoneyFromFloat(-3.00), Type: vault.PaymentTransaction}}}
+	if got := applySplits(transactions, parts); len(got) != 1 || got[0].TransactionID != "TXN001" {
+		t.Errorf("applySplits = %+v, want the transaction kept whole when its parts do not sum to it", got)
+	}
+}
+
+func TestPreviewHandler(t *testing.T) {
+	setupBookkeeping(t, testCSV)
+
+	preview := func(query string) (int, previewResponse) {
+		rec := httptest.NewRecorder()
+		PreviewHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/preview"+query, nil))
+
+		var resp previewResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := preview("?file=transactions.csv&rows=2")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if len(resp.Files) != 1 || len(resp.Files[0].Transactions) != 2 || !resp.Files[0].Truncated {
+		t.Errorf("files = %+v, want the first 2 transactions of transactions.csv", resp.Files)
+	}
+	if got := resp.Files[0].Header["transaction_id"]; got != "Transaction ID" {
+		t.Errorf("transaction_id header = %q, want %q", got, "Transaction ID")
+	}
+
+	if _, resp := preview("?rows=100000"); resp.Rows != maxPreviewRows {
+		t.Errorf("rows = %d, want it capped to %d", resp.Rows, maxPreviewRows)
+	}
+	if _, resp := preview(""); resp.Rows != defaultPreviewRows || len(resp.Files[0].Transactions) != 5 {
+		t.Errorf("default preview = %+v, want all 5 transactions", resp)
+	}
+
+	for query, want := range map[string]int{
+		"?rows=0":           http.StatusBadRequest,
+		"?rows=ten":         http.StatusBadRequest,
+		"?file=missing.csv": http.StatusNotFound,
+	} {
+		if code, _ := preview(query); code != want {
+			t.Errorf("%s: status = %d, want %d", query, code, want)
+		}
+	}
+}
+
+func TestProcessAlerts(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	var mu sync.Mutex
+	var requests int
+	var alerted []string
+	release := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var alert transactionAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		alerted = append(alerted, alert.Transaction.TransactionID)
+	}))
+	defer webhook.Close()
+
+	t.Setenv("ALERT_WEBHOOK_URL", webhook.URL)
+	t.Setenv("ALERT_MIN_AMOUNT", "50")
+	t.Setenv("ALERT_RETRY_DELAY", "1ms")
+
+	process := func() processResponse {
+		rec := httptest.NewRecorder()
+		ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("process status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var resp processResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// the first run marks the history as alerted without posting it
+	if resp := process(); resp.Alerts != 0 {
+		t.Errorf("alerts on the first run = %d, want 0", resp.Alerts)
+	}
+	alertJobs.wait()
+	if requests != 0 {
+		t.Errorf("first run posted %d alerts, want none", requests)
+	}
+
+	csv := testCSV + "2024-03-04,Payment,75.00,Large order,TXN006\n2024-03-05,Payment,-80.00,Large refund,TXN007\n"
+	if err := os.WriteFile(filepath.Join(os.Getenv("VAULT_DIR"), "transactions.csv"), []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// processing returns before the webhook, which is held back, responds
+	if resp := process(); resp.Alerts != 2 {
+		t.Errorf("alerts = %d, want the new TXN006 and TXN007", resp.Alerts)
+	}
+	close(release)
+	alertJobs.wait()
+	sort.Strings(alerted)
+	if requests != 3 || strings.Join(alerted, ",") != "TXN006,TXN007" {
+		t.Errorf("alerted = %v after %d requests, want TXN006 and TXN007 after a retry", alerted, requests)
+	}
+
+	if resp := process(); resp.Alerts != 0 {
+		t.Errorf("alerts after reprocessing = %d, want 0", resp.Alerts)
+	}
+	alertJobs.wait()
+}
+
+func TestWarningsHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV+"someday,Fee,-1.00,Fee,TXN001\n")
+
+	warnings := func() warningsResponse {
+		rec := httptest.NewRecorder()
+		WarningsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/warnings", nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var resp warningsResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	if resp := warnings(); resp.Processed || resp.Count != 0 {
+		t.Errorf("warnings before processing = %+v, want none", resp)
+	}
+
+	rec := httptest.NewRecorder()
+	ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("process status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	resp := warnings()
+	if !resp.Processed || resp.ProcessedAt.IsZero() || resp.Count != 2 {
+		t.Fatalf("warnings = %+v, want the date and duplicate ID warnings of the run", resp)
+	}
+	for _, w := range resp.Warnings {
+		if w.File != "transactions.csv" || w.Line != 7 {
+			t.Errorf("warning %s, want transactions.csv:7", w)
+		}
+	}
+}
+
+func TestSelfCheckHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	selfCheck := func(query string) selfCheckResponse {
+		rec := httptest.NewRecorder()
+		SelfCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/selfcheck"+query, nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var resp selfCheckResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+	statuses := func(resp selfCheckResponse) map[string]string {
+		got := make(map[string]string)
+		for _, c := range resp.Checks {
+			got[c.Name] = c.Status
+		}
+		return got
+	}
+
+	resp := selfCheck("")
+	want := map[string]string{"schema": checkOK, "duplicates": checkOK, "checksums": checkSkipped, "signs": checkSkipped, "warnings": checkOK}
+	if resp.Status != selfCheckHealthy || !reflect.DeepEqual(statuses(resp), want) {
+		t.Errorf("self-check before processing = %s %v, want healthy %v", resp.Status, statuses(resp), want)
+	}
+
+	rec := httptest.NewRecorder()
+	ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("process status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := statuses(selfCheck(""))["checksums"]; got != checkOK {
+		t.Errorf("checksums after processing = %s, want %s", got, checkOK)
+	}
+
+	// an ingest after processing changes a file and adds a conflicting record
+	t.Setenv("SIGN_EXPECTATIONS", "Fees=outflow")
+	path := filepath.Join(vaultDir(), "transactions.csv")
+	if err := os.WriteFile(path, []byte(testCSV+"2024-02-01,Fee,2.99,Fee,TXN006\n2024-02-02,Payment,1.00,Sale,TXN001\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp = selfCheck("")
+	want = map[string]string{"schema": checkOK, "duplicates": checkIssues, "checksums": checkIssues, "signs": checkIssues, "warnings": checkOK}
+	if resp.Status != selfCheckDegraded || !reflect.DeepEqual(statuses(resp), want) {
+		t.Errorf("self-check after the ingest = %s %v, want degraded %v", resp.Status, statuses(resp), want)
+	}
+	for _, c := range resp.Checks {
+		if c.Name == "checksums" && (c.Count != 1 || c.Issues[0].Reason != "changed since the last processing run") {
+			t.Errorf("checksum issues = %v, want transactions.csv changed", c.Issues)
+		}
+	}
+
+	resp = selfCheck("?skip=duplicates,checksums,signs")
+	if resp.Status != selfCheckHealthy || statuses(resp)["checksums"] != checkSkipped {
+		t.Errorf("self-check skipping the failing checks = %s %v, want healthy", resp.Status, statuses(resp))
+	}
+
+	rec = httptest.NewRecorder()
+	SelfCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/selfcheck?skip=everything", nil), db)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status with an unknown check = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRowCountAnomalies(t *testing.T) {
+	c := rowCountCheck{Factor: 3, MinHistory: 3}
+	history := map[string]int{"bank-2024-01.csv": 200, "bank-2024-02.csv": 190, "bank-2024-03.csv": 210, "card-01.csv": 40}
+
+	got := c.anomalies(history, map[string]int{
+		"bank-2024-03.csv": 210, // compared with the other two only
+		"bank-2024-04.csv": 3,
+		"bank-2024-05.csv": 70,
+		"card-02.csv":      1, // too little history
+	})
+	if len(got) != 1 || got[0].File != "bank-2024-04.csv" || got[0].Reason != "3 transactions, expected about 200 from the average of 3 earlier files (more than 3 times off)" {
+		t.Errorf("anomalies = %v, want only bank-2024-04.csv", got)
+	}
+	if got := c.anomalies(history, map[string]int{"bank-2024-04.csv": 601}); len(got) != 1 {
+		t.Errorf("anomalies = %v, want a file with too many transactions flagged", got)
+	}
+}
+
+func TestProcessRowCountCheck(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+	t.Setenv("ROW_COUNT_FACTOR", "3")
+	t.Setenv("ROW_COUNT_MIN_HISTORY", "2")
+
+	write := func(name string, rows int) {
+		content := "Date,Type,Amount,Description,Transaction ID\n"
+		for i := 0; i < rows; i++ {
+			content += fmt.Sprintf("2024-01-15,Payment,1.00,Sale,%s-%d\n", name, i)
+		}
+		if err := os.WriteFile(filepath.Join(vaultDir(), name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	process := func() warningsResponse {
+		rec := httptest.NewRecorder()
+		ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("process status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		rec = httptest.NewRecorder()
+		WarningsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/warnings", nil), db)
+		var resp warningsResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	write("bank-1.csv", 20)
+	write("bank-2.csv", 22)
+	write("bank-3.csv", 2)
+	if resp := process(); resp.Count != 0 {
+		t.Errorf("warnings without history = %v, want none", resp.Warnings)
+	}
+
+	resp := process()
+	if resp.Count != 1 || resp.Warnings[0].File != "bank-3.csv" || !strings.Contains(resp.Warnings[0].Reason, "2 transactions, expected about 21") {
+		t.Errorf("warnings = %v, want bank-3.csv flagged against its baseline", resp.Warnings)
+	}
+}
+
+func TestVaultErrorStatus(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: /missing", vault.ErrVaultDirMissing), http.StatusServiceUnavailable},
+		{fmt.Errorf("%w: vault /v, ledger /v", vault.ErrOverlappingDirs), http.StatusServiceUnavailable},
+		{&vault.ParseError{File: "a.csv", Line: 1, Err: vault.ErrInvalidHeader}, http.StatusUnprocessableEntity},
+		{fmt.Errorf("reading CSV files cancelled: %w", context.DeadlineExceeded), http.StatusServiceUnavailable},
+		{fmt.Errorf("reading CSV files cancelled: %w", context.Canceled), http.StatusRequestTimeout},
+		{errors.New("disk on fire"), http.StatusInternalServerError},
+	} {
+		if got, _ := vaultErrorStatus(tt.err); got != tt.want {
+			t.Errorf("vaultErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestProcessAndRecalculate(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	post := func(h func(http.ResponseWriter, *http.Request, *badger.DB), path string) (int, processResponse) {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, path, nil), db)
+
+		var resp processResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	if code, _ := post(RecalculateHandler, "/api/bookkeeping/recalculate"); code != http.StatusConflict {
+		t.Errorf("recalculate before processing: status = %d, want %d", code, http.StatusConflict)
+	}
+
+	code, resp := post(ProcessHandler, "/api/bookkeeping/process")
+	if code != http.StatusOK {
+		t.Fatalf("process: status = %d, want %d", code, http.StatusOK)
+	}
+	if resp.Transactions != 5 {
+		t.Errorf("processed transactions = %d, want 5", resp.Transactions)
+	}
+
+	// files added after processing are not read by a recalculation
+	extra := "Date,Type,Amount,Description,Transaction ID\n2024-04-01,Payment,10.00,Late payment,TXN099\n"
+	if err := os.WriteFile(filepath.Join(os.Getenv("VAULT_DIR"), "extra.csv"), []byte(extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, resp = post(RecalculateHandler, "/api/bookkeeping/recalculate")
+	if code != http.StatusOK {
+		t.Fatalf("recalculate: status = %d, want %d", code, http.StatusOK)
+	}
+	if resp.Summary.TotalTransactions != 5 {
+		t.Errorf("recalculated transactions = %d, want 5", resp.Summary.TotalTransactions)
+	}
+	if resp.Summary.PaymentsSum != vault.MoneyFromFloat(100.50) {
+		t.Errorf("recalculated PaymentsSum = %v, want 100.50", resp.Summary.PaymentsSum)
+	}
+}
+
+func TestSplitVaultDirs(t *testing.T) {
+	sep := string(filepath.ListSeparator)
+	got := splitVaultDirs("s3://bank/acme" + sep + "/data/globex" + sep + "s3://bank")
+	if want := []string{"s3://bank/acme", "/data/globex", "s3://bank"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitVaultDirs = %q, want %q", got, want)
+	}
+}
+
+func TestAccountFromRequest(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("VAULT_DIR", filepath.Join(dir, "acme")+string(filepath.ListSeparator)+filepath.Join(dir, "globex"))
+	t.Setenv("LEDGER_DIR", filepath.Join(dir, "ledger"))
+
+	for _, tt := range []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{"", "acme", false},
+		{"?account=globex", "globex", false},
+		{"?entity=globex", "globex", false},
+		{"?account=initech", "", true},
+	} {
+		acct, err := accountFromRequest(httptest.NewRequest(http.MethodGet, "/api/bookkeeping"+tt.query, nil))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if acct.Name != tt.want {
+			t.Errorf("%q: account = %q, want %q", tt.query, acct.Name, tt.want)
+		}
+		if !tt.wantErr && acct.LedgerDir != filepath.Join(dir, "ledger", tt.want) {
+			t.Errorf("%q: ledger dir = %q, want it under the account name", tt.query, acct.LedgerDir)
+		}
+	}
+}
+
+func TestCheckBookkeepingDirs(t *testing.T) {
+	dir := t.TempDir()
+	sep := string(filepath.ListSeparator)
+	for _, tt := range []struct {
+		vaultDir, ledgerDir string
+		wantErr             bool
+	}{
+		{filepath.Join(dir, "vault"), filepath.Join(dir, "ledger"), false},
+		{filepath.Join(dir, "vault"), filepath.Join(dir, "vault"), true},
+		{dir, filepath.Join(dir, "ledger"), true},
+		// the globex account's ledger would be written to the acme vault
+		{filepath.Join(dir, "acme") + sep + filepath.Join(dir, "globex"), filepath.Join(dir, "acme"), true},
+	} {
+		t.Setenv("VAULT_DIR", tt.vaultDir)
+		t.Setenv("LEDGER_DIR", tt.ledgerDir)
+		if err := CheckBookkeepingDirs(); (err != nil) != tt.wantErr {
+			t.Errorf("VAULT_DIR=%s LEDGER_DIR=%s: err = %v, wantErr %v", tt.vaultDir, tt.ledgerDir, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRulesTestHandler(t *testing.T) {
+	for _, tt := range []struct {
+		body      string
+		category  vault.TransactionType
+		ruleIndex int
+	}{
+		{`{"description": "ATM withdrawal 1234", "rules": [{"pattern": "hosting", "type": "Fees"}, {"pattern": "^atm", "type": "Transfers"}]}`, vault.TransferTransaction, 1},
+		{`{"description": "Lunch", "rules": [{"pattern": "hosting", "type": "Fees"}]}`, vault.UncategorizedTransaction, -1},
+		{`{"description": "ATM 1234", "amount": "-300.00", "rules": [{"pattern": "atm", "type": "Transfers"}, {"pattern": "atm", "amount": "< -200", "type": "Fees", "priority": 1}]}`, vault.FeeTransaction, 1},
+		{`{"description": "ATM 1234", "rules": [{"pattern": "atm", "type": "Transfers"}, {"pattern": "atm", "amount": "< -200", "type": "Fees", "priority": 1}]}`, vault.TransferTransaction, 0},
+	} {
+		rec := httptest.NewRecorder()
+		RulesTestHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/rules/test", strings.NewReader(tt.body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+
+		var resp rulesTestResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Category != tt.category || resp.RuleIndex != tt.ruleIndex {
+			t.Errorf("%s: got %s (rule %d), want %s (rule %d)", tt.body, resp.Category, resp.RuleIndex, tt.category, tt.ruleIndex)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	RulesTestHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/rules/test", strings.NewReader(`{"description": "x", "rules": [{"pattern": "(", "type": "Fees"}]}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid rule: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCalculateBreakdownTimezone(t *testing.T) {
+	utcPlusOne := time.FixedZone("UTC+1", 60*60)
+	categorized := map[vault.TransactionType][]vault.Transaction{
+		vault.PaymentTransaction: {
+			{Amount: vault.MoneyFromFloat(10.00), Timestamp: time.Date(2024, time.January, 31, 23, 30, 0, 0, time.UTC)},
+			{Amount: vault.MoneyFromFloat(5.00), Timestamp: time.Date(2024, time.February, 2, 12, 0, 0, 0, time.UTC)},
+		},
+		vault.FeeTransaction: {{Amount: vault.MoneyFromFloat(-1.00)}},
+	}
+
+	day := calculateBreakdown(categorized, "day", utcPlusOne, 0)
+	if len(day.Periods) != 2 || day.Periods[0].Period != "2024-02-01" || day.Periods[1].Period != "2024-02-02" {
+		t.Fatalf("day periods = %+v, want 2024-02-01 and 2024-02-02", day.Periods)
+	}
+	if day.Periods[0].Totals[vault.PaymentTransaction] != vault.MoneyFromFloat(10) {
+		t.Errorf("2024-02-01 payments = %v, want 10", day.Periods[0].Totals[vault.PaymentTransaction])
+	}
+	if day.Undated != 1 {
+		t.Errorf("undated = %d, want 1", day.Undated)
+	}
+
+	utc := calculateBreakdown(categorized, "month", time.UTC, 0)
+	if len(utc.Periods) != 2 || utc.Periods[0].Period != "2024-01" || utc.Periods[0].Net != vault.MoneyFromFloat(10) {
+		t.Errorf("UTC month periods = %+v, want January with net 10 and February", utc.Periods)
+	}
+
+	local := calculateBreakdown(categorized, "month", utcPlusOne, 0)
+	if len(local.Periods) != 1 || local.Periods[0].Period != "2024-02" || local.Periods[0].Net != vault.MoneyFromFloat(15) {
+		t.Errorf("local month periods = %+v, want February with net 15", local.Periods)
+	}
+
+	week := calculateBreakdown(categorized, "week", utcPlusOne, 0)
+	if len(week.Periods) != 1 || week.Periods[0].Period != "2024-01-29" {
+		t.Errorf("week periods = %+v, want the week starting Monday 2024-01-29", week.Periods)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	rec := httptest.NewRecorder()
+	OpenAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var doc struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range apiOperations {
+		if _, ok := doc.Paths[op.Path][strings.ToLower(op.Method)]; !ok {
+			t.Errorf("%s %s is missing from the document", op.Method, op.Path)
+		}
+	}
+
+	for _, ref := range regexp.MustCompile(`#/components/schemas/(\w+)`).FindAllStringSubmatch(rec.Body.String(), -1) {
+		if _, ok := doc.Components.Schemas[ref[1]]; !ok {
+			t.Errorf("unresolved reference to %s", ref[1])
+		}
+	}
+
+	if _, ok := doc.Components.Schemas["Transaction"].Properties["transaction_id"]; !ok {
+		t.Errorf("Transaction schema = %v, want a transaction_id property", doc.Components.Schemas["Transaction"])
+	}
+	if _, ok := doc.Components.Schemas["RecategorizeRequest"].Properties["from"]; !ok {
+		t.Errorf("RecategorizeRequest schema = %v, want the embedded filter's from property", doc.Components.Schemas["RecategorizeRequest"])
+	}
+}
+
+func TestLedgerDownloadRange(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("VAULT_DIR", filepath.Join(dir, "vault"))
+	t.Setenv("LEDGER_DIR", dir)
+
+	rec := httptest.NewRecorder()
+	LedgerDownloadHandler(rec, httptest.NewRequest(http.MethodGet, "/ledger/download", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without a ledger: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ledgerFilename), []byte("# FK Master Ledger\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ledger/download", nil)
+	req.Header.Set("Range", "bytes=2-3")
+	rec = httptest.NewRecorder()
+	LedgerDownloadHandler(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusPartialContent)
+	}
+	if rec.Body.String() != "FK" {
+		t.Errorf("body = %q, want %q", rec.Body.String(), "FK")
+	}
+	if rec.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", rec.Header().Get("Accept-Ranges"))
+	}
+}
+
+func TestReconcileHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	reconcile := func(method, body string) reconcileResponse {
+		rec := httptest.NewRecorder()
+		ReconcileHandler(rec, httptest.NewRequest(method, "/api/bookkeeping/reconcile", strings.NewReader(body)), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status = %d, want %d", method, body, rec.Code, http.StatusOK)
+		}
+
+		var resp reconcileResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	resp := reconcile(http.MethodPost, `{"transaction_ids": ["TXN001", "TXN002", "TXN999"]}`)
+	if resp.Changed != 2 || len(resp.Unknown) != 1 || resp.Unknown[0] != "TXN999" {
+		t.Errorf("mark: got %+v, want 2 changed and TXN999 unknown", resp)
+	}
+	if resp := reconcile(http.MethodPost, `{"transaction_ids": ["TXN001"]}`); resp.Changed != 0 {
+		t.Errorf("repeated mark changed = %d, want 0", resp.Changed)
+	}
+	if resp := reconcile(http.MethodDelete, `{"transaction_ids": ["TXN002"]}`); resp.Changed != 1 {
+		t.Errorf("unmark changed = %d, want 1", resp.Changed)
+	}
+
+	// marks survive reprocessing
+	rec := httptest.NewRecorder()
+	ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("process: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping?reconciled=false", nil), db)
+	var got bookkeepingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 4 {
+		t.Errorf("unreconciled count = %d, want 4", got.Count)
+	}
+	if got.Summary.TotalReconciled != 1 || got.Summary.TotalUnreconciled != 4 {
+		t.Errorf("summary reconciled/unreconciled = %d/%d, want 1/4", got.Summary.TotalReconciled, got.Summary.TotalUnreconciled)
+	}
+}
+
+func TestCalculateCashFlow(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.January, d, 12, 0, 0, 0, time.UTC) }
+	resp := calculateCashFlow([]vault.Transaction{
+		{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(100.00), Timestamp: day(1)},
+		{Type: vault.TransferTransaction, Amount: vault.MoneyFromFloat(-40.00), Timestamp: day(1)},
+		{Type: vault.FeeTransaction, Amount: vault.MoneyFromFloat(2.50), Timestamp: day(1)},
+		{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(10.00), Timestamp: day(3)},
+	}, "day", time.UTC, excludedDays{})
+
+	if len(resp.Periods) != 3 {
+		t.Fatalf("periods = %+v, want 3 consecutive days", resp.Periods)
+	}
+	if p := resp.Periods[0]; p.Inflow != vault.MoneyFromFloat(100) || p.Outflow != vault.MoneyFromFloat(42.5) || p.Net != vault.MoneyFromFloat(57.5) {
+		t.Errorf("2024-01-01 = %+v, want inflow 100, outflow 42.5, net 57.5", p)
+	}
+	if p := resp.Periods[1]; p.Period != "2024-01-02" || p.Inflow != 0 || p.Outflow != 0 {
+		t.Errorf("2024-01-02 = %+v, want an empty period", p)
+	}
+}
+
+func TestCashFlowDailyAverage(t *testing.T) {
+	// Friday 2024-01-05 to Monday 2024-01-08
+	transactions := []vault.Transaction{
+		{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(100.00), Timestamp: time.Date(2024, time.January, 5, 12, 0, 0, 0, time.UTC)},
+		{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(50.00), Timestamp: time.Date(2024, time.January, 8, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range []struct {
+		spec           string
+		days, excluded int
+		inflow         vault.Money
+	}{
+		{"", 4, 0, vault.MoneyFromFloat(37.5)},
+		{"weekends", 2, 2, vault.MoneyFromFloat(75)},
+		{"Saturday, sunday, 2024-01-08", 1, 3, vault.MoneyFromFloat(150)},
+		{"weekends,2024-12-25", 2, 2, vault.MoneyFromFloat(75)},
+	} {
+		excluded, err := parseExcludedDays(tt.spec)
+		if err != nil {
+			t.Fatalf("parseExcludedDays(%q): %v", tt.spec, err)
+		}
+		resp := calculateCashFlow(transactions, "month", time.UTC, excluded)
+		if avg := resp.DailyAverage; avg.Days != tt.days || avg.Excluded != tt.excluded || avg.Inflow != tt.inflow || avg.Net != tt.inflow {
+			t.Errorf("%q: daily average = %+v, want %d days, %d excluded, inflow %v", tt.spec, avg, tt.days, tt.excluded, tt.inflow)
+		}
+		if resp.Periods[0].Inflow != vault.MoneyFromFloat(150) {
+			t.Errorf("%q: January inflow = %v, want 150 including the excluded days", tt.spec, resp.Periods[0].Inflow)
+		}
+	}
+
+	for _, spec := range []string{"holidays", "2024-13-01"} {
+		if _, err := parseExcludedDays(spec); err == nil {
+			t.Errorf("parseExcludedDays(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestBusinessDayShift(t *testing.T) {
+	for _, tt := range []struct{ direction, daysOff string }{{"sideways", "weekends"}, {"forward", "2024-02-30"}, {"forward", "weekends,monday,tuesday,wednesday,thursday,friday"}} {
+		if _, err := parseBusinessDayShift(tt.direction, tt.daysOff); err == nil {
+			t.Errorf("parseBusinessDayShift(%q, %q) succeeded, want an error", tt.direction, tt.daysOff)
+		}
+	}
+
+	// Saturday 2024-03-30, before Easter Monday 2024-04-01
+	saturday := time.Date(2024, time.March, 30, 22, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		direction string
+		want      string
+	}{
+		{"none", "2024-03-30"},
+		{"forward", "2024-04-02"},
+		{"backward", "2024-03-29"},
+	} {
+		s, err := parseBusinessDayShift(tt.direction, "weekends,2024-04-01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		transactions := []vault.Transaction{
+			{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(10.00), Timestamp: saturday},
+			{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(1.00)},
+		}
+		applyBusinessDayShift(transactions, s, time.UTC)
+		if got := transactions[0].ReportingDate.Format(dateLayout); got != tt.want || !transactions[0].Timestamp.Equal(saturday) {
+			t.Errorf("%s: reporting date = %s, timestamp %v, want %s and the timestamp unchanged", tt.direction, got, transactions[0].Timestamp, tt.want)
+		}
+		if !transactions[1].ReportingDate.IsZero() {
+			t.Errorf("%s: undated transaction has reporting date %v", tt.direction, transactions[1].ReportingDate)
+		}
+	}
+
+	// shifted in the reporting time zone, where 22:00 UTC is already Sunday
+	s, _ := parseBusinessDayShift("backward", "weekends")
+	if got := s.shift(saturday, time.FixedZone("UTC+3", 3*60*60)).Format(dateLayout); got != "2024-03-29" {
+		t.Errorf("shift in UTC+3 = %s, want 2024-03-29", got)
+	}
+
+	db := setupBookkeeping(t, `Date,Type,Amount,Description,Transaction ID
+2024-03-30,Payment,10.00,Weekend sale,TXN001
+`)
+	t.Setenv("BUSINESS_DAY_SHIFT", "forward")
+	t.Setenv("BUSINESS_DAYS_OFF", "weekends,2024-04-01")
+
+	_, categorized, err := loadTransactions(context.Background(), db, accounts()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := calculateBreakdown(categorized, "month", time.UTC, 0)
+	if len(b.Periods) != 1 || b.Periods[0].Period != "2024-04" {
+		t.Errorf("breakdown = %+v, want the payment in 2024-04", b.Periods)
+	}
+	if got := categorized[vault.PaymentTransaction][0].Date; got != "2024-03-30" {
+		t.Errorf("date = %s, want 2024-03-30 unchanged", got)
+	}
+}
+
+func TestValidateUploadHandler(t *testing.T) {
+	setupBookkeeping(t, testCSV)
+	t.Setenv("UPLOAD_TOKEN", "secret")
+	t.Setenv("UPLOAD_MAX_BYTES", "400")
+
+	validate := func(target, token, contentType string, body io.Reader) (*httptest.ResponseRecorder, vault.FileValidation) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, target, body)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		ValidateUploadHandler(rec, req)
+		var v vault.FileValidation
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec, v
+	}
+
+	const upload = `Date,Type,Amount,Description,Transaction ID
+2024-04-01,Payment,10.00,Sale,TXN101
+2024-04-02,Fee,-0.30,Fee,TXN102
+not a date,Payment,1.00,Sale,TXN101
+`
+	if rec, _ := validate("/api/bookkeeping/validate", "", "text/csv", strings.NewReader(upload)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec, _ := validate("/api/bookkeeping/validate", "wrong", "text/csv", strings.NewReader(upload)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("with a wrong token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec, v := validate("/api/bookkeeping/validate?file=april.csv", "secret", "text/csv", strings.NewReader(upload))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if v.File != "april.csv" || v.Transactions != 3 || v.Valid || v.Error != "" {
+		t.Errorf("validation = %+v, want 3 transactions of april.csv with warnings", v)
+	}
+	var kinds []vault.WarningKind
+	for _, w := range v.Warnings {
+		kinds = append(kinds, w.Kind)
+	}
+	// the duplicate of TXN101 differs in its date and amount
+	if want := []vault.WarningKind{vault.WarningParse, vault.WarningConflict}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("warnings = %+v, want kinds %v", v.Warnings, want)
+	}
+
+	var form strings.Builder
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "bad.csv")
+	fmt.Fprint(fw, "Date,Amount\n2024-04-01,10.00\n")
+	mw.Close()
+	rec, v = validate("/api/bookkeeping/validate", "secret", mw.FormDataContentType(), strings.NewReader(form.String()))
+	if rec.Code != http.StatusOK || v.File != "bad.csv" || v.Valid || !strings.Contains(v.Error, "expected at least 5 columns") {
+		t.Errorf("multipart: status %d, validation %+v, want bad.csv with a header error", rec.Code, v)
+	}
+
+	if rec, _ := validate("/api/bookkeeping/validate", "secret", "text/csv", strings.NewReader(upload+strings.Repeat("x", 400))); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too large: status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	// the limit applies to the decompressed file too, which compresses well
+	// below it
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	fmt.Fprint(zw, upload+strings.Repeat("2024-04-03,Payment,1.00,Sale,TXN103\n", 100))
+	zw.Close()
+	if rec, _ := validate("/api/bookkeeping/validate?file=april.csv.gz", "secret", "application/gzip", bytes.NewReader(gz.Bytes())); rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "decompressed") {
+		t.Errorf("decompressed too large: status = %d, want %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body)
+	}
+
+	// uploads are refused until a token is configured
+	t.Setenv("UPLOAD_TOKEN", "")
+	if rec, _ := validate("/api/bookkeeping/validate?file=april.csv", "", "text/csv", strings.NewReader(upload)); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("without UPLOAD_TOKEN: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// nothing was added to the vault
+	files, err := os.ReadDir(os.Getenv("VAULT_DIR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("vault has %d files, want only transactions.csv", len(files))
+	}
+}
+
+func TestCategoryLevels(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+	rules := `[
+		{"pattern": "processing fee", "category": "Fees > PayPal > Processing"},
+		{"pattern": "hosting", "category": "Fees > Services > Hosting"}
+	]`
+	if err := os.WriteFile(os.Getenv("RULES_FILE"), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := func(query string) []string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		SummaryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/summary"+query, nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", query, rec.Code, http.StatusOK, rec.Body)
+		}
+		var s SummaryStats
+		if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range s.Categories {
+			got = append(got, fmt.Sprintf("%s %d %v", c.Category, c.Count, c.Sum))
+		}
+		return got
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Payments 1 100.50", "Transfers 1 -50.00", "Fees > PayPal > Processing 1 -2.99", "Fees > Services > Hosting 2 -24.00"}},
+		{"?level=2", []string{"Payments 1 100.50", "Transfers 1 -50.00", "Fees > PayPal 1 -2.99", "Fees > Services 2 -24.00"}},
+		{"?level=1", []string{"Payments 1 100.50", "Transfers 1 -50.00", "Fees 3 -26.99"}},
+	} {
+		if got := summary(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: categories = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	SummaryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/summary?level=0", nil), db)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("level=0: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	_, categorized, err := loadTransactions(context.Background(), db, accounts()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := categorized[vault.FeeTransaction][0].Category; got != "Fees > PayPal > Processing" {
+		t.Errorf("category of TXN003 = %q, want the full path", got)
+	}
+	b := calculateBreakdown(categorized, "month", time.UTC, 2)
+	if got := b.Periods[1].Categories; len(got) != 1 || got[0].Category != "Fees > Services" || got[0].Sum != vault.MoneyFromFloat(-12) {
+		t.Errorf("February categories = %+v, want Fees > Services -12.00", got)
+	}
+	if got := calculateBreakdown(categorized, "month", time.UTC, 0).Periods[0].Categories; got != nil {
+		t.Errorf("categories without a level = %+v, want none", got)
+	}
+}
+
+func TestGapsHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	gaps := func(query string) (int, gapsResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		GapsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/gaps"+query, nil), db)
+		var resp gapsResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	// nothing between the 17th of January and the 3rd of February, and until
+	// the 3rd of March
+	_, resp := gaps("")
+	want := []coverageGap{{"2024-01-18", "2024-02-02", 16}, {"2024-02-04", "2024-03-02", 28}}
+	if !reflect.DeepEqual(resp.Gaps, want) || resp.First != "2024-01-15" || resp.Last != "2024-03-03" {
+		t.Errorf("gaps = %+v from %s to %s, want %+v from 2024-01-15 to 2024-03-03", resp.Gaps, resp.First, resp.Last, want)
+	}
+
+	_, resp = gaps("?min_days=20")
+	if len(resp.Gaps) != 1 || resp.Gaps[0].Days != 28 || resp.MinDays != 20 {
+		t.Errorf("min_days=20: gaps = %+v, want only the 28 days of February", resp.Gaps)
+	}
+
+	t.Setenv("GAPS_MIN_DAYS", "30")
+	if _, resp = gaps(""); len(resp.Gaps) != 0 {
+		t.Errorf("GAPS_MIN_DAYS=30: gaps = %+v, want none", resp.Gaps)
+	}
+
+	for _, query := range []string{"?min_days=0", "?min_days=week"} {
+		if code, _ := gaps(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestIncludeZeroAmounts(t *testing.T) {
+	db := setupBookkeeping(t, testCSV+`2024-01-20,Other,0.00,Balance notice,TXN006
+2024-01-21,Other,-0,Statement notice,TXN007
+`)
+
+	get := func(handler func(http.ResponseWriter, *http.Request, *badger.DB), target string, v interface{}) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, target, nil), db)
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code
+	}
+
+	var all bookkeepingResponse
+	get(BookkeepingAPIHandler, "/api/bookkeeping", &all)
+	if all.Count != 7 || all.Summary.TotalTransactions != 7 || all.Summary.ZeroExcludedCount != 0 {
+		t.Errorf("by default: count %d, total %d, zero excluded %d, want 7, 7 and 0", all.Count, all.Summary.TotalTransactions, all.Summary.ZeroExcludedCount)
+	}
+
+	var resp bookkeepingResponse
+	get(BookkeepingAPIHandler, "/api/bookkeeping?include_zero=false", &resp)
+	if resp.Count != 5 || resp.Summary.TotalTransactions != 5 || resp.Summary.ZeroExcludedCount != 2 || resp.Summary.NetLiquidity != vault.MoneyFromFloat(23.51) {
+		t.Errorf("include_zero=false: count %d, total %d, zero excluded %d, net %v, want 5, 5, 2 and 23.51", resp.Count, resp.Summary.TotalTransactions, resp.Summary.ZeroExcludedCount, resp.Summary.NetLiquidity)
+	}
+
+	t.Setenv("INCLUDE_ZERO_AMOUNTS", "false")
+	var s SummaryStats
+	get(SummaryHandler, "/api/bookkeeping/summary?query=notice", &s)
+	if s.TotalTransactions != 0 || s.ZeroExcludedCount != 2 {
+		t.Errorf("INCLUDE_ZERO_AMOUNTS=false: total %d, zero excluded %d, want 0 and 2", s.TotalTransactions, s.ZeroExcludedCount)
+	}
+	get(SummaryHandler, "/api/bookkeeping/summary?include_zero=true", &s)
+	if s.TotalTransactions != 7 || s.ZeroExcludedCount != 0 {
+		t.Errorf("include_zero=true: total %d, zero excluded %d, want 7 and 0", s.TotalTransactions, s.ZeroExcludedCount)
+	}
+
+	if code := get(SummaryHandler, "/api/bookkeeping/summary?include_zero=maybe", &s); code != http.StatusBadRequest {
+		t.Errorf("include_zero=maybe: status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestCalculateStatement(t *testing.T) {
+	month := func(m time.Month) time.Time { return time.Date(2024, m, 10, 12, 0, 0, 0, time.UTC) }
+	resp := calculateStatement([]vault.Transaction{
+		{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(100.00), Timestamp: month(time.January)},
+		{Type: vault.FeeTransaction, Amount: vault.MoneyFromFloat(-5.00), Timestamp: month(time.January)},
+		{Type: vault.TransferTransaction, Amount: vault.MoneyFromFloat(-300.00), Timestamp: month(time.January), Internal: true},
+		{Type: vault.TransferTransaction, Amount: vault.MoneyFromFloat(-30.00), Timestamp: month(time.March)},
+		{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(1.00)},
+	}, "month", time.UTC, vault.MoneyFromFloat(1000))
+
+	if len(resp.Periods) != 3 || resp.Undated != 1 {
+		t.Fatalf("periods = %+v, undated %d, want January to March and 1 undated", resp.Periods, resp.Undated)
+	}
+	want := []struct{ opening, inflow, outflow, closing vault.Money }{
+		{vault.MoneyFromFloat(1000), vault.MoneyFromFloat(100), vault.MoneyFromFloat(5), vault.MoneyFromFloat(1095)},
+		{vault.MoneyFromFloat(1095), 0, 0, vault.MoneyFromFloat(1095)},
+		{vault.MoneyFromFloat(1095), 0, vault.MoneyFromFloat(30), vault.MoneyFromFloat(1065)},
+	}
+	for i, w := range want {
+		p := resp.Periods[i]
+		if p.Opening != w.opening || p.Inflow != w.inflow || p.Outflow != w.outflow || p.Closing != w.closing {
+			t.Errorf("%s = %+v, want %+v", p.Period, p, w)
+		}
+	}
+	if resp.Opening != vault.MoneyFromFloat(1000) || resp.Closing != vault.MoneyFromFloat(1065) {
+		t.Errorf("opening %v, closing %v, want 1000 and 1065", resp.Opening, resp.Closing)
+	}
+
+	if empty := calculateStatement(nil, "month", time.UTC, vault.MoneyFromFloat(50)); len(empty.Periods) != 0 || empty.Closing != vault.MoneyFromFloat(50) {
+		t.Errorf("without transactions: %+v, want no periods and the opening balance", empty)
+	}
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	categorized := map[vault.TransactionType][]vault.Transaction{
+		vault.FeeTransaction:      {{Amount: vault.MoneyFromFloat(-1.00)}, {Amount: vault.MoneyFromFloat(-1.00)}},
+		vault.TransferTransaction: {{Amount: vault.MoneyFromFloat(-5.00)}, {Amount: vault.MoneyFromFloat(-5.00)}, {Amount: vault.MoneyFromFloat(-5.00)}},
+	}
+	for i, amount := range []float64{10, 11, 12, 10, 11, 12, 10, 11, 500, 600} {
+		categorized[vault.PaymentTransaction] = append(categorized[vault.PaymentTransaction], vault.Transaction{Amount: vault.MoneyFromFloat(amount), TransactionID: fmt.Sprintf("TXN%03d", i)})
+	}
+
+	// the two large payments inflate the standard deviation enough to hide both
+	stddev := detectAnomalies(categorized, anomalyOptions{Method: anomalyStddev, K: 3})
+	if len(stddev.Anomalies) != 0 {
+		t.Errorf("stddev anomalies = %+v, want none", stddev.Anomalies)
+	}
+	if len(stddev.Categories) != 2 || stddev.Categories[0].Category != vault.PaymentTransaction || stddev.Categories[1].Spread != 0 {
+		t.Errorf("categories = %+v, want payments and transfers without spread", stddev.Categories)
+	}
+	if lower := detectAnomalies(categorized, anomalyOptions{Method: anomalyStddev, K: 2}); len(lower.Anomalies) != 1 || lower.Anomalies[0].ZScore != 2.22 {
+		t.Errorf("stddev anomalies with k 2 = %+v, want the 600 payment with z-score 2.22", lower.Anomalies)
+	}
+
+	mad := detectAnomalies(categorized, anomalyOptions{Method: anomalyMAD, K: 3})
+	if len(mad.Anomalies) != 2 || mad.Anomalies[0].Transaction.TransactionID != "TXN009" || mad.Anomalies[1].Transaction.TransactionID != "TXN008" {
+		t.Fatalf("mad anomalies = %+v, want the 600 and 500 payments", mad.Anomalies)
+	}
+	if a := mad.Anomalies[0]; a.Transaction.Type != vault.PaymentTransaction || a.ZScore <= 300 {
+		t.Errorf("largest anomaly = %+v, want a payment with a z-score over 300", a)
+	}
+	if mad.Categories[0].Center != vault.MoneyFromFloat(11) {
+		t.Errorf("payment median = %v, want 11", mad.Categories[0].Center)
+	}
+
+	for _, target := range []string{"?k=0", "?k=x", "?method=iqr"} {
+		if _, err := anomalyOptionsFromRequest(httptest.NewRequest(http.MethodGet, "/api/bookkeeping/anomalies"+target, nil)); err == nil {
+			t.Errorf("%s: want an error", target)
+		}
+	}
+}
+
+func TestSummaryHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	get := func(h func(http.ResponseWriter, *http.Request, *badger.DB), url string, v interface{}) string {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, url, nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", url, rec.Code, http.StatusOK)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Body.String()
+	}
+
+	var full bookkeepingResponse
+	get(BookkeepingAPIHandler, "/api/bookkeeping", &full)
+
+	var summary SummaryStats
+	body := get(SummaryHandler, "/api/bookkeeping/summary", &summary)
+	if !reflect.DeepEqual(summary, full.Summary) {
+		t.Errorf("summary = %+v, want the full API's %+v", summary, full.Summary)
+	}
+	if strings.Contains(body, "transaction_id") {
+		t.Errorf("summary response includes transactions: %s", body)
+	}
+
+	get(SummaryHandler, "/api/bookkeeping/summary?from=2024-02-01", &summary)
+	if summary.TotalTransactions != 2 || summary.UncategorizedSum != vault.MoneyFromFloat(-24) {
+		t.Errorf("filtered summary = %+v, want 2 transactions summing to -24", summary)
+	}
+}
+
+func TestDatabaseLocked(t *testing.T) {
+	dir := t.TempDir()
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if !IsDatabaseLocked(err) {
+		t.Errorf("IsDatabaseLocked(%v) = false, want true", err)
+	}
+	if IsDatabaseLocked(errors.New("some other error")) {
+		t.Error("IsDatabaseLocked(other error) = true, want false")
+	}
+
+	setupBookkeeping(t, testCSV)
+
+	rec := httptest.NewRecorder()
+	SummaryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/summary", nil), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("summary without db: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var summary SummaryStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalTransactions != 5 {
+		t.Errorf("summary without db has %d transactions, want 5 read from the vault", summary.TotalTransactions)
+	}
+
+	rec = httptest.NewRecorder()
+	ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), nil)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "database locked") {
+		t.Errorf("process without db = %d %s, want %d database locked", rec.Code, rec.Body.String(), http.StatusServiceUnavailable)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	post := func(h func(http.ResponseWriter, *http.Request, *badger.DB), method, url, body string) {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.SetBasicAuth("alice", "secret")
+		rec := httptest.NewRecorder()
+		h(rec, req, db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status = %d, want %d", method, url, rec.Code, http.StatusOK)
+		}
+	}
+	post(RecategorizeHandler, http.MethodPost, "/api/bookkeeping/recategorize", `{"query": "hosting", "type": "Fees"}`)
+	post(ReconcileHandler, http.MethodPost, "/api/bookkeeping/reconcile", `{"transaction_ids": ["TXN001"]}`)
+	post(ReconcileHandler, http.MethodDelete, "/api/bookkeeping/reconcile", `{"transaction_ids": ["TXN001"]}`)
+
+	audit := func(url string) []auditEvent {
+		rec := httptest.NewRecorder()
+		AuditHandler(rec, httptest.NewRequest(http.MethodGet, url, nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", url, rec.Code, http.StatusOK)
+		}
+		var events []auditEvent
+		if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+
+	events := audit("/api/bookkeeping/audit")
+	var got []string
+	for _, e := range events {
+		got = append(got, fmt.Sprintf("%s %s %s->%s %s", e.Action, e.TransactionID, e.OldValue, e.NewValue, e.Caller))
+	}
+	want := []string{
+		"recategorize TXN004 Uncategorized->Fees alice",
+		"recategorize TXN005 Uncategorized->Fees alice",
+		"reconcile TXN001 false->true alice",
+		"unreconcile TXN001 true->false alice",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit log =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if events := audit("/api/bookkeeping/audit?transaction_id=TXN001&action=reconcile"); len(events) != 1 {
+		t.Errorf("filtered audit log has %d events, want 1", len(events))
+	}
+	if events := audit("/api/bookkeeping/audit?to=2000-01-01"); len(events) != 0 {
+		t.Errorf("audit log before 2000 has %d events, want 0", len(events))
+	}
+}
+
+func TestBookkeepingAPIHideBelow(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	var tests = []struct {
+		query      string
+		count      int
+		hidden     int
+		hiddenSum  vault.Money
+		wantStatus int
+	}{
+		{"", 5, 0, 0, http.StatusOK},
+		{"?hide_below=3", 4, 1, vault.MoneyFromFloat(-2.99), http.StatusOK},
+		{"?hide_below=12,5", 2, 3, vault.MoneyFromFloat(-26.99), http.StatusOK},
+		{"?hide_below=-1", 0, 0, 0, http.StatusBadRequest},
+		{"?hide_below=abc", 0, 0, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping"+tt.query, nil), db)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%q: status = %d, want %d", tt.query, rec.Code, tt.wantStatus)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		var got bookkeepingResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Count != tt.count || got.HiddenCount != tt.hidden || got.HiddenSum != tt.hiddenSum {
+			t.Errorf("%q: count/hidden/hidden sum = %d/%d/%v, want %d/%d/%v", tt.query, got.Count, got.HiddenCount, got.HiddenSum, tt.count, tt.hidden, tt.hiddenSum)
+		}
+		if got.Summary.TotalTransactions != 5 {
+			t.Errorf("%q: summary counts %d transactions, want all 5", tt.query, got.Summary.TotalTransactions)
+		}
+	}
+
+	t.Setenv("BOOKKEEPING_HIDE_BELOW", "3")
+	rec := httptest.NewRecorder()
+	BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping", nil), db)
+	var got bookkeepingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.HiddenCount != 1 {
+		t.Errorf("with BOOKKEEPING_HIDE_BELOW=3: hidden count = %d, want 1", got.HiddenCount)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var tests = []struct {
+		from, to string
+		want     string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"", "a\n", "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n"},
+		{
+			"a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n",
+			"a\nb\nX\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n",
+			"--- old\n+++ new\n@@ -1,6 +1,6 @@\n a\n b\n-c\n+X\n d\n e\n f\n@@ -10,3 +10,4 @@\n j\n k\n l\n+m\n",
+		},
+		{"a\nb\nc\n", "c\nb\na\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n-a\n-b\n c\n+b\n+a\n"},
+	}
+
+	for _, tt := range tests {
+		if got := unifiedDiff("old", "new", tt.from, tt.to); got != tt.want {
+			t.Errorf("unifiedDiff(%q, %q) =\n%s\nwant\n%s", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestLedgerDiffHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	process := func() {
+		rec := httptest.NewRecorder()
+		ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("process: status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	}
+	process()
+
+	rec := httptest.NewRecorder()
+	LedgerDiffHandler(rec, httptest.NewRequest(http.MethodGet, "/api/ledger/diff", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("diff without a previous ledger: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	csv := testCSV + "2024-03-04,Payment,40.00,Consulting,TXN006\n"
+	if err := os.WriteFile(filepath.Join(os.Getenv("VAULT_DIR"), "transactions.csv"), []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	process()
+
+	rec = httptest.NewRecorder()
+	LedgerDiffHandler(rec, httptest.NewRequest(http.MethodGet, "/api/ledger/diff", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("diff: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	diff := rec.Body.String()
+	if !strings.HasPrefix(diff, "--- FK_MASTER_LEDGER.1.md\n+++ FK_MASTER_LEDGER.md\n") {
+		t.Errorf("diff does not compare the previous ledger to the current one:\n%s", diff)
+	}
+	if !strings.Contains(diff, "\n+") || !strings.Contains(diff, "TXN006") {
+		t.Errorf("diff does not add TXN006:\n%s", diff)
+	}
+
+	rec = httptest.NewRecorder()
+	LedgerDiffHandler(rec, httptest.NewRequest(http.MethodGet, "/api/ledger/diff?from=x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("diff from=x: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCalculateInsights(t *testing.T) {
+	b := breakdownResponse{Periods: []breakdownPeriod{
+		{Period: "2024-01", Totals: map[vault.TransactionType]vault.Money{
+			vault.PaymentTransaction:  vault.MoneyFromFloat(100),
+			vault.FeeTransaction:      vault.MoneyFromFloat(-10),
+			vault.TransferTransaction: vault.MoneyFromFloat(-50),
+		}},
+		{Period: "2024-02", Totals: map[vault.TransactionType]vault.Money{
+			vault.PaymentTransaction:  vault.MoneyFromFloat(110),
+			vault.FeeTransaction:      vault.MoneyFromFloat(-13),
+			vault.TransferTransaction: vault.MoneyFromFloat(-20),
+		}},
+	}}
+
+	var got []string
+	for _, in := range calculateInsights(b, 1, insightThresholds{MinPercent: 20}).Insights {
+		got = append(got, in.Message)
+	}
+	want := []string{
+		"Transfers down 60% vs last month (50.00 to 20.00)",
+		"Fees up 30% vs last month (10.00 to 13.00)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("insights =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if resp := calculateInsights(b, 1, insightThresholds{MinPercent: 5, MinAmount: vault.MoneyFromFloat(20)}); len(resp.Insights) != 1 || resp.Insights[0].Category != vault.TransferTransaction {
+		t.Errorf("insights with min amount 20 = %+v, want only transfers", resp.Insights)
+	}
+	if resp := calculateInsights(b, 0, insightThresholds{}); len(resp.Insights) != 0 {
+		t.Errorf("insights for the first month = %+v, want none", resp.Insights)
+	}
+}
+
+func TestInsightsHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	rec := httptest.NewRecorder()
+	InsightsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/insights?month=2024-02", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var resp insightsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, in := range resp.Insights {
+		got = append(got, string(in.Category)+" "+in.Direction)
+	}
+	want := "Payments gone, Transfers gone, Uncategorized new, Fees gone"
+	if strings.Join(got, ", ") != want || resp.Previous != "2024-01" {
+		t.Errorf("insights = %s (vs %s), want %s (vs 2024-01)", strings.Join(got, ", "), resp.Previous, want)
+	}
+
+	rec = httptest.NewRecorder()
+	InsightsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/insights?month=2023-01", nil), db)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("month outside the range: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestPageCacheHeaders(t *testing.T) {
+	t.Setenv("PAGE_CACHE_MAX_AGE", "30s")
+	modified := time.Now().Add(time.Hour)
+
+	rec := httptest.NewRecorder()
+	if setPageCacheHeaders(rec, httptest.NewRequest(http.MethodGet, "/ledger/", nil), modified) {
+		t.Fatal("request without If-Modified-Since was not modified")
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "max-age=30" {
+		t.Errorf("Cache-Control = %q, want max-age=30", got)
+	}
+	lastModified := rec.Header().Get("Last-Modified")
+
+	for _, tt := range []struct {
+		since string
+		want  bool
+	}{
+		{lastModified, true},
+		{modified.Add(-time.Minute).UTC().Format(http.TimeFormat), false},
+		{"not a date", false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/ledger/", nil)
+		req.Header.Set("If-Modified-Since", tt.since)
+		rec := httptest.NewRecorder()
+		if got := setPageCacheHeaders(rec, req, modified); got != tt.want {
+			t.Errorf("If-Modified-Since %q: not modified = %v, want %v", tt.since, got, tt.want)
+		}
+		if tt.want && rec.Code != http.StatusNotModified {
+			t.Errorf("If-Modified-Since %q: status = %d, want %d", tt.since, rec.Code, http.StatusNotModified)
+		}
+	}
+
+	db := setupBookkeeping(t, testCSV)
+	acct := accounts()[0]
+	before := bookkeepingModTime(db, acct)
+	time.Sleep(10 * time.Millisecond)
+
+	rec = httptest.NewRecorder()
+	ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("process Cache-Control = %q, want no-store", got)
+	}
+	if after := bookkeepingModTime(db, acct); !after.After(before) {
+		t.Errorf("modification time %s did not advance from %s after processing", after, before)
+	}
+}
+
+func TestTypeScopedSummary(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	rec := httptest.NewRecorder()
+	BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping?type=fees&type=Uncategorized", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got bookkeepingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Transactions) != 2 || len(got.Transactions["Fees"]) != 1 || len(got.Transactions["Uncategorized"]) != 2 {
+		t.Errorf("transactions = %v, want only 1 fee and 2 uncategorized", got.Transactions)
+	}
+	if got.Count != 3 || got.Summary.TotalTransactions != 3 || got.Summary.TotalPayments != 0 || got.Summary.NetLiquidity != vault.MoneyFromFloat(-26.99) {
+		t.Errorf("count %d, summary %+v, want 3 transactions with net -26.99", got.Count, got.Summary)
+	}
+
+	rec = httptest.NewRecorder()
+	SummaryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/summary?type=Payments", nil), db)
+	var summary SummaryStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalTransactions != 1 || summary.PaymentsSum != vault.MoneyFromFloat(100.5) {
+		t.Errorf("payments summary = %+v, want 1 transaction summing to 100.50", summary)
+	}
+
+	rec = httptest.NewRecorder()
+	SummaryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/summary?type=refunds", nil), db)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown type: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestBookkeepingExclusions(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+	get := func(query string) bookkeepingResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping?"+query, nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", query, rec.Code, http.StatusOK)
+		}
+		var got bookkeepingResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	got := get("exclude_type=transfers&exclude_q=HOSTING")
+	if got.Count != 2 || got.Summary.TotalTransactions != 2 || got.Summary.NetLiquidity != vault.MoneyFromFloat(97.51) {
+		t.Errorf("count %d, summary %+v, want 2 transactions with net 97.51", got.Count, got.Summary)
+	}
+
+	// exclusions apply to the selected types
+	got = get("type=fees&type=Uncategorized&exclude_q=invoice&exclude_q=nothing")
+	if got.Count != 1 || len(got.Transactions["Fees"]) != 1 || got.Summary.TotalTransactions != 1 {
+		t.Errorf("count %d, transactions %v, want only the fee", got.Count, got.Transactions)
+	}
+
+	rec := httptest.NewRecorder()
+	BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping?exclude_type=refunds", nil), db)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown excluded type: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestStreamSummary(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+	if err := db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set([]byte(CategoryOverridePrefix+"TXN004"), []byte(vault.FeeTransaction)); err != nil {
+			return err
+		}
+		return txn.Set([]byte(ReconciledPrefix+"TXN001"), []byte("1"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	acct := accounts()[0]
+	_, categorized, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := calculateSummary(categorized)
+
+	got, err := streamSummary(ctx, db, acct, func(vault.Transaction) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("streamed summary = %+v, want %+v", got, want)
+	}
+	if got.TotalFees != 2 || got.TotalReconciled != 1 {
+		t.Errorf("streamed summary = %+v, want the override and reconciliation mark applied", got)
+	}
+
+	rec := httptest.NewRecorder()
+	SummaryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/summary?from=2024-02-01&type=Fees", nil), db)
+	var filtered SummaryStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &filtered); err != nil {
+		t.Fatal(err)
+	}
+	if filtered.TotalTransactions != 1 || filtered.FeesSum != vault.MoneyFromFloat(-12) {
+		t.Errorf("filtered summary = %+v, want the one fee from February", filtered)
+	}
+}
+
+// peakHeap returns the most heap in use above the starting point while f runs
+func peakHeap(f func()) uint64 {
+	runtime.GC()
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	heap := func() uint64 {
+		metrics.Read(sample)
+		return sample[0].Value.Uint64()
+	}
+	base, peak := heap(), uint64(0)
+
+	done, sampled := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(sampled)
+		tick := time.NewTicker(100 * time.Microsecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				if h := heap(); h > peak {
+					peak = h
+				}
+			}
+		}
+	}()
+	f()
+	close(done)
+	<-sampled
+
+	if peak < base {
+		return 0
+	}
+	return peak - base
+}
+
+// benchmarkSummary summarizes a generated vault of 200,000 transactions,
+// reporting the peak heap in use alongside the allocations
+func benchmarkSummary(b *testing.B, summarize func(ctx context.Context, db *badger.DB, acct account) error) {
+	db := setupBookkeeping(b, "Date,Type,Amount,Description,Transaction ID\n")
+	cfg := vault.DefaultGeneratorConfig()
+	cfg.Files, cfg.RowsPerFile = 20, 10000
+	if _, err := vault.GenerateTestData(os.Getenv("VAULT_DIR"), cfg); err != nil {
+		b.Fatal(err)
+	}
+	acct := accounts()[0]
+
+	// collect often, so that the peak reflects what is kept rather than
+	// garbage awaiting collection
+	defer debug.SetGCPercent(debug.SetGCPercent(10))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		var err error
+		if p := peakHeap(func() { err = summarize(context.Background(), db, acct) }); p > peak {
+			peak = p
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(peak), "peak-heap-B")
+}
+
+func BenchmarkSummaryMaterialized(b *testing.B) {
+	benchmarkSummary(b, func(ctx context.Context, db *badger.DB, acct account) error {
+		_, categorized, err := loadTransactions(ctx, db, acct)
+		calculateSummary(categorized)
+		return err
+	})
+}
+
+func BenchmarkSummaryStreaming(b *testing.B) {
+	benchmarkSummary(b, func(ctx context.Context, db *badger.DB, acct account) error {
+		_, err := streamSummary(ctx, db, acct, func(vault.Transaction) bool { return true })
+		return err
+	})
+}
+
+func TestMatchInternalTransfers(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.March, d, 0, 0, 0, 0, time.UTC) }
+	txn := func(id string, amount float64, d int) vault.Transaction {
+		tx := vault.Transaction{TransactionID: id, Amount: vault.MoneyFromFloat(amount)}
+		if d > 0 {
+			tx.Timestamp = day(d)
+		}
+		return tx
+	}
+	byAccount := func() [][]vault.Transaction {
+		return [][]vault.Transaction{
+			{txn("A1", -500.00, 1), txn("A2", -75.00, 5), txn("A3", -20.00, 10), txn("A4", -40.00, 0)},
+			{txn("B1", 500.00, 9), txn("B2", 500.00, 2), txn("B3", 74.50, 6), txn("B4", 40.00, 12)},
+			{txn("C1", 20.00, 10), txn("C2", -20.00, 10)},
+		}
+	}
+
+	for _, tt := range []struct {
+		match internalTransferMatch
+		want  []string
+	}{
+		// A1 matches the closer of the two credits, C2 cannot match its own account's credit
+		{internalTransferMatch{Window: 3 * 24 * time.Hour}, []string{"A1", "A3", "B2", "C1"}},
+		{internalTransferMatch{Window: 3 * 24 * time.Hour, Tolerance: vault.MoneyFromFloat(0.5)}, []string{"A1", "A2", "A3", "B2", "B3", "C1"}},
+		{internalTransferMatch{Window: 0}, []string{"A3", "C1"}},
+	} {
+		accts := byAccount()
+		matchInternalTransfers(accts, tt.match)
+		var got []string
+		for _, txns := range accts {
+			for _, tx := range txns {
+				if tx.Internal {
+					got = append(got, tx.TransactionID)
+				}
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%+v: internal = %v, want %v", tt.match, got, tt.want)
+		}
+	}
+}
+
+func TestInternalTransfersSummary(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+	dir := filepath.Dir(os.Getenv("VAULT_DIR"))
+	savings := filepath.Join(dir, "savings")
+	if err := os.MkdirAll(savings, 0755); err != nil {
+		t.Fatal(err)
+	}
+	csv := "Date,Type,Amount,Description,Transaction ID\n" +
+		"2024-01-17,Transfer,50.00,Transfer from checking,SAV001\n" +
+		"2024-01-20,Payment,3.10,Interest,SAV002\n"
+	if err := os.WriteFile(filepath.Join(savings, "transactions.csv"), []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAULT_DIR", os.Getenv("VAULT_DIR")+string(filepath.ListSeparator)+savings)
+	// the fee is a rule-marked internal transfer, TXN002 and SAV001 are matched
+	if err := os.WriteFile(os.Getenv("RULES_FILE"), []byte(`[{"pattern": "fee", "type": "Fees", "internal": true}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := func(query string) SummaryStats {
+		rec := httptest.NewRecorder()
+		SummaryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/summary"+query, nil), db)
+		var s SummaryStats
+		if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	s := summary("")
+	if s.InternalTransferCount != 2 || s.TotalTransfers != 1 || s.TransfersSum != vault.MoneyFromFloat(-50) || s.NetLiquidity != vault.MoneyFromFloat(76.5) {
+		t.Errorf("summary = %+v, want 2 internal transfers left out of a net of 76.50", s)
+	}
+	if s := summary("?account=savings"); s.InternalTransferCount != 1 || s.NetLiquidity != vault.MoneyFromFloat(3.1) {
+		t.Errorf("savings summary = %+v, want 1 internal transfer and a net of 3.10", s)
+	}
+
+	t.Setenv("INTERNAL_TRANSFER_WINDOW", "-1")
+	if s := summary(""); s.InternalTransferCount != 1 || s.NetLiquidity != vault.MoneyFromFloat(26.5) {
+		t.Errorf("summary without matching = %+v, want only the rule-marked fee left out", s)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	if code := errorCode(http.StatusServiceUnavailable); code != "service_unavailable" {
+		t.Errorf("errorCode(503) = %q, want service_unavailable", code)
+	}
+
+	rec := httptest.NewRecorder()
+	EffectiveConfigHandler(rec, httptest.NewRequest(http.MethodPost, "/api/config", nil))
+	var body errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("could not decode error response: %v", err)
+	}
+	if want := (errorResponse{Error: "method not allowed", Code: "method_not_allowed"}); body != want {
+		t.Errorf("error response = %+v, want %+v", body, want)
+	}
+
+	db := setupBookkeeping(t, testCSV)
+	gh := GRCHandler{AssetsFS: http.Dir("../assets")}
+	rec = httptest.NewRecorder()
+	gh.BookkeepingHandler(rec, httptest.NewRequest(http.MethodGet, "/bookkeeping/?account=nope", nil), db)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown account status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("error page Content-Type = %q, want text/html", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "unknown account &#34;nope&#34;") {
+		t.Errorf("error page does not show the escaped message:\n%s", rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/report/github.com/gojp/goreportcard", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	gh.Error(rec, req, http.StatusServiceUnavailable, "database locked")
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type for a JSON client = %q, want application/json", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `"code":"service_unavailable"`) {
+		t.Errorf("JSON error = %s, want code service_unavailable", rec.Body.String())
+	}
+}
+
+func TestStatementPageHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+	t.Setenv("FISCAL_YEAR_START", "04-01")
+	gh := GRCHandler{AssetsFS: http.Dir("../assets")}
+
+	page := func(query string) (int, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		gh.StatementPageHandler(rec, httptest.NewRequest(http.MethodGet, "/bookkeeping/statement"+query, nil), db)
+		return rec.Code, rec.Body.String()
+	}
+
+	code, body := page("?month=2024-01&opening=1000")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d:\n%s", code, http.StatusOK, body)
+	}
+	for _, want := range []string{
+		"Statement for January 2024",
+		"2024-01-01 to 2024-01-31",
+		"fiscal year 2023-04-01 to 2024-03-31",
+		`<td>Opening balance</td><td class="amount">1000.00</td>`,
+		`<td>Closing balance</td><td class="amount">1047.51</td>`,
+		"<td>TXN003</td>",
+		"<td>Fees</td>\n        <td class=\"amount\">1</td>\n        <td class=\"amount\">-2.99</td>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("January statement does not contain %q", want)
+		}
+	}
+	if strings.Contains(body, "TXN004") {
+		t.Error("January statement lists February's TXN004")
+	}
+
+	// the latest month by default, and balances carried past the last transaction
+	if _, body := page("?opening=1000"); !strings.Contains(body, "Statement for March 2024") || !strings.Contains(body, `<td>Opening balance</td><td class="amount">1035.51</td>`) {
+		t.Errorf("default statement is not March's, opening with 1035.51:\n%s", body)
+	}
+	if _, body := page("?month=2024-06&opening=1000"); !strings.Contains(body, `<td>Opening balance</td><td class="amount">1023.51</td>`) || !strings.Contains(body, "No transactions in June 2024") {
+		t.Errorf("June statement does not carry the closing balance of 1023.51:\n%s", body)
+	}
+
+	if code, _ := page("?month=January"); code != http.StatusBadRequest {
+		t.Errorf("invalid month: status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestArchiveTransactions(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+	process := func() processResponse {
+		rec := httptest.NewRecorder()
+		ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+		var resp processResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	rec := httptest.NewRecorder()
+	ArchiveHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/archive", nil), db)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("archive without a policy status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	process()
+	acct := accounts()[0]
+	p := retentionPolicy{Years: 2, Action: retentionArchive, ArchiveDir: t.TempDir()}
+	now := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	resp, err := archiveTransactions(db, acct, p, now)
+	if err != nil {
+		t.Fatalf("could not archive transactions: %v", err)
+	}
+	if resp.Moved != 3 || resp.Kept != 2 {
+		t.Errorf("moved %d and kept %d transactions, want 3 and 2", resp.Moved, resp.Kept)
+	}
+
+	b, err := os.ReadFile(p.archiveFile(acct))
+	if err != nil {
+		t.Fatalf("could not read archive file: %v", err)
+	}
+	if lines := strings.Count(string(b), "\n"); lines != 3 {
+		t.Errorf("archive file has %d lines, want 3", lines)
+	}
+	if entries, _ := os.ReadDir(p.ArchiveDir); len(entries) != 1 {
+		t.Errorf("archive directory holds %d files, want only the archive file", len(entries))
+	}
+
+	// a staged archive leaves the archive file as it was until it is renamed
+	staged, err := stageArchive(p.archiveFile(acct), []vault.Transaction{{TransactionID: "TXN9"}})
+	if err != nil {
+		t.Fatalf("could not stage archive: %v", err)
+	}
+	if after, _ := os.ReadFile(p.archiveFile(acct)); string(after) != string(b) {
+		t.Errorf("staging changed the archive file")
+	}
+	if c, _ := os.ReadFile(staged); strings.Count(string(c), "\n") != 4 || !strings.HasPrefix(string(c), string(b)) {
+		t.Errorf("staged archive is %q, want the archive file and one more line", c)
+	}
+	os.Remove(staged)
+
+	// staging transactions the archive file holds, as a retried run does,
+	// leaves it as it was
+	var old []vault.Transaction
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(string(b), "\n"), "\n") {
+		var txn vault.Transaction
+		if err := json.Unmarshal([]byte(line), &txn); err != nil {
+			t.Fatal(err)
+		}
+		old = append(old, txn)
+	}
+	if staged, err = stageArchive(p.archiveFile(acct), old); err != nil {
+		t.Fatalf("could not stage archive: %v", err)
+	}
+	if c, _ := os.ReadFile(staged); string(c) != string(b) {
+		t.Errorf("retried archival appended %q, want nothing", strings.TrimPrefix(string(c), string(b)))
+	}
+	os.Remove(staged)
+	archived := 0
+	if err := forEachWithPrefix(db, ArchivePrefix+acct.Name+"\x00", func(string, []byte) { archived++ }); err != nil || archived != 3 {
+		t.Errorf("archive keyspace holds %d transactions (err %v), want 3", archived, err)
+	}
+
+	// archived transactions are not stored again, nor archived twice
+	if got := process(); got.Transactions != 2 || got.Summary.TotalTransactions != 2 {
+		t.Errorf("processing after archival stored %d transactions, want 2", got.Transactions)
+	}
+	if resp, err := archiveTransactions(db, acct, p, now); err != nil || resp.Moved != 0 {
+		t.Errorf("second archival moved %d transactions (err %v), want 0", resp.Moved, err)
+	}
+}
+
+func TestStoreTransactions(t *testing.T) {
+	// small tables limit a badger transaction to a couple of thousand keys
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithMaxTableSize(1 << 20).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	paypal, eur := account{Name: "paypal"}, account{Name: "paypal-eur"}
+	if _, found, err := storedTransactions(db, paypal); found || err != nil {
+		t.Fatalf("before processing: found %v, err %v, want nothing", found, err)
+	}
+
+	transactions := []vault.Transaction{
+		{TransactionID: "eur-X", Description: "second"},
+		{TransactionID: "TXN1", Description: "first"},
+		{Description: "without an ID"},
+		{TransactionID: "TXN1", Description: "conflicting"},
+	}
+	for i := 0; i < 5000; i++ {
+		transactions = append(transactions, vault.Transaction{TransactionID: fmt.Sprintf("BULK%05d", i), Description: "bulk payment"})
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		for i, tx := range transactions {
+			if err := setJSON(txn, fmt.Sprintf("scratch-%d", i), tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, badger.ErrTxnTooBig) {
+		t.Fatalf("storing %d transactions in one badger transaction: got %v, want ErrTxnTooBig", len(transactions), err)
+	}
+
+	mark := func(acct account) {
+		t.Helper()
+		if err := db.Update(func(txn *badger.Txn) error { return setJSON(txn, ProcessedPrefix+acct.Name, time.Now()) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := storeTransactions(db, paypal, transactions); err != nil {
+		t.Fatalf("could not store %d transactions: %v", len(transactions), err)
+	}
+	if _, found, _ := storedTransactions(db, paypal); found {
+		t.Errorf("transactions are found before the run marks the account as processed")
+	}
+	mark(paypal)
+	// "paypal-eur" with ID "X" would share a key with "paypal" and ID "eur-X"
+	// if the account were separated by a dash
+	if err := storeTransactions(db, eur, []vault.Transaction{{TransactionID: "X", Description: "euro"}}); err != nil {
+		t.Fatal(err)
+	}
+	mark(eur)
+
+	got, found, err := storedTransactions(db, paypal)
+	if !found || err != nil || len(got) != len(transactions) {
+		t.Fatalf("stored %d transactions (found %v, err %v), want %d", len(got), found, err, len(transactions))
+	}
+	for i := range got {
+		if got[i].Description != transactions[i].Description {
+			t.Errorf("transaction %d is %q, want %q in the order of the vault files", i, got[i].Description, transactions[i].Description)
+			break
+		}
+	}
+
+	// processing again replaces the account's transactions, and leaves the
+	// other account's alone
+	if err := storeTransactions(db, paypal, transactions[:2]); err != nil {
+		t.Fatalf("could not store transactions again: %v", err)
+	}
+	mark(paypal)
+	if got, found, err := storedTransactions(db, paypal); !found || err != nil || len(got) != 2 {
+		t.Errorf("after reprocessing: %d transactions (found %v, err %v), want 2", len(got), found, err)
+	}
+	if got, _, err := storedTransactions(db, eur); err != nil || len(got) != 1 || got[0].Description != "euro" {
+		t.Errorf("other account holds %+v (err %v), want its own transaction", got, err)
+	}
+}
+
+func TestProcessVault(t *testing.T) {
+	setupBookkeeping(t, testCSV)
+	if err := os.WriteFile(rulesFile(), []byte(`[{"pattern": "hosting", "type": "Fees"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ProcessVault(context.Background(), vaultDir(), ledgerDir())
+	if err != nil {
+		t.Fatalf("could not process vault: %v", err)
+	}
+	if result.Transactions != 5 || result.Summary.TotalFees != 3 {
+		t.Errorf("got %d transactions and %d fees, want 5 and 3 with the hosting rule", result.Transactions, result.Summary.TotalFees)
+	}
+	if _, err := os.Stat(filepath.Join(ledgerDir(), ledgerFilename)); err != nil {
+		t.Errorf("ledger was not generated: %v", err)
+	}
+
+	if _, err := ProcessVault(context.Background(), filepath.Join(t.TempDir(), "missing"), ledgerDir()); !errors.Is(err, vault.ErrVaultDirMissing) {
+		t.Errorf("missing vault: got %v, want ErrVaultDirMissing", err)
+	}
+}
+
+func TestFeesToPaymentsRatio(t *testing.T) {
+	t.Setenv("FEE_RATIO_MAX_PERCENT", "4")
+	s := calculateSummary(map[vault.TransactionType][]vault.Transaction{
+		vault.PaymentTransaction: {{Amount: vault.MoneyFromFloat(100.00)}, {Amount: vault.MoneyFromFloat(150.00)}},
+		vault.FeeTransaction:     {{Amount: vault.MoneyFromFloat(-12.50)}},
+	})
+	if s.FeesToPaymentsRatio == nil || *s.FeesToPaymentsRatio != 0.05 || !s.FeesOverThreshold {
+		t.Errorf("ratio %v, over %v, want 0.05 over the 4%% limit", s.FeesToPaymentsRatio, s.FeesOverThreshold)
+	}
+	if got, want := feeAlert(s), "Fees are 5.00% of payments, over the limit of 4%."; got != want {
+		t.Errorf("alert = %q, want %q", got, want)
+	}
+
+	t.Setenv("FEE_RATIO_MAX_PERCENT", "5.5")
+	if s := calculateSummary(map[vault.TransactionType][]vault.Transaction{
+		vault.PaymentTransaction: {{Amount: vault.MoneyFromFloat(250.00)}},
+		vault.FeeTransaction:     {{Amount: vault.MoneyFromFloat(-12.50)}},
+	}); s.FeesOverThreshold || feeAlert(s) != "" {
+		t.Errorf("fees under the limit flagged: %+v", s)
+	}
+
+	s = calculateSummary(map[vault.TransactionType][]vault.Transaction{vault.FeeTransaction: {{Amount: vault.MoneyFromFloat(-2.50)}}})
+	if s.FeesToPaymentsRatio != nil || s.FeesOverThreshold {
+		t.Errorf("without payments: ratio %v, over %v, want unavailable", s.FeesToPaymentsRatio, s.FeesOverThreshold)
+	}
+	b, _ := json.Marshal(s)
+	if !strings.Contains(string(b), `"fees_to_payments_ratio":null`) {
+		t.Errorf("ratio without payments encodes as %s, want null", b)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	h := WithRequestID(http.HandlerFunc(EffectiveConfigHandler))
+	serve := func(id string) (*httptest.ResponseRecorder, errorResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/config", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var body errorResponse
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec, body
+	}
+
+	rec, body := serve("abc-123")
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" || body.RequestID != "abc-123" {
+		t.Errorf("header %q, error request_id %q, want the incoming abc-123", got, body.RequestID)
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, id := range []string{"", "has spaces", strings.Repeat("x", 400)} {
+		rec, body := serve(id)
+		if got := rec.Header().Get(RequestIDHeader); !uuid.MatchString(got) || body.RequestID != got {
+			t.Errorf("incoming %q: header %q, error request_id %q, want a generated UUID", id, got, body.RequestID)
+		}
+	}
+
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, "abc-123"))
+	requestLog(req).Println("ERROR: something failed")
+	if !strings.Contains(buf.String(), "request_id=abc-123 ERROR: something failed") {
+		t.Errorf("log line %q does not carry the request ID", buf.String())
+	}
+}
+
+func TestPendingHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	pending := func() pendingResponse {
+		rec := httptest.NewRecorder()
+		PendingHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/pending", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		var resp pendingResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := pending(); resp.LedgerExists || resp.PendingCount != 5 || !resp.ReprocessNeeded {
+		t.Errorf("before any ledger: %+v, want all 5 transactions pending", resp)
+	}
+
+	rec := httptest.NewRecorder()
+	ProcessHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/process", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("process status = %d: %s", rec.Code, rec.Body)
+	}
+	if resp := pending(); !resp.LedgerExists || resp.LedgerGenerated == nil || resp.LedgerCount != 5 || resp.PendingCount != 0 || resp.ReprocessNeeded {
+		t.Errorf("after processing: %+v, want nothing pending", resp)
+	}
+
+	csv := "Date,Type,Amount,Description,Transaction ID\n2024-04-01,Payment,20.00,Late sale,TXN006\n2024-04-02,Fee,-1.00,No ID fee,\n"
+	if err := os.WriteFile(filepath.Join(os.Getenv("VAULT_DIR"), "april.csv"), []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(os.Getenv("VAULT_DIR"), "transactions.csv")); err != nil {
+		t.Fatal(err)
+	}
+	resp := pending()
+	if resp.PendingCount != 2 || resp.RemovedCount != 5 || !resp.ReprocessNeeded {
+		t.Fatalf("after a new export: %+v, want 2 pending and 5 removed", resp)
+	}
+	if resp.Pending[0].TransactionID != "TXN006" || resp.Pending[1].Description != "No ID fee" {
+		t.Errorf("pending = %+v, want the new export's transactions", resp.Pending)
+	}
+}
+
+func TestSummaryImage(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	get := func(target, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		SummaryImageHandler(rec, req, db)
+		return rec
+	}
+
+	rec := get("/api/bookkeeping/summary.png", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("status = %d, content type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != summaryImageWidth || b.Dy() != summaryImageHeight {
+		t.Errorf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), summaryImageWidth, summaryImageHeight)
+	}
+	// the first row's swatch has the color of the payments
+	want := parseHexColor(categoryColors()[string(vault.PaymentTransaction)])
+	if got := color.RGBAModel.Convert(img.At(70, 340)); got != want {
+		t.Errorf("swatch color = %v, want %v", got, want)
+	}
+
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if rec := get("/api/bookkeeping/summary.png", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("revalidating status = %d, want 304", rec.Code)
+	}
+	if rec := get("/api/bookkeeping/summary.png", ""); rec.Header().Get("ETag") != etag {
+		t.Errorf("ETag changed without the data changing: %q, then %q", etag, rec.Header().Get("ETag"))
+	}
+
+	rec = get("/api/bookkeeping/summary.png?from=2024-02-01&to=2024-03-31", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("filtered image: status %d, ETag %q, want a new image", rec.Code, rec.Header().Get("ETag"))
+	}
+	if rec := get("/api/bookkeeping/summary.png?from=yesterday", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid date status = %d, want 400", rec.Code)
+	}
+}
+
+func TestVaultFiles(t *testing.T) {
+	setupBookkeeping(t, testCSV)
+	dir := os.Getenv("VAULT_DIR")
+	outside := filepath.Join(filepath.Dir(dir), "secret.csv")
+	if err := os.WriteFile(outside, []byte(testCSV), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link.csv")); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	VaultFilesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/files", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp vaultFilesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, f := range resp.Files {
+		if f.Name == "transactions.csv" {
+			found = true
+			if f.Rows != 5 || f.Size != int64(len(testCSV)) || f.Modified.IsZero() {
+				t.Errorf("transactions.csv = %+v, want 5 rows and %d bytes", f, len(testCSV))
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("files = %+v, want transactions.csv", resp.Files)
+	}
+
+	download := func(name string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		VaultFileDownloadHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/files/download?file="+url.QueryEscape(name), nil))
+		return rec
+	}
+
+	rec = download("transactions.csv")
+	if rec.Code != http.StatusOK || rec.Body.String() != testCSV {
+		t.Fatalf("download status = %d, body %q", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="transactions.csv"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	for _, name := range []string{"../secret.csv", "sub/transactions.csv", "/etc/passwd", "..", "missing.csv", "link.csv"} {
+		if rec := download(name); rec.Code != http.StatusNotFound {
+			t.Errorf("download %q: status = %d, want 404", name, rec.Code)
+		}
+	}
+	if rec := download(""); rec.Code != http.StatusBadRequest {
+		t.Errorf("download without a file: status = %d, want 400", rec.Code)
+	}
+}
+
+func FuzzParseAmount(f *testing.F) {
+	for _, seed := range []string{"150.00", "-2.50", " 1e3 ", "1e400", "NaN", "-Inf", "0x1p-2", "1,5", "12.50 USD", "\x00", "١٢٣", ""} {
+		f.Add(seed)
+	}
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	f.Fuzz(func(t *testing.T, amount string) {
+		if v, _, err := vault.ParseAmount(amount, amountLocale()); err == nil {
+			if _, err := json.Marshal(v); err != nil {
+				t.Errorf("ParseAmount(%q) = %v cannot be encoded: %v", amount, v, err)
+			}
+		}
+		if d, err := parseDecimal(amount); err == nil && (math.IsNaN(d) || math.IsInf(d, 0)) {
+			t.Errorf("parseDecimal(%q) = %v, want an error", amount, d)
+		}
+	})
+}
+
+func TestPageTemplates(t *testing.T) {
+	gh := GRCHandler{AssetsFS: http.Dir("../assets")}
+	pages, err := filepath.Glob("../assets/templates/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range pages {
+		if _, err := gh.loadTemplate("/templates/" + filepath.Base(page)); err != nil {
+			t.Errorf("%s: %v", page, err)
+		}
+	}
+
+	db := setupBookkeeping(t, testCSV)
+	rec := httptest.NewRecorder()
+	gh.BookkeepingHandler(rec, httptest.NewRequest(http.MethodGet, "/bookkeeping/", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bookkeeping status = %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Net liquidity", "<td>TXN001</td>", `<span class="tag" style="background-color: #`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("bookkeeping page does not contain %q from its partials", want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	gh.LedgerHandler(rec, httptest.NewRequest(http.MethodGet, "/ledger", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "No Ledger Available") {
+		t.Errorf("ledger status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestParseReportingPeriod(t *testing.T) {
+	now := time.Date(2024, time.March, 15, 18, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		spec, from, to string
+	}{
+		{"90d", "2023-12-17", "2024-03-15"},
+		{"1d", "2024-03-15", "2024-03-15"},
+		{"3m", "2023-12-16", "2024-03-15"},
+		{"year", "2024-01-01", "2024-12-31"},
+		{"Fiscal-Year", "2023-04-01", "2024-03-31"},
+	} {
+		p, err := parseReportingPeriod(tt.spec, now, "04-01")
+		if err != nil || p.From != tt.from || p.To != tt.to {
+			t.Errorf("parseReportingPeriod(%q) = %+v, %v, want %s to %s", tt.spec, p, err, tt.from, tt.to)
+		}
+	}
+	if p, err := parseReportingPeriod("fiscal-year", now, "03-01"); err != nil || p.From != "2024-03-01" {
+		t.Errorf("fiscal year from March = %+v, %v, want it to start 2024-03-01", p, err)
+	}
+
+	for _, spec := range []string{"0d", "xd", "week", ""} {
+		if _, err := parseReportingPeriod(spec, now, "01-01"); err == nil {
+			t.Errorf("parseReportingPeriod(%q) succeeded, want an error", spec)
+		}
+	}
+	if _, err := parseReportingPeriod("fiscal-year", now, "13-01"); err == nil {
+		t.Error("fiscal year starting in month 13 succeeded, want an error")
+	}
+}
+
+func TestReportingPeriodDefault(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+	t.Setenv("REPORTING_PERIOD", "30d")
+
+	get := func(target string) (*httptest.ResponseRecorder, bookkeepingResponse) {
+		rec := httptest.NewRecorder()
+		BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, target, nil), db)
+		var resp bookkeepingResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec, resp
+	}
+
+	rec, resp := get("/api/bookkeeping")
+	if resp.Count != 0 || resp.Summary.TotalTransactions != 0 || resp.Period == nil || resp.Period.Name != "30d" {
+		t.Errorf("default: count %d, summary %d, period %+v, want nothing from 2024 in the last 30 days", resp.Count, resp.Summary.TotalTransactions, resp.Period)
+	}
+	if !strings.HasPrefix(rec.Header().Get("X-Reporting-Period"), "30d (") {
+		t.Errorf("X-Reporting-Period = %q", rec.Header().Get("X-Reporting-Period"))
+	}
+
+	if rec, resp := get("/api/bookkeeping?all=true"); resp.Count != 5 || resp.Period != nil || rec.Header().Get("X-Reporting-Period") != "" {
+		t.Errorf("all: count %d, period %+v, want all 5 transactions without a period", resp.Count, resp.Period)
+	}
+	if _, resp := get("/api/bookkeeping?from=2024-02-01"); resp.Count != 2 || resp.Summary.TotalTransactions != 2 || resp.Period != nil {
+		t.Errorf("from February: count %d, summary %d, want 2", resp.Count, resp.Summary.TotalTransactions)
+	}
+	if rec, _ := get("/api/bookkeeping?all=maybe"); rec.Code != http.StatusBadRequest {
+		t.Errorf("all=maybe status = %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	SummaryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/summary", nil), db)
+	if rec.Header().Get("X-Reporting-Period") == "" || !strings.Contains(rec.Body.String(), `"total_transactions":0`) {
+		t.Errorf("summary: %s, want the empty default period", rec.Body)
+	}
+}
+
+// TestFingerprintAssets tests that pages link to the assets with a
+// fingerprint of their contents, and without one when it is turned off.
+func TestFingerprintAssets(t *testing.T) {
+	gh := GRCHandler{AssetsFS: http.Dir("../assets")}
+	if err := gh.FingerprintAssets(); err != nil {
+		t.Fatalf("FingerprintAssets: %v", err)
+	}
+
+	css, err := os.ReadFile("../assets/goreportcard.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(css)
+	want := "/assets/goreportcard.css?v=" + hex.EncodeToString(sum[:])[:fingerprintLength]
+	if got := gh.assetURL("/assets/goreportcard.css"); got != want {
+		t.Errorf("assetURL = %q, want %q", got, want)
+	}
+	if got := gh.assetURL("/assets/missing.css"); got != "/assets/missing.css" {
+		t.Errorf("assetURL of a missing asset = %q, want it unchanged", got)
+	}
+	if _, ok := gh.fingerprints["/assets/templates/base.html"]; ok {
+		t.Error("the templates should not be fingerprinted")
+	}
+
+	rec := httptest.NewRecorder()
+	gh.AboutHandler(rec, httptest.NewRequest(http.MethodGet, "/about", nil))
+	if !strings.Contains(rec.Body.String(), `href="`+want+`"`) {
+		t.Errorf("about page does not link to %s", want)
+	}
+
+	t.Setenv("ASSET_FINGERPRINTS", "false")
+	if err := gh.FingerprintAssets(); err != nil {
+		t.Fatalf("FingerprintAssets: %v", err)
+	}
+	if got := gh.assetURL("/assets/goreportcard.css"); got != "/assets/goreportcard.css" {
+		t.Errorf("assetURL with ASSET_FINGERPRINTS=false = %q, want it unchanged", got)
+	}
+}
+
+func TestTaxTotalsHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+	t.Setenv("TAX_VAT_RATES", "deductible=20")
+	if err := os.WriteFile(os.Getenv("RULES_FILE"), []byte(`[{"pattern": "^hosting", "type": "Fees", "tax_category": "Deductible"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"query": "processing fee", "tag": "tax:Deductible"}`, `{"query": "product sale", "tag": "tax:Income"}`} {
+		rec := httptest.NewRecorder()
+		TagsHandler(rec, httptest.NewRequest(http.MethodPost, "/api/bookkeeping/tags", strings.NewReader(body)), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("tag %s: status = %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	totals := func(query string) (int, taxTotalsResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		TaxTotalsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/tax"+query, nil), db)
+		var resp taxTotalsResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	// the hosting invoices by rule and the PayPal fee by tag, each split at
+	// 20% VAT and rounded to the cent
+	_, resp := totals("")
+	want := []taxCategoryTotal{
+		{TaxCategory: "Deductible", Count: 3, Gross: vault.MoneyFromFloat(-26.99), VAT: &vatSplit{Rate: 20, Net: vault.MoneyFromFloat(-22.49), VAT: vault.MoneyFromFloat(-4.5)}},
+		{TaxCategory: "Income", Count: 1, Gross: vault.MoneyFromFloat(100.5)},
+	}
+	if resp.Year != 2024 || resp.FiscalYear.From != "2024-01-01" || resp.FiscalYear.To != "2024-12-31" {
+		t.Errorf("fiscal year = %d %+v, want 2024", resp.Year, resp.FiscalYear)
+	}
+	if len(resp.Categories) != len(want) {
+		t.Fatalf("categories = %+v, want %+v", resp.Categories, want)
+	}
+	for i, w := range want {
+		got := resp.Categories[i]
+		if got.TaxCategory != w.TaxCategory || got.Count != w.Count || got.Gross.String() != w.Gross.String() || (got.VAT == nil) != (w.VAT == nil) {
+			t.Errorf("category %d = %+v, want %+v", i, got, w)
+			continue
+		}
+		if got.VAT != nil && (got.VAT.Rate != w.VAT.Rate || got.VAT.Net.String() != w.VAT.Net.String() || got.VAT.VAT.String() != w.VAT.VAT.String()) {
+			t.Errorf("%s VAT = %+v, want %+v", got.TaxCategory, *got.VAT, *w.VAT)
+		}
+	}
+	if resp.Unassigned.Count != 1 || resp.Unassigned.Gross.String() != "-50.00" {
+		t.Errorf("unassigned = %+v, want the bank transfer", resp.Unassigned)
+	}
+	if resp.VAT == nil || resp.VAT.Net.String() != "-22.49" || resp.VAT.VAT.String() != "-4.50" {
+		t.Errorf("VAT = %+v, want -22.49 net and -4.50 VAT", resp.VAT)
+	}
+
+	// the fiscal year from March 2023 leaves out the March hosting invoice
+	t.Setenv("FISCAL_YEAR_START", "03-01")
+	_, resp = totals("?year=2023")
+	if resp.FiscalYear.From != "2023-03-01" || len(resp.Categories) != 2 || resp.Categories[0].Count != 2 || resp.Categories[0].Gross.String() != "-14.99" {
+		t.Errorf("fiscal year 2023 = %+v, want two deductible transactions totalling -14.99", resp)
+	}
+	if _, resp = totals(""); resp.Year != 2024 || resp.FiscalYear.From != "2024-03-01" {
+		t.Errorf("default fiscal year = %d %+v, want the one starting 2024-03-01", resp.Year, resp.FiscalYear)
+	}
+
+	if code, _ := totals("?year=last"); code != http.StatusBadRequest {
+		t.Errorf("year=last: status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestWeekdaysHandler(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	weekdays := func(query string) weekdaysResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		WeekdaysHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping/weekdays"+query, nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var resp weekdaysResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Monday the 15th of January to Wednesday the 17th, then Saturday the 3rd
+	// of February and Sunday the 3rd of March
+	want := []weekdayTotal{
+		{Weekday: "Monday", Count: 1, Inflow: vault.MoneyFromFloat(100.5), Net: vault.MoneyFromFloat(100.5)},
+		{Weekday: "Tuesday", Count: 1, Outflow: vault.MoneyFromFloat(50), Net: vault.MoneyFromFloat(-50)},
+		{Weekday: "Wednesday", Count: 1, Outflow: vault.MoneyFromFloat(2.99), Net: vault.MoneyFromFloat(-2.99)},
+		{Weekday: "Thursday"},
+		{Weekday: "Friday"},
+		{Weekday: "Saturday", Count: 1, Outflow: vault.MoneyFromFloat(12), Net: vault.MoneyFromFloat(-12)},
+		{Weekday: "Sunday", Count: 1, Outflow: vault.MoneyFromFloat(12), Net: vault.MoneyFromFloat(-12)},
+	}
+	resp := weekdays("?all=true")
+	if len(resp.Weekdays) != len(want) {
+		t.Fatalf("weekdays = %+v, want all seven", resp.Weekdays)
+	}
+	for i, w := range want {
+		got := resp.Weekdays[i]
+		if got.Weekday != w.Weekday || got.Count != w.Count || got.Inflow.String() != w.Inflow.String() || got.Outflow.String() != w.Outflow.String() || got.Net.String() != w.Net.String() {
+			t.Errorf("weekday %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	// only January
+	resp = weekdays("?from=2024-01-01&to=2024-01-31")
+	if resp.Weekdays[5].Count != 0 || resp.Weekdays[6].Count != 0 || resp.Weekdays[0].Count != 1 {
+		t.Errorf("January weekdays = %+v, want nothing on the weekend", resp.Weekdays)
+	}
+}
+
+func TestCalculateWeekdaysTimezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Sunday evening in UTC is already Monday in Tokyo
+	transactions := []vault.Transaction{
+		{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(10.00), Timestamp: time.Date(2024, time.January, 14, 23, 30, 0, 0, time.UTC)},
+		{Type: vault.PaymentTransaction, Amount: vault.MoneyFromFloat(5.00)},
+	}
+	if resp := calculateWeekdays(transactions, time.UTC); resp.Weekdays[6].Count != 1 || resp.Undated != 1 {
+		t.Errorf("UTC weekdays = %+v, want the payment on Sunday and one undated", resp)
+	}
+	if resp := calculateWeekdays(transactions, tokyo); resp.Weekdays[0].Count != 1 || resp.Weekdays[6].Count != 0 || resp.Timezone != "Asia/Tokyo" {
+		t.Errorf("Tokyo weekdays = %+v, want the payment on Monday", resp)
+	}
+}
+
+func TestBookkeepingAPIDateRange(t *testing.T) {
+	db := setupBookkeeping(t, testCSV+"2024-01-31T23:30:00Z,Payment,25.00,Late sale,TXN006\n")
+
+	get := func(query string) (int, bookkeepingResponse, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping"+query, nil), db)
+		var resp bookkeepingResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, resp, rec.Body.String()
+	}
+
+	// the sale at 23:30 on the last day of January is within to=2024-01-31,
+	// and the summary covers only the transactions in the range
+	_, resp, _ := get("?from=2024-01-16&to=2024-01-31")
+	if resp.Count != 3 || resp.Summary.TotalTransactions != 3 || resp.Summary.PaymentsSum != vault.MoneyFromFloat(25) {
+		t.Errorf("January 16-31 = %d transactions, summary %+v, want 3 with 25.00 of payments", resp.Count, resp.Summary)
+	}
+
+	for _, query := range []string{"?from=2024-13-01", "?to=31/01/2024", "?from=2024-02-01&to=2024-01-01"} {
+		code, _, body := get(query)
+		var e struct {
+			Error string `json:"error"`
+		}
+		if code != http.StatusBadRequest || json.Unmarshal([]byte(body), &e) != nil || e.Error == "" {
+			t.Errorf("%s: status = %d, body %s, want 400 with a JSON error", query, code, body)
+		}
+	}
+}
+
+// TestTransactionDayReportingZone tests that the date filters put a
+// transaction on the day of the reporting time zone, as the breakdowns do,
+// rather than on the day of its own offset.
+func TestTransactionDayReportingZone(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2024-02-01T00:30:00+02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := vault.Transaction{Date: "2024-02-01T00:30:00+02:00", Timestamp: ts, Type: vault.PaymentTransaction}
+	february := transactionFilter{From: "2024-02-01"}
+
+	for zone, want := range map[string]string{"UTC": "2024-01-31", "Europe/Helsinki": "2024-02-01"} {
+		t.Setenv("REPORTING_TIMEZONE", zone)
+		if got := transactionDay(txn); got != want {
+			t.Errorf("in %s, day = %s, want %s", zone, got, want)
+		}
+		if got := february.matches(txn); got != (want == "2024-02-01") {
+			t.Errorf("in %s, from=2024-02-01 matches = %t, want it on %s", zone, got, want)
+		}
+		b := calculateBreakdown(map[vault.TransactionType][]vault.Transaction{vault.PaymentTransaction: {txn}}, "day", reportingLocation(), 0)
+		if len(b.Periods) != 1 || b.Periods[0].Period != want {
+			t.Errorf("in %s, breakdown = %+v, want the day %s", zone, b.Periods, want)
+		}
+	}
+}
+
+// TestBookkeepingAPIBucketsCoverTransactions tests that every transaction is
+// listed, and counted in the summary, under exactly one type, including
+// those no rule or heuristic classifies.
+func TestBookkeepingAPIBucketsCoverTransactions(t *testing.T) {
+	db := setupBookkeeping(t, testCSV+"2024-03-04,Other,-30.00,Office chair,TXN006\n")
+
+	rec := httptest.NewRecorder()
+	BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping", nil), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var resp bookkeepingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Transactions) != len(vault.TransactionTypes) {
+		t.Errorf("got keys for %d types, want %d", len(resp.Transactions), len(vault.TransactionTypes))
+	}
+	listed := 0
+	for _, txns := range resp.Transactions {
+		listed += len(txns)
+	}
+	s := resp.Summary
+	counted := s.TotalPayments + s.TotalTransfers + s.TotalFees + s.TotalUncategorized
+	if listed != 6 || counted != 6 || resp.Count != 6 || s.TotalTransactions != 6 {
+		t.Errorf("listed %d, counted %d, count %d and total %d, want all 6", listed, counted, resp.Count, s.TotalTransactions)
+	}
+	if n := len(resp.Transactions[string(vault.UncategorizedTransaction)]); n == 0 || n != s.TotalUncategorized {
+		t.Errorf("got %d uncategorized transactions and a TotalUncategorized of %d, want the chair among them", n, s.TotalUncategorized)
+	}
+}
+
+func TestBookkeepingAPIPagination(t *testing.T) {
+	db := setupBookkeeping(t, testCSV)
+
+	get := func(query string) (int, bookkeepingResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping"+query, nil), db)
+		var resp bookkeepingResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, resp
+	}
+	ids := func(resp bookkeepingResponse) []string {
+		var ids []string
+		for _, txns := range resp.Transactions {
+			for _, txn := range txns {
+				ids = append(ids, txn.TransactionID)
+			}
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	_, all := get("")
+	if all.Total != 5 || all.Page != 1 || all.PageSize != 5 || all.TotalPages != 1 {
+		t.Errorf("unpaginated = total %d, page %d of %d, size %d, want page 1 of 1 with all 5", all.Total, all.Page, all.TotalPages, all.PageSize)
+	}
+
+	// the pages together list every transaction once, and each has the
+	// counts and summary of all of them
+	var seen []string
+	for page := 1; page <= 3; page++ {
+		code, resp := get(fmt.Sprintf("?page=%d&page_size=2", page))
+		if code != http.StatusOK {
+			t.Fatalf("page %d: status = %d, want %d", page, code, http.StatusOK)
+		}
+		if resp.Total != 5 || resp.Count != 5 || resp.Page != page || resp.PageSize != 2 || resp.TotalPages != 3 {
+			t.Errorf("page %d = total %d, count %d, page %d of %d, size %d, want page %d of 3 of 5", page, resp.Total, resp.Count, resp.Page, resp.TotalPages, resp.PageSize, page)
+		}
+		if !reflect.DeepEqual(resp.Summary, all.Summary) {
+			t.Errorf("page %d: summary %+v, want that of every page %+v", page, resp.Summary, all.Summary)
+		}
+		if want := min(2, 5-2*(page-1)); len(ids(resp)) != want {
+			t.Errorf("page %d lists %v, want %d transactions", page, ids(resp), want)
+		}
+		seen = append(seen, ids(resp)...)
+	}
+	sort.Strings(seen)
+	if !reflect.DeepEqual(seen, ids(all)) {
+		t.Errorf("pages list %v, want %v", seen, ids(all))
+	}
+
+	if _, resp := get("?page=9&page_size=2"); len(ids(resp)) != 0 || resp.Total != 5 {
+		t.Errorf("past the last page = %v of %d, want none of 5", ids(resp), resp.Total)
+	}
+	if _, resp := get("?page_size=5000"); resp.PageSize != maxPageSize || resp.Page != 1 {
+		t.Errorf("page_size=5000 = page %d of size %d, want page 1 of size %d", resp.Page, resp.PageSize, maxPageSize)
+	}
+	for _, query := range []string{"?page=0", "?page=-1", "?page=x", "?page_size=0", "?page=1&page_size=-5"} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestMarkdownToHTML(t *testing.T) {
+	md := "# FK Master Ledger\n\n" +
+		"**Generated:** 2024-01-15 10:00:00\n\n" +
+		"## Payments\n\n" +
+		"| Dagsetning | Upphæð | Lýsing |\n" +
+		"|------------|-------:|--------|\n" +
+		"| 2024-01-15 | 100.50 | <script>alert(1)</script> |\n" +
+		"| 2024-01-16 | 5 | A \\| B, *fast* TXN_001_A |\n\n" +
+		"- first\n- `<b>`\n\n" +
+		"<img src=x onerror=alert(1)>\n"
+	got := markdownToHTML(md)
+
+	for _, want := range []string{
+		"<h1>FK Master Ledger</h1>",
+		"<p><strong>Generated:</strong> 2024-01-15 10:00:00</p>",
+		"<h2>Payments</h2>",
+		"<th>Dagsetning</th>\n<th align=\"right\">Upphæð</th>\n<th>Lýsing</th>",
+		"<td>2024-01-15</td>\n<td align=\"right\">100.50</td>\n<td>alert(1)</td>",
+		"<td>A | B, <em>fast</em> TXN_001_A</td>",
+		"<ul>\n<li>first</li>\n<li><code>&lt;b&gt;</code></li>\n</ul>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<script") || strings.Contains(got, "<img") {
+		t.Errorf("markup from the ledger is not left out:\n%s", got)
+	}
+}
+
+func TestBookkeepingAPIBalances(t *testing.T) {
+	t.Setenv("OPENING_BALANCE", "1000")
+	db := setupBookkeeping(t, testCSV)
+
+	balances := func(query string) map[string]string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping"+query, nil), db)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", query, rec.Code, http.StatusOK)
+		}
+		var resp bookkeepingResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, txns := range resp.Transactions {
+			for _, txn := range txns {
+				got[txn.TransactionID] = txn.Balance.String()
+			}
+		}
+		return got
+	}
+
+	want := map[string]string{"TXN001": "1100.50", "TXN002": "1050.50", "TXN003": "1047.51", "TXN004": "1035.51", "TXN005": "1023.51"}
+	if got := balances(""); !reflect.DeepEqual(got, want) {
+		t.Errorf("balances = %v, want %v", got, want)
+	}
+	// the balances are those of the whole account, whatever is listed
+	if got := balances("?type=Fees&opening=0"); got["TXN003"] != "47.51" {
+		t.Errorf("balances of the fees from 0 = %v, want 47.51 after TXN003", got)
+	}
+
+	// an invalid opening balance is an error, not 0
+	t.Setenv("OPENING_BALANCE", "lots")
+	rec := httptest.NewRecorder()
+	BookkeepingAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/bookkeeping", nil), db)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("invalid OPENING_BALANCE: status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
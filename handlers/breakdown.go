@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// breakdownPeriod holds the totals of the transactions falling in one period
+type breakdownPeriod struct {
+	Period string                                `json:"period"`
+	Start  time.Time                             `json:"start"`
+	Totals map[vault.TransactionType]vault.Money `json:"totals"`
+	Counts map[vault.TransactionType]int         `json:"counts"`
+	Net    vault.Money                           `json:"net"` // excludes internal transfers
+	// Categories totals the period's transactions by category path, rolled
+	// up to the requested level; only listed when a level is requested
+	Categories []categoryPathTotal `json:"categories,omitempty"`
+}
+
+type breakdownResponse struct {
+	Granularity string            `json:"granularity"`
+	Timezone    string            `json:"timezone"`
+	Periods     []breakdownPeriod `json:"periods"`
+	Undated     int               `json:"undated"` // transactions skipped because their date could not be parsed
+}
+
+// reportingLocation returns the time zone transactions are bucketed in,
+// configured with REPORTING_TIMEZONE
+func reportingLocation() *time.Location {
+	return locationFromEnv("REPORTING_TIMEZONE")
+}
+
+// granularityFromRequest returns the granularity query parameter, defaulting to month
+func granularityFromRequest(r *http.Request) (string, error) {
+	switch g := r.URL.Query().Get("granularity"); g {
+	case "":
+		return "month", nil
+	case "day", "week", "month":
+		return g, nil
+	default:
+		return "", fmt.Errorf("unknown granularity %q, expected day, week or month", g)
+	}
+}
+
+// periodStart returns the start of the day, week (starting on Monday) or month
+// containing t, in t's location
+func periodStart(t time.Time, granularity string) time.Time {
+	y, m, d := t.Date()
+	switch granularity {
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// nextPeriod returns the start of the period following the one starting at start
+func nextPeriod(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+func periodLabel(start time.Time, granularity string) string {
+	if granularity == "month" {
+		return start.Format("2006-01")
+	}
+	return start.Format(dateLayout)
+}
+
+// periodBuckets groups dated transactions by the period containing their
+// reporting time in loc. Times are converted to loc before bucketing, so a transaction
+// shortly before midnight UTC can fall on the next local day. It returns the
+// start of every period from the first to the last transaction, including
+// periods without any, and the number of undated transactions skipped.
+func periodBuckets(transactions []vault.Transaction, granularity string, loc *time.Location) ([]time.Time, map[time.Time][]vault.Transaction, int) {
+	buckets := make(map[time.Time][]vault.Transaction)
+	undated := 0
+	var first, last time.Time
+	for _, txn := range transactions {
+		if txn.Timestamp.IsZero() {
+			undated++
+			continue
+		}
+
+		start := periodStart(reportingTime(txn).In(loc), granularity)
+		buckets[start] = append(buckets[start], txn)
+
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+
+	if len(buckets) == 0 {
+		return nil, buckets, undated
+	}
+
+	var starts []time.Time
+	for start := first; !start.After(last); start = nextPeriod(start, granularity) {
+		starts = append(starts, start)
+	}
+
+	return starts, buckets, undated
+}
+
+// calculateBreakdown totals categorized transactions per category for
+// consecutive periods in loc, including periods without any transactions.
+// With a level of at least 1, each period also totals its category paths
+// rolled up to that level.
+func calculateBreakdown(categorized map[vault.TransactionType][]vault.Transaction, granularity string, loc *time.Location, level int) breakdownResponse {
+	var transactions []vault.Transaction
+	for _, t := range vault.TransactionTypes {
+		for _, txn := range categorized[t] {
+			txn.Type = t
+			transactions = append(transactions, txn)
+		}
+	}
+
+	starts, buckets, undated := periodBuckets(transactions, granularity, loc)
+	resp := breakdownResponse{Granularity: granularity, Timezone: loc.String(), Periods: []breakdownPeriod{}, Undated: undated}
+	for _, start := range starts {
+		p := breakdownPeriod{
+			Period: periodLabel(start, granularity),
+			Start:  start,
+			Totals: make(map[vault.TransactionType]vault.Money),
+			Counts: make(map[vault.TransactionType]int),
+		}
+		cats := make(categoryPathTotals)
+		for _, txn := range buckets[start] {
+			amount := txn.Amount
+			p.Totals[txn.Type] = addMoney(p.Totals[txn.Type], amount)
+			p.Counts[txn.Type]++
+			if !txn.Internal {
+				p.Net = addMoney(p.Net, amount)
+			}
+			cats.add(txn.Type, txn)
+		}
+		if level > 0 {
+			p.Categories = rollUpCategories(cats.sorted(), level)
+		}
+		resp.Periods = append(resp.Periods, p)
+	}
+
+	return resp
+}
+
+// BreakdownHandler returns the account's transaction totals per day, week or
+// month, bucketed in the reporting time zone, and with the level parameter
+// those of each category rolled up to that level
+func BreakdownHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	granularity, err := granularityFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	level, err := levelFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	_, categorized, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, calculateBreakdown(categorized, granularity, reportingLocation(), level))
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// Directions in which a transaction posted on a day off is shifted
+const (
+	shiftNone     = "none"
+	shiftForward  = "forward"  // to the next business day
+	shiftBackward = "backward" // to the previous business day
+)
+
+// businessDayShift moves the reporting date of transactions posted on a day
+// off, such as a weekend or public holiday, to a business day, so that a
+// transaction the bank dates on a Saturday is reported with Friday's or
+// Monday's
+type businessDayShift struct {
+	Direction string
+	DaysOff   excludedDays
+}
+
+// parseBusinessDayShift returns a shift in the given direction over the days
+// off listed in spec, as for exclude_days. At least one weekday must be a
+// business day.
+func parseBusinessDayShift(direction, spec string) (businessDayShift, error) {
+	switch direction {
+	case shiftNone, shiftForward, shiftBackward:
+	default:
+		return businessDayShift{}, fmt.Errorf("unknown direction %q, expected none, forward or backward", direction)
+	}
+	daysOff, err := parseExcludedDays(spec)
+	if err != nil {
+		return businessDayShift{}, err
+	}
+	if len(daysOff.weekdays) == 7 {
+		return businessDayShift{}, fmt.Errorf("every weekday is a day off")
+	}
+	return businessDayShift{Direction: direction, DaysOff: daysOff}, nil
+}
+
+// businessDayShiftFromEnv returns the shift configured with BUSINESS_DAY_SHIFT
+// (default none) over the days off of BUSINESS_DAYS_OFF (default weekends)
+func businessDayShiftFromEnv() businessDayShift {
+	s, err := parseBusinessDayShift(getEnvOrDefault("BUSINESS_DAY_SHIFT", shiftNone), getEnvOrDefault("BUSINESS_DAYS_OFF", "weekends"))
+	if err != nil {
+		log.Printf("Invalid BUSINESS_DAY_SHIFT or BUSINESS_DAYS_OFF, using none: %v", err)
+		return businessDayShift{Direction: shiftNone}
+	}
+	return s
+}
+
+// shift returns t moved by whole days, in loc, until it falls on a business
+// day, keeping its time of day
+func (s businessDayShift) shift(t time.Time, loc *time.Location) time.Time {
+	step := 1
+	switch s.Direction {
+	case shiftForward:
+	case shiftBackward:
+		step = -1
+	default:
+		return t
+	}
+
+	t = t.In(loc)
+	for s.DaysOff.excludes(t) {
+		t = t.AddDate(0, 0, step)
+	}
+	return t
+}
+
+// applyBusinessDayShift sets the reporting date of each dated transaction,
+// shifted off days off in loc
+func applyBusinessDayShift(transactions []vault.Transaction, s businessDayShift, loc *time.Location) {
+	for i := range transactions {
+		transactions[i].ReportingDate = time.Time{}
+		if transactions[i].Timestamp.IsZero() {
+			continue
+		}
+		transactions[i].ReportingDate = s.shift(transactions[i].Timestamp, loc)
+	}
+}
+
+// reportingTime returns the time a transaction is bucketed at: its reporting
+// date, or its timestamp when it has none
+func reportingTime(txn vault.Transaction) time.Time {
+	if !txn.ReportingDate.IsZero() {
+		return txn.ReportingDate
+	}
+	return txn.Timestamp
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// cashFlowPeriod holds the money flowing in and out during one period
+type cashFlowPeriod struct {
+	Period  string      `json:"period"`
+	Start   time.Time   `json:"start"`
+	Inflow  vault.Money `json:"inflow"`
+	Outflow vault.Money `json:"outflow"` // a positive amount
+	Net     vault.Money `json:"net"`     // inflow minus outflow
+}
+
+// dailyAverage is the average flow per counted day, for projections
+type dailyAverage struct {
+	Days     int         `json:"days"`     // days from the first to the last transaction that are counted
+	Excluded int         `json:"excluded"` // days in the same range left out of the denominator
+	Inflow   vault.Money `json:"inflow"`
+	Outflow  vault.Money `json:"outflow"`
+	Net      vault.Money `json:"net"`
+}
+
+type cashFlowResponse struct {
+	Granularity  string           `json:"granularity"`
+	Timezone     string           `json:"timezone"`
+	Periods      []cashFlowPeriod `json:"periods"`
+	DailyAverage dailyAverage     `json:"daily_average"`
+	Undated      int              `json:"undated"` // transactions skipped because their date could not be parsed
+}
+
+// excludedDays are the days left out of the denominator of daily averages,
+// such as weekends and public holidays without any activity
+type excludedDays struct {
+	weekdays map[time.Weekday]bool
+	dates    map[string]bool // YYYY-MM-DD
+}
+
+// parseExcludedDays parses a comma-separated list of weekday names, dates
+// (YYYY-MM-DD) and "weekends", for Saturday and Sunday
+func parseExcludedDays(spec string) (excludedDays, error) {
+	e := excludedDays{weekdays: make(map[time.Weekday]bool), dates: make(map[string]bool)}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.EqualFold(item, "weekends") {
+			e.weekdays[time.Saturday], e.weekdays[time.Sunday] = true, true
+			continue
+		}
+		if d, ok := parseWeekday(item); ok {
+			e.weekdays[d] = true
+			continue
+		}
+		if _, err := time.Parse(dateLayout, item); err != nil {
+			return excludedDays{}, fmt.Errorf("invalid excluded day %q, expected a weekday, weekends or YYYY-MM-DD", item)
+		}
+		e.dates[item] = true
+	}
+	return e, nil
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// excludes reports whether the day starting at day is left out
+func (e excludedDays) excludes(day time.Time) bool {
+	return e.weekdays[day.Weekday()] || e.dates[day.Format(dateLayout)]
+}
+
+// excludedDaysFromRequest returns the exclude_days query parameter,
+// defaulting to CASHFLOW_EXCLUDE_DAYS
+func excludedDaysFromRequest(r *http.Request) (excludedDays, error) {
+	spec := r.URL.Query().Get("exclude_days")
+	if spec == "" {
+		spec = getEnvOrDefault("CASHFLOW_EXCLUDE_DAYS", "")
+	}
+	return parseExcludedDays(spec)
+}
+
+// flow sums the incoming and outgoing amounts of transactions. Fees are
+// always outgoing, whatever the sign of their amount. Internal transfers move
+// money between the user's own accounts and are left out.
+func flow(transactions []vault.Transaction) (inflow, outflow vault.Money) {
+	for _, txn := range transactions {
+		if txn.Internal {
+			continue
+		}
+		amount := txn.Amount
+		if amount > 0 && txn.Type != vault.FeeTransaction {
+			inflow = addMoney(inflow, amount)
+		} else {
+			outflow = addMoney(outflow, amount.Abs())
+		}
+	}
+	return inflow, outflow
+}
+
+// calculateCashFlow sums incoming and outgoing amounts for consecutive periods
+// in loc, including periods without any transactions, and averages them per
+// day. The excluded days still appear in the periods and their amounts in the
+// average, but are not counted in its denominator.
+func calculateCashFlow(transactions []vault.Transaction, granularity string, loc *time.Location, excluded excludedDays) cashFlowResponse {
+	starts, buckets, undated := periodBuckets(transactions, granularity, loc)
+	resp := cashFlowResponse{Granularity: granularity, Timezone: loc.String(), Periods: []cashFlowPeriod{}, Undated: undated}
+	var avg dailyAverage
+	for _, start := range starts {
+		p := cashFlowPeriod{Period: periodLabel(start, granularity), Start: start}
+		p.Inflow, p.Outflow = flow(buckets[start])
+		p.Net = addMoney(p.Inflow, -p.Outflow)
+		resp.Periods = append(resp.Periods, p)
+
+		avg.Inflow = addMoney(avg.Inflow, p.Inflow)
+		avg.Outflow = addMoney(avg.Outflow, p.Outflow)
+	}
+
+	days, _, _ := periodBuckets(transactions, "day", loc)
+	for _, day := range days {
+		if excluded.excludes(day) {
+			avg.Excluded++
+		} else {
+			avg.Days++
+		}
+	}
+	if avg.Days > 0 {
+		avg.Inflow = avg.Inflow.Div(avg.Days)
+		avg.Outflow = avg.Outflow.Div(avg.Days)
+		avg.Net = avg.Inflow - avg.Outflow
+	} else {
+		avg.Inflow, avg.Outflow = 0, 0
+	}
+	resp.DailyAverage = avg
+
+	return resp
+}
+
+// CashFlowHandler returns the account's inflow and outflow per day, week or
+// month, bucketed in the reporting time zone, and their daily average
+func CashFlowHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	granularity, err := granularityFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	excluded, err := excludedDaysFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, calculateCashFlow(transactions, granularity, reportingLocation(), excluded))
+}
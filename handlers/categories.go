@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// categoryPathTotal is the number and total of the transactions in a category,
+// including those in the categories under it
+type categoryPathTotal struct {
+	Category string      `json:"category"` // full path, such as "Fees > BankFees"
+	Count    int         `json:"count"`
+	Sum      vault.Money `json:"sum"`
+}
+
+// categoryPathTotals sums transactions by their category path
+type categoryPathTotals map[string]categoryPathTotal
+
+// add counts the transaction towards its category as one of type t
+func (c categoryPathTotals) add(t vault.TransactionType, txn vault.Transaction) {
+	txn.Type = t
+	path := txn.CategoryPath()
+	total := c[path]
+	total.Category = path
+	total.Count++
+	total.Sum = addMoney(total.Sum, txn.Amount)
+	c[path] = total
+}
+
+// sorted returns the totals ordered by type, in display order, and then by path
+func (c categoryPathTotals) sorted() []categoryPathTotal {
+	order := make(map[string]int, len(vault.TransactionTypes))
+	for i, t := range vault.TransactionTypes {
+		order[string(t)] = i
+	}
+	totals := make([]categoryPathTotal, 0, len(c))
+	for _, total := range c {
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		ti := order[vault.CategoryAt(totals[i].Category, 1)]
+		tj := order[vault.CategoryAt(totals[j].Category, 1)]
+		if ti != tj {
+			return ti < tj
+		}
+		return totals[i].Category < totals[j].Category
+	})
+	return totals
+}
+
+// rollUpCategories rolls the totals of categories deeper than level up into
+// their ancestor at that level, so that level 1 totals each type
+func rollUpCategories(totals []categoryPathTotal, level int) []categoryPathTotal {
+	c := make(categoryPathTotals)
+	for _, total := range totals {
+		path := vault.CategoryAt(total.Category, level)
+		rolled := c[path]
+		rolled.Category = path
+		rolled.Count += total.Count
+		rolled.Sum = addMoney(rolled.Sum, total.Sum)
+		c[path] = rolled
+	}
+	return c.sorted()
+}
+
+// levelFromRequest returns the level query parameter, the depth categories
+// are rolled up to, and 0 without it
+func levelFromRequest(r *http.Request) (int, error) {
+	v := strings.TrimSpace(r.URL.Query().Get("level"))
+	if v == "" {
+		return 0, nil
+	}
+	level, err := strconv.Atoi(v)
+	if err != nil || level < 1 {
+		return 0, fmt.Errorf("level must be a positive integer, got %q", v)
+	}
+	return level, nil
+}
@@ -3,9 +3,11 @@ package handlers
 import (
 	"container/heap"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/dgraph-io/badger/v2"
@@ -15,6 +17,8 @@ import (
 const (
 	// RepoPrefix is the badger prefix for repos
 	RepoPrefix string = "repos-"
+	// CheckCachePrefix is the badger prefix for cached per-file check results
+	CheckCachePrefix string = "check-cache-"
 )
 
 // CheckHandler handles the request for checking a repo
@@ -22,30 +26,86 @@ func CheckHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
 	w.Header().Set("Content-Type", "application/json")
 
 	repo := download.Clean(r.FormValue("repo"))
+	if deniedRepo(r, repo) {
+		writeJSONError(w, http.StatusForbidden, errRepoDenied.Error())
+		return
+	}
 
 	c := download.NewProxyClient("https://proxy.golang.org")
 	moduleName, err := c.ModuleName(repo)
 	if err != nil {
-		log.Println("ERROR: could not get module name:", err)
+		requestLog(r).Println("ERROR: could not get module name:", err)
 	}
 
-	if moduleName != "" {
+	if moduleName != "" && moduleName != repo {
 		repo = moduleName
+		if deniedRepo(r, repo) {
+			writeJSONError(w, http.StatusForbidden, errRepoDenied.Error())
+			return
+		}
 	}
 
-	log.Printf("Checking repo %q...", repo)
+	requestLog(r).Printf("Checking repo %q...", repo)
 
 	forceRefresh := r.Method != "GET" // if this is a GET request, try to fetch from cached version in badger first
-	_, err = newChecksResp(db, repo, forceRefresh)
-	if err != nil {
-		log.Println("ERROR: from newChecksResp:", err)
-		http.Error(w, "Could not analyze the repository: "+err.Error(), http.StatusBadRequest)
+
+	// a repo being graded is about to be cached again, so even GET requests
+	// wait for its job
+	job := gradingJobs.find(repo)
+	grade := job == nil && forceRefresh
+	if job == nil && !forceRefresh {
+		_, cached := cachedChecksResp(db, repo)
+		grade = !cached
+	}
+	if grade {
+		job, err = submitGrading(db, repo, forceRefresh)
+		if errors.Is(err, errQueueFull) {
+			w.Header().Set("Retry-After", strconv.Itoa(gradingRetryAfter))
+			writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if errors.Is(err, errRepoDenied) {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	// unless asked to wait, answer right away with the job, whose progress
+	// the client follows at /api/jobs/<id>
+	wait, _ := strconv.ParseBool(r.FormValue("wait"))
+	if job != nil && !wait && job.progress != nil {
+		s := jobStatus(job)
+		w.Header().Set("Location", "/api/jobs/"+s.ID)
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(s); err != nil {
+			requestLog(r).Println("JSON marshal error:", err)
+		}
 		return
 	}
 
+	if job != nil {
+		// answer right away while the job waits for a worker, so the client
+		// can show its position and ask again; its request shares the job
+		if pos := gradingJobs.position(job); pos > 0 {
+			b, err := json.Marshal(map[string]interface{}{"status": "queued", "position": pos})
+			if err != nil {
+				requestLog(r).Println("JSON marshal error:", err)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			w.Write(b)
+			return
+		}
+
+		if _, err := job.wait(); err != nil {
+			requestLog(r).Println("ERROR: from newChecksResp:", err)
+			writeJSONError(w, http.StatusBadRequest, "Could not analyze the repository: "+err.Error())
+			return
+		}
+	}
+
 	b, err := json.Marshal(map[string]string{"redirect": "/report/" + repo})
 	if err != nil {
-		log.Println("JSON marshal error:", err)
+		requestLog(r).Println("JSON marshal error:", err)
 	}
 	w.WriteHeader(http.StatusOK)
 	w.Write(b)
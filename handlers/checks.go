@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -65,6 +66,135 @@ func getFromCache(db *badger.DB, repo string) (checksResp, error) {
 	return resp, nil
 }
 
+// checkCacheTTL is how long per-file check results are kept
+const checkCacheTTL = 30 * 24 * time.Hour
+
+// badgerResultCache stores per-file check results in badger
+type badgerResultCache struct {
+	db *badger.DB
+}
+
+func (c badgerResultCache) Get(key string) ([]check.Error, bool) {
+	var errs []check.Error
+	found, err := getJSON(c.db, CheckCachePrefix+key, &errs)
+	if err != nil {
+		log.Println("ERROR: could not read check cache:", err)
+		return nil, false
+	}
+	return errs, found
+}
+
+func (c badgerResultCache) Set(key string, errs []check.Error) {
+	b, err := json.Marshal(errs)
+	if err != nil {
+		log.Println("ERROR: could not marshal check cache entry:", err)
+		return
+	}
+
+	err = c.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(CheckCachePrefix+key), b).WithTTL(checkCacheTTL))
+	})
+	if err != nil {
+		log.Println("ERROR: could not write check cache:", err)
+	}
+}
+
+// complexityGate returns the complexity gate configured with MAX_COMPLEXITY
+// (0, the default, disables it) and MAX_COMPLEXITY_GRADE (default C)
+func complexityGate() check.ComplexityGate {
+	max, err := strconv.Atoi(getEnvOrDefault("MAX_COMPLEXITY", "0"))
+	if err != nil || max < 0 {
+		log.Printf("Invalid MAX_COMPLEXITY, disabling the complexity gate: %v", err)
+		return check.ComplexityGate{}
+	}
+	grade, err := check.ParseGrade(getEnvOrDefault("MAX_COMPLEXITY_GRADE", check.GradeC))
+	if err != nil {
+		log.Printf("Invalid MAX_COMPLEXITY_GRADE, using %s: %v", check.GradeC, err)
+		grade = check.GradeC
+	}
+	return check.ComplexityGate{Max: max, MaxGrade: grade}
+}
+
+// minFilesGate returns the file count gate configured with MIN_FILES
+// (default check.DefaultMinFiles, 0 disables it) and MIN_FILES_GRADE (default B)
+func minFilesGate() check.FileCountGate {
+	min, err := strconv.Atoi(getEnvOrDefault("MIN_FILES", strconv.Itoa(check.DefaultMinFiles)))
+	if err != nil || min < 0 {
+		log.Printf("Invalid MIN_FILES, using %d: %v", check.DefaultMinFiles, err)
+		min = check.DefaultMinFiles
+	}
+	grade, err := check.ParseGrade(getEnvOrDefault("MIN_FILES_GRADE", check.GradeB))
+	if err != nil {
+		log.Printf("Invalid MIN_FILES_GRADE, using %s: %v", check.GradeB, err)
+		grade = check.GradeB
+	}
+	return check.FileCountGate{Min: min, MaxGrade: grade}
+}
+
+// todoOptions returns the todo check settings configured with TODO_WEIGHT
+// (0, the default, lists TODO comments without grading them) and
+// TODO_THRESHOLD (default check.DefaultTodoThreshold per 1000 lines)
+func todoOptions() check.TodoOptions {
+	var opts check.TodoOptions
+	if w, err := strconv.ParseFloat(getEnvOrDefault("TODO_WEIGHT", "0"), 64); err == nil && w >= 0 {
+		opts.Weight = w
+	} else {
+		log.Printf("Invalid TODO_WEIGHT, using 0: %v", err)
+	}
+	if th, err := strconv.ParseFloat(getEnvOrDefault("TODO_THRESHOLD", "0"), 64); err == nil && th >= 0 {
+		opts.Threshold = th
+	} else {
+		log.Printf("Invalid TODO_THRESHOLD, using %d: %v", check.DefaultTodoThreshold, err)
+	}
+	return opts
+}
+
+// gofmtGrace returns the lines a file may need to change for gofmt before
+// they count against the grade, configured with GOFMT_GRACE (default 0)
+func gofmtGrace() int {
+	n, err := strconv.Atoi(getEnvOrDefault("GOFMT_GRACE", "0"))
+	if err != nil || n < 0 {
+		log.Printf("Invalid GOFMT_GRACE, using 0: %v", err)
+		return 0
+	}
+	return n
+}
+
+// coverageOptions returns the coverage check settings configured with
+// COVERAGE, which enables it, COVERAGE_MIN (default check.DefaultCoverageMin
+// percent per package), COVERAGE_PROFILE and COVERAGE_TIMEOUT (default
+// check.DefaultCoverageTimeout)
+func coverageOptions() check.CoverageOptions {
+	var opts check.CoverageOptions
+	enabled, err := strconv.ParseBool(getEnvOrDefault("COVERAGE", "false"))
+	if err != nil {
+		log.Printf("Invalid COVERAGE, disabling the coverage check: %v", err)
+	}
+	opts.Enabled = enabled
+	if min, err := strconv.ParseFloat(getEnvOrDefault("COVERAGE_MIN", "0"), 64); err == nil && min >= 0 && min <= 100 {
+		opts.Min = min
+	} else {
+		log.Printf("Invalid COVERAGE_MIN, using %d: %v", check.DefaultCoverageMin, err)
+	}
+	if timeout, err := time.ParseDuration(getEnvOrDefault("COVERAGE_TIMEOUT", "0s")); err == nil && timeout >= 0 {
+		opts.Timeout = timeout
+	} else {
+		log.Printf("Invalid COVERAGE_TIMEOUT, using %s: %v", check.DefaultCoverageTimeout, err)
+	}
+	opts.Profile = getEnvOrDefault("COVERAGE_PROFILE", "")
+	return opts
+}
+
+// useGolint reports whether GOLINT asks for style to be graded with the
+// deprecated golint instead of revive
+func useGolint() bool {
+	golint, err := strconv.ParseBool(getEnvOrDefault("GOLINT", "false"))
+	if err != nil {
+		log.Printf("Invalid GOLINT, using revive: %v", err)
+	}
+	return golint
+}
+
 type checksResp struct {
 	Checks               []check.Score `json:"checks"`
 	Average              float64       `json:"average"`
@@ -78,20 +208,61 @@ type checksResp struct {
 	LastRefreshFormatted string        `json:"formatted_last_refresh"`
 	LastRefreshHumanized string        `json:"humanized_last_refresh"`
 	DidError             bool          `json:"did_error"`
+	Gates                []check.Gate  `json:"gates"`
 }
 
+// cachedChecksResp returns the repo's cached report card, and false if there is none
+func cachedChecksResp(db *badger.DB, repo string) (checksResp, bool) {
+	resp, err := getFromCache(db, repo)
+	if err != nil {
+		// just log the error and continue
+		log.Println(err)
+		return checksResp{}, false
+	}
+
+	// grade is not stored for some repos, yet
+	resp.Grade = check.CapGrade(gradingOptions(db, repo).Thresholds.Grade(resp.Average*100), resp.Gates)
+	return resp, true
+}
+
+// newChecksResp returns the repo's report card, from the cache unless
+// forceRefresh is set, and waits for it to be graded otherwise
 func newChecksResp(db *badger.DB, repo string, forceRefresh bool) (checksResp, error) {
 	if !forceRefresh {
-		resp, err := getFromCache(db, repo)
-		if err != nil {
-			// just log the error and continue
-			log.Println(err)
-		} else {
-			resp.Grade = check.GradeFromPercentage(resp.Average * 100) // grade is not stored for some repos, yet
+		if resp, ok := cachedChecksResp(db, repo); ok {
 			return resp, nil
 		}
 	}
 
+	job, err := submitGrading(db, repo, forceRefresh)
+	if err != nil {
+		return checksResp{}, err
+	}
+	return job.wait()
+}
+
+// submitGrading queues the grading of repo under a new job ID, sharing the
+// job of a grading of the repo already in progress
+func submitGrading(db *badger.DB, repo string, forceRefresh bool) (*gradingJob, error) {
+	return submitGradingJob(db, repo, forceRefresh, newGradingProgress(db, newRequestID(), repo, forceRefresh))
+}
+
+// submitGradingJob queues the grading of repo with its status tracked by p,
+// sharing the job of a grading of the repo already in progress. Repos on the
+// denylist are never queued; errRepoDenied is returned for them.
+func submitGradingJob(db *badger.DB, repo string, forceRefresh bool, p *gradingProgress) (*gradingJob, error) {
+	if pattern, denied := gradingDenylist.match(repo); denied {
+		log.Printf("DENIED: grading of %q, matching denylist pattern %q", repo, pattern)
+		return nil, errRepoDenied
+	}
+	return gradingJobs.submit(repo, p, func() (checksResp, error) {
+		return gradeRepo(db, repo, forceRefresh, p)
+	})
+}
+
+// gradeRepo downloads and grades the repo, reporting the progress of its
+// checks to p, and caches its report card
+func gradeRepo(db *badger.DB, repo string, forceRefresh bool, p *gradingProgress) (checksResp, error) {
 	c := download.NewProxyClient("https://proxy.golang.org")
 	ver, err := c.ProxyDownload(repo)
 	if err != nil {
@@ -99,7 +270,9 @@ func newChecksResp(db *badger.DB, repo string, forceRefresh bool) (checksResp, e
 		return checksResp{}, fmt.Errorf("could not download repo: %v", err)
 	}
 
-	checkResult, err := check.Run(dirName(repo, ver), false)
+	opts := gradingOptions(db, repo)
+	opts.Progress = p.setCheck
+	checkResult, err := check.RunWithOptions(dirName(repo, ver), false, opts)
 	if err != nil {
 		return checksResp{}, err
 	}
@@ -125,6 +298,7 @@ func newChecksResp(db *badger.DB, repo string, forceRefresh bool) (checksResp, e
 		LastRefreshFormatted: t.Format(time.UnixDate),
 		LastRefreshHumanized: humanize.Time(t),
 		DidError:             checkResult.DidError,
+		Gates:                checkResult.Gates,
 	}
 
 	respBytes, err := json.Marshal(resp)
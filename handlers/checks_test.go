@@ -1,6 +1,19 @@
 package handlers
 
-import "testing"
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/check"
+)
 
 var dirNameTests = []struct {
 	url  string
@@ -17,3 +30,221 @@ func TestDirName(t *testing.T) {
 		}
 	}
 }
+
+func TestRepoConfigHandler(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const repo = "github.com/foo/bar"
+	do := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		RepoConfigHandler(rec, httptest.NewRequest(method, "/api/config/"+repo, strings.NewReader(body)), db, repo)
+		return rec
+	}
+
+	if opts := gradingOptions(db, repo); opts.Exclude != nil || opts.Weights != nil || opts.Thresholds != nil {
+		t.Errorf("options without a config = %+v, want the defaults", opts)
+	}
+
+	rec := do(http.MethodPut, `{"exclude": ["gen/"], "weights": {"gofmt": 0.5}, "thresholds": {"A+": 95}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	opts := gradingOptions(db, repo)
+	if !reflect.DeepEqual(opts.Exclude, []string{"gen/"}) || opts.Weights["gofmt"] != 0.5 || opts.Thresholds.Grade(93) != check.GradeA {
+		t.Errorf("options = %+v, want the repo's config applied", opts)
+	}
+	if other := gradingOptions(db, "github.com/foo/baz"); other.Thresholds.Grade(93) != check.GradeAPlus {
+		t.Errorf("another repo's options = %+v, want the defaults", other)
+	}
+
+	if rec := do(http.MethodGet, ""); !strings.Contains(rec.Body.String(), `"gen/"`) {
+		t.Errorf("GET = %s, want the stored config", rec.Body)
+	}
+
+	for _, body := range []string{
+		`{"weights": {"spelling": 1}}`,
+		`{"weights": {"gofmt": -1}}`,
+		`{"thresholds": {"A": 95}}`,
+		`{"excluded": ["gen/"]}`,
+	} {
+		if rec := do(http.MethodPut, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: status = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	if rec := do(http.MethodDelete, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if opts := gradingOptions(db, repo); opts.Exclude != nil {
+		t.Errorf("options after DELETE = %+v, want the defaults", opts)
+	}
+}
+
+func TestGradingQueue(t *testing.T) {
+	q := newGradingQueue(1, 1)
+	release := make(chan struct{})
+	var runs []string
+	run := func(repo string) func() (checksResp, error) {
+		return func() (checksResp, error) {
+			<-release
+			runs = append(runs, repo)
+			return checksResp{Repo: repo}, nil
+		}
+	}
+
+	a, err := q.submit("a", nil, run("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := q.submit("a", nil, run("a")); again != a {
+		t.Error("a second request for a repo being graded did not share its job")
+	}
+	b, err := q.submit("b", nil, run("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.position(a); got != 0 {
+		t.Errorf("position of the running job = %d, want 0", got)
+	}
+	if got := q.position(b); got != 1 {
+		t.Errorf("position of the queued job = %d, want 1", got)
+	}
+	if _, err := q.submit("c", nil, run("c")); err != errQueueFull {
+		t.Errorf("submit with a full queue = %v, want errQueueFull", err)
+	}
+
+	close(release)
+	if resp, err := b.wait(); err != nil || resp.Repo != "b" {
+		t.Errorf("b = %+v, %v", resp, err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(runs, want) {
+		t.Errorf("runs = %v, want %v", runs, want)
+	}
+	if q.find("a") != nil || q.find("b") != nil {
+		t.Error("finished jobs are still found")
+	}
+}
+
+func TestGradingStatusHandler(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	status := func(id string) (int, gradingStatus) {
+		rec := httptest.NewRecorder()
+		GradingStatusHandler(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/"+id, nil), db, id)
+		var s gradingStatus
+		json.Unmarshal(rec.Body.Bytes(), &s)
+		return rec.Code, s
+	}
+
+	const repo = "github.com/foo/status"
+	release := make(chan struct{})
+	p := newGradingProgress(db, "job-1", repo, true)
+	job, err := gradingJobs.submit(repo, p, func() (checksResp, error) {
+		p.setCheck("gofmt", check.CheckPending)
+		p.setCheck("go_vet", check.CheckPending)
+		p.setCheck("gofmt", check.CheckDone)
+		<-release
+		return checksResp{Repo: repo, Grade: check.GradeAPlus}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the job to report its checks
+	var s gradingStatus
+	for i := 0; i < 100; i++ {
+		if _, s = status("job-1"); len(s.Checks) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := []checkProgress{{"gofmt", check.CheckDone}, {"go_vet", check.CheckPending}}
+	if s.Status != jobRunning || !reflect.DeepEqual(s.Checks, want) {
+		t.Errorf("running job = %s %+v, want running with %+v", s.Status, s.Checks, want)
+	}
+
+	close(release)
+	job.wait()
+	code, s := status("job-1")
+	if code != http.StatusOK || s.Status != jobDone || s.Result == nil || s.Result.Grade != check.GradeAPlus || s.Redirect != "/report/"+repo {
+		t.Errorf("finished job = %d %+v, want done with its report card", code, s)
+	}
+
+	if code, _ := status("unknown"); code != http.StatusNotFound {
+		t.Errorf("unknown job status = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, repo string
+		want          bool
+	}{
+		{"github.com/foo/bar", "github.com/foo/bar", true},
+		{"github.com/foo/bar", "github.com/Foo/Bar", true},
+		{"github.com/foo/bar", "github.com/foo/barbaz", false},
+		{"github.com/foo/...", "github.com/foo", true},
+		{"github.com/foo/...", "github.com/foo/bar/v2", true},
+		{"github.com/foo/...", "github.com/foobar/x", false},
+		{"github.com/*/monorepo", "github.com/acme/monorepo", true},
+		{"github.com/*/monorepo", "github.com/acme/sub/monorepo", false},
+	} {
+		if got := denylistMatch(tt.pattern, tt.repo); got != tt.want {
+			t.Errorf("denylistMatch(%q, %q) = %v, want %v", tt.pattern, tt.repo, got, tt.want)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "denylist")
+	if err := os.WriteFile(file, []byte("# resource bombs\ngithub.com/huge/monorepo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GRADING_DENYLIST", "github.com/spam/...")
+	t.Setenv("GRADING_DENYLIST_FILE", file)
+	t.Cleanup(func() { gradingDenylist = &repoDenylist{} })
+
+	check := func(repo string) int {
+		rec := httptest.NewRecorder()
+		CheckHandler(rec, httptest.NewRequest(http.MethodPost, "/checks?repo="+repo, nil), nil)
+		return rec.Code
+	}
+	for _, repo := range []string{"github.com/spam/x", "github.com/huge/monorepo"} {
+		if code := check(repo); code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", repo, code, http.StatusForbidden)
+		}
+	}
+	if _, err := submitGrading(nil, "github.com/huge/monorepo", true); err != errRepoDenied {
+		t.Errorf("submitGrading of a denied repo: err = %v, want %v", err, errRepoDenied)
+	}
+
+	// the file is read again once it changes
+	if err := os.WriteFile(file, []byte("github.com/other/repo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, denied := gradingDenylist.match("github.com/huge/monorepo"); denied {
+		t.Error("github.com/huge/monorepo is still denied after it was removed from the file")
+	}
+	if _, denied := gradingDenylist.match("github.com/other/repo"); !denied {
+		t.Error("github.com/other/repo is not denied after it was added to the file")
+	}
+
+	// a file that can no longer be read keeps the previous patterns
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, denied := gradingDenylist.match("github.com/other/repo"); !denied {
+		t.Error("github.com/other/repo is no longer denied after the file was removed")
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// hexColor matches the colors that can be configured, such as #2ecc71 or #f80
+var hexColor = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}){1,2}$`)
+
+// parseCategoryColors parses a comma-separated list of category=color pairs,
+// such as "Fees=#e74c3c,Payments=#2ecc71"
+func parseCategoryColors(spec string) (map[string]string, error) {
+	colors := make(map[string]string)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		category, color, ok := strings.Cut(item, "=")
+		category, color = strings.TrimSpace(category), strings.ToLower(strings.TrimSpace(color))
+		if !ok || category == "" || !hexColor.MatchString(color) {
+			return nil, fmt.Errorf("invalid category color %q, expected category=#rrggbb", item)
+		}
+		colors[category] = color
+	}
+	return colors, nil
+}
+
+// paletteColor generates the color of a category without a configured one.
+// It depends only on the name, so a category keeps its color as others are
+// added or removed.
+func paletteColor(category string) string {
+	h := fnv.New32a()
+	h.Write([]byte(category))
+	hue := float64(h.Sum32()%360) / 360
+	return hslColor(hue, 0.6, 0.5)
+}
+
+// hslColor converts a color given by its hue, saturation and lightness,
+// each between 0 and 1, to #rrggbb
+func hslColor(h, s, l float64) string {
+	c := (1 - math.Abs(2*l-1)) * s
+	channel := func(n float64) int {
+		k := math.Mod(n+h*12, 12)
+		v := l - c/2*math.Max(-1, math.Min(math.Min(k-3, 9-k), 1))
+		return int(math.Round(v * 255))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", channel(0), channel(8), channel(4))
+}
+
+// categoryColors returns the chart color of every transaction category, and
+// of any other category given one, configured with CATEGORY_COLORS or
+// generated from the category name
+func categoryColors() map[string]string {
+	configured, err := parseCategoryColors(getEnvOrDefault("CATEGORY_COLORS", ""))
+	if err != nil {
+		log.Printf("Invalid CATEGORY_COLORS, using generated colors: %v", err)
+	}
+
+	colors := make(map[string]string, len(vault.TransactionTypes)+len(configured))
+	for _, t := range vault.TransactionTypes {
+		colors[string(t)] = paletteColor(string(t))
+	}
+	for category, color := range configured {
+		colors[category] = color
+	}
+	return colors
+}
+
+// ColorsHandler returns the color of each category, for charts and legends
+func ColorsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, categoryColors())
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errRepoDenied is returned when a repo on the denylist is submitted for grading
+var errRepoDenied = errors.New("this repository is not graded on this server")
+
+// repoDenylist holds the patterns of the repos that are never graded: those
+// of GRADING_DENYLIST and of the file GRADING_DENYLIST_FILE, which is read
+// again whenever it changes, so entries can be added without a restart
+type repoDenylist struct {
+	mu       sync.Mutex
+	file     string    // file the patterns were read from
+	modTime  time.Time // modification time of the file when it was read
+	size     int64
+	patterns []string // patterns of the file
+}
+
+var gradingDenylist = &repoDenylist{}
+
+// filePatterns returns the patterns of the denylist file, reading it again if
+// it has changed since. When it cannot be read, the patterns read last are
+// kept, so that a file being rewritten does not let denied repos through.
+func (d *repoDenylist) filePatterns() []string {
+	file := getEnvOrDefault("GRADING_DENYLIST_FILE", "")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if file == "" {
+		d.file, d.patterns = "", nil
+		return nil
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		if file != d.file {
+			log.Printf("ERROR: could not read GRADING_DENYLIST_FILE %s: %v", file, err)
+			d.file, d.modTime, d.size, d.patterns = file, time.Time{}, 0, nil
+		}
+		return d.patterns
+	}
+	if file == d.file && fi.ModTime().Equal(d.modTime) && fi.Size() == d.size {
+		return d.patterns
+	}
+
+	patterns, err := readDenylist(file)
+	if err != nil {
+		log.Printf("ERROR: could not read GRADING_DENYLIST_FILE %s, keeping the previous denylist: %v", file, err)
+		return d.patterns
+	}
+	if d.file != "" {
+		log.Printf("Reloaded the grading denylist from %s: %d pattern(s)", file, len(patterns))
+	}
+	d.file, d.modTime, d.size, d.patterns = file, fi.ModTime(), fi.Size(), patterns
+	return patterns
+}
+
+// readDenylist reads the patterns of a denylist file, one per line, skipping
+// blank lines and # comments
+func readDenylist(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// match returns the denylist pattern repo matches, and false if it matches none
+func (d *repoDenylist) match(repo string) (string, bool) {
+	patterns := strings.Split(getEnvOrDefault("GRADING_DENYLIST", ""), ",")
+	for _, p := range append(patterns, d.filePatterns()...) {
+		if p = strings.TrimSpace(p); p != "" && denylistMatch(p, repo) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// denylistMatch reports whether repo matches a denylist pattern: an exact
+// path, a path ending in /... for it and every repo under it, or a glob
+// whose * matches within a path element, such as github.com/*/monorepo.
+// Paths are compared case-insensitively, as hosts such as GitHub do.
+func denylistMatch(pattern, repo string) bool {
+	pattern, repo = strings.ToLower(pattern), strings.ToLower(repo)
+	if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+		return repo == prefix || strings.HasPrefix(repo, prefix+"/")
+	}
+	if pattern == repo {
+		return true
+	}
+	ok, _ := path.Match(pattern, repo)
+	return ok
+}
+
+// deniedRepo reports whether the repo requested by r is on the denylist,
+// logging the attempt and the client's address for moderation
+func deniedRepo(r *http.Request, repo string) bool {
+	pattern, denied := gradingDenylist.match(repo)
+	if denied {
+		requestLog(r).Printf("DENIED: grading of %q requested by %s, matching denylist pattern %q", repo, r.RemoteAddr, pattern)
+	}
+	return denied
+}
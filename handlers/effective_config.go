@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gojp/goreportcard/check"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// Sources of a configuration value
+const (
+	configFromEnv     = "env"
+	configFromFile    = "file"
+	configFromDefault = "default"
+)
+
+// redacted replaces the values of secret settings
+const redacted = "[redacted]"
+
+// configSetting is a setting read from an environment variable
+type configSetting struct {
+	Name   string      `json:"name"`          // environment variable
+	Value  interface{} `json:"value"`         // value in effect, after parsing and falling back to the default
+	Source string      `json:"source"`        // env, or default when the variable is not set
+	Raw    string      `json:"raw,omitempty"` // value of the variable as set, before parsing
+}
+
+// configFile is a configuration file and what was read from it
+type configFile struct {
+	Name   string      `json:"name"`
+	Path   string      `json:"path"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"` // file, or default when the file does not exist
+	Error  string      `json:"error,omitempty"`
+}
+
+type gradingConfig struct {
+	Weights    map[string]float64 `json:"weights"`
+	Thresholds check.Thresholds   `json:"thresholds"`
+}
+
+type effectiveConfigResponse struct {
+	Settings []configSetting `json:"settings"`
+	Files    []configFile    `json:"files"`
+	// Grading holds the defaults; the settings of a repo are at /api/config/{repo}
+	Grading gradingConfig `json:"grading"`
+}
+
+// configSettings lists the environment variables the server reads, with the
+// value each resolves to
+var configSettings = []struct {
+	name  string
+	value func() interface{}
+}{
+	{"VAULT_DIR", func() interface{} { return vaultDir() }},
+	{"LEDGER_DIR", func() interface{} { return ledgerDir() }},
+	{"RULES_FILE", func() interface{} { return rulesFile() }},
+	{"NORMALIZATION_FILE", func() interface{} { return normalizationFile() }},
+	{"VAULT_IGNORE", func() interface{} { return getEnvOrDefault("VAULT_IGNORE", "") }},
+	{"VAULT_IGNORE_FILE", func() interface{} { return getEnvOrDefault("VAULT_IGNORE_FILE", "") }},
+	{"SOURCE_TIMEZONE", func() interface{} { return locationFromEnv("SOURCE_TIMEZONE").String() }},
+	{"REPORTING_TIMEZONE", func() interface{} { return reportingLocation().String() }},
+	{"BOOKKEEPING_DECIMALS", func() interface{} { return moneyDecimals }},
+	{"BOOKKEEPING_TIMEOUT", func() interface{} { return requestTimeout().String() }},
+	{"BOOKKEEPING_HIDE_BELOW", func() interface{} { return getEnvOrDefault("BOOKKEEPING_HIDE_BELOW", "0") }},
+	{"INCLUDE_ZERO_AMOUNTS", func() interface{} { return getEnvOrDefault("INCLUDE_ZERO_AMOUNTS", "true") }},
+	{"VAULT_READ_RETRIES", func() interface{} { return retryPolicy().Retries }},
+	{"VAULT_READ_RETRY_DELAY", func() interface{} { return retryPolicy().Delay.String() }},
+	{"VAULT_READ_RETRY_MAX_DELAY", func() interface{} { return retryPolicy().MaxDelay.String() }},
+	{"LEDGER_HISTORY", func() interface{} { return ledgerHistory() }},
+	{"CSV_DELIMITER", func() interface{} { return getEnvOrDefault("CSV_DELIMITER", "auto") }},
+	{"CSV_QUOTE_ESCAPE", func() interface{} { return csvDialect().Escape }},
+	{"CSV_LAZY_QUOTES", func() interface{} { return csvDialect().LazyQuotes }},
+	{"CSV_KEEP_NEWLINES", func() interface{} { return csvDialect().KeepNewlines }},
+	{"SIGN_EXPECTATIONS", func() interface{} { return signPolicy().Expect }},
+	{"SIGN_STRICT", func() interface{} { return signPolicy().Strict }},
+	{"PARSE_STRICTNESS", func() interface{} { return parseStrictness() }},
+	{"AMOUNT_COLUMNS", func() interface{} { return amountColumns().Mode }},
+	{"AMOUNT_LOCALE", func() interface{} { return amountLocale() }},
+	{"OPENING_BALANCE", func() interface{} { m, _ := openingBalance(); return m }},
+	{"DEBIT_COLUMN", func() interface{} { return amountColumns().Debit }},
+	{"CREDIT_COLUMN", func() interface{} { return amountColumns().Credit }},
+	{"SELFCHECK_SKIP", func() interface{} { return getEnvOrDefault("SELFCHECK_SKIP", "") }},
+	{"DEFAULT_TRANSACTION_TYPE", func() interface{} { return defaultTransactionType() }},
+	{"INTERNAL_TRANSFER_WINDOW", func() interface{} { return internalTransferMatching().Window.String() }},
+	{"INTERNAL_TRANSFER_TOLERANCE", func() interface{} { return internalTransferMatching().Tolerance }},
+	{"UPLOAD_MAX_BYTES", func() interface{} { return uploadMaxBytes() }},
+	{"UPLOAD_TOKEN", func() interface{} { return getEnvOrDefault("UPLOAD_TOKEN", "") }},
+	{"CASHFLOW_EXCLUDE_DAYS", func() interface{} { return getEnvOrDefault("CASHFLOW_EXCLUDE_DAYS", "") }},
+	{"BUSINESS_DAY_SHIFT", func() interface{} { return businessDayShiftFromEnv().Direction }},
+	{"BUSINESS_DAYS_OFF", func() interface{} { return getEnvOrDefault("BUSINESS_DAYS_OFF", "weekends") }},
+	{"INSIGHTS_MIN_PERCENT", func() interface{} { return getEnvOrDefault("INSIGHTS_MIN_PERCENT", "20") }},
+	{"INSIGHTS_MIN_AMOUNT", func() interface{} { return getEnvOrDefault("INSIGHTS_MIN_AMOUNT", "0") }},
+	{"REPORTING_PERIOD", func() interface{} { p, _ := defaultReportingPeriod(time.Now()); return p.Name }},
+	{"FISCAL_YEAR_START", func() interface{} { return getEnvOrDefault("FISCAL_YEAR_START", "01-01") }},
+	{"ANOMALY_K", func() interface{} { return getEnvOrDefault("ANOMALY_K", "3") }},
+	{"ANOMALY_METHOD", func() interface{} { return getEnvOrDefault("ANOMALY_METHOD", anomalyStddev) }},
+	{"GAPS_MIN_DAYS", func() interface{} { return getEnvOrDefault("GAPS_MIN_DAYS", "14") }},
+	{"TAX_VAT_RATES", func() interface{} { return vatRates() }},
+	{"SUMMARY_AVERAGE_MONTHS", func() interface{} { return averageMonths() }},
+	{"FEE_RATIO_MAX_PERCENT", func() interface{} { return getEnvOrDefault("FEE_RATIO_MAX_PERCENT", "") }},
+	{"FEE_ASSOCIATION", func() interface{} { return feeAssociationFromEnv().Rules }},
+	{"FEE_ASSOCIATION_WINDOW", func() interface{} { return feeAssociationFromEnv().Window.String() }},
+	{"FEE_TIERS", func() interface{} { return feeTiersFromEnv() }},
+	{"CATEGORY_COLORS", func() interface{} { return categoryColors() }},
+	{"RETENTION_YEARS", func() interface{} { p, _ := retentionPolicyFromEnv(); return p.Years }},
+	{"RETENTION_ACTION", func() interface{} { p, _ := retentionPolicyFromEnv(); return p.Action }},
+	{"ARCHIVE_DIR", func() interface{} { return getEnvOrDefault("ARCHIVE_DIR", "") }},
+	{"PAGE_CACHE_MAX_AGE", func() interface{} { return pageMaxAge().String() }},
+	{"ASSET_FINGERPRINTS", func() interface{} { return getEnvOrDefault("ASSET_FINGERPRINTS", "true") }},
+	{"ALERT_WEBHOOK_URL", func() interface{} { return getEnvOrDefault("ALERT_WEBHOOK_URL", "") }},
+	{"ALERT_MIN_AMOUNT", func() interface{} { return getEnvOrDefault("ALERT_MIN_AMOUNT", "") }},
+	{"ALERT_RETRIES", func() interface{} { w, _ := alertWebhookFromEnv(); return w.Retries }},
+	{"ALERT_RETRY_DELAY", func() interface{} { w, _ := alertWebhookFromEnv(); return w.Delay.String() }},
+	{"ALERT_WORKERS", func() interface{} { return alertJobs.workers }},
+	{"BADGE_PASSING_GRADE", func() interface{} { return badgePassingGrade() }},
+	{"MAX_COMPLEXITY", func() interface{} { return complexityGate().Max }},
+	{"MAX_COMPLEXITY_GRADE", func() interface{} { return complexityGate().MaxGrade }},
+	{"MIN_FILES", func() interface{} { return minFilesGate().Min }},
+	{"MIN_FILES_GRADE", func() interface{} { return minFilesGate().MaxGrade }},
+	{"GOLINT", func() interface{} { return useGolint() }},
+	{"REVIVE_CONFIG", func() interface{} { return getEnvOrDefault("REVIVE_CONFIG", "") }},
+	{"REQUIRED_FILES", func() interface{} { return check.ParseRequiredFiles(getEnvOrDefault("REQUIRED_FILES", "")) }},
+	{"TODO_WEIGHT", func() interface{} { return todoOptions().Weight }},
+	{"TODO_THRESHOLD", func() interface{} { return todoOptions().Threshold }},
+	{"GOFMT_GRACE", func() interface{} { return gofmtGrace() }},
+	{"COVERAGE", func() interface{} { return coverageOptions().Enabled }},
+	{"COVERAGE_MIN", func() interface{} { return coverageOptions().Min }},
+	{"COVERAGE_PROFILE", func() interface{} { return coverageOptions().Profile }},
+	{"COVERAGE_TIMEOUT", func() interface{} { return coverageOptions().Timeout.String() }},
+	{"GRADING_WORKERS", func() interface{} { return gradingJobs.workers }},
+	{"GRADING_QUEUE", func() interface{} { return gradingJobs.maxQueued }},
+	{"GRADING_DENYLIST", func() interface{} { return getEnvOrDefault("GRADING_DENYLIST", "") }},
+	{"GRADING_DENYLIST_FILE", func() interface{} { return getEnvOrDefault("GRADING_DENYLIST_FILE", "") }},
+	{"AWS_REGION", func() interface{} {
+		return getEnvOrDefault("AWS_REGION", getEnvOrDefault("AWS_DEFAULT_REGION", "us-east-1"))
+	}},
+	{"AWS_ENDPOINT_URL", func() interface{} { return getEnvOrDefault("AWS_ENDPOINT_URL", "") }},
+	{"AWS_PROFILE", func() interface{} { return getEnvOrDefault("AWS_PROFILE", "default") }},
+	{"AWS_ACCESS_KEY_ID", func() interface{} { return getEnvOrDefault("AWS_ACCESS_KEY_ID", "") }},
+	{"AWS_SECRET_ACCESS_KEY", func() interface{} { return getEnvOrDefault("AWS_SECRET_ACCESS_KEY", "") }},
+	{"AWS_SESSION_TOKEN", func() interface{} { return getEnvOrDefault("AWS_SESSION_TOKEN", "") }},
+	{"GOOGLE_SHEETS_SPREADSHEET_ID", func() interface{} { return getEnvOrDefault("GOOGLE_SHEETS_SPREADSHEET_ID", "") }},
+	{"GOOGLE_SHEETS_SHEET", func() interface{} { return getEnvOrDefault("GOOGLE_SHEETS_SHEET", "Summary") }},
+	{"GOOGLE_SHEETS_CREDENTIALS_FILE", func() interface{} { return getEnvOrDefault("GOOGLE_SHEETS_CREDENTIALS_FILE", "") }},
+	{"GOOGLE_SHEETS_CREDENTIALS", func() interface{} { return getEnvOrDefault("GOOGLE_SHEETS_CREDENTIALS", "") }},
+	{"GOOGLE_SHEETS_ENDPOINT", func() interface{} { return getEnvOrDefault("GOOGLE_SHEETS_ENDPOINT", "https://sheets.googleapis.com") }},
+}
+
+// secretSettings are settings whose values are never returned. The webhook
+// URL often embeds a token. Any setting whose name mentions a secret, token,
+// password or key is also redacted.
+var secretSettings = map[string]bool{"ALERT_WEBHOOK_URL": true}
+
+func isSecret(name string) bool {
+	if secretSettings[name] {
+		return true
+	}
+	for _, word := range []string{"SECRET", "TOKEN", "PASSWORD", "KEY", "CREDENTIAL"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveConfig resolves every setting and configuration file the way the
+// handlers do, redacting secrets
+func effectiveConfig() effectiveConfigResponse {
+	resp := effectiveConfigResponse{
+		Settings: make([]configSetting, 0, len(configSettings)),
+		Grading:  gradingConfig{Weights: check.DefaultWeights(), Thresholds: check.DefaultThresholds},
+	}
+
+	for _, s := range configSettings {
+		setting := configSetting{Name: s.name, Value: s.value(), Source: configFromDefault, Raw: os.Getenv(s.name)}
+		if setting.Raw != "" {
+			setting.Source = configFromEnv
+		}
+		if isSecret(s.name) {
+			if setting.Raw != "" {
+				setting.Value, setting.Raw = redacted, redacted
+			} else {
+				setting.Value = ""
+			}
+		}
+		resp.Settings = append(resp.Settings, setting)
+	}
+
+	rules := configFile{Name: "rules", Path: rulesFile()}
+	rules.Value, rules.Source, rules.Error = readConfigFile(rules.Path, func() (interface{}, error) {
+		r, err := vault.LoadRules(rules.Path)
+		if r == nil {
+			r = []vault.CategoryRule{}
+		}
+		return r, err
+	})
+	normalization := configFile{Name: "normalization", Path: normalizationFile()}
+	normalization.Value, normalization.Source, normalization.Error = readConfigFile(normalization.Path, func() (interface{}, error) {
+		return vault.LoadNormalizer(normalization.Path)
+	})
+	resp.Files = []configFile{rules, normalization}
+
+	return resp
+}
+
+// readConfigFile loads a configuration file, reporting whether its value
+// comes from the file or, when it does not exist, the default
+func readConfigFile(path string, load func() (interface{}, error)) (interface{}, string, string) {
+	source := configFromFile
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		source = configFromDefault
+	}
+	v, err := load()
+	if err != nil {
+		return nil, source, err.Error()
+	}
+	return v, source, ""
+}
+
+// EffectiveConfigHandler returns the configuration in effect: every setting
+// with its resolved value and source, the configuration files, and the
+// default grading weights and thresholds. Secrets are redacted.
+func EffectiveConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, effectiveConfig())
+}
@@ -3,20 +3,82 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"strings"
 )
 
+// errorResponse is the body of every JSON error
+type errorResponse struct {
+	Error     string `json:"error"`                // message for people
+	Code      string `json:"code"`                 // stable code for clients, such as not_found
+	RequestID string `json:"request_id,omitempty"` // correlation ID of the request, to find it in the logs
+}
+
+// errorCode returns the machine-readable code of an HTTP status, its status
+// text in snake case
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.NewReplacer("-", " ", "'", "").Replace(text)), " ", "_")
+}
+
+// writeJSONError writes an error response with the status, its code and msg,
+// and the request ID set by WithRequestID
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg, Code: errorCode(status), RequestID: w.Header().Get(RequestIDHeader)})
+}
+
+// wantsJSON reports whether the error for r should be JSON rather than an
+// error page: requests to the API, and clients that ask for JSON
+func wantsJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/checks" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// Error answers r with an error, as JSON for API clients and as an error page
+// otherwise
+func (gh *GRCHandler) Error(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if wantsJSON(r) {
+		writeJSONError(w, status, msg)
+		return
+	}
+	gh.errorPage(w, status, msg)
+}
+
+// errorPage renders the error page with the status and msg
+func (gh *GRCHandler) errorPage(w http.ResponseWriter, status int, msg string) {
+	t, err := gh.loadTemplate("/templates/error.html")
+	if err != nil {
+		log.Println("ERROR: could not get error template: ", err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := t.ExecuteTemplate(w, "base", map[string]interface{}{
+		"google_analytics_key": googleAnalyticsKey,
+		"Status":               status,
+		"StatusText":           http.StatusText(status),
+		"Message":              msg,
+		"RequestID":            w.Header().Get(RequestIDHeader),
+	}); err != nil {
+		log.Println("ERROR:", err)
+	}
+}
+
+// errorHandler renders the not found page
 func (gh *GRCHandler) errorHandler(w http.ResponseWriter, r *http.Request, status int) {
+	t, err := gh.loadTemplate("/templates/404.html")
+	if err != nil {
+		requestLog(r).Println("ERROR: could not get 404 template: ", err)
+		gh.errorPage(w, status, "Page not found")
+		return
+	}
+
 	w.WriteHeader(status)
-	if status == http.StatusNotFound {
-		t, err := gh.loadTemplate("/templates/404.html")
-		if err != nil {
-			log.Println("ERROR: could not get 404 template: ", err)
-			http.Error(w, err.Error(), 500)
-			return
-		}
-
-		if err := t.ExecuteTemplate(w, "base", nil); err != nil {
-			log.Println("ERROR:", err)
-		}
+	if err := t.ExecuteTemplate(w, "base", nil); err != nil {
+		requestLog(r).Println("ERROR:", err)
 	}
 }
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// Rules associating a fee with the payment it was charged for
+const (
+	feeByReference = "reference" // the fee's reference is the payment's transaction ID
+	feeByProximity = "proximity" // the payment closest in time to the fee, within the window
+)
+
+// feeAssociation associates fees with payments by trying each of its rules
+// in order, so that payments can be reported net of their fees
+type feeAssociation struct {
+	Rules  []string
+	Window time.Duration // largest time between a fee and its payment for the proximity rule
+}
+
+// feeAssociationFromEnv returns the association configured with
+// FEE_ASSOCIATION, a comma-separated list of rules (default reference, none
+// to associate no fees), and FEE_ASSOCIATION_WINDOW (default 24h)
+func feeAssociationFromEnv() feeAssociation {
+	a := feeAssociation{Window: 24 * time.Hour}
+	v := getEnvOrDefault("FEE_ASSOCIATION", feeByReference)
+	if v != "none" {
+		for _, rule := range strings.Split(v, ",") {
+			switch rule = strings.TrimSpace(rule); rule {
+			case feeByReference, feeByProximity:
+				a.Rules = append(a.Rules, rule)
+			case "":
+			default:
+				log.Printf("Invalid FEE_ASSOCIATION rule %q, ignoring it", rule)
+			}
+		}
+	}
+
+	if d, err := time.ParseDuration(getEnvOrDefault("FEE_ASSOCIATION_WINDOW", "24h")); err == nil && d > 0 {
+		a.Window = d
+	} else {
+		log.Printf("Invalid FEE_ASSOCIATION_WINDOW, using 24h: %v", err)
+	}
+	return a
+}
+
+// associate returns the index of the payment each associated fee was charged
+// for, keyed by the index of the fee. Internal transactions are never
+// associated.
+func (a feeAssociation) associate(transactions []vault.Transaction) map[int]int {
+	var payments, fees []int
+	for i, txn := range transactions {
+		switch {
+		case txn.Internal:
+		case txn.Type == vault.PaymentTransaction:
+			payments = append(payments, i)
+		case txn.Type == vault.FeeTransaction:
+			fees = append(fees, i)
+		}
+	}
+
+	parents := make(map[int]int)
+	if len(payments) == 0 || len(fees) == 0 {
+		return parents
+	}
+	for _, rule := range a.Rules {
+		switch rule {
+		case feeByReference:
+			byID := make(map[string]int, len(payments))
+			for _, p := range payments {
+				if id := transactions[p].TransactionID; id != "" {
+					byID[id] = p
+				}
+			}
+			for _, f := range fees {
+				if _, done := parents[f]; done || transactions[f].Reference == "" {
+					continue
+				}
+				if p, ok := byID[transactions[f].Reference]; ok {
+					parents[f] = p
+				}
+			}
+
+		case feeByProximity:
+			var dated []int
+			for _, p := range payments {
+				if !transactions[p].Timestamp.IsZero() {
+					dated = append(dated, p)
+				}
+			}
+			sort.SliceStable(dated, func(i, j int) bool {
+				return transactions[dated[i]].Timestamp.Before(transactions[dated[j]].Timestamp)
+			})
+			for _, f := range fees {
+				if _, done := parents[f]; done || transactions[f].Timestamp.IsZero() {
+					continue
+				}
+				if p, ok := a.nearest(transactions, dated, transactions[f].Timestamp); ok {
+					parents[f] = p
+				}
+			}
+		}
+	}
+	return parents
+}
+
+// nearest returns the payment of dated, sorted by time, closest to at and
+// within the window, the earlier one on a tie
+func (a feeAssociation) nearest(transactions []vault.Transaction, dated []int, at time.Time) (int, bool) {
+	i := sort.Search(len(dated), func(i int) bool { return !transactions[dated[i]].Timestamp.Before(at) })
+
+	best, bestGap := 0, time.Duration(-1)
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(dated) {
+			continue
+		}
+		gap := transactions[dated[j]].Timestamp.Sub(at)
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap <= a.Window && (bestGap < 0 || gap < bestGap) {
+			best, bestGap = dated[j], gap
+		}
+	}
+	return best, bestGap >= 0
+}
+
+// netOfFees is the total of the payments before and after the fees
+// associated with them
+type netOfFees struct {
+	Gross        vault.Money
+	Net          vault.Money
+	Unassociated vault.Money         // fees not associated with any payment
+	ByPayment    map[int]vault.Money // net amount of each payment, by index
+}
+
+// netOfFees sums the payments and fees of transactions, taking each
+// associated fee off its payment
+func (a feeAssociation) netOfFees(transactions []vault.Transaction) netOfFees {
+	parents := a.associate(transactions)
+	n := netOfFees{ByPayment: make(map[int]vault.Money)}
+	for i, txn := range transactions {
+		amount := txn.Amount
+		switch txn.Type {
+		case vault.PaymentTransaction:
+			n.Gross = addMoney(n.Gross, amount)
+			n.ByPayment[i] = addMoney(n.ByPayment[i], amount)
+		case vault.FeeTransaction:
+			if p, ok := parents[i]; ok {
+				n.ByPayment[p] = addMoney(n.ByPayment[p], amount)
+				n.Net = addMoney(n.Net, amount)
+			} else {
+				n.Unassociated = addMoney(n.Unassociated, amount)
+			}
+		}
+	}
+	n.Net = addMoney(n.Net, n.Gross)
+	return n
+}
+
+// setNetAmounts sets the net amount of each payment of transactions
+func setNetAmounts(transactions []vault.Transaction) {
+	n := feeAssociationFromEnv().netOfFees(transactions)
+	for i, net := range n.ByPayment {
+		transactions[i].NetAmount = &net
+	}
+}
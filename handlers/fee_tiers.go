@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// defaultFeeTiers splits the fees into those under 1, those from 1 up to 10,
+// and those from 10 on
+const defaultFeeTiers = "micro:0,small:1,large:10"
+
+// feeTier is a tier of fees by amount, from its lower bound, inclusive, up to
+// the lower bound of the next tier
+type feeTier struct {
+	Name string      `json:"name"`
+	Min  vault.Money `json:"min"` // lower bound of the fee's absolute amount
+}
+
+// feeTierSummary is the number and total of the fees in a tier
+type feeTierSummary struct {
+	Name  string       `json:"name"`
+	Min   vault.Money  `json:"min"`
+	Max   *vault.Money `json:"max"` // lower bound of the next tier, excluded; null for the last tier
+	Count int          `json:"count"`
+	Sum   vault.Money  `json:"sum"`
+}
+
+// parseFeeTiers parses a comma-separated list of name:lower-bound pairs, such
+// as micro:0,small:1,large:10, into tiers sorted by their bound. The first
+// tier must start at 0, so that every fee falls in a tier.
+func parseFeeTiers(s string) ([]feeTier, error) {
+	var tiers []feeTier
+	names := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, bound, ok := strings.Cut(part, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("tier %q is not name:lower-bound", part)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("tier %q is listed twice", name)
+		}
+		lower, err := vault.ParseMoney(bound)
+		if err != nil || lower < 0 {
+			return nil, fmt.Errorf("tier %q needs a lower bound of at least 0", name)
+		}
+		names[name] = true
+		tiers = append(tiers, feeTier{Name: name, Min: lower})
+	}
+	if len(tiers) == 0 {
+		return nil, nil
+	}
+
+	sort.SliceStable(tiers, func(i, j int) bool { return tiers[i].Min < tiers[j].Min })
+	if tiers[0].Min != 0 {
+		return nil, fmt.Errorf("the first tier, %q, must start at 0", tiers[0].Name)
+	}
+	for i := 1; i < len(tiers); i++ {
+		if tiers[i].Min == tiers[i-1].Min {
+			return nil, fmt.Errorf("tiers %q and %q have the same lower bound", tiers[i-1].Name, tiers[i].Name)
+		}
+	}
+	return tiers, nil
+}
+
+// feeTiersFromEnv returns the tiers configured with FEE_TIERS, defaulting to
+// defaultFeeTiers; none disables them
+func feeTiersFromEnv() []feeTier {
+	v := getEnvOrDefault("FEE_TIERS", defaultFeeTiers)
+	if v == "none" {
+		return nil
+	}
+	tiers, err := parseFeeTiers(v)
+	if err != nil {
+		log.Printf("Invalid FEE_TIERS, using %s: %v", defaultFeeTiers, err)
+		tiers, _ = parseFeeTiers(defaultFeeTiers)
+	}
+	return tiers
+}
+
+// feeTierIndex returns the index of the tier of a fee of the given amount,
+// the last tier whose lower bound it reaches, or -1 if there are no tiers
+func feeTierIndex(tiers []feeTier, amount vault.Money) int {
+	amount = amount.Abs()
+	i := sort.Search(len(tiers), func(i int) bool { return tiers[i].Min > amount })
+	return i - 1
+}
+
+// applyFeeTiers sets the tier of each fee, and clears it on other transactions
+func applyFeeTiers(transactions []vault.Transaction, tiers []feeTier) {
+	for i := range transactions {
+		transactions[i].FeeTier = ""
+		if transactions[i].Type != vault.FeeTransaction {
+			continue
+		}
+		if t := feeTierIndex(tiers, transactions[i].Amount); t >= 0 {
+			transactions[i].FeeTier = tiers[t].Name
+		}
+	}
+}
+
+// newFeeTierSummaries returns an empty summary of each tier, in order, so
+// that tiers without fees are listed too
+func newFeeTierSummaries(tiers []feeTier) []feeTierSummary {
+	summaries := make([]feeTierSummary, len(tiers))
+	for i, t := range tiers {
+		summaries[i] = feeTierSummary{Name: t.Name, Min: t.Min}
+		if i+1 < len(tiers) {
+			summaries[i].Max = &tiers[i+1].Min
+		}
+	}
+	return summaries
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// coverageGap is a run of days without any transactions, such as the month
+// of a statement that was never exported
+type coverageGap struct {
+	Start string `json:"start"` // first day without transactions, YYYY-MM-DD
+	End   string `json:"end"`   // last day without transactions
+	Days  int    `json:"days"`
+}
+
+type gapsResponse struct {
+	MinDays  int           `json:"min_days"`
+	Timezone string        `json:"timezone"`
+	First    string        `json:"first,omitempty"` // day of the first transaction
+	Last     string        `json:"last,omitempty"`  // day of the last transaction
+	Gaps     []coverageGap `json:"gaps"`
+	Undated  int           `json:"undated"` // transactions skipped because their date could not be parsed
+}
+
+// gapMinDaysFromRequest returns the min_days query parameter, the length of
+// the shortest gap reported, defaulting to GAPS_MIN_DAYS (14)
+func gapMinDaysFromRequest(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("min_days")
+	if v == "" {
+		v = getEnvOrDefault("GAPS_MIN_DAYS", "14")
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid min_days %q, expected a positive number of days", v)
+	}
+	return n, nil
+}
+
+// findGaps returns the runs of at least minDays days in loc without any
+// transactions, between the first and the last dated transaction. Every
+// transaction counts, whatever its amount or category, since the gaps are
+// about missing data rather than activity.
+func findGaps(transactions []vault.Transaction, minDays int, loc *time.Location) gapsResponse {
+	resp := gapsResponse{MinDays: minDays, Timezone: loc.String(), Gaps: []coverageGap{}}
+
+	var days []time.Time
+	for _, txn := range transactions {
+		if txn.Timestamp.IsZero() {
+			resp.Undated++
+			continue
+		}
+		days = append(days, periodStart(txn.Timestamp.In(loc), "day"))
+	}
+	if len(days) == 0 {
+		return resp
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	resp.First, resp.Last = days[0].Format(dateLayout), days[len(days)-1].Format(dateLayout)
+
+	for i := 1; i < len(days); i++ {
+		start := days[i-1].AddDate(0, 0, 1)
+		// counted in calendar days, so that a change of UTC offset does not
+		// shorten or lengthen a gap
+		n := 0
+		for d := start; d.Before(days[i]); d = d.AddDate(0, 0, 1) {
+			n++
+		}
+		if n >= minDays {
+			resp.Gaps = append(resp.Gaps, coverageGap{
+				Start: start.Format(dateLayout),
+				End:   days[i].AddDate(0, 0, -1).Format(dateLayout),
+				Days:  n,
+			})
+		}
+	}
+	return resp
+}
+
+// GapsHandler returns the runs of days without any of the account's
+// transactions, as potentially missing statements
+func GapsHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	minDays, err := gapMinDaysFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, findGaps(transactions, minDays, reportingLocation()))
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// sheetsScope is the OAuth scope of the access tokens used to write to
+// spreadsheets
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+// errSheetsDisabled is returned when an export is triggered without a
+// spreadsheet or credentials
+var errSheetsDisabled = errors.New("no Google Sheets spreadsheet is configured, set GOOGLE_SHEETS_SPREADSHEET_ID and GOOGLE_SHEETS_CREDENTIALS_FILE")
+
+// googleServiceAccount holds the fields of a service account key file used to
+// get access tokens. The private key is never logged or returned.
+type googleServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// parseServiceAccount parses a service account key file. Its errors never
+// include the key's contents.
+func parseServiceAccount(content []byte) (*googleServiceAccount, error) {
+	var sa googleServiceAccount
+	if err := json.Unmarshal(content, &sa); err != nil || sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("not a service account key file with a client_email and private_key")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, errors.New("the private_key is not PEM encoded")
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		key, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("the private_key is not an RSA key")
+		}
+		sa.key = key
+	} else if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		sa.key = key
+	} else {
+		return nil, errors.New("the private_key could not be parsed")
+	}
+	return &sa, nil
+}
+
+// assertion returns the signed JWT exchanged for an access token
+func (sa *googleServiceAccount) assertion(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, sa.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// sheetsExport writes the summary and monthly breakdown to a sheet of a
+// Google Sheets spreadsheet
+type sheetsExport struct {
+	SpreadsheetID string
+	Sheet         string
+	Endpoint      string                // base URL of the Sheets API
+	credentials   *googleServiceAccount // nil when none are configured
+	client        *http.Client
+}
+
+// sheetsExportFromEnv returns the export configured with
+// GOOGLE_SHEETS_SPREADSHEET_ID, GOOGLE_SHEETS_SHEET (default Summary) and the
+// service account key in GOOGLE_SHEETS_CREDENTIALS_FILE, or its contents in
+// GOOGLE_SHEETS_CREDENTIALS. An invalid key is an error; missing settings are
+// reported by enabled.
+func sheetsExportFromEnv() (sheetsExport, error) {
+	e := sheetsExport{
+		SpreadsheetID: getEnvOrDefault("GOOGLE_SHEETS_SPREADSHEET_ID", ""),
+		Sheet:         getEnvOrDefault("GOOGLE_SHEETS_SHEET", "Summary"),
+		Endpoint:      strings.TrimSuffix(getEnvOrDefault("GOOGLE_SHEETS_ENDPOINT", "https://sheets.googleapis.com"), "/"),
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}
+
+	content := []byte(getEnvOrDefault("GOOGLE_SHEETS_CREDENTIALS", ""))
+	if path := getEnvOrDefault("GOOGLE_SHEETS_CREDENTIALS_FILE", ""); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return e, fmt.Errorf("could not read GOOGLE_SHEETS_CREDENTIALS_FILE: %v", err)
+		}
+		content = b
+	}
+	if len(content) == 0 {
+		return e, nil
+	}
+	sa, err := parseServiceAccount(content)
+	if err != nil {
+		return e, fmt.Errorf("invalid Google service account credentials: %v", err)
+	}
+	e.credentials = sa
+	return e, nil
+}
+
+func (e sheetsExport) enabled() bool {
+	return e.SpreadsheetID != "" && e.credentials != nil
+}
+
+// sheetRange returns the A1 notation of the sheet, quoted so that names with
+// spaces work
+func (e sheetsExport) sheetRange() string {
+	return "'" + strings.ReplaceAll(e.Sheet, "'", "''") + "'"
+}
+
+// accessToken exchanges a signed assertion for an access token
+func (e sheetsExport) accessToken(ctx context.Context) (string, error) {
+	assertion, err := e.credentials.assertion(time.Now())
+	if err != nil {
+		return "", fmt.Errorf("could not sign the token request: %v", err)
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.credentials.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := e.do(req, &token); err != nil {
+		return "", fmt.Errorf("could not get an access token: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("could not get an access token: none in the response")
+	}
+	return token.AccessToken, nil
+}
+
+// do sends req and decodes its JSON response into v, returning an error with
+// the start of the body for statuses other than 2xx
+func (e sheetsExport) do(req *http.Request, v interface{}) error {
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// write replaces the contents of the sheet with rows and returns the number
+// of rows written
+func (e sheetsExport) write(ctx context.Context, rows [][]interface{}) (int, error) {
+	token, err := e.accessToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+	values := e.Endpoint + "/v4/spreadsheets/" + url.PathEscape(e.SpreadsheetID) + "/values/"
+
+	send := func(method, u string, body interface{}, v interface{}) error {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return e.do(req, v)
+	}
+
+	// clear the sheet first, so that rows left from a longer export go
+	if err := send(http.MethodPost, values+url.PathEscape(e.sheetRange())+":clear", struct{}{}, nil); err != nil {
+		return 0, fmt.Errorf("could not clear the sheet: %v", err)
+	}
+
+	start := e.sheetRange() + "!A1"
+	var updated struct {
+		UpdatedRows int `json:"updatedRows"`
+	}
+	body := map[string]interface{}{"range": start, "majorDimension": "ROWS", "values": rows}
+	if err := send(http.MethodPut, values+url.PathEscape(start)+"?valueInputOption=RAW", body, &updated); err != nil {
+		return 0, fmt.Errorf("could not write the rows: %v", err)
+	}
+	return updated.UpdatedRows, nil
+}
+
+// sheetsRows lays out the summary and the monthly breakdown as the rows of a
+// sheet: the totals of each category, then a row per month
+func sheetsRows(acct account, period string, s SummaryStats, b breakdownResponse, now time.Time) [][]interface{} {
+	// amounts are written as numbers, not the strings of the API, so that
+	// the sheet can sum them
+	number := func(m vault.Money) json.Number { return json.Number(m.Format(moneyDecimals)) }
+	rows := [][]interface{}{
+		{"Account", acct.Name},
+		{"Period", period},
+		{"Exported", now.UTC().Format(time.RFC3339)},
+		{},
+		{"Category", "Transactions", "Total"},
+		{string(vault.PaymentTransaction), s.TotalPayments, number(s.PaymentsSum)},
+		{string(vault.TransferTransaction), s.TotalTransfers, number(s.TransfersSum)},
+		{string(vault.FeeTransaction), s.TotalFees, number(s.FeesSum)},
+		{string(vault.UncategorizedTransaction), s.TotalUncategorized, number(s.UncategorizedSum)},
+		{"Net liquidity", s.TotalTransactions, number(s.NetLiquidity)},
+		{},
+	}
+
+	header := []interface{}{"Month"}
+	for _, t := range vault.TransactionTypes {
+		header = append(header, string(t))
+	}
+	rows = append(rows, append(header, "Net"))
+	for _, p := range b.Periods {
+		row := []interface{}{p.Period}
+		for _, t := range vault.TransactionTypes {
+			row = append(row, number(p.Totals[t]))
+		}
+		rows = append(rows, append(row, number(p.Net)))
+	}
+	return rows
+}
+
+type sheetsExportResponse struct {
+	SpreadsheetID string          `json:"spreadsheet_id,omitempty"`
+	Range         string          `json:"range"`
+	DryRun        bool            `json:"dry_run"`
+	Rows          [][]interface{} `json:"rows"`
+	UpdatedRows   int             `json:"updated_rows"`
+}
+
+// SheetsExportHandler writes the account's summary and monthly breakdown to
+// the configured Google Sheets spreadsheet, replacing the sheet's contents.
+// With dry_run=true, the rows are returned without being written, which
+// needs no credentials.
+func SheetsExportHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var dryRun bool
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+	}
+
+	filter, _, err := filterWithPeriod(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	e, err := sheetsExportFromEnv()
+	if err != nil {
+		requestLog(r).Println("ERROR:", err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !dryRun && !e.enabled() {
+		writeJSONError(w, http.StatusConflict, errSheetsDisabled.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+	categorized := groupByType(filter.apply(transactions))
+
+	period := "all transactions"
+	if filter.From != "" || filter.To != "" {
+		from, to := filter.From, filter.To
+		if from == "" {
+			from = "the start"
+		}
+		if to == "" {
+			to = "the end"
+		}
+		period = from + " to " + to
+	}
+	resp := sheetsExportResponse{
+		SpreadsheetID: e.SpreadsheetID,
+		Range:         e.sheetRange() + "!A1",
+		DryRun:        dryRun,
+		Rows:          sheetsRows(acct, period, calculateSummary(categorized), calculateBreakdown(categorized, "month", reportingLocation(), 0), time.Now()),
+	}
+	if dryRun {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resp.UpdatedRows, err = e.write(ctx, resp.Rows)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not export to Google Sheets:", err)
+		writeJSONError(w, http.StatusBadGateway, "could not export to Google Sheets: "+err.Error())
+		return
+	}
+	requestLog(r).Printf("Exported %d rows of %s to Google Sheets", resp.UpdatedRows, acct.Name)
+	writeJSON(w, http.StatusOK, resp)
+}
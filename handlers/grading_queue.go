@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// errQueueFull is returned when a grading job cannot be queued because the
+// queue already holds as many jobs as it may
+var errQueueFull = errors.New("too many repositories are being graded, try again later")
+
+// gradingRetryAfter is the number of seconds clients are asked to wait when
+// the grading queue is full
+const gradingRetryAfter = 30
+
+// gradingJob grades a single repo; done is closed once resp and err are set
+type gradingJob struct {
+	repo     string
+	run      func() (checksResp, error)
+	progress *gradingProgress // nil if the job's status is not tracked
+	done     chan struct{}
+	resp     checksResp
+	err      error
+}
+
+// gradingQueue runs at most workers grading jobs at once, keeping at most
+// maxQueued more waiting in order. Requests for a repo that is already being
+// graded, or waiting to be, share its job.
+type gradingQueue struct {
+	workers   int
+	maxQueued int
+
+	mu      sync.Mutex
+	running int
+	jobs    map[string]*gradingJob // running and queued jobs by repo
+	queued  []*gradingJob
+}
+
+func newGradingQueue(workers, maxQueued int) *gradingQueue {
+	return &gradingQueue{workers: workers, maxQueued: maxQueued, jobs: make(map[string]*gradingJob)}
+}
+
+// gradingJobs is the queue of all report card grading, sized with
+// GRADING_WORKERS (default the number of CPUs) and GRADING_QUEUE (default 20)
+var gradingJobs = newGradingQueue(
+	positiveIntFromEnv("GRADING_WORKERS", runtime.NumCPU()),
+	positiveIntFromEnv("GRADING_QUEUE", 20),
+)
+
+// positiveIntFromEnv returns the positive integer set in an environment
+// variable, or def when it is unset or invalid
+func positiveIntFromEnv(name string, def int) int {
+	v := getEnvOrDefault(name, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Printf("Invalid %s, using %d", name, def)
+		return def
+	}
+	return n
+}
+
+// submit returns the job grading repo, starting one with run if there is
+// none yet, whose status p tracks. The job starts right away if a worker is
+// free and is queued otherwise; errQueueFull is returned if the queue is full
+// too.
+func (q *gradingQueue) submit(repo string, p *gradingProgress, run func() (checksResp, error)) (*gradingJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if job, ok := q.jobs[repo]; ok {
+		return job, nil
+	}
+
+	job := &gradingJob{repo: repo, run: run, progress: p, done: make(chan struct{})}
+	switch {
+	case q.running < q.workers:
+		q.running++
+		go q.work(job)
+	case len(q.queued) < q.maxQueued:
+		q.queued = append(q.queued, job)
+	default:
+		return nil, errQueueFull
+	}
+	q.jobs[repo] = job
+	p.save()
+	return job, nil
+}
+
+// find returns the job grading repo, or nil if it is not being graded
+func (q *gradingQueue) find(repo string) *gradingJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.jobs[repo]
+}
+
+// findID returns the running or queued job whose progress has the given ID,
+// or nil if there is none
+func (q *gradingQueue) findID(id string) *gradingJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range q.jobs {
+		if job.progress != nil && job.progress.id == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// work runs job, then the queued jobs in turn until there are none left
+func (q *gradingQueue) work(job *gradingJob) {
+	for job != nil {
+		job.progress.start()
+		job.resp, job.err = job.run()
+		job.progress.finish(job.resp, job.err)
+
+		q.mu.Lock()
+		delete(q.jobs, job.repo)
+		close(job.done)
+		job = nil
+		if len(q.queued) > 0 {
+			job, q.queued = q.queued[0], q.queued[1:]
+		} else {
+			q.running--
+		}
+		q.mu.Unlock()
+	}
+}
+
+// position returns the 1-based position of job in the queue, or 0 if it is
+// running or done
+func (q *gradingQueue) position(job *gradingJob) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, j := range q.queued {
+		if j == job {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// wait returns the result of the job
+func (job *gradingJob) wait() (checksResp, error) {
+	<-job.done
+	return job.resp, job.err
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/check"
+)
+
+const (
+	// GradingJobPrefix is the badger prefix for the status of grading jobs,
+	// keyed by job ID
+	GradingJobPrefix string = "grading-job-"
+)
+
+// gradingJobTTL is how long the status of a grading job is kept
+const gradingJobTTL = 24 * time.Hour
+
+// States of a grading job
+const (
+	jobQueued  = "queued"  // waiting for a worker
+	jobRunning = "running" // downloading the repo or running its checks
+	jobDone    = "done"
+	jobFailed  = "error"
+)
+
+// checkProgress is the state of one check of a grading job
+type checkProgress struct {
+	Name  string           `json:"name"`
+	State check.CheckState `json:"state"`
+}
+
+// gradingStatus is the progress of a grading job, as stored in badger and
+// returned by the status endpoint
+type gradingStatus struct {
+	ID           string          `json:"id"`
+	Repo         string          `json:"repo"`
+	ForceRefresh bool            `json:"force_refresh"`
+	Status       string          `json:"status"`
+	Position     int             `json:"position,omitempty"` // in the queue, while queued
+	Checks       []checkProgress `json:"checks"`             // empty until the repo is downloaded
+	Result       *checksResp     `json:"result,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Redirect     string          `json:"redirect,omitempty"` // the report card, once done
+	Started      time.Time       `json:"started"`
+	Updated      time.Time       `json:"updated"`
+}
+
+func (s gradingStatus) finished() bool {
+	return s.Status == jobDone || s.Status == jobFailed
+}
+
+// gradingProgress tracks the status of a grading job and stores it in badger
+// on every change, so that it can be asked for across a restart. Its methods
+// do nothing on a nil progress.
+type gradingProgress struct {
+	db *badger.DB
+	id string
+
+	mu     sync.Mutex
+	status gradingStatus
+}
+
+func newGradingProgress(db *badger.DB, id, repo string, forceRefresh bool) *gradingProgress {
+	now := time.Now().UTC()
+	return &gradingProgress{db: db, id: id, status: gradingStatus{
+		ID:           id,
+		Repo:         repo,
+		ForceRefresh: forceRefresh,
+		Status:       jobQueued,
+		Checks:       []checkProgress{},
+		Started:      now,
+		Updated:      now,
+	}}
+}
+
+// update changes the status with fn and stores it
+func (p *gradingProgress) update(fn func(s *gradingStatus)) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fn(&p.status)
+	p.status.Updated = time.Now().UTC()
+	p.saveLocked()
+}
+
+// save stores the status as it is
+func (p *gradingProgress) save() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.saveLocked()
+}
+
+func (p *gradingProgress) saveLocked() {
+	if p.db == nil {
+		return
+	}
+	err := p.db.Update(func(txn *badger.Txn) error {
+		b, err := json.Marshal(p.status)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry([]byte(GradingJobPrefix+p.id), b).WithTTL(gradingJobTTL))
+	})
+	if err != nil {
+		log.Printf("ERROR: could not save the status of grading job %s: %v", p.id, err)
+	}
+}
+
+// snapshot returns a copy of the status
+func (p *gradingProgress) snapshot() gradingStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.status
+	s.Checks = append([]checkProgress{}, s.Checks...)
+	return s
+}
+
+// start marks the job as running
+func (p *gradingProgress) start() {
+	p.update(func(s *gradingStatus) { s.Status = jobRunning })
+}
+
+// setCheck records the state of a check, as reported to check.Options.Progress
+func (p *gradingProgress) setCheck(name string, state check.CheckState) {
+	p.update(func(s *gradingStatus) {
+		for i := range s.Checks {
+			if s.Checks[i].Name == name {
+				s.Checks[i].State = state
+				return
+			}
+		}
+		s.Checks = append(s.Checks, checkProgress{Name: name, State: state})
+	})
+}
+
+// finish records the result of the job
+func (p *gradingProgress) finish(resp checksResp, err error) {
+	p.update(func(s *gradingStatus) {
+		if err != nil {
+			s.Status = jobFailed
+			s.Error = err.Error()
+			return
+		}
+		s.Status = jobDone
+		s.Result = &resp
+		s.Redirect = "/report/" + s.Repo
+	})
+}
+
+// loadGradingStatus returns the stored status of the grading job with the
+// given ID, and false if there is none
+func loadGradingStatus(db *badger.DB, id string) (gradingStatus, bool, error) {
+	var s gradingStatus
+	found, err := getJSON(db, GradingJobPrefix+id, &s)
+	return s, found, err
+}
+
+// jobStatus returns the current status of a job, with its queue position
+func jobStatus(job *gradingJob) gradingStatus {
+	s := job.progress.snapshot()
+	s.Position = gradingJobs.position(job)
+	return s
+}
+
+// GradingStatusHandler returns the progress of the grading job with the given
+// ID: whether it is queued, running or done, the state of each check, and the
+// report card once it is graded. A job that was stopped by a restart before
+// it finished is started again.
+func GradingStatusHandler(w http.ResponseWriter, r *http.Request, db *badger.DB, id string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if job := gradingJobs.findID(id); job != nil {
+		writeJSON(w, http.StatusOK, jobStatus(job))
+		return
+	}
+
+	s, found, err := loadGradingStatus(db, id)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load grading job:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not load grading job")
+		return
+	}
+	if !found {
+		writeJSONError(w, http.StatusNotFound, "unknown grading job "+strconv.Quote(id))
+		return
+	}
+
+	if !s.finished() {
+		requestLog(r).Printf("Grading job %s of %q was interrupted, starting it again", id, s.Repo)
+		job, err := submitGradingJob(db, s.Repo, s.ForceRefresh, newGradingProgress(db, id, s.Repo, s.ForceRefresh))
+		if errors.Is(err, errQueueFull) {
+			w.Header().Set("Retry-After", strconv.Itoa(gradingRetryAfter))
+			writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if errors.Is(err, errRepoDenied) {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		// the repo may have been submitted again since, in which case its
+		// newer job is reported
+		s = jobStatus(job)
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
@@ -5,4 +5,6 @@ import "net/http"
 // GRCHandler contains fields shared among the different handlers
 type GRCHandler struct {
 	AssetsFS http.FileSystem
+
+	fingerprints map[string]string // Fingerprints of the assets by URL path, set by FingerprintAssets
 }
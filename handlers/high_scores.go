@@ -3,7 +3,6 @@ package handlers
 import (
 	"container/heap"
 	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/dgraph-io/badger/v2"
@@ -17,7 +16,7 @@ func (gh *GRCHandler) HighScoresHandler(w http.ResponseWriter, r *http.Request,
 		var scoreBytes = []byte("[]")
 		item, err := txn.Get([]byte("scores"))
 		if err != nil {
-			log.Println("ERROR:", err)
+			requestLog(r).Println("ERROR:", err)
 		}
 
 		if item != nil {
@@ -27,7 +26,7 @@ func (gh *GRCHandler) HighScoresHandler(w http.ResponseWriter, r *http.Request,
 			})
 
 			if err != nil {
-				log.Println("ERROR:", err)
+				requestLog(r).Println("ERROR:", err)
 			}
 		}
 
@@ -51,15 +50,15 @@ func (gh *GRCHandler) HighScoresHandler(w http.ResponseWriter, r *http.Request,
 	})
 
 	if err != nil {
-		log.Println("ERROR: Failed to load high scores from bolt database: ", err)
-		http.Error(w, err.Error(), 500)
+		requestLog(r).Println("ERROR: Failed to load high scores from bolt database: ", err)
+		gh.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	t, err := gh.loadTemplate("/templates/high_scores.html")
 	if err != nil {
-		log.Println("ERROR: could not get high scores template: ", err)
-		http.Error(w, err.Error(), 500)
+		requestLog(r).Println("ERROR: could not get high scores template: ", err)
+		gh.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -73,6 +72,6 @@ func (gh *GRCHandler) HighScoresHandler(w http.ResponseWriter, r *http.Request,
 		"Count":                humanize.Comma(int64(count)),
 		"google_analytics_key": googleAnalyticsKey,
 	}); err != nil {
-		log.Println("ERROR:", err)
+		requestLog(r).Println("ERROR:", err)
 	}
 }
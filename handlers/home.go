@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"sync"
 
@@ -26,9 +25,9 @@ func (gh *GRCHandler) HomeHandler(w http.ResponseWriter, r *http.Request, db *ba
 
 		if cache.count < 100 && len(cache.items) == 5 {
 			recentRepos = cache.items
-			log.Println("Fetching recent repos from cache...")
+			requestLog(r).Println("Fetching recent repos from cache...")
 		} else {
-			log.Println("Updating recent repos cache...")
+			requestLog(r).Println("Updating recent repos cache...")
 			recent := &[]recentItem{}
 			err := db.View(func(txn *badger.Txn) error {
 				item, err := txn.Get([]byte("recent"))
@@ -48,7 +47,7 @@ func (gh *GRCHandler) HomeHandler(w http.ResponseWriter, r *http.Request, db *ba
 			})
 
 			if err != nil {
-				log.Println("ERROR: ", err)
+				requestLog(r).Println("ERROR: ", err)
 			}
 
 			recentRepos = make([]string, len(*recent))
@@ -64,8 +63,8 @@ func (gh *GRCHandler) HomeHandler(w http.ResponseWriter, r *http.Request, db *ba
 
 		t, err := gh.loadTemplate("templates/home.html")
 		if err != nil {
-			log.Println("ERROR: could not get home template: ", err)
-			http.Error(w, err.Error(), 500)
+			requestLog(r).Println("ERROR: could not get home template: ", err)
+			gh.errorPage(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
@@ -73,7 +72,7 @@ func (gh *GRCHandler) HomeHandler(w http.ResponseWriter, r *http.Request, db *ba
 			"Recent":               recentRepos,
 			"google_analytics_key": googleAnalyticsKey,
 		}); err != nil {
-			log.Println(err)
+			requestLog(r).Println(err)
 		}
 
 		return
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// Directions of an insight
+const (
+	insightUp   = "up"
+	insightDown = "down"
+	insightNew  = "new"  // nothing in the previous month
+	insightGone = "gone" // nothing in the current month
+)
+
+// insight is a notable month-over-month change in a category's total
+type insight struct {
+	Category vault.TransactionType `json:"category"`
+	Month    string                `json:"month"`
+	Previous vault.Money           `json:"previous"`
+	Current  vault.Money           `json:"current"`
+	// Change and ChangePercent compare the absolute totals, so that growing
+	// fees go up even though their amounts are negative
+	Change        vault.Money `json:"change"`
+	ChangePercent *float64    `json:"change_percent"` // nil when the previous month had nothing
+	Direction     string      `json:"direction"`
+	Message       string      `json:"message"`
+}
+
+// insightThresholds decide which changes are notable: both the absolute
+// change and the percentage change must reach their minimum
+type insightThresholds struct {
+	MinPercent float64
+	MinAmount  vault.Money
+}
+
+type insightsResponse struct {
+	Month    string    `json:"month"`
+	Previous string    `json:"previous"`
+	Insights []insight `json:"insights"`
+}
+
+// insightThresholdsFromRequest reads the min_percent and min_amount
+// parameters, defaulting to INSIGHTS_MIN_PERCENT (20) and INSIGHTS_MIN_AMOUNT (0)
+func insightThresholdsFromRequest(r *http.Request) (insightThresholds, error) {
+	var t insightThresholds
+	param := func(name, env, def string) string {
+		if v := r.URL.Query().Get(name); v != "" {
+			return v
+		}
+		return getEnvOrDefault(env, def)
+	}
+
+	v := param("min_percent", "INSIGHTS_MIN_PERCENT", "20")
+	percent, err := parseDecimal(v)
+	if err != nil || percent < 0 {
+		return t, fmt.Errorf("invalid min_percent %q, expected a non-negative number", v)
+	}
+	v = param("min_amount", "INSIGHTS_MIN_AMOUNT", "0")
+	amount, _, err := vault.ParseAmount(v, amountLocale())
+	if err != nil || amount < 0 {
+		return t, fmt.Errorf("invalid min_amount %q, expected a non-negative number", v)
+	}
+	t.MinPercent, t.MinAmount = percent, amount
+	return t, nil
+}
+
+// significance orders insights: the larger the relative change the more
+// significant, with new and vanished categories counting as a 100% change
+func (i insight) significance() float64 {
+	if i.ChangePercent == nil {
+		return 100
+	}
+	return math.Abs(*i.ChangePercent)
+}
+
+// calculateInsights compares each category's total in the given period of a
+// monthly breakdown with the period before it, returning the notable changes
+// with the most significant first
+func calculateInsights(b breakdownResponse, index int, t insightThresholds) insightsResponse {
+	resp := insightsResponse{Insights: []insight{}}
+	if index < 1 || index >= len(b.Periods) {
+		return resp
+	}
+	cur, prev := b.Periods[index], b.Periods[index-1]
+	resp.Month, resp.Previous = cur.Period, prev.Period
+
+	for _, category := range vault.TransactionTypes {
+		c, p := cur.Totals[category], prev.Totals[category]
+		change := c.Abs() - p.Abs()
+		if change == 0 || change.Abs() < t.MinAmount {
+			continue
+		}
+
+		in := insight{Category: category, Month: cur.Period, Previous: p, Current: c, Change: change}
+		switch {
+		case p == 0:
+			in.Direction = insightNew
+			in.Message = fmt.Sprintf("%s of %s in %s, none in %s", category, c.Abs(), cur.Period, prev.Period)
+		case c == 0:
+			in.Direction = insightGone
+			in.Message = fmt.Sprintf("No %s in %s, down from %s in %s", strings.ToLower(string(category)), cur.Period, p.Abs(), prev.Period)
+		default:
+			percent := change.Float() / p.Abs().Float() * 100
+			if math.Abs(percent) < t.MinPercent {
+				continue
+			}
+			in.ChangePercent = &percent
+			in.Direction = insightUp
+			if change < 0 {
+				in.Direction = insightDown
+			}
+			in.Message = fmt.Sprintf("%s %s %.0f%% vs last month (%s to %s)", category, in.Direction, math.Abs(percent), p.Abs(), c.Abs())
+		}
+		resp.Insights = append(resp.Insights, in)
+	}
+
+	sort.SliceStable(resp.Insights, func(i, j int) bool {
+		a, b := resp.Insights[i], resp.Insights[j]
+		if a.significance() != b.significance() {
+			return a.significance() > b.significance()
+		}
+		return a.Change.Abs() > b.Change.Abs()
+	})
+
+	return resp
+}
+
+// InsightsHandler returns the notable changes in each category's monthly
+// total between a month, by default the latest, and the month before it
+func InsightsHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	thresholds, err := insightThresholdsFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	_, categorized, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	b := calculateBreakdown(categorized, "month", reportingLocation(), 0)
+	index := len(b.Periods) - 1
+	if month := r.URL.Query().Get("month"); month != "" {
+		index = -1
+		for i, p := range b.Periods {
+			if p.Period == month {
+				index = i
+			}
+		}
+		if index < 0 {
+			writeJSONError(w, http.StatusNotFound, "month "+month+" is outside the range of the transactions, expected YYYY-MM")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, calculateInsights(b, index, thresholds))
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// internalTransferMatch configures how a debit in one account is matched to
+// the credit of the same transfer in another account
+type internalTransferMatch struct {
+	Window    time.Duration // largest time between the debit and the credit; negative disables matching
+	Tolerance vault.Money   // largest difference between the amounts debited and credited
+}
+
+// internalTransferMatching returns the matching configured with
+// INTERNAL_TRANSFER_WINDOW, in days (default 3, negative disables matching),
+// and INTERNAL_TRANSFER_TOLERANCE (default 0)
+func internalTransferMatching() internalTransferMatch {
+	m := internalTransferMatch{Window: 3 * 24 * time.Hour}
+	if days, err := strconv.Atoi(getEnvOrDefault("INTERNAL_TRANSFER_WINDOW", "3")); err == nil {
+		m.Window = time.Duration(days) * 24 * time.Hour
+	} else {
+		log.Printf("Invalid INTERNAL_TRANSFER_WINDOW, using 3 days: %v", err)
+	}
+	if tolerance, _, err := vault.ParseAmount(getEnvOrDefault("INTERNAL_TRANSFER_TOLERANCE", "0"), amountLocale()); err == nil && tolerance >= 0 {
+		m.Tolerance = tolerance
+	} else {
+		log.Printf("Invalid INTERNAL_TRANSFER_TOLERANCE, using 0: %v", err)
+	}
+	return m
+}
+
+// enabled reports whether transfers are matched, which takes several accounts
+func (m internalTransferMatch) enabled() bool {
+	return m.Window >= 0 && len(accounts()) > 1
+}
+
+// internalCandidate is a transaction that may be one side of an internal transfer
+type internalCandidate struct {
+	account int
+	txn     *vault.Transaction
+	amount  vault.Money
+}
+
+// matchInternalTransfers marks as internal every debit in one account that
+// is matched by a credit of the same amount, within the tolerance, in another
+// account within the window, along with its credit. Each transaction is
+// matched at most once, to the candidate closest in date; transactions
+// without a date, or already marked internal, are left alone.
+func matchInternalTransfers(byAccount [][]vault.Transaction, m internalTransferMatch) {
+	var debits, credits []internalCandidate
+	for a := range byAccount {
+		for i := range byAccount[a] {
+			txn := &byAccount[a][i]
+			if txn.Internal || txn.Timestamp.IsZero() {
+				continue
+			}
+			c := internalCandidate{account: a, txn: txn, amount: txn.Amount}
+			switch {
+			case c.amount < 0:
+				debits = append(debits, c)
+			case c.amount > 0:
+				credits = append(credits, c)
+			}
+		}
+	}
+
+	sort.SliceStable(credits, func(i, j int) bool { return credits[i].txn.Timestamp.Before(credits[j].txn.Timestamp) })
+	matched := make([]bool, len(credits))
+	for _, d := range debits {
+		from := sort.Search(len(credits), func(i int) bool { return !credits[i].txn.Timestamp.Before(d.txn.Timestamp.Add(-m.Window)) })
+		best, bestGap := -1, time.Duration(0)
+		for i := from; i < len(credits) && !credits[i].txn.Timestamp.After(d.txn.Timestamp.Add(m.Window)); i++ {
+			c := credits[i]
+			if matched[i] || c.account == d.account || (c.amount+d.amount).Abs() > m.Tolerance {
+				continue
+			}
+			gap := c.txn.Timestamp.Sub(d.txn.Timestamp)
+			if gap < 0 {
+				gap = -gap
+			}
+			if best < 0 || gap < bestGap {
+				best, bestGap = i, gap
+			}
+		}
+		if best >= 0 {
+			matched[best] = true
+			d.txn.Internal, credits[best].txn.Internal = true, true
+		}
+	}
+}
+
+// markInternalTransfers marks the account's transactions that are matched
+// with a transaction in another account as internal transfers, reading the
+// other accounts' transactions when matching is enabled
+func markInternalTransfers(ctx context.Context, db *badger.DB, acct account, transactions []vault.Transaction) error {
+	m := internalTransferMatching()
+	if !m.enabled() {
+		return nil
+	}
+
+	var byAccount [][]vault.Transaction
+	for _, other := range accounts() {
+		if other.Name == acct.Name {
+			byAccount = append(byAccount, transactions)
+			continue
+		}
+		txns, err := loadAccountTransactions(ctx, db, other)
+		if err != nil {
+			return err
+		}
+		byAccount = append(byAccount, txns)
+	}
+
+	matchInternalTransfers(byAccount, m)
+	return nil
+}
@@ -1,45 +1,91 @@
 package handlers
 
 import (
-	"html"
+	"fmt"
 	"html/template"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 )
 
+// ledgerFilename is the name of the ledger generated in each account's ledger directory
+const ledgerFilename = "FK_MASTER_LEDGER.md"
+
 // LedgerHandler handles the ledger page
 func (gh *GRCHandler) LedgerHandler(w http.ResponseWriter, r *http.Request) {
 	// Read the ledger markdown file
-	ledgerPath := filepath.Join("ledger", "FK_MASTER_LEDGER.md")
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		gh.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	ledgerPath := filepath.Join(acct.LedgerDir, ledgerFilename)
+	if setPageCacheHeaders(w, r, newestModTime(ledgerPath)) {
+		return
+	}
+
 	content, err := os.ReadFile(ledgerPath)
 	if err != nil {
-		log.Println("ERROR: could not read ledger file: ", err)
+		requestLog(r).Println("ERROR: could not read ledger file: ", err)
 		// If file doesn't exist, show a message
 		content = []byte("# No Ledger Available\n\nNo ledger data has been generated yet.")
 	}
 
 	t, err := gh.loadTemplate("templates/ledger.html")
 	if err != nil {
-		log.Println("ERROR: could not get ledger template: ", err)
-		http.Error(w, err.Error(), 500)
+		requestLog(r).Println("ERROR: could not get ledger template: ", err)
+		gh.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	if err := t.ExecuteTemplate(w, "base", map[string]interface{}{
 		"google_analytics_key": googleAnalyticsKey,
 		"LedgerContent":        template.HTML(markdownToHTML(string(content))),
+		"Account":              acct.Name,
+		"Accounts":             accounts(),
 	}); err != nil {
-		log.Println("ERROR:", err)
+		requestLog(r).Println("ERROR:", err)
+	}
+}
+
+// LedgerDownloadHandler serves the account's ledger file as a download. Range
+// requests are supported, so interrupted downloads of large ledgers can resume.
+func LedgerDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	f, err := os.Open(filepath.Join(acct.LedgerDir, ledgerFilename))
+	if os.IsNotExist(err) {
+		writeJSONError(w, http.StatusNotFound, "no ledger has been generated yet")
+		return
+	}
+	if err != nil {
+		requestLog(r).Println("ERROR: could not open ledger file: ", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not open ledger")
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		requestLog(r).Println("ERROR: could not stat ledger file: ", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not open ledger")
+		return
 	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", acct.Name+"_"+ledgerFilename))
+	// ServeContent handles Range and If-Range requests and sets Accept-Ranges
+	http.ServeContent(w, r, ledgerFilename, fi.ModTime(), f)
 }
 
-// markdownToHTML converts markdown to HTML with proper escaping
-// This is a minimal implementation for the ledger display
+// markdownToHTML renders the ledger's markdown as HTML: its headings, tables
+// of transactions, lists and bold or italic text. Raw HTML is left out and
+// the result sanitized, so descriptions from the vault cannot inject markup.
 func markdownToHTML(md string) string {
-	// Escape HTML to prevent XSS attacks
-	escaped := html.EscapeString(md)
-	// Wrap in a div with proper styling
-	return `<div class="ledger-content">` + escaped + `</div>`
+	return `<div class="ledger-content">` + renderMarkdown(md) + `</div>`
 }
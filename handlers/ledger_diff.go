@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// diffLine is a line of a diff: ' ' for an unchanged line, '-' for a removed
+// line and '+' for an added one
+type diffLine struct {
+	Op   byte
+	Text string
+}
+
+// diffLines returns the shortest edit script turning a into b, using Myers'
+// O(ND) algorithm
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+
+	// trace[d][k+d] is the furthest x reached on diagonal k with d edits
+	var trace [][]int
+	furthest := func(d, k int) int { return trace[d][k+d] }
+	down := func(d, k int) bool {
+		return k == -d || (k != d && furthest(d-1, k-1) < furthest(d-1, k+1))
+	}
+
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, make([]int, 2*d+1))
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			if d > 0 {
+				if down(d, k) {
+					x = furthest(d-1, k+1)
+				} else {
+					x = furthest(d-1, k-1) + 1
+				}
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			trace[d][k+d] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var lines []diffLine
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+		prevK := k - 1
+		if down(d, k) {
+			prevK = k + 1
+		}
+		prevX := furthest(d-1, prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			lines = append(lines, diffLine{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			lines = append(lines, diffLine{'+', b[y]})
+		} else {
+			x--
+			lines = append(lines, diffLine{'-', a[x]})
+		}
+	}
+	for x > 0 {
+		x--
+		lines = append(lines, diffLine{' ', a[x]})
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+// unifiedDiff returns the unified diff between two texts, or an empty string
+// if they are equal
+func unifiedDiff(fromName, toName, from, to string) string {
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	var b strings.Builder
+	fromLine, toLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].Op == ' ' {
+			i, fromLine, toLine = i+1, fromLine+1, toLine+1
+			continue
+		}
+
+		// a hunk starts diffContext lines before the change and runs until
+		// more than 2*diffContext unchanged lines follow a change
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end, unchanged := i, 0
+		for ; end < len(lines) && unchanged <= 2*diffContext; end++ {
+			if lines[end].Op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		if unchanged > diffContext {
+			end -= unchanged - diffContext
+		}
+
+		hunkFrom, hunkTo := fromLine-(i-start), toLine-(i-start)
+		var fromCount, toCount int
+		var body strings.Builder
+		for _, l := range lines[start:end] {
+			if l.Op != '+' {
+				fromCount++
+			}
+			if l.Op != '-' {
+				toCount++
+			}
+			body.WriteByte(l.Op)
+			body.WriteString(l.Text)
+			body.WriteByte('\n')
+		}
+
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(hunkFrom, fromCount), hunkRange(hunkTo, toCount))
+		b.WriteString(body.String())
+
+		fromLine, toLine = hunkFrom+fromCount, hunkTo+toCount
+		i = end
+	}
+
+	return b.String()
+}
+
+// hunkRange formats the start and length of a hunk; an empty range starts at
+// the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// ledgerVersionParam reads a ledger version from the request, 0 being the
+// current ledger and 1 the previous one
+func ledgerVersionParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a ledger version such as 0 (current) or 1 (previous)", name, v)
+	}
+	return version, nil
+}
+
+// ledgerDiff returns the unified diff between the from and to versions of
+// the account's ledger requested, and the HTTP status and message of any error
+func ledgerDiff(r *http.Request) (diff string, status int, err error) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		return "", http.StatusNotFound, err
+	}
+
+	from, err := ledgerVersionParam(r, "from", 1)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	to, err := ledgerVersionParam(r, "to", 0)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	var contents [2]string
+	for i, version := range []int{from, to} {
+		b, err := os.ReadFile(vault.LedgerVersionPath(acct.LedgerDir, ledgerFilename, version))
+		if os.IsNotExist(err) {
+			return "", http.StatusNotFound, fmt.Errorf("ledger version %d does not exist", version)
+		}
+		if err != nil {
+			requestLog(r).Println("ERROR: could not read ledger version:", err)
+			return "", http.StatusInternalServerError, fmt.Errorf("could not read ledger version %d", version)
+		}
+		contents[i] = string(b)
+	}
+
+	name := func(version int) string {
+		return strings.TrimPrefix(vault.LedgerVersionPath("", ledgerFilename, version), "/")
+	}
+	return unifiedDiff(name(from), name(to), contents[0], contents[1]), http.StatusOK, nil
+}
+
+// LedgerDiffHandler returns the unified diff between two versions of the
+// account's ledger, by default the previous and the current one
+func LedgerDiffHandler(w http.ResponseWriter, r *http.Request) {
+	diff, status, err := ledgerDiff(r)
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	fmt.Fprint(w, diff)
+}
+
+// ledgerDiffLine is a line of the ledger diff page, with its CSS class
+type ledgerDiffLine struct {
+	Class string
+	Text  string
+}
+
+// LedgerDiffPageHandler shows the diff between two versions of the account's
+// ledger, highlighting added and removed lines
+func (gh *GRCHandler) LedgerDiffPageHandler(w http.ResponseWriter, r *http.Request) {
+	diff, status, err := ledgerDiff(r)
+	if err != nil {
+		gh.errorPage(w, status, err.Error())
+		return
+	}
+
+	var lines []ledgerDiffLine
+	for _, l := range splitLines(diff) {
+		class := ""
+		switch {
+		case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+			class = "diff-file"
+		case strings.HasPrefix(l, "@@"):
+			class = "diff-hunk"
+		case strings.HasPrefix(l, "+"):
+			class = "diff-add"
+		case strings.HasPrefix(l, "-"):
+			class = "diff-del"
+		}
+		lines = append(lines, ledgerDiffLine{Class: class, Text: l})
+	}
+
+	t, err := gh.loadTemplate("templates/ledger_diff.html")
+	if err != nil {
+		requestLog(r).Println("ERROR: could not get ledger diff template: ", err)
+		gh.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	acct, _ := accountFromRequest(r)
+	if err := t.ExecuteTemplate(w, "base", map[string]interface{}{
+		"google_analytics_key": googleAnalyticsKey,
+		"Account":              acct.Name,
+		"Lines":                lines,
+		"From":                 r.URL.Query().Get("from"),
+		"To":                   r.URL.Query().Get("to"),
+	}); err != nil {
+		requestLog(r).Println("ERROR:", err)
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"bytes"
+	"html"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// ledgerMarkdown renders markdown with GitHub-style tables. Raw HTML in the
+// source is left out rather than passed through.
+var ledgerMarkdown = goldmark.New(
+	goldmark.WithExtensions(extension.NewTable(
+		extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute),
+	)),
+)
+
+// ledgerPolicy sanitizes the rendered HTML, so that it is safe to include in
+// a page whatever the ledger contains
+var ledgerPolicy = bluemonday.UGCPolicy()
+
+// renderMarkdown converts markdown to sanitized HTML
+func renderMarkdown(md string) string {
+	var b bytes.Buffer
+	if err := ledgerMarkdown.Convert([]byte(md), &b); err != nil {
+		return "<pre>" + html.EscapeString(md) + "</pre>"
+	}
+	return ledgerPolicy.SanitizeReader(&b).String()
+}
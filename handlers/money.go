@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"log"
+	"reflect"
+	"strconv"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// moneyDecimals is the number of decimal places amounts are rounded to in
+// the JSON API, configured with BOOKKEEPING_DECIMALS
+var moneyDecimals = decimalsFromEnv()
+
+func decimalsFromEnv() int {
+	decimals, err := strconv.Atoi(getEnvOrDefault("BOOKKEEPING_DECIMALS", "2"))
+	if err != nil || decimals < 0 {
+		log.Printf("Invalid BOOKKEEPING_DECIMALS, using 2 decimal places")
+		return 2
+	}
+	return decimals
+}
+
+// addMoney returns sum+n with vault.Money.Add, which caps a sum that
+// overflows rather than wrapping it around, and logs when it caps it
+func addMoney(sum, n vault.Money) vault.Money {
+	s, err := sum.Add(n)
+	if err != nil && s != sum {
+		log.Printf("Capping a sum of amounts at %s: %v", s, err)
+	}
+	return s
+}
+
+// requestAmount is an amount in a request body: a JSON number, or a string
+// in the AMOUNT_LOCALE number format, such as "-9,00"
+type requestAmount vault.Money
+
+func (a *requestAmount) UnmarshalJSON(data []byte) error {
+	var v vault.Money
+	if s, err := strconv.Unquote(string(data)); err == nil {
+		if v, _, err = vault.ParseAmount(s, amountLocale()); err != nil {
+			return err
+		}
+	} else if err := v.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*a = requestAmount(v)
+	return nil
+}
+
+// roundAmounts returns a copy of v with every vault.Money in it rounded to
+// decimals places, for writing v as JSON; v itself is not changed. The
+// amounts are still written with at least two decimal places.
+func roundAmounts(v interface{}, decimals int) interface{} {
+	if v == nil {
+		return nil
+	}
+	return roundValue(reflect.ValueOf(v), decimals).Interface()
+}
+
+func roundValue(v reflect.Value, decimals int) reflect.Value {
+	if v.Type() == moneyType {
+		return reflect.ValueOf(vault.Money(v.Int()).Round(decimals))
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(roundValue(v.Elem(), decimals))
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		i := reflect.New(v.Type()).Elem()
+		i.Set(roundValue(v.Elem(), decimals))
+		return i
+	case reflect.Struct:
+		s := reflect.New(v.Type()).Elem()
+		s.Set(v)
+		for i := 0; i < s.NumField(); i++ {
+			if s.Type().Field(i).IsExported() {
+				s.Field(i).Set(roundValue(v.Field(i), decimals))
+			}
+		}
+		return s
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(roundValue(v.Index(i), decimals))
+		}
+		return s
+	case reflect.Array:
+		a := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			a.Index(i).Set(roundValue(v.Index(i), decimals))
+		}
+		return a
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			m.SetMapIndex(it.Key(), roundValue(it.Value(), decimals))
+		}
+		return m
+	}
+	return v
+}
@@ -0,0 +1,568 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// apiParam is a query parameter of a bookkeeping API operation
+type apiParam struct {
+	Name        string
+	Description string
+	Type        string // JSON schema type, defaults to string
+	Enum        []string
+	Repeated    bool // the parameter may be given several times
+	InPath      bool // the parameter is part of the path rather than the query
+}
+
+// apiOperation describes a bookkeeping API endpoint. The request and response
+// schemas of the OpenAPI document are generated from the Go types the
+// handlers decode and encode, so they cannot drift from the handlers.
+type apiOperation struct {
+	Method   string
+	Path     string
+	Summary  string
+	Params   []apiParam
+	Request  interface{} // value of the JSON request body type, if any
+	Status   int
+	Response interface{} // value of the JSON response type
+	// ContentType is the media type of a binary response, such as image/png,
+	// returned instead of JSON
+	ContentType string
+}
+
+var accountParam = apiParam{Name: "account", Description: "Account to use, defaults to the first configured account (alias: entity)"}
+
+// transactionTypeNames returns the names of the transaction types in display order
+func transactionTypeNames() []string {
+	names := make([]string, 0, len(vault.TransactionTypes))
+	for _, t := range vault.TransactionTypes {
+		names = append(names, string(t))
+	}
+	return names
+}
+
+var typeParam = apiParam{Name: "type", Description: "Only include transactions of this type; repeat for several types", Enum: transactionTypeNames(), Repeated: true}
+
+// filterParams select transactions by date and description; without from and
+// to, the default reporting period applies
+var filterParams = []apiParam{
+	{Name: "from", Description: "Inclusive start date, YYYY-MM-DD"},
+	{Name: "to", Description: "Inclusive end date, YYYY-MM-DD"},
+	{Name: "query", Description: "Case-insensitive substring of the description"},
+	{Name: "all", Description: "Include all transactions instead of the default reporting period (REPORTING_PERIOD) when neither from nor to is given", Type: "boolean"},
+	{Name: "include_zero", Description: "Include transactions with an amount of zero in listings and counts; defaults to INCLUDE_ZERO_AMOUNTS or true", Type: "boolean"},
+}
+
+var granularityParam = apiParam{Name: "granularity", Description: "Period length, defaults to month", Enum: []string{"day", "week", "month"}}
+
+var levelParam = apiParam{Name: "level", Description: "Roll the category totals up to this depth of their paths; 1 totals each type", Type: "integer"}
+
+// apiOperations lists the bookkeeping API; add new endpoints here
+var apiOperations = []apiOperation{
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping",
+		Summary: "Categorized transactions and summary",
+		Params: append([]apiParam{
+			accountParam,
+			typeParam,
+			{Name: "exclude_type", Description: "Leave out transactions of this type, after type selects; repeat for several types", Enum: transactionTypeNames(), Repeated: true},
+			{Name: "exclude_q", Description: "Leave out transactions whose description contains this, case-insensitively; repeat for several", Repeated: true},
+			{Name: "reconciled", Description: "Only list transactions that are (true) or are not (false) reconciled", Type: "boolean"},
+			{Name: "hide_below", Description: "Leave transactions with a smaller absolute amount out of the listing, but not the summary; defaults to BOOKKEEPING_HIDE_BELOW", Type: "number"},
+			{Name: "net", Description: "Give each payment its net_amount, less the fees associated with it by FEE_ASSOCIATION", Type: "boolean"},
+			levelParam,
+			{Name: "page", Description: "Page of the listing to return, counted from 1; defaults to 1 with page_size", Type: "integer"},
+			{Name: "page_size", Description: "Transactions per page, at most 1000; defaults to 100 with page", Type: "integer"},
+			{Name: "opening", Description: "Balance before the first transaction, which the running balances start from; defaults to OPENING_BALANCE or 0", Type: "number"},
+		}, filterParams...),
+		Status:   http.StatusOK,
+		Response: bookkeepingResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/summary",
+		Summary: "Summary of the transactions, without the transactions themselves",
+		Params: append([]apiParam{
+			accountParam,
+			typeParam,
+			levelParam,
+		}, filterParams...),
+		Status:   http.StatusOK,
+		Response: SummaryStats{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/summary.png",
+		Summary: "The summary as a PNG image for sharing, cached by the fingerprint of its data",
+		Params: append([]apiParam{
+			accountParam,
+			typeParam,
+		}, filterParams...),
+		Status:      http.StatusOK,
+		ContentType: "image/png",
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/breakdown",
+		Summary:  "Totals per category and period, bucketed in the reporting time zone",
+		Params:   []apiParam{accountParam, granularityParam, levelParam},
+		Status:   http.StatusOK,
+		Response: breakdownResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/cashflow",
+		Summary: "Money in and out per period, bucketed in the reporting time zone, and per day on average",
+		Params: []apiParam{
+			accountParam,
+			granularityParam,
+			{Name: "exclude_days", Description: "Comma-separated weekdays, dates (YYYY-MM-DD) and weekends left out of the daily average's denominator; defaults to CASHFLOW_EXCLUDE_DAYS"},
+		},
+		Status:   http.StatusOK,
+		Response: cashFlowResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/statement",
+		Summary: "Opening balance, inflow, outflow and closing balance per period, bucketed in the reporting time zone",
+		Params: []apiParam{
+			accountParam,
+			granularityParam,
+			{Name: "opening", Description: "Balance before the first period, defaults to 0"},
+		},
+		Status:   http.StatusOK,
+		Response: statementResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/sheets",
+		Summary: "Write the summary and monthly breakdown to the configured Google Sheets spreadsheet, replacing the sheet's contents",
+		Params: append([]apiParam{
+			accountParam,
+			{Name: "dry_run", Description: "Return the rows without writing them, which needs no credentials", Type: "boolean"},
+		}, filterParams...),
+		Status:   http.StatusOK,
+		Response: sheetsExportResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/insights",
+		Summary: "Notable month-over-month changes per category, most significant first",
+		Params: []apiParam{
+			accountParam,
+			{Name: "month", Description: "Month to compare with the month before, YYYY-MM; defaults to the latest"},
+			{Name: "min_percent", Description: "Smallest notable change in percent, defaults to INSIGHTS_MIN_PERCENT or 20", Type: "number"},
+			{Name: "min_amount", Description: "Smallest notable change in amount, defaults to INSIGHTS_MIN_AMOUNT or 0", Type: "number"},
+		},
+		Status:   http.StatusOK,
+		Response: insightsResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/anomalies",
+		Summary: "Transactions with amounts far from the others of their category, largest z-score first",
+		Params: []apiParam{
+			accountParam,
+			{Name: "k", Description: "Smallest absolute z-score flagged, defaults to ANOMALY_K or 3", Type: "number"},
+			{Name: "method", Description: "stddev compares with the mean, mad with the median; defaults to ANOMALY_METHOD or stddev", Enum: []string{anomalyStddev, anomalyMAD}},
+		},
+		Status:   http.StatusOK,
+		Response: anomaliesResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/gaps",
+		Summary: "Runs of days without any transactions, as potentially missing statements",
+		Params: []apiParam{
+			accountParam,
+			{Name: "min_days", Description: "Shortest gap reported, in days; defaults to GAPS_MIN_DAYS or 14", Type: "integer"},
+		},
+		Status:   http.StatusOK,
+		Response: gapsResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/tax",
+		Summary: "Totals of a fiscal year by tax category, with VAT separated where a rate is configured",
+		Params: []apiParam{
+			accountParam,
+			{Name: "year", Description: "Year the fiscal year starts in; defaults to the fiscal year of the latest transaction", Type: "integer"},
+		},
+		Status:   http.StatusOK,
+		Response: taxTotalsResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/weekdays",
+		Summary:  "Number and flow of the transactions per day of the week, Monday to Sunday",
+		Params:   append([]apiParam{accountParam}, filterParams...),
+		Status:   http.StatusOK,
+		Response: weekdaysResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/suggestions",
+		Summary:  "Suggested categories for uncategorized transactions",
+		Params:   []apiParam{accountParam},
+		Status:   http.StatusOK,
+		Response: []vault.Suggestion{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/suggestions",
+		Summary:  "Accept a suggestion as a categorization rule",
+		Params:   []apiParam{accountParam},
+		Request:  acceptSuggestionRequest{},
+		Status:   http.StatusCreated,
+		Response: vault.CategoryRule{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/recategorize",
+		Summary:  "Reassign the category of the transactions matching a filter",
+		Params:   []apiParam{accountParam},
+		Request:  recategorizeRequest{},
+		Status:   http.StatusOK,
+		Response: recategorizeResponse{},
+	},
+	{
+		Method: http.MethodPatch, Path: transactionPath + "{id}",
+		Summary: "Override the category of a single transaction",
+		Params: []apiParam{
+			{Name: "id", Description: "Transaction ID", InPath: true},
+			accountParam,
+		},
+		Request:  overrideRequest{},
+		Status:   http.StatusOK,
+		Response: categoryChange{},
+	},
+	{
+		Method: http.MethodPost, Path: splitPath + "{id}",
+		Summary: "Split a transaction into parts with their own categories, summing to its amount",
+		Params: []apiParam{
+			{Name: "id", Description: "Transaction ID", InPath: true},
+			accountParam,
+		},
+		Request:  splitRequest{},
+		Status:   http.StatusOK,
+		Response: splitResponse{},
+	},
+	{
+		Method: http.MethodDelete, Path: splitPath + "{id}",
+		Summary: "Remove the split of a transaction",
+		Params: []apiParam{
+			{Name: "id", Description: "Transaction ID", InPath: true},
+			accountParam,
+		},
+		Status:   http.StatusOK,
+		Response: splitResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/tags",
+		Summary:  "Tag every transaction matching a filter",
+		Params:   []apiParam{accountParam},
+		Request:  tagRequest{},
+		Status:   http.StatusOK,
+		Response: tagResponse{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/api/bookkeeping/tags",
+		Summary:  "Remove a tag from every transaction matching a filter",
+		Params:   []apiParam{accountParam},
+		Request:  tagRequest{},
+		Status:   http.StatusOK,
+		Response: tagResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/reconcile",
+		Summary:  "Mark transactions as reconciled",
+		Params:   []apiParam{accountParam},
+		Request:  reconcileRequest{},
+		Status:   http.StatusOK,
+		Response: reconcileResponse{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/api/bookkeeping/reconcile",
+		Summary:  "Remove the reconciled mark of transactions",
+		Params:   []apiParam{accountParam},
+		Request:  reconcileRequest{},
+		Status:   http.StatusOK,
+		Response: reconcileResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/audit",
+		Summary: "Audit log of category changes and reconciliation marks, oldest first",
+		Params: []apiParam{
+			accountParam,
+			{Name: "action", Description: "Only list events with this action", Enum: []string{auditRecategorize, auditReconcile, auditUnreconcile, auditSplit, auditUnsplit, auditTag, auditUntag}},
+			{Name: "transaction_id", Description: "Only list events for this transaction"},
+			{Name: "from", Description: "Inclusive start date of the event (UTC), YYYY-MM-DD"},
+			{Name: "to", Description: "Inclusive end date of the event (UTC), YYYY-MM-DD"},
+		},
+		Status:   http.StatusOK,
+		Response: []auditEvent{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/warnings",
+		Summary:  "Parse, schema and integrity warnings of the last processing run",
+		Params:   []apiParam{accountParam},
+		Status:   http.StatusOK,
+		Response: warningsResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/selfcheck",
+		Summary: "Check the integrity of the account's data, reporting healthy or degraded",
+		Params: []apiParam{
+			accountParam,
+			{Name: "skip", Description: "Comma-separated checks not to run, of schema, duplicates, checksums, signs and warnings; defaults to SELFCHECK_SKIP"},
+		},
+		Status:   http.StatusOK,
+		Response: selfCheckResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/preview",
+		Summary: "Parse the first rows of the CSV files without storing anything",
+		Params: []apiParam{
+			accountParam,
+			{Name: "file", Description: "Base name of the only CSV file to preview"},
+			{Name: "rows", Description: "Rows to parse per file, defaults to 10 and is capped to 100", Type: "integer"},
+		},
+		Status:   http.StatusOK,
+		Response: previewResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/validate",
+		Summary: "Parse an uploaded CSV file, as a multipart file field or the body, without adding it to the vault",
+		Params: []apiParam{
+			accountParam,
+			{Name: "file", Description: "Name of a CSV file sent as the body, ending in .gz if it is compressed"},
+		},
+		Status:   http.StatusOK,
+		Response: vault.FileValidation{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/files",
+		Summary:  "List the vault's CSV files with their size, modification time and rows",
+		Params:   []apiParam{accountParam},
+		Status:   http.StatusOK,
+		Response: vaultFilesResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/files/download",
+		Summary: "Download one of the vault's CSV files as stored",
+		Params: []apiParam{
+			accountParam,
+			{Name: "file", Description: "Base name of a file listed by /api/bookkeeping/files"},
+		},
+		Status:      http.StatusOK,
+		ContentType: "text/csv",
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/colors",
+		Summary:  "Chart color of each category, configured with CATEGORY_COLORS or generated",
+		Status:   http.StatusOK,
+		Response: map[string]string{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/rules/test",
+		Summary:  "Report the category the rules assign to a description",
+		Request:  rulesTestRequest{},
+		Status:   http.StatusOK,
+		Response: rulesTestResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/process",
+		Summary:  "Read the vault, regenerate the ledger and store the transactions",
+		Params:   []apiParam{accountParam},
+		Status:   http.StatusOK,
+		Response: processResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/recalculate",
+		Summary:  "Rebuild the summary from the stored transactions",
+		Params:   []apiParam{accountParam},
+		Status:   http.StatusOK,
+		Response: processResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/bookkeeping/archive",
+		Summary:  "Move stored transactions older than RETENTION_YEARS out of the hot keyspace",
+		Params:   []apiParam{accountParam},
+		Status:   http.StatusOK,
+		Response: archiveResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/bookkeeping/pending",
+		Summary:  "List the vault transactions missing from the last generated ledger",
+		Params:   []apiParam{accountParam},
+		Status:   http.StatusOK,
+		Response: pendingResponse{},
+	},
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	moneyType   = reflect.TypeOf(vault.Money(0))
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+	txnTypeType = reflect.TypeOf(vault.TransactionType(""))
+)
+
+// schemaBuilder generates JSON schemas from Go types, collecting named
+// structs as reusable components
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case moneyType:
+		return map[string]interface{}{"type": "string", "format": "decimal"}
+	case rawJSONType:
+		return map[string]interface{}{}
+	case txnTypeType:
+		return map[string]interface{}{"type": "string", "enum": transactionTypeNames()}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := b.components[name]; !ok {
+			b.components[name] = nil // reserve the name while the fields are generated
+			props := make(map[string]interface{})
+			b.addProperties(props, t)
+			b.components[name] = map[string]interface{}{"type": "object", "properties": props}
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	return map[string]interface{}{}
+}
+
+// addProperties adds the JSON-encoded fields of struct type t to props,
+// flattening embedded structs as encoding/json does
+func (b *schemaBuilder) addProperties(props map[string]interface{}, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			b.addProperties(props, f.Type)
+			continue
+		}
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+	}
+}
+
+// openAPIDocument returns the OpenAPI 3 description of the bookkeeping API
+func openAPIDocument() map[string]interface{} {
+	b := &schemaBuilder{components: make(map[string]interface{})}
+	b.components["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{"type": "string"},
+			"code":  map[string]interface{}{"type": "string"},
+		},
+	}
+
+	paths := make(map[string]map[string]interface{})
+	for _, op := range apiOperations {
+		params := make([]interface{}, 0, len(op.Params))
+		for _, p := range op.Params {
+			typ := p.Type
+			if typ == "" {
+				typ = "string"
+			}
+			s := map[string]interface{}{"type": typ}
+			if len(p.Enum) > 0 {
+				s["enum"] = p.Enum
+			}
+			if p.Repeated {
+				s = map[string]interface{}{"type": "array", "items": s}
+			}
+			param := map[string]interface{}{
+				"name": p.Name, "in": "query", "description": p.Description, "schema": s,
+			}
+			if p.InPath {
+				param["in"], param["required"] = "path", true
+			}
+			params = append(params, param)
+		}
+
+		var response map[string]interface{}
+		if op.ContentType == "" {
+			response = jsonContent(http.StatusText(op.Status), b.schema(reflect.TypeOf(op.Response)))
+		} else {
+			response = map[string]interface{}{
+				"description": http.StatusText(op.Status),
+				"content": map[string]interface{}{
+					op.ContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+				},
+			}
+		}
+		operation := map[string]interface{}{
+			"summary":    op.Summary,
+			"parameters": params,
+			"responses": map[string]interface{}{
+				strconv.Itoa(op.Status): response,
+				"default":               jsonContent("Error", map[string]interface{}{"$ref": "#/components/schemas/Error"}),
+			},
+		}
+		if op.Request != nil {
+			body := jsonContent("", b.schema(reflect.TypeOf(op.Request)))
+			delete(body, "description")
+			body["required"] = true
+			operation["requestBody"] = body
+		}
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = make(map[string]interface{})
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Bookkeeping API",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": b.components},
+	}
+}
+
+func jsonContent(description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		},
+	}
+}
+
+// OpenAPIHandler serves the OpenAPI 3 document of the bookkeeping API
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPIDocument())
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// ModifiedPrefix is the badger prefix for the time an account's stored
+	// transactions, overrides or reconciliation marks last changed, keyed by account
+	ModifiedPrefix string = "bookkeeping-modified-"
+)
+
+// serverStart is when the server started; pages are never older than that
+var serverStart = time.Now()
+
+// pageMaxAge is how long browsers and proxies may cache the ledger and
+// bookkeeping pages, configured with PAGE_CACHE_MAX_AGE (a duration such as
+// "1m"). Zero makes them revalidate on every request.
+func pageMaxAge() time.Duration {
+	d, err := time.ParseDuration(getEnvOrDefault("PAGE_CACHE_MAX_AGE", "1m"))
+	if err != nil || d < 0 {
+		log.Printf("Invalid PAGE_CACHE_MAX_AGE, using 1m: %v", err)
+		return time.Minute
+	}
+	return d
+}
+
+// setPageCacheHeaders sets the Cache-Control and Last-Modified headers of a
+// page whose content last changed at modified, and reports whether the
+// client's copy is still fresh, in which case it has been sent 304 Not
+// Modified and the page must not be rendered. A zero modified time sets only
+// Cache-Control.
+func setPageCacheHeaders(w http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	if maxAge := pageMaxAge(); maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	if modified.IsZero() {
+		return false
+	}
+	if modified.Before(serverStart) {
+		// the templates may have changed with a new release
+		modified = serverStart
+	}
+	// HTTP dates have a resolution of one second
+	modified = modified.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// newestModTime returns the latest modification time of the given files,
+// ignoring files that do not exist
+func newestModTime(filenames ...string) time.Time {
+	var newest time.Time
+	for _, fn := range filenames {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			continue
+		}
+		if fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+	}
+	return newest
+}
+
+// touchAccount records that the account's stored bookkeeping state changed
+func touchAccount(txn *badger.Txn, acct account) error {
+	return setJSON(txn, ModifiedPrefix+acct.Name, time.Now().UTC())
+}
+
+// bookkeepingModTime returns when the account's bookkeeping page last
+// changed: the newest of its vault files, the vault directory itself (which
+// changes when a file is removed), the rules and normalization files and its
+// stored state. Remote vaults are not checked for changes, so their pages
+// are always revalidated.
+func bookkeepingModTime(db *badger.DB, acct account) time.Time {
+	if vault.IsRemote(acct.VaultDir) {
+		return time.Time{}
+	}
+	files, err := vault.CSVFiles(acct.VaultDir)
+	if err != nil {
+		log.Println("ERROR: could not list vault files:", err)
+		return time.Time{}
+	}
+	newest := newestModTime(append(files, acct.VaultDir, rulesFile(), normalizationFile())...)
+
+	var stored time.Time
+	if _, err := getJSON(db, ModifiedPrefix+acct.Name, &stored); err != nil {
+		log.Println("ERROR: could not read modification time:", err)
+		return time.Time{}
+	}
+	if stored.After(newest) {
+		newest = stored
+	}
+
+	return newest
+}
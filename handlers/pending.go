@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+type pendingResponse struct {
+	LedgerExists    bool                `json:"ledger_exists"`
+	LedgerGenerated *time.Time          `json:"ledger_generated,omitempty"` // modification time of the ledger file
+	LedgerCount     int                 `json:"ledger_count"`
+	VaultCount      int                 `json:"vault_count"`
+	Pending         []vault.Transaction `json:"pending"` // in the vault but not in the ledger
+	PendingCount    int                 `json:"pending_count"`
+	RemovedCount    int                 `json:"removed_count"` // in the ledger but no longer in the vault
+	ReprocessNeeded bool                `json:"reprocess_needed"`
+}
+
+// ledgerKey identifies a transaction in both the vault and the ledger: its
+// transaction ID, or its date, amount and description when it has none
+func ledgerKey(txn vault.Transaction) string {
+	if txn.TransactionID != "" {
+		return "id|" + txn.TransactionID
+	}
+	return "row|" + txn.Date + "|" + txn.Amount.String() + "|" + txn.Description
+}
+
+// pendingTransactions returns the vault transactions missing from the ledger,
+// and the number of ledger transactions missing from the vault. Transactions
+// are counted, so that a repeated row is pending if the ledger has it fewer
+// times.
+func pendingTransactions(inVault, inLedger []vault.Transaction) ([]vault.Transaction, int) {
+	ledgered := make(map[string]int, len(inLedger))
+	for _, txn := range inLedger {
+		ledgered[ledgerKey(txn)]++
+	}
+
+	pending := []vault.Transaction{}
+	for _, txn := range inVault {
+		key := ledgerKey(txn)
+		if ledgered[key] > 0 {
+			ledgered[key]--
+			continue
+		}
+		pending = append(pending, txn)
+	}
+
+	removed := 0
+	for _, n := range ledgered {
+		removed += n
+	}
+	return pending, removed
+}
+
+// readLedger returns the transactions of the account's ledger and its
+// modification time, and false if no ledger has been generated
+func readLedger(acct account) ([]vault.Transaction, time.Time, bool, error) {
+	f, err := os.Open(filepath.Join(acct.LedgerDir, ledgerFilename))
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	transactions, err := vault.ParseLedger(f)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return transactions, fi.ModTime(), true, nil
+}
+
+// PendingHandler compares the transactions in the account's vault with those
+// in its last generated ledger, and lists the ones the ledger is missing
+func PendingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	tp, err := newBookkeepingProcessor(acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not create processor:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	inVault, err := tp.ReadCSVFiles(ctx)
+	if err != nil && !errors.Is(err, vault.ErrNoFiles) {
+		requestLog(r).Println("ERROR: could not read transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	inLedger, generated, exists, err := readLedger(acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not read ledger:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not read ledger")
+		return
+	}
+
+	pending, removed := pendingTransactions(inVault, inLedger)
+	resp := pendingResponse{
+		LedgerExists:    exists,
+		LedgerCount:     len(inLedger),
+		VaultCount:      len(inVault),
+		Pending:         pending,
+		PendingCount:    len(pending),
+		RemovedCount:    removed,
+		ReprocessNeeded: len(pending) > 0 || removed > 0,
+	}
+	if exists {
+		resp.LedgerGenerated = &generated
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
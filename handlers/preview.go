@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	defaultPreviewRows = 10
+	// maxPreviewRows caps the rows parsed per file, so that previews stay cheap
+	maxPreviewRows = 100
+)
+
+type previewResponse struct {
+	Rows  int                 `json:"rows"` // rows parsed at most per file, after capping
+	Files []vault.FilePreview `json:"files"`
+}
+
+// previewRows returns the rows query parameter, defaulting to
+// defaultPreviewRows and capped to maxPreviewRows
+func previewRows(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("rows")
+	if v == "" {
+		return defaultPreviewRows, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, errors.New("rows must be a positive integer")
+	}
+	if n > maxPreviewRows {
+		n = maxPreviewRows
+	}
+	return n, nil
+}
+
+// PreviewHandler parses the first rows of the vault's CSV files, or of the
+// one named by the file query parameter, and reports the transactions and
+// the header of the column each field is read from. Nothing is stored, so a
+// file's format can be checked before the vault is processed.
+func PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := previewRows(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	tp, err := newBookkeepingProcessor(acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not create processor:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	files, err := tp.PreviewCSVFiles(ctx, r.URL.Query().Get("file"), rows)
+	if errors.Is(err, vault.ErrUnknownFile) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, vault.ErrNoFiles) {
+		files = []vault.FilePreview{}
+	} else if err != nil {
+		requestLog(r).Println("ERROR: could not preview transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, previewResponse{Rows: rows, Files: files})
+}
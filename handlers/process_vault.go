@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// ProcessResult is the outcome of processing a vault outside the server
+type ProcessResult struct {
+	Transactions int             `json:"transactions"`
+	Summary      SummaryStats    `json:"summary"`
+	Warnings     []vault.Warning `json:"warnings"`
+	Took         string          `json:"took"`
+}
+
+// ProcessVault reads the vault directory and regenerates its ledger with the
+// configuration the server uses: rules, normalization, time zones, decimals
+// and retries are read from the environment. Unlike the process endpoint it
+// stores nothing in badger, so category overrides and reconciliation marks
+// do not apply. opts, such as vault.WithLogger, are applied after the
+// configuration.
+func ProcessVault(ctx context.Context, vaultDir, ledgerDir string, opts ...vault.Option) (ProcessResult, error) {
+	start := time.Now()
+	acct := account{Name: filepath.Base(vaultDir), VaultDir: vaultDir, LedgerDir: ledgerDir}
+	tp, err := newBookkeepingProcessor(acct, opts...)
+	if err != nil {
+		return ProcessResult{}, err
+	}
+
+	transactions, err := tp.ReadCSVFiles(ctx)
+	if err != nil && !errors.Is(err, vault.ErrNoFiles) {
+		return ProcessResult{}, err
+	}
+	if len(transactions) > 0 {
+		if err := tp.GenerateLedger(transactions, ledgerFilename); err != nil {
+			return ProcessResult{}, fmt.Errorf("could not generate ledger: %w", err)
+		}
+	}
+
+	warnings := tp.Warnings()
+	if warnings == nil {
+		warnings = []vault.Warning{}
+	}
+	return ProcessResult{
+		Transactions: len(transactions),
+		Summary:      calculateSummary(groupByType(transactions)),
+		Warnings:     warnings,
+		Took:         time.Since(start).String(),
+	}, nil
+}
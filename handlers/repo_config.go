@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/check"
+)
+
+const (
+	// RepoConfigPrefix is the badger prefix for per-repo grading settings,
+	// keyed by repo
+	RepoConfigPrefix string = "repo-config-"
+)
+
+// repoConfig holds the grading settings of a single repo. Settings left out
+// use the global defaults.
+type repoConfig struct {
+	Exclude    []string           `json:"exclude,omitempty"`    // patterns of files to exclude, in .goreportcardignore syntax
+	Weights    map[string]float64 `json:"weights,omitempty"`    // weights replacing those of the named checks
+	Thresholds check.Thresholds   `json:"thresholds,omitempty"` // percentages a score must exceed for each grade
+}
+
+// apply sets the repo's settings on the global options
+func (c repoConfig) apply(opts check.Options) check.Options {
+	opts.Exclude = c.Exclude
+	opts.Weights = c.Weights
+	opts.Thresholds = c.Thresholds
+	return opts
+}
+
+// loadRepoConfig returns the repo's stored settings; a repo without any has
+// an empty config
+func loadRepoConfig(db *badger.DB, repo string) (repoConfig, error) {
+	var c repoConfig
+	_, err := getJSON(db, RepoConfigPrefix+repo, &c)
+	return c, err
+}
+
+// gradingOptions returns the options repos are graded with, from the
+// environment, with the repo's own settings applied
+func gradingOptions(db *badger.DB, repo string) check.Options {
+	opts := check.Options{
+		Cache:         badgerResultCache{db},
+		Complexity:    complexityGate(),
+		MinFiles:      minFilesGate(),
+		ReviveConfig:  getEnvOrDefault("REVIVE_CONFIG", ""),
+		Golint:        useGolint(),
+		RequiredFiles: check.ParseRequiredFiles(getEnvOrDefault("REQUIRED_FILES", "")),
+		Todos:         todoOptions(),
+		GofmtGrace:    gofmtGrace(),
+		Coverage:      coverageOptions(),
+	}
+
+	c, err := loadRepoConfig(db, repo)
+	if err != nil {
+		log.Printf("ERROR: could not load config of %s, using the defaults: %v", repo, err)
+		return opts
+	}
+	return c.apply(opts)
+}
+
+// RepoConfigHandler returns the repo's grading settings on GET, replaces
+// them on PUT and removes them on DELETE, so that the repo is graded with the
+// global defaults again. New settings apply from the repo's next refresh.
+func RepoConfigHandler(w http.ResponseWriter, r *http.Request, db *badger.DB, repo string) {
+	switch r.Method {
+	case http.MethodGet:
+		c, err := loadRepoConfig(db, repo)
+		if err != nil {
+			requestLog(r).Println("ERROR: could not load repo config:", err)
+			writeJSONError(w, http.StatusInternalServerError, "could not load repo config")
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	case http.MethodPut:
+		var c repoConfig
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "request body must be a JSON repo config: "+err.Error())
+			return
+		}
+		if err := c.apply(check.Options{}).Validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err := db.Update(func(txn *badger.Txn) error {
+			return setJSON(txn, RepoConfigPrefix+repo, c)
+		})
+		if err != nil {
+			requestLog(r).Println("ERROR: could not save repo config:", err)
+			writeJSONError(w, http.StatusInternalServerError, "could not save repo config")
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	case http.MethodDelete:
+		err := db.Update(func(txn *badger.Txn) error {
+			return txn.Delete([]byte(RepoConfigPrefix + repo))
+		})
+		if err != nil {
+			requestLog(r).Println("ERROR: could not delete repo config:", err)
+			writeJSONError(w, http.StatusInternalServerError, "could not delete repo config")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
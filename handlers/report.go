@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
 	"flag"
@@ -15,11 +14,15 @@ var googleAnalyticsKey = flag.String("google_analytics_key", "G-TFTF5Y92QD", "Go
 
 // ReportHandler handles the report page
 func (gh *GRCHandler) ReportHandler(w http.ResponseWriter, r *http.Request, db *badger.DB, repo string) {
-	log.Printf("Displaying report: %q", repo)
+	requestLog(r).Printf("Displaying report: %q", repo)
+	if deniedRepo(r, repo) {
+		gh.errorPage(w, http.StatusForbidden, errRepoDenied.Error())
+		return
+	}
 	t, err := gh.loadTemplate("/templates/report.html")
 	if err != nil {
-		log.Println("ERROR: could not get report template: ", err)
-		http.Error(w, err.Error(), 500)
+		requestLog(r).Println("ERROR: could not get report template: ", err)
+		gh.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -30,15 +33,15 @@ func (gh *GRCHandler) ReportHandler(w http.ResponseWriter, r *http.Request, db *
 		case notFoundError:
 			// don't bother logging - we already log in getFromCache. continue
 		default:
-			log.Println("ERROR ReportHandler:", err) // log error, but continue
+			requestLog(r).Println("ERROR ReportHandler:", err) // log error, but continue
 		}
 		needToLoad = true
 	}
 
 	respBytes, err := json.Marshal(resp)
 	if err != nil {
-		log.Println("ERROR ReportHandler: could not marshal JSON: ", err)
-		http.Error(w, "Failed to load cache object", 500)
+		requestLog(r).Println("ERROR ReportHandler: could not marshal JSON: ", err)
+		gh.errorPage(w, http.StatusInternalServerError, "Failed to load cache object")
 		return
 	}
 
@@ -49,6 +52,6 @@ func (gh *GRCHandler) ReportHandler(w http.ResponseWriter, r *http.Request, db *
 		"domain":               domain,
 		"google_analytics_key": googleAnalyticsKey,
 	}); err != nil {
-		log.Println("ERROR:", err)
+		requestLog(r).Println("ERROR:", err)
 	}
 }
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportingPeriod is the date range listings and summaries default to when a
+// request gives neither from nor to, configured with REPORTING_PERIOD
+type reportingPeriod struct {
+	Name string `json:"name"` // as configured, such as 90d or fiscal-year
+	From string `json:"from"` // inclusive, YYYY-MM-DD
+	To   string `json:"to"`   // inclusive, YYYY-MM-DD
+}
+
+func (p reportingPeriod) String() string {
+	return fmt.Sprintf("%s (%s to %s)", p.Name, p.From, p.To)
+}
+
+// parseReportingPeriod returns the period named by spec that contains now:
+// Nd for the last N days and Nm for the last N months, both up to today,
+// year for the calendar year and fiscal-year for the year starting on
+// fiscalStart (MM-DD)
+func parseReportingPeriod(spec string, now time.Time, fiscalStart string) (reportingPeriod, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	p := reportingPeriod{Name: spec, To: today.Format(dateLayout)}
+
+	switch {
+	case spec == "year":
+		start := time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, today.Location())
+		p.From, p.To = start.Format(dateLayout), start.AddDate(1, 0, -1).Format(dateLayout)
+	case spec == "fiscal-year":
+		s, err := time.Parse("01-02", fiscalStart)
+		if err != nil {
+			return reportingPeriod{}, fmt.Errorf("invalid fiscal year start %q, expected MM-DD", fiscalStart)
+		}
+		start := time.Date(today.Year(), s.Month(), s.Day(), 0, 0, 0, 0, today.Location())
+		if start.After(today) {
+			start = start.AddDate(-1, 0, 0)
+		}
+		p.From, p.To = start.Format(dateLayout), start.AddDate(1, 0, -1).Format(dateLayout)
+	case strings.HasSuffix(spec, "d") || strings.HasSuffix(spec, "m"):
+		n, err := strconv.Atoi(spec[:len(spec)-1])
+		if err != nil || n <= 0 {
+			return reportingPeriod{}, fmt.Errorf("invalid reporting period %q, expected a positive number of days or months", spec)
+		}
+		if strings.HasSuffix(spec, "d") {
+			p.From = today.AddDate(0, 0, 1-n).Format(dateLayout)
+		} else {
+			p.From = today.AddDate(0, -n, 1).Format(dateLayout)
+		}
+	default:
+		return reportingPeriod{}, fmt.Errorf("unknown reporting period %q, expected Nd, Nm, year or fiscal-year", spec)
+	}
+	return p, nil
+}
+
+// defaultReportingPeriod returns the configured reporting period containing
+// now, and false if none is configured or it is invalid
+func defaultReportingPeriod(now time.Time) (reportingPeriod, bool) {
+	spec := getEnvOrDefault("REPORTING_PERIOD", "")
+	if spec == "" {
+		return reportingPeriod{}, false
+	}
+	p, err := parseReportingPeriod(spec, now.In(reportingLocation()), getEnvOrDefault("FISCAL_YEAR_START", "01-01"))
+	if err != nil {
+		log.Printf("Invalid REPORTING_PERIOD, reporting on all transactions: %v", err)
+		return reportingPeriod{}, false
+	}
+	return p, true
+}
+
+// filterWithPeriod reads the transaction filter of a request like
+// filterFromQuery, limited to the default reporting period when neither from
+// nor to is given and all=true is not set. The period applied, if any, is
+// returned and sent in the X-Reporting-Period header.
+func filterWithPeriod(w http.ResponseWriter, r *http.Request) (transactionFilter, *reportingPeriod, error) {
+	filter, err := filterFromQuery(r)
+	if err != nil {
+		return transactionFilter{}, nil, err
+	}
+
+	all := false
+	if v := r.URL.Query().Get("all"); v != "" {
+		if all, err = strconv.ParseBool(v); err != nil {
+			return transactionFilter{}, nil, fmt.Errorf("all must be true or false")
+		}
+	}
+	if all || filter.From != "" || filter.To != "" {
+		return filter, nil, nil
+	}
+
+	p, ok := defaultReportingPeriod(time.Now())
+	if !ok {
+		return filter, nil, nil
+	}
+	filter.From, filter.To = p.From, p.To
+	w.Header().Set("X-Reporting-Period", p.String())
+	return filter, &p, nil
+}
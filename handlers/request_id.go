@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// RequestIDHeader is the header a request's correlation ID is read from and
+// echoed in
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest incoming request ID that is kept; longer
+// or unprintable ones are replaced with a generated ID
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID gives every request a correlation ID: the incoming
+// X-Request-ID, or a generated UUID. The ID is stored in the request context,
+// echoed in the response header and included in the handlers' logs and error
+// responses.
+func WithRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestID returns the correlation ID stored in ctx by WithRequestID, or an
+// empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random version 4 UUID
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Println("ERROR: could not generate request ID:", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// requestLog returns a logger that prefixes messages with the request's ID,
+// writing where the standard logger does
+func requestLog(r *http.Request) *log.Logger {
+	id := RequestID(r.Context())
+	if id == "" {
+		return log.Default()
+	}
+	return log.New(log.Writer(), "request_id="+id+" ", log.Flags()|log.Lmsgprefix)
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// ArchivePrefix is the badger prefix for the transactions moved out of the
+	// stored transactions by the retention policy, keyed by account and
+	// transaction ID like the stored transactions
+	ArchivePrefix string = "bookkeeping-archive-"
+	// RetentionPrefix is the badger prefix for the cutoff of the last archival
+	// run, keyed by account. Transactions before it are not stored again when
+	// the vault is processed.
+	RetentionPrefix string = "bookkeeping-retention-"
+)
+
+// Actions of the retention policy on transactions older than its cutoff
+const (
+	retentionArchive = "archive" // moved to the archive keyspace
+	retentionDelete  = "delete"  // removed from badger
+)
+
+// retentionPolicy moves transactions older than a number of years out of the
+// stored transactions, so that summaries and queries only cover recent ones
+type retentionPolicy struct {
+	Years      int
+	Action     string
+	ArchiveDir string // directory of the cold archive files, none when empty
+}
+
+// errRetentionDisabled is returned when archival is triggered without a policy
+var errRetentionDisabled = errors.New("no retention policy is configured, set RETENTION_YEARS")
+
+// retentionPolicyFromEnv returns the policy configured with RETENTION_YEARS,
+// which enables it, RETENTION_ACTION (archive or delete, default archive) and
+// ARCHIVE_DIR
+func retentionPolicyFromEnv() (retentionPolicy, bool) {
+	v := getEnvOrDefault("RETENTION_YEARS", "")
+	if v == "" {
+		return retentionPolicy{}, false
+	}
+	years, err := strconv.Atoi(v)
+	if err != nil || years <= 0 {
+		log.Printf("Invalid RETENTION_YEARS, expected a positive number of years, disabling the retention policy: %v", err)
+		return retentionPolicy{}, false
+	}
+
+	p := retentionPolicy{Years: years, Action: retentionArchive, ArchiveDir: getEnvOrDefault("ARCHIVE_DIR", "")}
+	switch action := getEnvOrDefault("RETENTION_ACTION", retentionArchive); action {
+	case retentionArchive, retentionDelete:
+		p.Action = action
+	default:
+		log.Printf("Invalid RETENTION_ACTION %q, using %s", action, retentionArchive)
+	}
+	return p, true
+}
+
+// cutoff returns the time before which transactions are archived
+func (p retentionPolicy) cutoff(now time.Time) time.Time {
+	return now.AddDate(-p.Years, 0, 0)
+}
+
+// splitByCutoff splits transactions into those from the cutoff on and those
+// before it. Transactions without a date are kept.
+func splitByCutoff(transactions []vault.Transaction, cutoff time.Time) (kept, old []vault.Transaction) {
+	kept = make([]vault.Transaction, 0, len(transactions))
+	for _, txn := range transactions {
+		if before(txn, cutoff) {
+			old = append(old, txn)
+			continue
+		}
+		kept = append(kept, txn)
+	}
+	return kept, old
+}
+
+// before reports whether the transaction is dated before the cutoff
+func before(txn vault.Transaction, cutoff time.Time) bool {
+	return !txn.Timestamp.IsZero() && txn.Timestamp.Before(cutoff)
+}
+
+// archivedBefore returns the cutoff of the account's last archival run, and
+// false if its transactions have never been archived
+func archivedBefore(db *badger.DB, acct account) (time.Time, bool, error) {
+	var cutoff time.Time
+	found, err := getJSON(db, RetentionPrefix+acct.Name, &cutoff)
+	return cutoff, found, err
+}
+
+// archiveFile returns the path of the account's cold archive file
+func (p retentionPolicy) archiveFile(acct account) string {
+	return filepath.Join(p.ArchiveDir, acct.Name+"-archive.jsonl")
+}
+
+// stageArchive writes the archive file with transactions appended, one JSON
+// object per line, to a temporary file next to it, and returns its path.
+// Renaming it over the archive file with commitArchive appends them at once,
+// so that a failed run leaves the archive file as it was. Transactions the
+// archive file already holds are not appended again, so that a run retried
+// after the file was committed does not archive them twice.
+func stageArchive(path string, transactions []vault.Transaction) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if err := writeArchive(f, path, transactions); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// writeArchive writes the contents of the archive file at path, if there is
+// one, followed by the transactions it does not hold yet to f, and syncs f
+func writeArchive(f *os.File, path string, transactions []vault.Transaction) error {
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+
+	// lines of the archive file, counted so that identical transactions
+	// without an ID are each appended once
+	archived := make(map[string]int)
+	archive, err := os.Open(path)
+	if err == nil {
+		err = copyLines(f, archive, func(line string) { archived[line]++ })
+		archive.Close()
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for _, txn := range transactions {
+		b, err := json.Marshal(txn)
+		if err != nil {
+			return err
+		}
+		line := string(b) + "\n"
+		if archived[line] > 0 {
+			archived[line]--
+			continue
+		}
+		if _, err := f.WriteString(line); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+// copyLines copies r to w, calling fn with each line it copies
+func copyLines(w io.Writer, r io.Reader, fn func(line string)) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			fn(line)
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// commitArchive renames the staged archive file over the archive file at
+// path, and syncs its directory so that the rename survives a crash
+func commitArchive(staged, path string) error {
+	if err := os.Rename(staged, path); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+type archiveResponse struct {
+	Action string    `json:"action"`
+	Cutoff time.Time `json:"cutoff"`
+	Moved  int       `json:"moved"` // transactions archived or deleted
+	Kept   int       `json:"kept"`
+	File   string    `json:"file,omitempty"` // archive file the moved transactions were appended to
+	GCRuns int       `json:"gc_runs"`        // value log files rewritten to reclaim space
+	Took   string    `json:"took"`
+}
+
+// archiveTransactions moves the account's stored transactions older than the
+// policy's cutoff out of the stored transactions. The archive file is written
+// and the archived transactions stored under ArchivePrefix before any stored
+// transaction is removed, so that nothing is lost when a run fails partway;
+// a retried run archives what is left without duplicating the rest. Keys are
+// written and removed in batches, as several years of history do not fit in
+// one badger transaction.
+func archiveTransactions(db *badger.DB, acct account, p retentionPolicy, now time.Time) (archiveResponse, error) {
+	processed, err := isProcessed(db, acct)
+	if err != nil {
+		return archiveResponse{}, err
+	}
+	if !processed {
+		return archiveResponse{}, errNotProcessed
+	}
+
+	cutoff := p.cutoff(now).UTC()
+	resp := archiveResponse{Action: p.Action, Cutoff: cutoff}
+	var keys [][]byte
+	var old []storedTransaction
+	err = db.View(func(txn *badger.Txn) error {
+		return forEachStoredTransaction(txn, acct, func(key []byte, t storedTransaction) error {
+			if !before(t.Transaction, cutoff) {
+				resp.Kept++
+				return nil
+			}
+			keys = append(keys, key)
+			old = append(old, t)
+			return nil
+		})
+	})
+	if err != nil {
+		return archiveResponse{}, err
+	}
+	resp.Moved = len(old)
+
+	if len(old) > 0 && p.ArchiveDir != "" {
+		// the archive file lists them in the order of the vault files
+		sorted := append([]storedTransaction(nil), old...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Seq < sorted[j].Seq })
+		transactions := make([]vault.Transaction, len(sorted))
+		for i, t := range sorted {
+			transactions[i] = t.Transaction
+		}
+		resp.File = p.archiveFile(acct)
+		staged, err := stageArchive(resp.File, transactions)
+		if err != nil {
+			return archiveResponse{}, fmt.Errorf("could not write archive file: %v", err)
+		}
+		if err := commitArchive(staged, resp.File); err != nil {
+			os.Remove(staged)
+			return archiveResponse{}, fmt.Errorf("could not write archive file: %v", err)
+		}
+	}
+
+	if len(old) > 0 && p.Action == retentionArchive {
+		if err := archiveKeys(db, acct, keys, old); err != nil {
+			return archiveResponse{}, fmt.Errorf("could not store archived transactions: %v", err)
+		}
+	}
+	if err := deleteKeys(db, keys); err != nil {
+		return archiveResponse{}, err
+	}
+
+	previous, archived, err := archivedBefore(db, acct)
+	if err != nil {
+		return archiveResponse{}, err
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		// later processing runs leave out what was archived before the cutoff
+		if !archived || cutoff.After(previous) {
+			if err := setJSON(txn, RetentionPrefix+acct.Name, cutoff); err != nil {
+				return err
+			}
+		}
+		if len(old) == 0 {
+			return nil
+		}
+		if internalTransferMatching().enabled() {
+			return invalidateSummaries(txn)
+		}
+		return invalidateSummary(txn, acct)
+	})
+	if err != nil {
+		return archiveResponse{}, err
+	}
+
+	if len(old) > 0 {
+		resp.GCRuns = runValueLogGC(db)
+	}
+	return resp, nil
+}
+
+// archiveKeys stores the transactions stored at keys under ArchivePrefix,
+// keyed like they were stored, so that archiving them again overwrites them
+func archiveKeys(db *badger.DB, acct account, keys [][]byte, transactions []storedTransaction) error {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	n := len(transactionsPrefix(acct))
+	for i, key := range keys {
+		b, err := json.Marshal(transactions[i])
+		if err != nil {
+			return err
+		}
+		if err := wb.Set([]byte(ArchivePrefix+acct.Name+"\x00"+string(key[n:])), b); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// runValueLogGC rewrites value log files until none has enough stale data
+// left to be worth it, and returns how many were rewritten
+func runValueLogGC(db *badger.DB) int {
+	n := 0
+	for db.RunValueLogGC(0.5) == nil {
+		n++
+	}
+	return n
+}
+
+// ArchiveHandler applies the retention policy to the account's stored
+// transactions, moving those older than RETENTION_YEARS out of them
+func ArchiveHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireDB(w, db) {
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	p, ok := retentionPolicyFromEnv()
+	if !ok {
+		writeJSONError(w, http.StatusConflict, errRetentionDisabled.Error())
+		return
+	}
+
+	start := time.Now()
+	resp, err := archiveTransactions(db, acct, p, start)
+	if errors.Is(err, errNotProcessed) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		requestLog(r).Println("ERROR: could not archive transactions:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not archive transactions")
+		return
+	}
+	resp.Took = time.Since(start).String()
+
+	writeJSON(w, http.StatusOK, resp)
+}
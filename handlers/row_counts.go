@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// FileCountsPrefix is the badger prefix for the number of transactions
+	// last read from each of an account's vault files, keyed by account
+	FileCountsPrefix string = "file-counts-"
+)
+
+// rowCountWarning is the kind of the warnings of the row count check
+const rowCountWarning vault.WarningKind = "row_count"
+
+// rowCountCheck flags vault files with far fewer or far more transactions
+// than the earlier files of the same source, such as a truncated export
+type rowCountCheck struct {
+	Factor     float64 // largest ratio between a file's count and the average of its source
+	MinHistory int     // earlier files of a source needed before its files are checked
+}
+
+// rowCountCheckFromEnv returns the check configured with ROW_COUNT_FACTOR,
+// which enables it, and ROW_COUNT_MIN_HISTORY (default 3)
+func rowCountCheckFromEnv() (rowCountCheck, bool) {
+	v := getEnvOrDefault("ROW_COUNT_FACTOR", "")
+	if v == "" {
+		return rowCountCheck{}, false
+	}
+	factor, err := parseDecimal(v)
+	if err != nil || factor <= 1 {
+		log.Printf("Invalid ROW_COUNT_FACTOR, expected a number above 1, disabling the row count check: %v", err)
+		return rowCountCheck{}, false
+	}
+
+	c := rowCountCheck{Factor: factor, MinHistory: 3}
+	if n, err := strconv.Atoi(getEnvOrDefault("ROW_COUNT_MIN_HISTORY", "3")); err == nil && n > 0 {
+		c.MinHistory = n
+	} else {
+		log.Printf("Invalid ROW_COUNT_MIN_HISTORY, using 3: %v", err)
+	}
+	return c, true
+}
+
+// fileSource returns the source of a vault file: its name without digits, so
+// that monthly exports such as paypal-2024-01.csv and paypal-2024-02.csv
+// share a baseline
+func fileSource(file string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return -1
+		}
+		return r
+	}, file)
+}
+
+// anomalies compares the number of transactions read from each file with the
+// average of the other files of its source in history, the counts stored by
+// earlier runs, and returns a warning for each file that is off by more than
+// the factor. Sources with too little history are not checked.
+func (c rowCountCheck) anomalies(history, counts map[string]int) []vault.Warning {
+	files := make([]string, 0, len(counts))
+	for file := range counts {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var warnings []vault.Warning
+	for _, file := range files {
+		source := fileSource(file)
+		sum, n := 0, 0
+		for other, count := range history {
+			if other != file && fileSource(other) == source {
+				sum += count
+				n++
+			}
+		}
+		if n < c.MinHistory {
+			continue
+		}
+
+		expected := float64(sum) / float64(n)
+		actual := float64(counts[file])
+		if actual*c.Factor >= expected && actual <= expected*c.Factor {
+			continue
+		}
+		warnings = append(warnings, vault.Warning{
+			File: file,
+			Kind: rowCountWarning,
+			Reason: fmt.Sprintf("%d transactions, expected about %.0f from the average of %d earlier files (more than %s times off)",
+				counts[file], math.Round(expected), n, strconv.FormatFloat(c.Factor, 'f', -1, 64)),
+		})
+	}
+	return warnings
+}
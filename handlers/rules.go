@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+type rulesTestRequest struct {
+	Description string          `json:"description"`
+	Amount      string          `json:"amount,omitempty"` // optional amount, for the rules with an amount condition
+	Rules       json.RawMessage `json:"rules"`            // optional rules to test instead of the rules file
+}
+
+type rulesTestResponse struct {
+	Description           string                `json:"description"`
+	NormalizedDescription string                `json:"normalized_description"`
+	Category              vault.TransactionType `json:"category"`
+	Matched               bool                  `json:"matched"`
+	RuleIndex             int                   `json:"rule_index"` // -1 when no rule matched
+	Rule                  *vault.CategoryRule   `json:"rule,omitempty"`
+	Message               string                `json:"message"`
+}
+
+// RulesTestHandler reports which category the categorization rules assign to
+// a description, and optionally an amount, and which rule matched. Rules
+// given in the request body are tested instead of the rules file, so a new
+// file can be tried before it is installed.
+func RulesTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req rulesTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Description == "" {
+		writeJSONError(w, http.StatusBadRequest, "request body must be JSON with a description")
+		return
+	}
+
+	var amount *vault.Money
+	if req.Amount != "" {
+		v, _, err := vault.ParseAmount(req.Amount, amountLocale())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		amount = &v
+	}
+
+	var rules []vault.CategoryRule
+	var err error
+	if len(req.Rules) > 0 {
+		rules, err = vault.ParseRules(req.Rules)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		rules, err = vault.LoadRules(rulesFile())
+		if err != nil {
+			requestLog(r).Println("ERROR: could not load rules:", err)
+			writeJSONError(w, http.StatusInternalServerError, "could not load rules")
+			return
+		}
+	}
+
+	normalizer, err := vault.LoadNormalizer(normalizationFile())
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load normalization:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not load normalization")
+		return
+	}
+
+	resp := rulesTestResponse{
+		Description:           req.Description,
+		NormalizedDescription: normalizer.Normalize(req.Description),
+		Category:              vault.UncategorizedTransaction,
+		RuleIndex:             -1,
+		Message:               fmt.Sprintf("no match among %d rule(s) -> %s", len(rules), vault.UncategorizedTransaction),
+	}
+
+	if i, ok := vault.MatchTransactionRules(rules, resp.NormalizedDescription, amount); ok {
+		resp.Category = rules[i].Type
+		resp.Matched = true
+		resp.RuleIndex = i
+		resp.Rule = &rules[i]
+		resp.Message = fmt.Sprintf("rule %d (%q) -> %s", i, rules[i].Pattern, rules[i].Type)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// ChecksumsPrefix is the badger prefix for the SHA-256 of each vault file
+	// read by the last processing run, keyed by account
+	ChecksumsPrefix string = "bookkeeping-checksums-"
+)
+
+// Sub-checks of the self-check
+const (
+	selfCheckSchema     = "schema"     // headers with the expected columns
+	selfCheckDuplicates = "duplicates" // transaction IDs read more than once
+	selfCheckChecksums  = "checksums"  // files changed since the last processing run
+	selfCheckSigns      = "signs"      // amounts with the wrong sign for their type
+	selfCheckWarnings   = "warnings"   // rows, dates and amounts that could not be parsed, and unreadable files
+)
+
+// selfChecks lists the sub-checks in the order they are reported
+var selfChecks = []string{selfCheckSchema, selfCheckDuplicates, selfCheckChecksums, selfCheckSigns, selfCheckWarnings}
+
+// Statuses of a sub-check
+const (
+	checkOK      = "ok"
+	checkIssues  = "issues"
+	checkSkipped = "skipped"
+	checkError   = "error"
+)
+
+// Overall statuses of the self-check
+const (
+	selfCheckHealthy  = "healthy"
+	selfCheckDegraded = "degraded" // a sub-check found issues or could not run
+)
+
+// checksumWarning is the kind of the issues found by the checksums check
+const checksumWarning vault.WarningKind = "checksum"
+
+type selfCheckResult struct {
+	Name    string          `json:"name"`
+	Status  string          `json:"status"`
+	Count   int             `json:"count"`
+	Issues  []vault.Warning `json:"issues,omitempty"`
+	Message string          `json:"message,omitempty"` // why the check was skipped or failed
+}
+
+type selfCheckResponse struct {
+	Status string            `json:"status"`
+	Checks []selfCheckResult `json:"checks"`
+	Took   string            `json:"took"`
+}
+
+// skippedSelfChecks returns the sub-checks named by the comma-separated skip
+// parameter, defaulting to SELFCHECK_SKIP
+func skippedSelfChecks(r *http.Request) (map[string]bool, error) {
+	spec := r.URL.Query().Get("skip")
+	if spec == "" {
+		spec = getEnvOrDefault("SELFCHECK_SKIP", "")
+	}
+	skip := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, c := range selfChecks {
+			known = known || c == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown check %q, expected %s", name, strings.Join(selfChecks, ", "))
+		}
+		skip[name] = true
+	}
+	return skip, nil
+}
+
+// issuesOfKinds returns the warnings of the given kinds
+func issuesOfKinds(warnings []vault.Warning, kinds ...vault.WarningKind) []vault.Warning {
+	var issues []vault.Warning
+	for _, w := range warnings {
+		for _, k := range kinds {
+			if w.Kind == k {
+				issues = append(issues, w)
+			}
+		}
+	}
+	return issues
+}
+
+// checksumIssues compares the vault's files with the checksums stored by the
+// last processing run, reporting files that changed, were added or were
+// removed since
+func checksumIssues(files []vault.FileInfo, stored map[string]string) []vault.Warning {
+	var issues []vault.Warning
+	listed := make(map[string]bool, len(files))
+	for _, f := range files {
+		listed[f.Name] = true
+		sum, ok := stored[f.Name]
+		switch {
+		case f.Error != "" || f.SHA256 == "":
+			issues = append(issues, vault.Warning{File: f.Name, Reason: "could not be read to verify its checksum: " + f.Error, Kind: checksumWarning})
+		case !ok:
+			issues = append(issues, vault.Warning{File: f.Name, Reason: "not read by the last processing run", Kind: checksumWarning})
+		case sum != f.SHA256:
+			issues = append(issues, vault.Warning{File: f.Name, Reason: "changed since the last processing run", Kind: checksumWarning})
+		}
+	}
+
+	var removed []string
+	for name := range stored {
+		if !listed[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		issues = append(issues, vault.Warning{File: name, Reason: "removed since the last processing run", Kind: checksumWarning})
+	}
+	return issues
+}
+
+// result reports a sub-check's issues
+func result(name string, issues []vault.Warning) selfCheckResult {
+	res := selfCheckResult{Name: name, Status: checkOK, Count: len(issues), Issues: issues}
+	if len(issues) > 0 {
+		res.Status = checkIssues
+	}
+	return res
+}
+
+// SelfCheckHandler checks the integrity of the account's data, for operators
+// after an ingest: the files' headers, duplicate and conflicting transaction
+// IDs, the files' checksums against the last processing run, the signs of
+// the amounts and the parse warnings. The vault is read once for all but the
+// checksums; sub-checks named in skip are not run.
+func SelfCheckHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	skip, err := skippedSelfChecks(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	start := time.Now()
+	policy := signPolicy()
+	tp, err := newBookkeepingProcessor(acct, vault.WithSignPolicy(policy))
+	if err != nil {
+		requestLog(r).Println("ERROR: could not create processor:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	// the checks of what reading the vault warns about share one read
+	var warnings []vault.Warning
+	var readErr error
+	if !skip[selfCheckSchema] || !skip[selfCheckDuplicates] || !skip[selfCheckSigns] || !skip[selfCheckWarnings] {
+		if _, readErr = tp.ReadCSVFiles(ctx); errors.Is(readErr, vault.ErrNoFiles) {
+			readErr = nil
+		}
+		warnings = tp.Warnings()
+	}
+
+	resp := selfCheckResponse{Status: selfCheckHealthy, Checks: []selfCheckResult{}}
+	for _, name := range selfChecks {
+		var res selfCheckResult
+		switch {
+		case skip[name]:
+			res = selfCheckResult{Name: name, Status: checkSkipped, Message: "skipped by request"}
+		case name == selfCheckChecksums:
+			res = checksumsCheck(r, db, tp, acct)
+		case readErr != nil:
+			requestLog(r).Println("ERROR: could not read the vault:", readErr)
+			_, msg := vaultErrorStatus(readErr)
+			res = selfCheckResult{Name: name, Status: checkError, Message: msg}
+		case name == selfCheckSchema:
+			res = result(name, issuesOfKinds(warnings, vault.WarningSchema))
+		case name == selfCheckDuplicates:
+			res = result(name, issuesOfKinds(warnings, vault.WarningDuplicate, vault.WarningConflict))
+		case name == selfCheckSigns && len(policy.Expect) == 0:
+			res = selfCheckResult{Name: name, Status: checkSkipped, Message: "no sign expectations are configured, set SIGN_EXPECTATIONS"}
+		case name == selfCheckSigns:
+			res = result(name, issuesOfKinds(warnings, vault.WarningSign))
+		case name == selfCheckWarnings:
+			res = result(name, issuesOfKinds(warnings, vault.WarningParse, vault.WarningFile))
+		}
+		if res.Status == checkIssues || res.Status == checkError {
+			resp.Status = selfCheckDegraded
+		}
+		resp.Checks = append(resp.Checks, res)
+	}
+	resp.Took = time.Since(start).String()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// checksumsCheck compares the checksums of the vault's files with those
+// stored by the last processing run. Every file is read again to do so.
+func checksumsCheck(r *http.Request, db *badger.DB, tp *vault.TransactionProcessor, acct account) selfCheckResult {
+	res := selfCheckResult{Name: selfCheckChecksums, Status: checkSkipped}
+	if db == nil {
+		res.Message = "the database is not available"
+		return res
+	}
+	var stored map[string]string
+	found, err := getJSON(db, ChecksumsPrefix+acct.Name, &stored)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not read checksums:", err)
+		return selfCheckResult{Name: selfCheckChecksums, Status: checkError, Message: "could not read checksums"}
+	}
+	if !found {
+		res.Message = "the vault has not been processed yet"
+		return res
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	files, err := tp.ListCSVFiles(ctx)
+	if err != nil && !errors.Is(err, vault.ErrNoFiles) {
+		requestLog(r).Println("ERROR: could not list vault files:", err)
+		_, msg := vaultErrorStatus(err)
+		return selfCheckResult{Name: selfCheckChecksums, Status: checkError, Message: msg}
+	}
+	return result(selfCheckChecksums, checksumIssues(files, stored))
+}
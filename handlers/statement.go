@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// statementPeriod holds the balances of one period, like a bank statement
+type statementPeriod struct {
+	Period  string      `json:"period"`
+	Start   time.Time   `json:"start"`
+	Opening vault.Money `json:"opening"`
+	Inflow  vault.Money `json:"inflow"`
+	Outflow vault.Money `json:"outflow"` // a positive amount
+	Closing vault.Money `json:"closing"` // opening plus inflow minus outflow
+	Count   int         `json:"count"`   // transactions in the period, including internal transfers
+}
+
+type statementResponse struct {
+	Granularity string            `json:"granularity"`
+	Timezone    string            `json:"timezone"`
+	Opening     vault.Money       `json:"opening"`
+	Closing     vault.Money       `json:"closing"`
+	Periods     []statementPeriod `json:"periods"`
+	Undated     int               `json:"undated"` // transactions skipped because their date could not be parsed
+}
+
+// openingFromRequest returns the opening query parameter, the balance before
+// the first period, defaulting to 0
+func openingFromRequest(r *http.Request) (vault.Money, error) {
+	v := r.URL.Query().Get("opening")
+	if v == "" {
+		return 0, nil
+	}
+	opening, err := parseDecimal(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid opening balance %q", v)
+	}
+	return vault.MoneyFromFloat(opening), nil
+}
+
+// calculateStatement computes the opening and closing balance of consecutive
+// periods in loc, starting from opening. Each period's closing balance is the
+// next one's opening balance, and periods without transactions carry it
+// forward. Inflow and outflow are summed as for the cash flow, so internal
+// transfers leave the balance unchanged.
+func calculateStatement(transactions []vault.Transaction, granularity string, loc *time.Location, opening vault.Money) statementResponse {
+	starts, buckets, undated := periodBuckets(transactions, granularity, loc)
+	resp := statementResponse{Granularity: granularity, Timezone: loc.String(), Opening: opening, Periods: []statementPeriod{}, Undated: undated}
+	balance := opening
+	for _, start := range starts {
+		p := statementPeriod{Period: periodLabel(start, granularity), Start: start, Opening: balance, Count: len(buckets[start])}
+		p.Inflow, p.Outflow = flow(buckets[start])
+		p.Closing = p.Opening + p.Inflow - p.Outflow
+		balance = p.Closing
+		resp.Periods = append(resp.Periods, p)
+	}
+	resp.Closing = balance
+
+	return resp
+}
+
+// StatementHandler returns the account's opening balance, inflow, outflow and
+// closing balance per day, week or month, bucketed in the reporting time zone
+func StatementHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	granularity, err := granularityFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opening, err := openingFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, calculateStatement(transactions, granularity, reportingLocation(), opening))
+}
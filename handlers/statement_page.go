@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// monthStatement is a printable statement of one month's transactions
+type monthStatement struct {
+	Account      string
+	Month        string // YYYY-MM
+	Title        string // such as January 2024
+	From, To     string // first and last day of the month, YYYY-MM-DD
+	Timezone     string
+	FiscalYear   *reportingPeriod // the fiscal year the month falls in, when FISCAL_YEAR_START is valid
+	Balance      statementPeriod
+	Transactions []vault.Transaction // in the order they were made
+	Subtotals    []categoryPathTotal
+	Generated    string
+}
+
+// calculateMonthStatement returns the statement of the month starting at
+// month, in its location. The balances carry over from opening, the balance
+// before the first transaction, as for calculateStatement; a month before
+// the first transaction opens with it, and one after the last opens with the
+// final closing balance.
+func calculateMonthStatement(transactions []vault.Transaction, month time.Time, opening vault.Money, level int) monthStatement {
+	loc := month.Location()
+	s := monthStatement{
+		Month:    month.Format("2006-01"),
+		Title:    month.Format("January 2006"),
+		From:     month.Format(dateLayout),
+		To:       month.AddDate(0, 1, -1).Format(dateLayout),
+		Timezone: loc.String(),
+		Balance:  statementPeriod{Period: month.Format("2006-01"), Start: month, Opening: opening, Closing: opening},
+	}
+
+	statement := calculateStatement(transactions, "month", loc, opening)
+	for _, p := range statement.Periods {
+		if p.Start.Equal(month) {
+			s.Balance = p
+		}
+	}
+	if n := len(statement.Periods); n > 0 && month.After(statement.Periods[n-1].Start) {
+		s.Balance.Opening, s.Balance.Closing = statement.Closing, statement.Closing
+	}
+
+	_, buckets, _ := periodBuckets(transactions, "month", loc)
+	s.Transactions = buckets[month]
+	sort.SliceStable(s.Transactions, func(i, j int) bool {
+		return reportingTime(s.Transactions[i]).Before(reportingTime(s.Transactions[j]))
+	})
+
+	cats := make(categoryPathTotals)
+	for _, txn := range s.Transactions {
+		cats.add(txn.Type, txn)
+	}
+	s.Subtotals = rollUpCategories(cats.sorted(), level)
+	return s
+}
+
+// statementMonth returns the start of the month parameter (YYYY-MM) in loc,
+// defaulting to the month of the latest transaction, or the current month
+// when there are none
+func statementMonth(r *http.Request, transactions []vault.Transaction, loc *time.Location) (time.Time, error) {
+	if v := r.URL.Query().Get("month"); v != "" {
+		m, err := time.ParseInLocation("2006-01", v, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid month %q, expected YYYY-MM", v)
+		}
+		return m, nil
+	}
+
+	var latest time.Time
+	for _, txn := range transactions {
+		if t := reportingTime(txn); t.After(latest) {
+			latest = t
+		}
+	}
+	if latest.IsZero() {
+		latest = time.Now()
+	}
+	return periodStart(latest.In(loc), "month"), nil
+}
+
+// StatementPageHandler renders a printable statement of one month of the
+// account's transactions: the opening and closing balance, every transaction
+// and the subtotal of each category. It takes the opening parameter of the
+// statement API, and level to roll the subtotals up, by default to the types.
+func (gh *GRCHandler) StatementPageHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		gh.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	opening, err := openingFromRequest(r)
+	if err != nil {
+		gh.errorPage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	level, err := levelFromRequest(r)
+	if err != nil {
+		gh.errorPage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if level == 0 {
+		level = 1
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions: ", err)
+		status, msg := vaultErrorStatus(err)
+		gh.errorPage(w, status, msg)
+		return
+	}
+
+	loc := reportingLocation()
+	month, err := statementMonth(r, transactions, loc)
+	if err != nil {
+		gh.errorPage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s := calculateMonthStatement(transactions, month, opening, level)
+	s.Account = acct.Name
+	s.Generated = time.Now().In(loc).Format("2006-01-02 15:04 MST")
+	if fy, err := parseReportingPeriod("fiscal-year", month, getEnvOrDefault("FISCAL_YEAR_START", "01-01")); err == nil {
+		s.FiscalYear = &fy
+	}
+
+	t, err := gh.loadTemplate("/templates/statement.html")
+	if err != nil {
+		requestLog(r).Println("ERROR: could not get statement template: ", err)
+		gh.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := t.Execute(w, s); err != nil {
+		requestLog(r).Println("ERROR:", err)
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+type acceptSuggestionRequest struct {
+	TransactionID string `json:"transaction_id"`
+}
+
+// SuggestionsHandler lists category suggestions for uncategorized transactions
+// on GET, and accepts a suggestion as a new categorization rule on POST
+func SuggestionsHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	suggestions := vault.SuggestCategories(transactions)
+
+	switch r.Method {
+	case http.MethodGet:
+		if suggestions == nil {
+			suggestions = []vault.Suggestion{}
+		}
+		writeJSON(w, http.StatusOK, suggestions)
+	case http.MethodPost:
+		acceptSuggestion(w, r, suggestions)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// acceptSuggestion turns the suggestion for the requested transaction into a
+// rule appended to the rules file
+func acceptSuggestion(w http.ResponseWriter, r *http.Request, suggestions []vault.Suggestion) {
+	var req acceptSuggestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TransactionID == "" {
+		writeJSONError(w, http.StatusBadRequest, "request body must be JSON with a transaction_id")
+		return
+	}
+
+	var suggestion *vault.Suggestion
+	for i := range suggestions {
+		if suggestions[i].Transaction.TransactionID == req.TransactionID {
+			suggestion = &suggestions[i]
+			break
+		}
+	}
+	if suggestion == nil {
+		writeJSONError(w, http.StatusNotFound, "no suggestion for transaction "+req.TransactionID)
+		return
+	}
+
+	rule, err := vault.NewCategoryRule(suggestion.Pattern, suggestion.Suggested)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rules, err := vault.LoadRules(rulesFile())
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load rules:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not load rules")
+		return
+	}
+
+	if err := vault.SaveRules(rulesFile(), append(rules, rule)); err != nil {
+		requestLog(r).Println("ERROR: could not save rules:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not save rules")
+		return
+	}
+
+	requestLog(r).Printf("Added rule %q -> %s from suggestion for %s", rule.Pattern, rule.Type, req.TransactionID)
+	writeJSON(w, http.StatusCreated, rule)
+}
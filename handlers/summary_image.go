@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// SummaryImagePrefix is the badger prefix for rendered summary images,
+	// keyed by the fingerprint of the data they show
+	SummaryImagePrefix string = "bookkeeping-summary-image-"
+)
+
+// The summary image is sized for link previews and slides
+const (
+	summaryImageWidth  = 1200
+	summaryImageHeight = 630
+	// summaryImageVersion changes the fingerprint of every image when the layout changes
+	summaryImageVersion = 1
+	summaryImageTTL     = 24 * time.Hour
+)
+
+var (
+	imageBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	imageText       = color.RGBA{0x36, 0x36, 0x36, 0xff}
+	imageMuted      = color.RGBA{0x7a, 0x7a, 0x7a, 0xff}
+	imageTrack      = color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+	imagePositive   = color.RGBA{0x25, 0x7a, 0x4a, 0xff}
+	imageNegative   = color.RGBA{0xcc, 0x0f, 0x35, 0xff}
+)
+
+// categoryTotal is one category's row on the summary image
+type categoryTotal struct {
+	Type  vault.TransactionType
+	Count int
+	Sum   vault.Money
+}
+
+// categoryTotals returns the totals of the given types from the summary, or
+// of every type when types is empty
+func categoryTotals(s SummaryStats, types []vault.TransactionType) []categoryTotal {
+	all := []categoryTotal{
+		{vault.PaymentTransaction, s.TotalPayments, s.PaymentsSum},
+		{vault.TransferTransaction, s.TotalTransfers, s.TransfersSum},
+		{vault.FeeTransaction, s.TotalFees, s.FeesSum},
+		{vault.UncategorizedTransaction, s.TotalUncategorized, s.UncategorizedSum},
+	}
+	var totals []categoryTotal
+	for _, t := range all {
+		if hasType(types, t.Type) {
+			totals = append(totals, t)
+		}
+	}
+	return totals
+}
+
+// summaryPeriod describes the transactions a summary covers
+func summaryPeriod(filter transactionFilter, types []vault.TransactionType) string {
+	var label string
+	switch {
+	case filter.From != "" && filter.To != "":
+		label = filter.From + " to " + filter.To
+	case filter.From != "":
+		label = "From " + filter.From
+	case filter.To != "":
+		label = "Until " + filter.To
+	default:
+		label = "All transactions"
+	}
+	if filter.Query != "" {
+		label += fmt.Sprintf(" matching '%s'", filter.Query)
+	}
+	if len(types) > 0 {
+		names := make([]string, len(types))
+		for i, t := range types {
+			names[i] = string(t)
+		}
+		label += ", " + strings.Join(names, " and ")
+	}
+	return label
+}
+
+// parseHexColor parses a #rrggbb or #rgb color, as validated by hexColor
+func parseHexColor(s string) color.RGBA {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 6 {
+		return imageMuted
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+}
+
+// fill draws a rectangle of the given color
+func fill(img draw.Image, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// renderSummaryImage draws the summary card: the title and period, the net
+// liquidity and transaction count, and a row per category with its count,
+// total and a bar scaled to the largest total
+func renderSummaryImage(title, period string, s SummaryStats, totals []categoryTotal, colors map[string]string) *image.RGBA {
+	const margin = 60
+	img := image.NewRGBA(image.Rect(0, 0, summaryImageWidth, summaryImageHeight))
+	fill(img, img.Bounds(), imageBackground)
+
+	drawText(img, margin, margin, title, 6, imageText)
+	drawText(img, margin, margin+60, period, 3, imageMuted)
+
+	net := imagePositive
+	if s.NetLiquidity < 0 {
+		net = imageNegative
+	}
+	drawText(img, margin, 190, "Net liquidity", 3, imageMuted)
+	drawText(img, margin, 220, formatAmount(s.NetLiquidity), 8, net)
+	count := fmt.Sprintf("%d transactions", s.TotalTransactions)
+	drawText(img, summaryImageWidth-margin-textWidth(count, 3), 240, count, 3, imageMuted)
+
+	largest := 0.0
+	for _, t := range totals {
+		largest = math.Max(largest, math.Abs(t.Sum.Float()))
+	}
+
+	const barX, barWidth = 600, 280
+	for i, t := range totals {
+		y := 330 + i*66
+		c := parseHexColor(colors[string(t.Type)])
+		fill(img, image.Rect(margin, y, margin+28, y+28), c)
+		drawText(img, margin+48, y, fmt.Sprintf("%s (%d)", t.Type, t.Count), 4, imageText)
+
+		fill(img, image.Rect(barX, y+2, barX+barWidth, y+26), imageTrack)
+		if largest > 0 {
+			w := int(math.Round(math.Abs(t.Sum.Float()) / largest * barWidth))
+			fill(img, image.Rect(barX, y+2, barX+w, y+26), c)
+		}
+
+		sum := formatAmount(t.Sum)
+		drawText(img, summaryImageWidth-margin-textWidth(sum, 4), y, sum, 4, imageText)
+	}
+	return img
+}
+
+// summaryImageFingerprint identifies everything a summary image shows, so
+// that an image is only rendered again when its data changes
+func summaryImageFingerprint(title, period string, s SummaryStats, totals []categoryTotal, colors map[string]string) (string, error) {
+	b, err := json.Marshal(struct {
+		Version  int
+		Title    string
+		Period   string
+		Summary  SummaryStats
+		Totals   []categoryTotal
+		Colors   map[string]string
+		Decimals int
+	}{summaryImageVersion, title, period, s, totals, colors, moneyDecimals})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// SummaryImageHandler returns the account's summary as a PNG image for
+// sharing. It takes the from, to, query and type parameters of the summary
+// endpoint. Images are cached by the fingerprint of their data, which is also
+// their ETag.
+func SummaryImageHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !requireDB(w, db) {
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	filter, _, err := filterWithPeriod(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	types, err := typesFromQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s, err := filteredSummary(r, db, acct, filter, types)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	title := acct.Name + " summary"
+	period := summaryPeriod(filter, types)
+	totals := categoryTotals(s, types)
+	colors := categoryColors()
+	fingerprint, err := summaryImageFingerprint(title, period, s, totals, colors)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not fingerprint summary:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not render summary image")
+		return
+	}
+
+	setPageCacheHeaders(w, r, time.Time{})
+	etag := `"` + fingerprint + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	key := []byte(SummaryImagePrefix + fingerprint)
+	var cached []byte
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		cached, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		requestLog(r).Println("ERROR: could not read cached summary image:", err)
+	}
+
+	if cached == nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, renderSummaryImage(title, period, s, totals, colors)); err != nil {
+			requestLog(r).Println("ERROR: could not encode summary image:", err)
+			writeJSONError(w, http.StatusInternalServerError, "could not render summary image")
+			return
+		}
+		cached = buf.Bytes()
+		err = db.Update(func(txn *badger.Txn) error {
+			return txn.SetEntry(badger.NewEntry(key, cached).WithTTL(summaryImageTTL))
+		})
+		if err != nil {
+			requestLog(r).Println("ERROR: could not cache summary image:", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(cached)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(cached); err != nil {
+		requestLog(r).Println("ERROR: could not write summary image:", err)
+	}
+}
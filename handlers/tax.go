@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// taxTagPrefix marks a tag giving the transaction's tax category, such as
+// "tax:Deductible", which takes precedence over the rules' tax category
+const taxTagPrefix = "tax:"
+
+// vatSplit separates amounts that include VAT into the amount before tax and
+// the VAT itself
+type vatSplit struct {
+	Rate float64     `json:"rate,omitempty"` // percent
+	Net  vault.Money `json:"net"`
+	VAT  vault.Money `json:"vat"`
+}
+
+// taxCategoryTotal is the number and total of the transactions in a tax
+// category. Amounts are gross; VAT is set for the categories with a VAT rate.
+type taxCategoryTotal struct {
+	TaxCategory string      `json:"tax_category"`
+	Count       int         `json:"count"`
+	Gross       vault.Money `json:"gross"`
+	VAT         *vatSplit   `json:"vat,omitempty"`
+}
+
+type taxTotalsResponse struct {
+	Year       int                `json:"year"` // the year the fiscal year starts in
+	FiscalYear reportingPeriod    `json:"fiscal_year"`
+	Categories []taxCategoryTotal `json:"categories"`
+	Unassigned taxCategoryTotal   `json:"unassigned"`    // transactions without a tax category
+	VAT        *vatSplit          `json:"vat,omitempty"` // totals of the categories with a VAT rate
+}
+
+// applyTaxTags sets the tax category of the transactions tagged with one
+func applyTaxTags(transactions []vault.Transaction) {
+	for i := range transactions {
+		for _, tag := range transactions[i].Tags {
+			if len(tag) > len(taxTagPrefix) && strings.EqualFold(tag[:len(taxTagPrefix)], taxTagPrefix) {
+				transactions[i].TaxCategory = strings.TrimSpace(tag[len(taxTagPrefix):])
+				break
+			}
+		}
+	}
+}
+
+// vatRates returns the VAT rate of each tax category in percent, configured
+// with TAX_VAT_RATES, such as "Deductible=20,Books=7". Categories are matched
+// case-insensitively.
+func vatRates() map[string]float64 {
+	rates, err := parseVATRates(getEnvOrDefault("TAX_VAT_RATES", ""))
+	if err != nil {
+		log.Printf("Invalid TAX_VAT_RATES, not separating VAT: %v", err)
+		return map[string]float64{}
+	}
+	return rates
+}
+
+// parseVATRates parses a comma-separated list of category=percent pairs
+func parseVATRates(spec string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, rate, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid VAT rate %q, expected category=percent", item)
+		}
+		r, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if err != nil || r < 0 || math.IsInf(r, 0) {
+			return nil, fmt.Errorf("invalid VAT rate %q: the rate must be a non-negative percentage", item)
+		}
+		rates[strings.ToLower(name)] = r
+	}
+	return rates, nil
+}
+
+// splitVAT separates a gross amount including VAT at rate percent
+func splitVAT(gross vault.Money, rate float64) vatSplit {
+	net := vault.MoneyFromFloat(math.Round(gross.Float()/(1+rate/100)*100) / 100)
+	return vatSplit{Rate: rate, Net: net, VAT: gross - net}
+}
+
+// calculateTaxTotals totals the transactions by tax category, separating the
+// VAT of the categories in rates. Internal transfers are left out, as from
+// the net.
+func calculateTaxTotals(transactions []vault.Transaction, rates map[string]float64) ([]taxCategoryTotal, taxCategoryTotal, *vatSplit) {
+	totals := make(map[string]*taxCategoryTotal)
+	var unassigned taxCategoryTotal
+	for _, txn := range transactions {
+		if txn.Internal {
+			continue
+		}
+		amount := txn.Amount
+		if txn.TaxCategory == "" {
+			unassigned.Count++
+			unassigned.Gross = addMoney(unassigned.Gross, amount)
+			continue
+		}
+
+		total, ok := totals[strings.ToLower(txn.TaxCategory)]
+		if !ok {
+			total = &taxCategoryTotal{TaxCategory: txn.TaxCategory}
+			totals[strings.ToLower(txn.TaxCategory)] = total
+		}
+		total.Count++
+		total.Gross = addMoney(total.Gross, amount)
+		if rate, ok := rates[strings.ToLower(txn.TaxCategory)]; ok {
+			// split per transaction, so that the VAT is rounded as invoiced
+			split := splitVAT(amount, rate)
+			if total.VAT == nil {
+				total.VAT = &vatSplit{Rate: rate}
+			}
+			total.VAT.Net = addMoney(total.VAT.Net, split.Net)
+			total.VAT.VAT = addMoney(total.VAT.VAT, split.VAT)
+		}
+	}
+
+	categories := make([]taxCategoryTotal, 0, len(totals))
+	var vat *vatSplit
+	for _, total := range totals {
+		categories = append(categories, *total)
+		if total.VAT != nil {
+			if vat == nil {
+				vat = &vatSplit{}
+			}
+			vat.Net = addMoney(vat.Net, total.VAT.Net)
+			vat.VAT = addMoney(vat.VAT, total.VAT.VAT)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return strings.ToLower(categories[i].TaxCategory) < strings.ToLower(categories[j].TaxCategory)
+	})
+	return categories, unassigned, vat
+}
+
+// fiscalYearFromRequest returns the fiscal year starting in the year query
+// parameter, defaulting to the one of the latest transaction, or the current
+// one when there are none
+func fiscalYearFromRequest(r *http.Request, transactions []vault.Transaction, loc *time.Location) (int, reportingPeriod, error) {
+	fiscalStart := getEnvOrDefault("FISCAL_YEAR_START", "01-01")
+	s, err := time.Parse("01-02", fiscalStart)
+	if err != nil {
+		return 0, reportingPeriod{}, fmt.Errorf("invalid fiscal year start %q, expected MM-DD", fiscalStart)
+	}
+
+	var year int
+	if v := r.URL.Query().Get("year"); v != "" {
+		if year, err = strconv.Atoi(v); err != nil || year < 1 || year > 9999 {
+			return 0, reportingPeriod{}, fmt.Errorf("invalid year %q", v)
+		}
+	} else {
+		var latest time.Time
+		for _, txn := range transactions {
+			if t := reportingTime(txn); t.After(latest) {
+				latest = t
+			}
+		}
+		if latest.IsZero() {
+			latest = time.Now()
+		}
+		latest = latest.In(loc)
+		year = latest.Year()
+		if time.Date(year, s.Month(), s.Day(), 0, 0, 0, 0, loc).After(latest) {
+			year--
+		}
+	}
+
+	p, err := parseReportingPeriod("fiscal-year", time.Date(year, s.Month(), s.Day(), 0, 0, 0, 0, loc), fiscalStart)
+	return year, p, err
+}
+
+// TaxTotalsHandler returns the totals of the account's transactions in a
+// fiscal year by tax category, the tax treatment assigned by the rules or a
+// tax: tag, with the VAT separated for the categories configured with a VAT rate
+func TaxTotalsHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	year, fy, err := fiscalYearFromRequest(r, transactions, reportingLocation())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := taxTotalsResponse{Year: year, FiscalYear: fy}
+	in := transactionFilter{From: fy.From, To: fy.To}.apply(transactions)
+	resp.Categories, resp.Unassigned, resp.VAT = calculateTaxTotals(in, vatRates())
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -3,9 +3,25 @@ package handlers
 import (
 	"fmt"
 	"io"
+	"path"
+	"sort"
+	"strings"
 	"text/template"
+
+	"github.com/gojp/goreportcard/vault"
 )
 
+// partialsDir holds the templates shared between pages, such as the summary
+// card and the transaction table. Each file defines one or more named
+// templates, which every page can include with [[ template "name" . ]].
+const partialsDir = "/templates/partials"
+
+var templateFuncs = template.FuncMap{
+	"add":          add,
+	"formatScore":  formatScore,
+	"formatAmount": formatAmount,
+}
+
 func add(x, y int) int {
 	return x + y
 }
@@ -14,42 +30,85 @@ func formatScore(x float64) string {
 	return fmt.Sprintf("%.2f", x)
 }
 
-func (gh *GRCHandler) loadTemplate(name string) (*template.Template, error) {
+func formatAmount(x vault.Money) string {
+	return x.Format(moneyDecimals)
+}
+
+// readAsset returns the contents of a file in the assets
+func (gh *GRCHandler) readAsset(name string) (string, error) {
 	f, err := gh.AssetsFS.Open(name)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-
 	defer f.Close()
 
 	contents, err := io.ReadAll(f)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return string(contents), nil
+}
 
-	tpl, err := template.New(name).Delims("[[", "]]").Funcs(template.FuncMap{
-		"add":         add,
-		"formatScore": formatScore,
-	}).Parse(string(contents))
+// partials returns the paths of the partial templates, sorted so that a
+// template defined twice resolves the same way every time
+func (gh *GRCHandler) partials() ([]string, error) {
+	dir, err := gh.AssetsFS.Open(partialsDir)
 	if err != nil {
 		return nil, err
 	}
+	defer dir.Close()
 
-	if name == "/templates/report.html" {
-		return tpl, nil
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
 	}
+	var names []string
+	for _, fi := range infos {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".html") {
+			names = append(names, path.Join(partialsDir, fi.Name()))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
 
-	base, err := gh.AssetsFS.Open("/templates/base.html")
+// templateFiles returns the files composing the page template name: the page
+// itself, the base layout and the partials. The report page and the printable
+// statement have their own layout.
+func (gh *GRCHandler) templateFiles(name string) ([]string, error) {
+	files := []string{name}
+	if name != "/templates/report.html" && name != "/templates/statement.html" {
+		files = append(files, "/templates/base.html")
+	}
+	partials, err := gh.partials()
 	if err != nil {
 		return nil, err
 	}
+	return append(files, partials...), nil
+}
 
-	defer base.Close()
-
-	baseContents, err := io.ReadAll(base)
+// loadTemplate parses the page template name with the base layout and the
+// partials it can include
+func (gh *GRCHandler) loadTemplate(name string) (*template.Template, error) {
+	files, err := gh.templateFiles(name)
 	if err != nil {
 		return nil, err
 	}
 
-	return tpl.Parse(string(baseContents))
+	tpl := template.New(name).Delims("[[", "]]").Funcs(templateFuncs).Funcs(template.FuncMap{"asset": gh.assetURL})
+	for _, file := range files {
+		contents, err := gh.readAsset(file)
+		if err != nil {
+			return nil, err
+		}
+		// the page keeps the template's name, the others are named by path
+		t := tpl
+		if file != name {
+			t = tpl.New(file)
+		}
+		if _, err := t.Parse(contents); err != nil {
+			return nil, err
+		}
+	}
+	return tpl, nil
 }
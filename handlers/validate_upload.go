@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+// defaultUploadMaxBytes is the default size limit of an uploaded CSV file
+const defaultUploadMaxBytes = 10 << 20
+
+// uploadMaxBytes returns the size limit of an uploaded CSV file, configured
+// with UPLOAD_MAX_BYTES
+func uploadMaxBytes() int64 {
+	n, err := strconv.ParseInt(getEnvOrDefault("UPLOAD_MAX_BYTES", strconv.Itoa(defaultUploadMaxBytes)), 10, 64)
+	if err != nil || n < 1 {
+		log.Printf("Invalid UPLOAD_MAX_BYTES, using %d: %v", defaultUploadMaxBytes, err)
+		return defaultUploadMaxBytes
+	}
+	return n
+}
+
+// authorizeUpload reports whether the request carries the bearer token
+// configured with UPLOAD_TOKEN, and responds with 401 Unauthorized if not.
+// Uploads are refused with 503 Service Unavailable when no token is
+// configured.
+func authorizeUpload(w http.ResponseWriter, r *http.Request) bool {
+	want := getEnvOrDefault("UPLOAD_TOKEN", "")
+	if want == "" {
+		writeJSONError(w, http.StatusServiceUnavailable, "uploads are disabled until UPLOAD_TOKEN is configured")
+		return false
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1 {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="upload"`)
+	writeJSONError(w, http.StatusUnauthorized, "a valid upload token is required")
+	return false
+}
+
+// uploadedCSV reads the CSV file of an upload and returns it with its name:
+// the file field of a multipart form, or else the request body, named by the
+// file query parameter
+func uploadedCSV(r *http.Request) ([]byte, string, error) {
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+		// parts are read as they come rather than with ParseMultipartForm,
+		// which keeps large files in temporary files on disk
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, "", err
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil, "", errors.New("no file field in the form")
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			if part.FormName() == "file" {
+				b, err := io.ReadAll(part)
+				return b, part.FileName(), err
+			}
+		}
+	}
+
+	b, err := io.ReadAll(r.Body)
+	return b, r.URL.Query().Get("file"), err
+}
+
+// ValidateUploadHandler parses an uploaded CSV file as it would be parsed in
+// the vault and reports the number of transactions it would add, with any
+// warnings or the error it could not be read with. Nothing is written to the
+// vault or badger, so a file can be checked before it is added.
+func ValidateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorizeUpload(w, r) {
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	limit := uploadMaxBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	b, name, err := uploadedCSV(r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "file is larger than "+strconv.FormatInt(limit, 10)+" bytes")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "could not read the uploaded file: "+err.Error())
+		return
+	}
+	if name == "" {
+		name = "upload.csv"
+	}
+
+	tp, err := newBookkeepingProcessor(acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not create processor:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	v, err := tp.ValidateCSV(ctx, name, bytes.NewReader(b), limit)
+	if errors.Is(err, vault.ErrFileTooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "file is larger than "+strconv.FormatInt(limit, 10)+" bytes decompressed")
+		return
+	}
+	if err != nil {
+		requestLog(r).Println("ERROR: could not validate upload:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, v)
+}
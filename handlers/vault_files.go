@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gojp/goreportcard/vault"
+)
+
+type vaultFilesResponse struct {
+	Files []vault.FileInfo `json:"files"`
+}
+
+// VaultFilesHandler lists the CSV files in the account's vault with their
+// size, modification time and number of rows
+func VaultFilesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	tp, err := newBookkeepingProcessor(acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not create processor:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	files, err := tp.ListCSVFiles(ctx)
+	if errors.Is(err, vault.ErrNoFiles) {
+		files = []vault.FileInfo{}
+	} else if err != nil {
+		requestLog(r).Println("ERROR: could not list vault files:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, vaultFilesResponse{Files: files})
+}
+
+// VaultFileDownloadHandler streams the vault's CSV file named by the file
+// parameter, as stored. Only the base names of the files the vault lists are
+// accepted, so no other file can be reached.
+func VaultFileDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	name := r.URL.Query().Get("file")
+	if name == "" {
+		writeJSONError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+
+	tp, err := newBookkeepingProcessor(acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not create processor:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	f, info, err := tp.OpenCSVFile(ctx, name)
+	if errors.Is(err, vault.ErrUnknownFile) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		requestLog(r).Println("ERROR: could not open vault file:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+	defer f.Close()
+
+	contentType := "text/csv; charset=utf-8"
+	if strings.HasSuffix(strings.ToLower(info.Name), ".gz") {
+		contentType = "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", info.Name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		// local files support Range requests
+		http.ServeContent(w, r, info.Name, info.Modified, rs)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		requestLog(r).Println("ERROR: could not stream vault file:", err)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+const (
+	// WarningsPrefix is the badger prefix for the warnings of the last
+	// processing run, keyed by account
+	WarningsPrefix string = "bookkeeping-warnings-"
+)
+
+type warningsResponse struct {
+	Processed   bool            `json:"processed"` // false until the vault has been processed
+	ProcessedAt time.Time       `json:"processed_at,omitzero"`
+	Count       int             `json:"count"`
+	Warnings    []vault.Warning `json:"warnings"`
+}
+
+// WarningsHandler returns the parse, schema and integrity warnings of the
+// account's last processing run, without the transactions. They are stored
+// when the vault is processed, so the vault is not read again.
+func WarningsHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var resp warningsResponse
+	found, err := getJSON(db, WarningsPrefix+acct.Name, &resp)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not read warnings:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not read warnings")
+		return
+	}
+	resp.Processed = found
+	if resp.Warnings == nil {
+		resp.Warnings = []vault.Warning{}
+	}
+	resp.Count = len(resp.Warnings)
+
+	writeJSON(w, http.StatusOK, resp)
+}
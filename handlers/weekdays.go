@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// weekdayTotal is the number and flow of the transactions made on one day of
+// the week
+type weekdayTotal struct {
+	Weekday string      `json:"weekday"`
+	Count   int         `json:"count"`
+	Inflow  vault.Money `json:"inflow"`
+	Outflow vault.Money `json:"outflow"` // a positive amount
+	Net     vault.Money `json:"net"`
+}
+
+type weekdaysResponse struct {
+	Timezone string           `json:"timezone"`
+	Period   *reportingPeriod `json:"period,omitempty"` // the default reporting period, when applied
+	Weekdays []weekdayTotal   `json:"weekdays"`         // Monday to Sunday
+	Undated  int              `json:"undated"`          // transactions skipped because their date could not be parsed
+}
+
+// calculateWeekdays totals transactions by the day of the week of their
+// reporting time in loc, from Monday to Sunday, listing every day even
+// without any. Internal transfers are left out, as from the cash flow.
+func calculateWeekdays(transactions []vault.Transaction, loc *time.Location) weekdaysResponse {
+	resp := weekdaysResponse{Timezone: loc.String()}
+
+	var days [7][]vault.Transaction
+	for _, txn := range transactions {
+		if txn.Timestamp.IsZero() {
+			resp.Undated++
+			continue
+		}
+		if txn.Internal {
+			continue
+		}
+		// Monday first, as the weeks of the breakdown
+		day := (int(reportingTime(txn).In(loc).Weekday()) + 6) % 7
+		days[day] = append(days[day], txn)
+	}
+
+	resp.Weekdays = make([]weekdayTotal, 0, len(days))
+	for i, txns := range days {
+		total := weekdayTotal{Weekday: time.Weekday((i + 1) % 7).String(), Count: len(txns)}
+		total.Inflow, total.Outflow = flow(txns)
+		total.Net = total.Inflow - total.Outflow
+		resp.Weekdays = append(resp.Weekdays, total)
+	}
+	return resp
+}
+
+// WeekdaysHandler returns the number and flow of the account's transactions
+// in the selected period per day of the week, in the reporting time zone
+func WeekdaysHandler(w http.ResponseWriter, r *http.Request, db *badger.DB) {
+	acct, err := accountFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	filter, period, err := filterWithPeriod(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	transactions, _, err := loadTransactions(ctx, db, acct)
+	if err != nil {
+		requestLog(r).Println("ERROR: could not load transactions:", err)
+		status, msg := vaultErrorStatus(err)
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	resp := calculateWeekdays(filter.apply(transactions), reportingLocation())
+	resp.Period = period
+	writeJSON(w, http.StatusOK, resp)
+}
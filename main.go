@@ -10,6 +10,7 @@ import (
 	"os"
 	"regexp"
 	"time"
+	_ "time/tzdata" // time zone database for REPORTING_TIMEZONE and SOURCE_TIMEZONE
 
 	"github.com/dgraph-io/badger/v2"
 	"github.com/gojp/goreportcard/handlers"
@@ -27,7 +28,7 @@ var (
 	embedFS embed.FS
 )
 
-func makeHandler(db *badger.DB, name string, fn func(http.ResponseWriter, *http.Request, *badger.DB, string)) http.HandlerFunc {
+func makeHandler(gh *handlers.GRCHandler, db *badger.DB, name string, fn func(http.ResponseWriter, *http.Request, *badger.DB, string)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		validPath := regexp.MustCompile(fmt.Sprintf(`^/%s/([a-zA-Z0-9\-_\/\.~]+)$`, name))
 
@@ -37,7 +38,7 @@ func makeHandler(db *badger.DB, name string, fn func(http.ResponseWriter, *http.
 			return
 		}
 		if len(m) < 1 || m[1] == "" {
-			http.Error(w, "Please enter a repository", http.StatusBadRequest)
+			gh.Error(w, r, http.StatusBadRequest, "Please enter a repository")
 			return
 		}
 
@@ -69,6 +70,17 @@ func injectBadgerHandler(db *badger.DB, fn func(http.ResponseWriter, *http.Reque
 	}
 }
 
+// requireBadger serves a database locked error instead of h when the server
+// runs without badger
+func requireBadger(gh *handlers.GRCHandler, db *badger.DB, h http.HandlerFunc) http.HandlerFunc {
+	if db != nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		gh.Error(w, r, http.StatusServiceUnavailable, "Database locked by another process, please try again later")
+	}
+}
+
 // metrics provides functionality for monitoring the application status
 type metrics struct {
 	responseTimes *prometheus.SummaryVec
@@ -91,16 +103,16 @@ func setupMetrics() *metrics {
 }
 
 // recordDuration records the length of a request from start to now
-func (m metrics) recordDuration(start time.Time, name string) {
+func (m metrics) recordDuration(start time.Time, r *http.Request) {
 	elapsed := time.Since(start)
-	m.responseTimes.WithLabelValues(name).Observe(float64(elapsed.Milliseconds()))
-	log.Printf("Served %s in %s", name, elapsed)
+	m.responseTimes.WithLabelValues(r.URL.Path).Observe(float64(elapsed.Milliseconds()))
+	log.Printf("Served %s in %s (request_id=%s)", r.URL.Path, elapsed, handlers.RequestID(r.Context()))
 }
 
 // instrument adds metric instrumentation to the handler passed in as argument
 func (m metrics) instrument(path string, h http.HandlerFunc) (string, http.HandlerFunc) {
 	return path, func(w http.ResponseWriter, r *http.Request) {
-		defer m.recordDuration(time.Now(), r.URL.Path)
+		defer m.recordDuration(time.Now(), r)
 		h.ServeHTTP(w, r)
 	}
 }
@@ -114,13 +126,26 @@ func getEnv(name, def string) string {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "process" {
+		os.Exit(runProcess(os.Args[2:]))
+	}
+
 	flag.Parse()
 	if err := os.MkdirAll("_repos/src/github.com", 0755); err != nil && !os.IsExist(err) {
 		log.Fatal("ERROR: could not create repos dir: ", err)
 	}
 
+	if err := handlers.CheckBookkeepingDirs(); err != nil {
+		log.Fatal("ERROR: invalid VAULT_DIR or LEDGER_DIR: ", err)
+	}
+
 	db, err := badger.Open(badger.DefaultOptions(*databasePath).WithTruncate(true))
-	if err != nil {
+	if handlers.IsDatabaseLocked(err) {
+		// keep serving bookkeeping from the CSV files; report cards and all
+		// writes answer with a database locked error
+		log.Println("WARNING: badger db is locked by another process, running read-only without it:", err)
+		db = nil
+	} else if err != nil {
 		log.Fatal("ERROR: could not open badger db: ", err)
 	}
 
@@ -130,23 +155,68 @@ func main() {
 	}
 
 	gh := handlers.GRCHandler{AssetsFS: http.FS(assetsFS)}
+	if err := gh.FingerprintAssets(); err != nil {
+		log.Println("WARNING: could not fingerprint assets, linking them without one:", err)
+	}
 
-	defer db.Close()
+	if db != nil {
+		defer db.Close()
+	}
 
 	m := setupMetrics()
 
 	http.HandleFunc(m.instrument("/assets/", http.StripPrefix("/assets/", http.FileServer(http.FS(assetsFS))).ServeHTTP))
-	http.HandleFunc(m.instrument("/checks", injectBadgerHandler(db, handlers.CheckHandler)))
-	http.HandleFunc(m.instrument("/report/", makeHandler(db, "report", gh.ReportHandler)))
-	http.HandleFunc(m.instrument("/badge/", makeHandler(db, "badge", handlers.BadgeHandler)))
-	http.HandleFunc(m.instrument("/high_scores/", injectBadgerHandler(db, gh.HighScoresHandler)))
+	http.HandleFunc(m.instrument("/checks", requireBadger(&gh, db, injectBadgerHandler(db, handlers.CheckHandler))))
+	http.HandleFunc(m.instrument("/report/", requireBadger(&gh, db, makeHandler(&gh, db, "report", gh.ReportHandler))))
+	http.HandleFunc(m.instrument("/api/jobs/", requireBadger(&gh, db, makeHandler(&gh, db, "api/jobs", handlers.GradingStatusHandler))))
+	http.HandleFunc(m.instrument("/badge/", requireBadger(&gh, db, makeHandler(&gh, db, "badge", handlers.BadgeHandler))))
+	http.HandleFunc(m.instrument("/api/config", handlers.EffectiveConfigHandler))
+	http.HandleFunc(m.instrument("/api/config/", requireBadger(&gh, db, makeHandler(&gh, db, "api/config", handlers.RepoConfigHandler))))
+	http.HandleFunc(m.instrument("/high_scores/", requireBadger(&gh, db, injectBadgerHandler(db, gh.HighScoresHandler))))
 	http.HandleFunc(m.instrument("/supporters/", gh.SupportersHandler))
 	http.HandleFunc(m.instrument("/ledger/", gh.LedgerHandler))
+	http.HandleFunc(m.instrument("/ledger/download", handlers.LedgerDownloadHandler))
+	http.HandleFunc(m.instrument("/ledger/diff", gh.LedgerDiffPageHandler))
+	http.HandleFunc(m.instrument("/api/ledger/diff", handlers.LedgerDiffHandler))
+	http.HandleFunc(m.instrument("/bookkeeping/", injectBadgerHandler(db, gh.BookkeepingHandler)))
+	http.HandleFunc(m.instrument("/bookkeeping/statement", injectBadgerHandler(db, gh.StatementPageHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping", injectBadgerHandler(db, handlers.BookkeepingAPIHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/suggestions", injectBadgerHandler(db, handlers.SuggestionsHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/recategorize", injectBadgerHandler(db, handlers.RecategorizeHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/transaction/", injectBadgerHandler(db, handlers.TransactionHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/split/", injectBadgerHandler(db, handlers.SplitHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/tags", injectBadgerHandler(db, handlers.TagsHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/preview", handlers.PreviewHandler))
+	http.HandleFunc(m.instrument("/api/bookkeeping/validate", handlers.ValidateUploadHandler))
+	http.HandleFunc(m.instrument("/api/bookkeeping/files", handlers.VaultFilesHandler))
+	http.HandleFunc(m.instrument("/api/bookkeeping/files/download", handlers.VaultFileDownloadHandler))
+	http.HandleFunc(m.instrument("/api/bookkeeping/warnings", injectBadgerHandler(db, handlers.WarningsHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/selfcheck", injectBadgerHandler(db, handlers.SelfCheckHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/rules/test", handlers.RulesTestHandler))
+	http.HandleFunc(m.instrument("/api/bookkeeping/colors", handlers.ColorsHandler))
+	http.HandleFunc(m.instrument("/api/bookkeeping/process", injectBadgerHandler(db, handlers.ProcessHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/recalculate", injectBadgerHandler(db, handlers.RecalculateHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/archive", injectBadgerHandler(db, handlers.ArchiveHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/pending", handlers.PendingHandler))
+	http.HandleFunc(m.instrument("/api/bookkeeping/summary", injectBadgerHandler(db, handlers.SummaryHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/summary.png", injectBadgerHandler(db, handlers.SummaryImageHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/breakdown", injectBadgerHandler(db, handlers.BreakdownHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/cashflow", injectBadgerHandler(db, handlers.CashFlowHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/statement", injectBadgerHandler(db, handlers.StatementHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/sheets", injectBadgerHandler(db, handlers.SheetsExportHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/insights", injectBadgerHandler(db, handlers.InsightsHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/anomalies", injectBadgerHandler(db, handlers.AnomaliesHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/gaps", injectBadgerHandler(db, handlers.GapsHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/tax", injectBadgerHandler(db, handlers.TaxTotalsHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/weekdays", injectBadgerHandler(db, handlers.WeekdaysHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/reconcile", injectBadgerHandler(db, handlers.ReconcileHandler)))
+	http.HandleFunc(m.instrument("/api/bookkeeping/audit", injectBadgerHandler(db, handlers.AuditHandler)))
+	http.HandleFunc(m.instrument("/api/openapi.json", handlers.OpenAPIHandler))
 	http.HandleFunc(m.instrument("/about/", gh.AboutHandler))
-	http.HandleFunc(m.instrument("/", injectBadgerHandler(db, gh.HomeHandler)))
+	http.HandleFunc(m.instrument("/", requireBadger(&gh, db, injectBadgerHandler(db, gh.HomeHandler))))
 
 	http.Handle("/metrics", promhttp.Handler())
 
 	log.Printf("Running on %s ...", *addr)
-	log.Fatal(http.ListenAndServe(*addr, nil))
+	log.Fatal(http.ListenAndServe(*addr, handlers.WithRequestID(http.DefaultServeMux)))
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gojp/goreportcard/handlers"
+	"github.com/gojp/goreportcard/vault"
+)
+
+// runProcess runs the process subcommand, which processes a vault like
+// POST /api/bookkeeping/process without starting the server, prints a
+// summary and returns the exit code: 0 on success, 1 when processing failed
+// and 2 for invalid arguments
+func runProcess(args []string) int {
+	fs := flag.NewFlagSet("process", flag.ContinueOnError)
+	vaultDir := fs.String("vault", getEnv("VAULT_DIR", "vault"), "Directory containing the CSV transaction files, or an s3://bucket/prefix URL")
+	ledgerDir := fs.String("ledger", getEnv("LEDGER_DIR", "ledger"), "Directory for the generated ledger")
+	jsn := fs.Bool("json", false, "Print the result as JSON")
+	timeout := fs.Duration("timeout", 0, "Give up reading the vault after this long (0 waits indefinitely)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goreportcard process [-vault dir] [-ledger dir] [-json] [-timeout duration]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	vaultPath, ledgerPath := *vaultDir, *ledgerDir
+	if !vault.IsRemote(vaultPath) {
+		if abs, err := filepath.Abs(vaultPath); err == nil {
+			vaultPath = abs
+		}
+	}
+	if abs, err := filepath.Abs(ledgerPath); err == nil {
+		ledgerPath = abs
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	// progress goes to stderr, leaving stdout to the summary
+	logger := log.New(os.Stderr, "[TransactionProcessor] ", log.LstdFlags)
+	result, err := handlers.ProcessVault(ctx, vaultPath, ledgerPath, vault.WithLogger(logger))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", vaultPath, err)
+		return 1
+	}
+
+	if *jsn {
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not encode the result: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(b))
+		return 0
+	}
+
+	s := result.Summary
+	fmt.Printf("Vault:         %s\n", vaultPath)
+	fmt.Printf("Ledger:        %s\n", ledgerPath)
+	fmt.Printf("Transactions:  %d\n", result.Transactions)
+	fmt.Printf("Payments:      %d (%s)\n", s.TotalPayments, s.PaymentsSum)
+	fmt.Printf("Transfers:     %d (%s)\n", s.TotalTransfers, s.TransfersSum)
+	fmt.Printf("Fees:          %d (%s)\n", s.TotalFees, s.FeesSum)
+	fmt.Printf("Uncategorized: %d (%s)\n", s.TotalUncategorized, s.UncategorizedSum)
+	fmt.Printf("Net:           %s\n", s.NetLiquidity)
+	fmt.Printf("Warnings:      %d\n", len(result.Warnings))
+	for _, w := range result.Warnings {
+		fmt.Printf("\t%s\n", w)
+	}
+	fmt.Printf("Took:          %s\n", result.Took)
+	return 0
+}
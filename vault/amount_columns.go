@@ -0,0 +1,170 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// AmountMode is how the amount of a transaction is laid out in the CSV files.
+type AmountMode string
+
+const (
+	// AmountAuto reads separate debit and credit columns when the header has
+	// both, and a single signed amount otherwise.
+	AmountAuto AmountMode = "auto"
+	// AmountSigned reads a single signed amount, the third column.
+	AmountSigned AmountMode = "signed"
+	// AmountDebitCredit reads the amount from a debit column, money paid out,
+	// and a credit column, money received. Files without both are rejected.
+	AmountDebitCredit AmountMode = "debit-credit"
+)
+
+// ParseAmountMode parses the name of an AmountMode.
+func ParseAmountMode(s string) (AmountMode, error) {
+	switch m := AmountMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case AmountAuto, AmountSigned, AmountDebitCredit:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown amount mode %q, expected %s, %s or %s", s, AmountAuto, AmountSigned, AmountDebitCredit)
+}
+
+// AmountColumns controls how transaction amounts are read. The zero value
+// detects the layout from the header, as AmountAuto.
+type AmountColumns struct {
+	Mode   AmountMode // Layout of the amounts, AmountAuto when empty
+	Debit  string     // Header of the debit column, one of DebitColumns when empty
+	Credit string     // Header of the credit column, one of CreditColumns when empty
+}
+
+// DebitColumns and CreditColumns are the headers of the debit and credit
+// columns recognized by default, matched case-insensitively.
+var (
+	DebitColumns  = []string{"Debit", "Debit Amount", "Withdrawal", "Withdrawals", "Paid Out", "Money Out"}
+	CreditColumns = []string{"Credit", "Credit Amount", "Deposit", "Deposits", "Paid In", "Money In"}
+)
+
+// WithAmountColumns sets how transaction amounts are read from the CSV files.
+func WithAmountColumns(c AmountColumns) Option {
+	return func(tp *TransactionProcessor) {
+		tp.amounts = c
+	}
+}
+
+// find returns the indexes of the debit and credit columns of headers, or -1
+// for both when the file has a single signed amount.
+func (c AmountColumns) find(headers []string) (int, int, error) {
+	if c.Mode == AmountSigned {
+		return -1, -1, nil
+	}
+	debit := headerIndex(headers, c.Debit, DebitColumns)
+	credit := headerIndex(headers, c.Credit, CreditColumns)
+	if debit >= 0 && credit >= 0 && debit != credit {
+		return debit, credit, nil
+	}
+	if c.Mode == AmountDebitCredit {
+		return -1, -1, fmt.Errorf("%w: expected a debit and a credit column", ErrInvalidHeader)
+	}
+	return -1, -1, nil
+}
+
+// headerIndex returns the index of the header named name, or of the first of
+// defaults when name is empty, or -1 if there is none.
+func headerIndex(headers []string, name string, defaults []string) int {
+	names := defaults
+	if name != "" {
+		names = []string{name}
+	}
+	for _, n := range names {
+		for i, h := range headers {
+			if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(n)) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// mergeAmountColumns returns fields without the debit and credit columns and
+// with amount as the third one, so that the other columns are read by their
+// position as in a file with a single signed amount.
+func mergeAmountColumns(fields []string, debit, credit int, amount string) []string {
+	merged := make([]string, 0, len(fields)-1)
+	for i, f := range fields {
+		if i != debit && i != credit {
+			merged = append(merged, f)
+		}
+	}
+	at := min(2, len(merged))
+	merged = append(merged[:at], append([]string{amount}, merged[at:]...)...)
+	return merged
+}
+
+// signedAmount combines a debit and a credit into a signed amount: the debit
+// negated, or the credit as is, and a warning for the row if there is one.
+// Blank and zero values count as empty. A row with both is netted as credit
+// minus debit, and one with neither counts as 0; both are warned about, except
+// for an explicit zero amount.
+func signedAmount(debit, credit string, f NumberFormat) (string, string) {
+	d, dSet, dWarn := columnAmount("debit", debit, f)
+	c, cSet, cWarn := columnAmount("credit", credit, f)
+	warning := dWarn
+	if cWarn != "" && warning != "" {
+		warning += "; " + cWarn
+	} else if cWarn != "" {
+		warning = cWarn
+	}
+
+	switch {
+	case dSet && cSet:
+		decimals := max(decimalPlaces(debit, f), decimalPlaces(credit, f))
+		net := (c - d).Format(decimals)
+		return net, fmt.Sprintf("both debit %q and credit %q are set, using the net amount %s", strings.TrimSpace(debit), strings.TrimSpace(credit), net)
+	case dSet:
+		return "-" + unsigned(debit), warning
+	case cSet:
+		return unsigned(credit), warning
+	case warning != "":
+		return "0", warning
+	case zeroAmount(debit, f) || zeroAmount(credit, f):
+		return "0", ""
+	}
+	return "0", "neither a debit nor a credit is set, it counts as 0"
+}
+
+// columnAmount parses the absolute value of a debit or credit, reporting
+// whether it is set, or a warning when it is not a number.
+func columnAmount(column, s string, f NumberFormat) (Money, bool, string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false, ""
+	}
+	v, _, err := ParseAmount(s, f)
+	if err != nil {
+		return 0, false, fmt.Sprintf("%s %q is not a number, ignoring it", column, s)
+	}
+	if v == 0 {
+		return 0, false, ""
+	}
+	return v.Abs(), true, ""
+}
+
+// zeroAmount reports whether s is an explicit zero amount, such as "0.00".
+func zeroAmount(s string, f NumberFormat) bool {
+	v, _, err := ParseAmount(s, f)
+	return err == nil && v == 0
+}
+
+// unsigned returns an amount as written, without its sign.
+func unsigned(s string) string {
+	return strings.TrimLeft(strings.TrimSpace(s), "+-")
+}
+
+// decimalPlaces returns the number of digits after the decimal separator of
+// s in the number format f.
+func decimalPlaces(s string, f NumberFormat) int {
+	if _, frac, ok := strings.Cut(normalizeNumber(s, f), "."); ok {
+		return strings.IndexFunc(frac+" ", func(r rune) bool { return !unicode.IsDigit(r) })
+	}
+	return 0
+}
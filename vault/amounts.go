@@ -0,0 +1,224 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// NumberFormat is how the decimal and thousands separators of amounts are
+// written, as in a locale.
+type NumberFormat string
+
+const (
+	// FormatAuto takes the last of a point and a comma as the decimal
+	// separator when an amount has both. A lone comma followed by three
+	// digits, as in "1,234", separates thousands, and otherwise decimals; a
+	// lone point is a decimal point, and several separate thousands.
+	FormatAuto NumberFormat = "auto"
+	// FormatPoint has a decimal point, as in "1,234.56" (US) or "1'234.56"
+	// (Swiss).
+	FormatPoint NumberFormat = "point"
+	// FormatComma has a decimal comma, as in "1.234,56" or "1 234,56".
+	FormatComma NumberFormat = "comma"
+)
+
+// numberFormatAliases are the locales accepted by ParseNumberFormat
+var numberFormatAliases = map[string]NumberFormat{
+	"us": FormatPoint, "en": FormatPoint, "uk": FormatPoint, "ch": FormatPoint,
+	"eu": FormatComma, "de": FormatComma, "fr": FormatComma, "se": FormatComma,
+	"no": FormatComma, "dk": FormatComma, "is": FormatComma,
+}
+
+// ParseNumberFormat parses the name of a NumberFormat, or of a locale using
+// it, such as "us", "ch" or "eu".
+func ParseNumberFormat(s string) (NumberFormat, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	switch f := NumberFormat(name); f {
+	case FormatAuto, FormatPoint, FormatComma:
+		return f, nil
+	}
+	if f, ok := numberFormatAliases[name]; ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown number format %q, expected %s, %s, %s or a locale such as us, ch or eu", s, FormatAuto, FormatPoint, FormatComma)
+}
+
+// WithNumberFormat sets the decimal and thousands separators amounts are
+// written with, for the checks of their sign. It is FormatAuto by default.
+func WithNumberFormat(f NumberFormat) Option {
+	return func(tp *TransactionProcessor) {
+		tp.numberFormat = f
+	}
+}
+
+// currencySymbols are the currencies recognized by their symbol. Other
+// symbols, such as "kr", are accepted without naming a currency.
+var currencySymbols = map[string]string{
+	"$": "USD", "US$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY", "₹": "INR",
+	"Fr.": "CHF", "Fr": "CHF", "SFr.": "CHF", "C$": "CAD", "A$": "AUD",
+}
+
+// ParseAmount parses an amount written with a currency symbol or code and
+// thousands separators, such as "$1,234.56", "-1.234,56 €", "1 234,56 kr",
+// "CHF 1'234.50" or "(12.00)", in the number format f. It returns the amount
+// and the ISO 4217 code of its currency, or "" when it has none or the symbol
+// does not tell, such as "kr". An empty f is FormatAuto.
+func ParseAmount(s string, f NumberFormat) (Money, string, error) {
+	number, code, err := decimalAmount(s, f)
+	if err != nil {
+		return 0, "", err
+	}
+	v, err := parseDecimal(number)
+	if err != nil {
+		return 0, "", fmt.Errorf("amount %q %w", strings.TrimSpace(s), err)
+	}
+	return v, code, nil
+}
+
+// isDigit reports whether r is an ASCII digit, the only digits amounts are
+// written with
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// decimalAmount parses an amount like ParseAmount, but returns it as a plain
+// decimal, such as "-1234.56", for ParseMoney.
+func decimalAmount(s string, f NumberFormat) (string, string, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(strings.TrimLeft(s, "+-")) {
+	case "nan", "inf", "infinity":
+		return "", "", fmt.Errorf("amount %q is not a finite number", s)
+	}
+	first := strings.IndexFunc(s, isDigit)
+	last := strings.LastIndexFunc(s, isDigit)
+	if first < 0 {
+		return "", "", fmt.Errorf("amount %q has no digits", s)
+	}
+	// a leading separator belongs to the number, as in ".5"
+	if first > 0 && (s[first-1] == '.' || s[first-1] == ',') {
+		first--
+	}
+	number := s[first : last+1]
+	// only an exponent, as in "1e3", may be written with a letter
+	if strings.ContainsFunc(number, func(r rune) bool { return unicode.IsLetter(r) && r != 'e' && r != 'E' }) {
+		return "", "", fmt.Errorf("amount %q has unexpected characters %q", s, number)
+	}
+
+	// one sign at most: a minus on either side, a plus before the number, or
+	// parentheses around it as in accounting
+	var minus, plus, opening, closing int
+	var currency []string
+	for i, affix := range []string{s[:first], s[last+1:]} {
+		symbol := strings.TrimFunc(affix, func(r rune) bool {
+			switch r {
+			case '-', '−':
+				minus++
+			case '+':
+				plus++
+			case '(':
+				opening++
+			case ')':
+				closing++
+			default:
+				return unicode.IsSpace(r)
+			}
+			return true
+		})
+		if i == 1 && strings.ContainsRune(affix, '+') {
+			return "", "", fmt.Errorf("amount %q has a plus sign after the number", s)
+		}
+		if symbol == "" {
+			continue
+		}
+		isSymbol := func(r rune) bool { return unicode.IsLetter(r) || unicode.Is(unicode.Sc, r) }
+		if !strings.ContainsFunc(symbol, isSymbol) || strings.ContainsFunc(symbol, func(r rune) bool { return !isSymbol(r) && r != '.' }) {
+			return "", "", fmt.Errorf("amount %q has unexpected characters %q", s, symbol)
+		}
+		currency = append(currency, symbol)
+	}
+	if opening != closing || opening > 1 || opening == 1 && (strings.IndexRune(s, '(') > first || strings.IndexRune(s, ')') < last) {
+		return "", "", fmt.Errorf("amount %q has unbalanced parentheses", s)
+	}
+	if minus+plus+opening > 1 {
+		return "", "", fmt.Errorf("amount %q has more than one sign", s)
+	}
+	if len(currency) > 1 {
+		return "", "", fmt.Errorf("amount %q has two currencies", s)
+	}
+
+	number = normalizeNumber(number, f)
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return "", "", fmt.Errorf("amount %q %w", s, errNotDecimal)
+	}
+	// out of range, such as 1e400, parses as an infinity
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", "", fmt.Errorf("amount %q is not a finite number", s)
+	}
+	if (minus > 0 || opening > 0) && v != 0 {
+		number = "-" + number
+	}
+
+	code := ""
+	if len(currency) == 1 {
+		code = currencyCode(currency[0])
+	}
+	return number, code, nil
+}
+
+// normalizeNumber returns the digits of number with a decimal point and
+// without thousands separators, as strconv.ParseFloat reads them
+func normalizeNumber(number string, f NumberFormat) string {
+	number = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '\'' || r == '’' {
+			return -1
+		}
+		return r
+	}, number)
+
+	decimal := '.'
+	switch f {
+	case FormatComma:
+		decimal = ','
+	case FormatAuto, "":
+		points, commas := strings.Count(number, "."), strings.Count(number, ",")
+		switch {
+		case points > 0 && commas > 0:
+			if strings.LastIndex(number, ",") > strings.LastIndex(number, ".") {
+				decimal = ','
+			}
+		case commas == 1 && len(number)-strings.Index(number, ",") != 4:
+			decimal = ','
+		case points > 1:
+			decimal = ','
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range number {
+		switch {
+		case r == decimal:
+			b.WriteRune('.')
+		case r == '.' || r == ',':
+			// thousands separator
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// currencyCode returns the ISO 4217 code of a currency symbol or code
+func currencyCode(symbol string) string {
+	if code, ok := currencySymbols[symbol]; ok {
+		return code
+	}
+	if len(symbol) == 3 && strings.IndexFunc(symbol, func(r rune) bool { return r < 'A' || r > 'Z' }) < 0 {
+		return symbol
+	}
+	return ""
+}
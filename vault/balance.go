@@ -0,0 +1,62 @@
+package vault
+
+import (
+	"sort"
+)
+
+// BalancedTransaction is a transaction with the balance of the account after
+// it; see WithRunningBalance.
+type BalancedTransaction struct {
+	Transaction
+	Balance Money `json:"balance"` // Balance of the account after the transaction, from the opening balance
+}
+
+// WithOpeningBalance sets the balance of the account before its first
+// transaction, from which WithRunningBalance starts. It is 0 by default.
+func WithOpeningBalance(balance Money) Option {
+	return func(tp *TransactionProcessor) {
+		tp.openingBalance = balance
+	}
+}
+
+// SortChronologically sorts transactions by their timestamp, and those at the
+// same time, such as on the same day without a time, by transaction ID, so
+// that the order does not depend on the order the files were read in.
+// Transactions without a timestamp come last, by date.
+func SortChronologically(transactions []Transaction) {
+	sort.SliceStable(transactions, func(i, j int) bool {
+		a, b := transactions[i], transactions[j]
+		if a.Timestamp.IsZero() != b.Timestamp.IsZero() {
+			return b.Timestamp.IsZero()
+		}
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		if a.Timestamp.IsZero() && a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return a.TransactionID < b.TransactionID
+	})
+}
+
+// WithRunningBalance returns the transactions in chronological order, see
+// SortChronologically, each with the balance of the account after it: the
+// opening balance plus its amount and those of every transaction before it.
+// The transactions passed in are left as they are.
+func (tp *TransactionProcessor) WithRunningBalance(transactions []Transaction) []BalancedTransaction {
+	sorted := make([]Transaction, len(transactions))
+	copy(sorted, transactions)
+	SortChronologically(sorted)
+
+	balanced := make([]BalancedTransaction, len(sorted))
+	balance := tp.openingBalance
+	for i, txn := range sorted {
+		next, err := balance.Add(txn.Amount)
+		if err != nil && next != balance {
+			tp.logger.Printf("Capping the running balance at %s: %v", next, err)
+		}
+		balance = next
+		balanced[i] = BalancedTransaction{Transaction: txn, Balance: balance}
+	}
+	return balanced
+}
@@ -0,0 +1,53 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CategorySeparator separates the levels of a category path, such as
+// "Fees > BankFees > WireFee".
+const CategorySeparator = " > "
+
+// ParseCategory splits a category path into its levels. The first level must
+// be a transaction type, matched case-insensitively, and is returned with its
+// canonical name; the levels under it are free-form.
+func ParseCategory(path string) ([]string, error) {
+	levels := strings.Split(path, ">")
+	for i := range levels {
+		levels[i] = strings.TrimSpace(levels[i])
+		if levels[i] == "" {
+			return nil, fmt.Errorf("category %q has an empty level", path)
+		}
+	}
+	t, err := ParseTransactionType(levels[0])
+	if err != nil {
+		return nil, fmt.Errorf("category %q: %w", path, err)
+	}
+	levels[0] = string(t)
+	return levels, nil
+}
+
+// CategoryAt returns the first level levels of a category path, rolling its
+// deeper levels up into them. Paths with no more than level levels, and every
+// path if level is less than 1, are returned unchanged.
+func CategoryAt(path string, level int) string {
+	if level < 1 {
+		return path
+	}
+	levels := strings.Split(path, CategorySeparator)
+	if len(levels) <= level {
+		return path
+	}
+	return strings.Join(levels[:level], CategorySeparator)
+}
+
+// CategoryPath returns the full category path of the transaction: its
+// Category when that is under its Type, or else the type alone, as after the
+// type has been overridden.
+func (t Transaction) CategoryPath() string {
+	if t.Category == string(t.Type) || strings.HasPrefix(t.Category, string(t.Type)+CategorySeparator) {
+		return t.Category
+	}
+	return string(t.Type)
+}
@@ -4,7 +4,11 @@
 package vault
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -25,32 +29,149 @@ const (
 	TransferTransaction TransactionType = "Transfers"
 	// FeeTransaction represents PayPal processing and service fees.
 	FeeTransaction TransactionType = "Fees"
+	// UncategorizedTransaction represents transactions that no rule or heuristic could classify.
+	UncategorizedTransaction TransactionType = "Uncategorized"
 )
 
+// TransactionTypes lists every known transaction type in display order.
+var TransactionTypes = []TransactionType{PaymentTransaction, TransferTransaction, FeeTransaction, UncategorizedTransaction}
+
+// Valid reports whether t is one of the known transaction types.
+func (t TransactionType) Valid() bool {
+	for _, known := range TransactionTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTransactionType returns the known transaction type with the given name,
+// matched case-insensitively.
+func ParseTransactionType(name string) (TransactionType, error) {
+	for _, known := range TransactionTypes {
+		if strings.EqualFold(strings.TrimSpace(name), string(known)) {
+			return known, nil
+		}
+	}
+	return "", fmt.Errorf("unknown transaction type %q", strings.TrimSpace(name))
+}
+
 // Transaction represents a single PayPal transaction record with all relevant details.
 type Transaction struct {
-	Date          string          // Date of the transaction
-	Type          TransactionType // Category: Payments, Transfers, or Fees
-	Amount        string          // Transaction amount (can be negative)
-	Description   string          // Human-readable description
-	TransactionID string          // Unique PayPal transaction identifier
+	Date          string          `json:"date"`                  // Date of the transaction
+	Timestamp     time.Time       `json:"timestamp"`             // Date parsed in the source time zone; zero if unparseable
+	ReportingDate time.Time       `json:"reporting_date"`        // Timestamp shifted off weekends and holidays for bucketing; set by the server, not read from the CSV files
+	Type          TransactionType `json:"type"`                  // Category: Payments, Transfers, Fees, or Uncategorized
+	Amount        Money           `json:"amount"`                // Transaction amount (can be negative); 0 when it cannot be parsed
+	AmountText    string          `json:"amount_text,omitempty"` // Amount as written in the CSV file, such as "$1,234.50", which the ledger keeps
+	Description   string          `json:"description"`           // Human-readable description, as in the CSV file
+	TransactionID string          `json:"transaction_id"`        // Unique PayPal transaction identifier
+	Reconciled    bool            `json:"reconciled"`            // Matched to the accounting system; not read from the CSV files
+	Internal      bool            `json:"internal"`              // Transfer between the user's own accounts, excluded from net calculations
+
+	NormalizedDescription string   `json:"normalized_description"` // Description after normalization, matched by the categorization rules
+	SplitFrom             string   `json:"split_from,omitempty"`   // ID of the transaction this is a part of; not read from the CSV files
+	Tags                  []string `json:"tags,omitempty"`         // Labels assigned to the transaction; not read from the CSV files
+	Reference             string   `json:"reference,omitempty"`    // Transaction ID this one refers to, such as the payment a fee was charged for
+	NetAmount             *Money   `json:"net_amount,omitempty"`   // Payment amount less the fees charged for it; set by the server on request, not read from the CSV files
+	FeeTier               string   `json:"fee_tier,omitempty"`     // Amount tier of a fee, such as micro or large; set by the server, not read from the CSV files
+	Category              string   `json:"category"`               // Full category path under Type, such as "Fees > BankFees > WireFee", assigned by the rules; the type alone otherwise
+	TaxCategory           string   `json:"tax_category,omitempty"` // Tax treatment, such as Deductible, assigned by the rules
+	Currency              string   `json:"currency,omitempty"`     // ISO 4217 code of the currency, when the amount has a symbol or code that tells
+}
+
+// Normalized returns the normalized description, normalizing the raw one with
+// NormalizeDescription for transactions read before it was recorded.
+func (t Transaction) Normalized() string {
+	if t.NormalizedDescription == "" && t.Description != "" {
+		return NormalizeDescription(t.Description)
+	}
+	return t.NormalizedDescription
 }
 
 // TransactionProcessor handles reading, categorizing, and reporting on PayPal transactions.
 type TransactionProcessor struct {
-	vaultDir  string      // Directory containing CSV transaction files
-	ledgerDir string      // Directory for generated ledger reports
-	logger    *log.Logger // Logger for operational messages
+	vaultDir       string          // Directory containing CSV transaction files
+	ledgerDir      string          // Directory for generated ledger reports
+	source         Source          // Where the CSV files are read from, the vault directory by default
+	logger         *log.Logger     // Logger for operational messages
+	rules          []CategoryRule  // User-defined categorization rules, checked before the heuristics
+	sourceLocation *time.Location  // Time zone of dates without a UTC offset
+	ledgerHistory  int             // Previous ledger versions kept when regenerating
+	retry          RetryPolicy     // Retrying of transient errors reading a file
+	normalizer     Normalizer      // Normalization of descriptions before categorization
+	dialect        CSVDialect      // Quoting and line breaks of the CSV files
+	amounts        AmountColumns   // Layout of the amounts in the CSV files
+	numberFormat   NumberFormat    // Decimal and thousands separators of the amounts
+	openingBalance Money           // Balance before the first transaction, for WithRunningBalance
+	signs          SignPolicy      // Expected signs of the amounts by transaction type
+	defaultType    TransactionType // Type of the transactions no rule or heuristic classifies
+	ignore         []string        // Patterns of the base names of files to skip
+	strictness     Strictness      // Handling of malformed input
+
+	warnings []Warning                  // Warnings of the last read
+	warned   map[Warning]bool           // Warnings already recorded during the last read
+	seenIDs  map[string]seenTransaction // First record of each transaction ID read during the last read
+	seenRows map[string]Warning         // First location of each transaction without an ID read during the last read, by date, amount and description
+
+	duplicates int // Duplicate transactions skipped during the last read
+
+	fileCounts    map[string]int    // Transactions read from each file during the last read, by base name
+	fileChecksums map[string]string // SHA-256 of each file read in full during the last read, by base name
+}
+
+// Option configures optional behaviour of a TransactionProcessor.
+type Option func(*TransactionProcessor)
+
+// WithRules sets the categorization rules evaluated before the built-in heuristics.
+func WithRules(rules []CategoryRule) Option {
+	return func(tp *TransactionProcessor) {
+		tp.rules = rules
+	}
+}
+
+// WithLogger sets the logger for operational messages, which are written to
+// stdout by default.
+func WithLogger(logger *log.Logger) Option {
+	return func(tp *TransactionProcessor) {
+		tp.logger = logger
+	}
+}
+
+// WithDefaultType sets the type given to transactions that no rule or
+// heuristic classifies, and to transactions without a known type passed to
+// CategorizeTransactions. It is UncategorizedTransaction by default; types
+// other than TransactionTypes are ignored.
+func WithDefaultType(t TransactionType) Option {
+	return func(tp *TransactionProcessor) {
+		if t.Valid() {
+			tp.defaultType = t
+		}
+	}
 }
 
 // NewTransactionProcessor creates a new processor with the specified directories.
-// It initializes logging and validates that the vault directory exists.
-func NewTransactionProcessor(vaultDir, ledgerDir string) (*TransactionProcessor, error) {
+// It initializes logging and validates that the vault directory exists. The
+// vault may also be an s3://bucket/prefix URL; see NewSource.
+func NewTransactionProcessor(vaultDir, ledgerDir string, opts ...Option) (*TransactionProcessor, error) {
 	logger := log.New(os.Stdout, "[TransactionProcessor] ", log.LstdFlags)
 
-	// Validate vault directory exists
-	if _, err := os.Stat(vaultDir); os.IsNotExist(err) {
-		return nil, fmt.Errorf("vault directory does not exist: %s", vaultDir)
+	source, err := NewSource(vaultDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsRemote(vaultDir) {
+		// Validate vault directory exists
+		if _, err := os.Stat(vaultDir); os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrVaultDirMissing, vaultDir)
+		}
+
+		// Refuse to write ledgers among the source files
+		if err := CheckDirs(vaultDir, ledgerDir); err != nil {
+			return nil, err
+		}
 	}
 
 	// Create ledger directory if it doesn't exist
@@ -58,150 +179,465 @@ func NewTransactionProcessor(vaultDir, ledgerDir string) (*TransactionProcessor,
 		return nil, fmt.Errorf("failed to create ledger directory: %w", err)
 	}
 
-	return &TransactionProcessor{
-		vaultDir:  vaultDir,
-		ledgerDir: ledgerDir,
-		logger:    logger,
-	}, nil
+	tp := &TransactionProcessor{
+		vaultDir:       vaultDir,
+		ledgerDir:      ledgerDir,
+		source:         source,
+		logger:         logger,
+		sourceLocation: time.UTC,
+		ledgerHistory:  DefaultLedgerHistory,
+		retry:          DefaultRetryPolicy,
+		normalizer:     DefaultNormalizer(),
+		defaultType:    UncategorizedTransaction,
+	}
+	for _, opt := range opts {
+		opt(tp)
+	}
+
+	return tp, nil
+}
+
+// CSVFiles returns the CSV files in a vault directory, plain or gzip-compressed, sorted by name.
+func CSVFiles(vaultDir string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"*.csv", "*.gz"} {
+		matches, err := filepath.Glob(filepath.Join(vaultDir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to search for CSV files: %w", err)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
 }
 
 // ReadCSVFiles reads all CSV files from the vault directory and returns parsed transactions.
+// Files ending in .gz are decompressed on the fly and parsed like plain CSV files.
+// Transient read errors are retried with backoff; see WithRetryPolicy.
 // It handles file reading errors gracefully and logs any issues encountered.
-func (tp *TransactionProcessor) ReadCSVFiles() ([]Transaction, error) {
+// ErrNoFiles is returned, along with an empty slice, when the directory has no CSV files.
+// Reading stops with the context's error when ctx is done, checked between files and rows.
+func (tp *TransactionProcessor) ReadCSVFiles(ctx context.Context) ([]Transaction, error) {
 	var allTransactions []Transaction
 
-	// Find all CSV files in vault directory
-	files, err := filepath.Glob(filepath.Join(tp.vaultDir, "*.csv"))
+	err := tp.forEachCSVFile(ctx, func(filename string) (int, error) {
+		var transactions []Transaction
+		err := tp.readCSVWithRetry(ctx, filename, func(txn Transaction) error {
+			transactions = append(transactions, txn)
+			return nil
+		})
+		if err == nil {
+			allTransactions = append(allTransactions, transactions...)
+		} else {
+			tp.forgetFile(filepath.Base(filename))
+		}
+		return len(transactions), err
+	})
+	if err != nil && !errors.Is(err, ErrNoFiles) {
+		return nil, err
+	}
+
+	return allTransactions, err
+}
+
+// StreamCSVFiles reads the vault directory like ReadCSVFiles, but sends each
+// transaction on out as soon as it is parsed instead of collecting them, so
+// that large vaults can be aggregated without holding every row in memory.
+// out is closed when StreamCSVFiles returns. Unlike ReadCSVFiles, the
+// transactions of a file that fails partway through, after any retries, have
+// already been sent.
+func (tp *TransactionProcessor) StreamCSVFiles(ctx context.Context, out chan<- Transaction) error {
+	defer close(out)
+
+	return tp.forEachCSVFile(ctx, func(filename string) (int, error) {
+		sent := 0
+		err := tp.readCSVWithRetry(ctx, filename, func(txn Transaction) error {
+			select {
+			case out <- txn:
+				sent++
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		return sent, err
+	})
+}
+
+// forEachCSVFile calls read with each CSV file in the vault directory, which
+// returns the number of transactions it read. Files that cannot be read are
+// logged and skipped.
+func (tp *TransactionProcessor) forEachCSVFile(ctx context.Context, read func(filename string) (int, error)) error {
+	tp.resetWarnings()
+	tp.fileCounts = make(map[string]int)
+	tp.fileChecksums = make(map[string]string)
+
+	files, err := tp.listFiles(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search for CSV files: %w", err)
+		return err
 	}
 
 	if len(files) == 0 {
-		tp.logger.Printf("Warning: No CSV files found in %s", tp.vaultDir)
-		return allTransactions, nil
+		tp.warn(WarningFile, "", 0, "no CSV files found in %s", tp.source)
+		return ErrNoFiles
 	}
 
 	tp.logger.Printf("Found %d CSV file(s) to process", len(files))
 
 	// Process each CSV file
 	for _, filename := range files {
-		transactions, err := tp.readSingleCSV(filename)
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("reading CSV files cancelled: %w", err)
+		}
+
+		n, err := read(filename)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("reading CSV files cancelled: %w", ctxErr)
+		}
 		if err != nil {
-			// Log error but continue processing other files
+			// Record the error but continue processing other files
 			tp.logger.Printf("Error reading %s: %v", filepath.Base(filename), err)
+			w := Warning{File: filepath.Base(filename), Reason: err.Error(), Kind: WarningFile}
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				w.Line, w.Reason = parseErr.Line, parseErr.Err.Error()
+			}
+			if errors.Is(err, ErrInvalidHeader) {
+				w.Kind = WarningSchema
+			}
+			tp.record(w)
+			if tp.aborts(err) {
+				return err
+			}
 			continue
 		}
-		allTransactions = append(allTransactions, transactions...)
-		tp.logger.Printf("Successfully processed %s: %d transactions", filepath.Base(filename), len(transactions))
+		tp.logger.Printf("Successfully processed %s: %d transactions", filepath.Base(filename), n)
+		tp.fileCounts[filepath.Base(filename)] = n
+	}
+
+	if tp.duplicates > 0 {
+		tp.logger.Printf("Skipped %d duplicate transaction(s)", tp.duplicates)
 	}
+	return nil
+}
 
-	return allTransactions, nil
+// FileCounts returns the number of transactions read from each file, by base
+// name, the last time the vault was read. Files that could not be read are
+// left out.
+func (tp *TransactionProcessor) FileCounts() map[string]int {
+	counts := make(map[string]int, len(tp.fileCounts))
+	for file, n := range tp.fileCounts {
+		counts[file] = n
+	}
+	return counts
 }
 
-// readSingleCSV reads and parses a single CSV file.
+// readSingleCSV reads and parses a single CSV file, passing each transaction to emit.
 // It expects a header row with: Date, Type, Amount, Description, Transaction ID
-func (tp *TransactionProcessor) readSingleCSV(filename string) ([]Transaction, error) {
-	file, err := os.Open(filename)
+// Errors concerning the whole file are returned as a *ParseError, and an error
+// returned by emit stops reading.
+func (tp *TransactionProcessor) readSingleCSV(ctx context.Context, filename string, emit func(Transaction) error) error {
+	return tp.readCSV(ctx, filename, nil, emit)
+}
+
+// gzipFile is a gzip-compressed file being decompressed.
+type gzipFile struct {
+	*gzip.Reader
+	file io.Closer
+}
+
+func (g gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// openCSV opens one of the vault's files, decompressing it on the fly if it
+// ends in .gz. The bytes read, as stored, are also written to sum if it is not
+// nil. Errors are returned as a *ParseError.
+func (tp *TransactionProcessor) openCSV(ctx context.Context, filename string, sum io.Writer) (io.ReadCloser, error) {
+	base := filepath.Base(filename)
+	file, err := tp.source.Open(ctx, filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, &ParseError{File: base, Err: fmt.Errorf("failed to open file: %w", err)}
+	}
+	if sum != nil {
+		file = teeFile{Reader: io.TeeReader(file, sum), Closer: file}
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), ".gz") {
+		return file, nil
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.TrimLeadingSpace = true
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, &ParseError{File: base, Err: fmt.Errorf("failed to decompress file: %w", err)}
+	}
+	return gzipFile{Reader: gz, file: file}, nil
+}
+
+// readCSV is readSingleCSV, also passing the header row to header if it is not nil.
+func (tp *TransactionProcessor) readCSV(ctx context.Context, filename string, header func([]string), emit func(Transaction) error) error {
+	base := filepath.Base(filename)
+
+	sum := sha256.New()
+	r, err := tp.openCSV(ctx, filename, sum)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return tp.parseCSV(ctx, base, r, header, emit, func() { tp.recordChecksum(base, r, sum) })
+}
+
+// parseCSV parses the CSV file named base from r, as readCSV, calling eof if
+// it is not nil once r has been read to its end.
+func (tp *TransactionProcessor) parseCSV(ctx context.Context, base string, r io.Reader, header func([]string), emit func(Transaction) error, eof func()) error {
+	reader := tp.dialect.newReader(r)
 
 	// Read header row
 	headers, err := reader.Read()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		return &ParseError{File: base, Line: 1, Err: fmt.Errorf("%w: %v", ErrInvalidHeader, err)}
+	}
+
+	// Separate debit and credit columns are read as a single signed amount
+	debitCol, creditCol, err := tp.amounts.find(headers)
+	if err != nil {
+		return &ParseError{File: base, Line: 1, Err: err}
+	}
+	if debitCol >= 0 {
+		headers = mergeAmountColumns(headers, debitCol, creditCol, "Amount")
 	}
 
 	// Validate header structure
 	if len(headers) < 5 {
-		return nil, fmt.Errorf("invalid CSV format: expected at least 5 columns, got %d", len(headers))
+		return &ParseError{File: base, Line: 1, Err: fmt.Errorf("%w: expected at least 5 columns, got %d", ErrInvalidHeader, len(headers))}
+	}
+	if header != nil {
+		header(headers)
 	}
+	refCol := referenceColumn(headers)
 
-	var transactions []Transaction
+	emitted := 0
 	lineNum := 1 // Track line number for error reporting (header was line 1, data starts at line 2)
 
 	// Read data rows
 	for {
-		lineNum++
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		record, err := reader.Read()
 		if err == io.EOF {
+			if eof != nil {
+				eof()
+			}
+			break
+		}
+		var csvErr *csv.ParseError
+		if err != nil && !errors.As(err, &csvErr) && isTransient(err) {
+			return &ParseError{File: base, Line: lineNum + 1, Err: fmt.Errorf("failed to read file: %w", err)}
+		}
+		if err != nil && !errors.As(err, &csvErr) {
+			// the file itself cannot be read further, e.g. a corrupt gzip stream
+			tp.warn(WarningFile, base, lineNum, "error reading after this line, keeping the %d transaction(s) read so far: %v", emitted, err)
 			break
 		}
 		if err != nil {
-			tp.logger.Printf("Warning: Error reading line %d in %s: %v", lineNum, filepath.Base(filename), err)
+			lineNum = csvErr.StartLine
+			if err := tp.malformed(WarningParse, base, lineNum, csvErr.Err.Error(), ""); err != nil {
+				return err
+			}
 			continue
 		}
+		// a record spans several lines when a quoted field has line breaks
+		lineNum, _ = reader.FieldPos(0)
+		for i := range record {
+			record[i] = tp.dialect.field(record[i])
+		}
+		if debitCol >= 0 && max(debitCol, creditCol) < len(record) {
+			amount, warning := signedAmount(record[debitCol], record[creditCol], tp.numberFormat)
+			if warning != "" {
+				if err := tp.malformed(WarningParse, base, lineNum, warning, ""); err != nil {
+					return err
+				}
+			}
+			record = mergeAmountColumns(record, debitCol, creditCol, amount)
+		}
 
 		// Validate record has enough fields
 		if len(record) < 5 {
-			tp.logger.Printf("Warning: Line %d in %s has insufficient fields (%d), skipping", lineNum, filepath.Base(filename), len(record))
+			if err := tp.malformed(WarningParse, base, lineNum, fmt.Sprintf("insufficient fields (%d)", len(record)), "skipping"); err != nil {
+				return err
+			}
 			continue
 		}
 
-		// Parse transaction type
-		transactionType := tp.categorizeTransaction(record[1], record[2], record[3])
+		// Parse transaction type, by the amount when it can be parsed; ParseAmount
+		// also rejects amounts that are not finite, such as 1e999
+		amount, currency, amountErr := ParseAmount(record[2], tp.numberFormat)
+		known := &amount
+		if amountErr != nil {
+			known = nil
+		}
+		description := strings.TrimSpace(record[3])
+		normalized := tp.normalizer.Normalize(description)
+		rule := tp.categorize(record[1], known, description, normalized)
+
+		date := strings.TrimSpace(record[0])
+		timestamp, err := ParseDate(date, tp.sourceLocation)
+		if err != nil {
+			if err := tp.malformed(WarningParse, base, lineNum, err.Error(), ""); err != nil {
+				return err
+			}
+		}
 
 		transaction := Transaction{
-			Date:          strings.TrimSpace(record[0]),
-			Type:          transactionType,
-			Amount:        strings.TrimSpace(record[2]),
-			Description:   strings.TrimSpace(record[3]),
+			Date:          date,
+			Timestamp:     timestamp,
+			Type:          rule.Type,
+			Amount:        amount,
+			AmountText:    strings.TrimSpace(record[2]),
+			Description:   description,
 			TransactionID: strings.TrimSpace(record[4]),
+			Internal:      rule.Internal,
+
+			NormalizedDescription: normalized,
+			Category:              rule.Category,
+			TaxCategory:           rule.TaxCategory,
+		}
+		transaction.Category = transaction.CategoryPath()
+		if refCol >= 0 && refCol < len(record) {
+			transaction.Reference = strings.TrimSpace(record[refCol])
+		}
+
+		if amountErr != nil {
+			if err := tp.malformed(WarningParse, base, lineNum, amountErr.Error(), "it counts as 0"); err != nil {
+				return err
+			}
+		} else {
+			transaction.Currency = currency
+		}
+
+		if v := tp.signs.violation(transaction); v != "" {
+			if tp.strictness != StrictnessStrict && tp.signs.Strict {
+				tp.warn(WarningSign, base, lineNum, "%s, skipping", v)
+				continue
+			}
+			if err := tp.malformed(WarningSign, base, lineNum, v, ""); err != nil {
+				return err
+			}
 		}
 
-		transactions = append(transactions, transaction)
+		if tp.skipDuplicate(base, lineNum, transaction) {
+			continue
+		}
+
+		if err := emit(transaction); err != nil {
+			return err
+		}
+		emitted++
 	}
 
-	return transactions, nil
+	return nil
+}
+
+// referenceColumns are the headers of the optional column naming the
+// transaction a row refers to, matched case-insensitively
+var referenceColumns = []string{"Reference Txn ID", "Reference"}
+
+// referenceColumn returns the index of the optional reference column, after
+// the five standard ones, or -1 if the file has none
+func referenceColumn(headers []string) int {
+	for i := 5; i < len(headers); i++ {
+		for _, name := range referenceColumns {
+			if strings.EqualFold(strings.TrimSpace(headers[i]), name) {
+				return i
+			}
+		}
+	}
+	return -1
 }
 
 // categorizeTransaction determines the transaction category based on type, amount, and description.
-// It uses heuristics to classify transactions as Payments, Transfers, or Fees.
+// User-defined rules are checked first, by priority; otherwise heuristics classify transactions as
+// Payments, Transfers, or Fees. Outgoing money that matches none of them is Uncategorized.
 func (tp *TransactionProcessor) categorizeTransaction(rawType, amount, description string) TransactionType {
+	value, _, err := ParseAmount(amount, tp.numberFormat)
+	known := &value
+	if err != nil {
+		known = nil
+	}
+	return tp.categorize(rawType, known, description, tp.normalizer.Normalize(description)).Type
+}
+
+// categorize is categorizeTransaction for a description that has already been
+// normalized: the rules match the normalized description, the heuristics the raw one.
+// It returns the matching rule, for its category path, tax category and
+// whether it marks the transaction as internal, or else a rule with only the
+// type the heuristics give. The amount is nil when it cannot be parsed.
+func (tp *TransactionProcessor) categorize(rawType string, amount *Money, description, normalized string) CategoryRule {
+	if rule, ok := matchRule(tp.rules, normalized, amount); ok {
+		return rule
+	}
+
 	typeStr := strings.ToLower(strings.TrimSpace(rawType))
 	descStr := strings.ToLower(strings.TrimSpace(description))
 
 	// Check for fee indicators
 	if typeStr == "fee" || strings.Contains(descStr, "fee") || strings.Contains(descStr, "charge") {
-		return FeeTransaction
+		return CategoryRule{Type: FeeTransaction}
 	}
 
 	// Check for transfer indicators
 	if typeStr == "transfer" || strings.Contains(descStr, "transfer") ||
 		strings.Contains(descStr, "withdrawal") || strings.Contains(descStr, "bank") {
-		return TransferTransaction
+		return CategoryRule{Type: TransferTransaction}
 	}
 
-	// Default to payment for anything else
-	return PaymentTransaction
+	// Explicit payments and incoming money are payments
+	if typeStr == "payment" || amount != nil && *amount > 0 {
+		return CategoryRule{Type: PaymentTransaction}
+	}
+
+	return CategoryRule{Type: tp.defaultType}
 }
 
 // CategorizeTransactions groups transactions by their type.
 // Returns a map with transaction types as keys and transaction slices as values.
+// Transactions with an empty or unknown type are grouped, and given, the
+// default type, so every key is one of TransactionTypes. Each transaction's
+// Category is set to its CategoryPath.
 func (tp *TransactionProcessor) CategorizeTransactions(transactions []Transaction) map[TransactionType][]Transaction {
 	categorized := make(map[TransactionType][]Transaction)
 
 	for _, txn := range transactions {
+		if !txn.Type.Valid() {
+			txn.Type = tp.defaultType
+		}
+		txn.Category = txn.CategoryPath()
 		categorized[txn.Type] = append(categorized[txn.Type], txn)
 	}
 
-	tp.logger.Printf("Categorization complete: %d Payments, %d Transfers, %d Fees",
+	tp.logger.Printf("Categorization complete: %d Payments, %d Transfers, %d Fees, %d Uncategorized",
 		len(categorized[PaymentTransaction]),
 		len(categorized[TransferTransaction]),
-		len(categorized[FeeTransaction]))
+		len(categorized[FeeTransaction]),
+		len(categorized[UncategorizedTransaction]))
 
 	return categorized
 }
 
 // GenerateLedger creates a markdown-formatted ledger report and writes it to the specified file.
 // The report includes a summary table with all transactions organized by category.
+// The previous ledger, if any, is kept as an older version; see WithLedgerHistory.
 func (tp *TransactionProcessor) GenerateLedger(transactions []Transaction, outputFilename string) error {
 	if len(transactions) == 0 {
-		return fmt.Errorf("no transactions to write to ledger")
+		return ErrNoTransactions
+	}
+
+	if err := tp.rotateLedger(outputFilename); err != nil {
+		return err
 	}
 
 	outputPath := filepath.Join(tp.ledgerDir, outputFilename)
@@ -226,12 +662,20 @@ func (tp *TransactionProcessor) GenerateLedger(transactions []Transaction, outpu
 		return fmt.Errorf("failed to write transaction count: %w", err)
 	}
 
-	// Categorize transactions
-	categorized := tp.CategorizeTransactions(transactions)
+	// Categorize transactions, then give each the balance after it over all
+	// of them, which keeps each category in chronological order
+	var all []Transaction
+	byType := tp.CategorizeTransactions(transactions)
+	for _, category := range TransactionTypes {
+		all = append(all, byType[category]...)
+	}
+	categorized := make(map[TransactionType][]BalancedTransaction)
+	for _, txn := range tp.WithRunningBalance(all) {
+		categorized[txn.Type] = append(categorized[txn.Type], txn)
+	}
 
 	// Write each category
-	categories := []TransactionType{PaymentTransaction, TransferTransaction, FeeTransaction}
-	for _, category := range categories {
+	for _, category := range TransactionTypes {
 		txns := categorized[category]
 		if len(txns) == 0 {
 			continue
@@ -247,8 +691,9 @@ func (tp *TransactionProcessor) GenerateLedger(transactions []Transaction, outpu
 }
 
 // writeCategory writes a single category section to the ledger file.
-// It includes a header and a formatted table of transactions.
-func (tp *TransactionProcessor) writeCategory(w io.Writer, category TransactionType, transactions []Transaction) error {
+// It includes a header and a formatted table of transactions, in the order
+// given, with the running balance of the account after each.
+func (tp *TransactionProcessor) writeCategory(w io.Writer, category TransactionType, transactions []BalancedTransaction) error {
 	// Write category header
 	if _, err := fmt.Fprintf(w, "## %s\n\n", category); err != nil {
 		return err
@@ -259,27 +704,27 @@ func (tp *TransactionProcessor) writeCategory(w io.Writer, category TransactionT
 	}
 
 	// Write table header
-	if _, err := w.Write([]byte("| Dagsetning | Tegund | Upphæð | Lýsing | PayPal Transaction ID |\n")); err != nil {
+	if _, err := w.Write([]byte("| Dagsetning | Tegund | Upphæð | Staða | Lýsing | PayPal Transaction ID |\n")); err != nil {
 		return err
 	}
-	if _, err := w.Write([]byte("|------------|--------|---------|--------|-----------------------|\n")); err != nil {
+	if _, err := w.Write([]byte("|------------|--------|---------|-------|--------|-----------------------|\n")); err != nil {
 		return err
 	}
 
-	// Sort transactions by date for better readability
-	sortedTxns := make([]Transaction, len(transactions))
-	copy(sortedTxns, transactions)
-	sort.Slice(sortedTxns, func(i, j int) bool {
-		return sortedTxns[i].Date < sortedTxns[j].Date
-	})
-
 	// Write transaction rows
-	for _, txn := range sortedTxns {
-		if _, err := fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n",
+	for _, txn := range transactions {
+		// amounts are written as they were read, and those of transactions
+		// that were not read from a file, such as the parts of a split, in full
+		amount := txn.AmountText
+		if amount == "" {
+			amount = txn.Amount.String()
+		}
+		if _, err := fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s |\n",
 			txn.Date,
 			txn.Type,
-			txn.Amount,
-			txn.Description,
+			amount,
+			txn.Balance,
+			escapeCell(txn.Description),
 			txn.TransactionID); err != nil {
 			return err
 		}
@@ -292,14 +737,20 @@ func (tp *TransactionProcessor) writeCategory(w io.Writer, category TransactionT
 	return nil
 }
 
+// escapeCell escapes the pipes of a ledger table cell, which would otherwise
+// end it
+func escapeCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
 // Process is the main entry point that orchestrates the entire transaction processing workflow.
 // It reads CSV files, categorizes transactions, and generates the ledger report.
-func (tp *TransactionProcessor) Process() error {
+func (tp *TransactionProcessor) Process(ctx context.Context) error {
 	tp.logger.Println("Starting transaction processing...")
 
 	// Read all CSV files
-	transactions, err := tp.ReadCSVFiles()
-	if err != nil {
+	transactions, err := tp.ReadCSVFiles(ctx)
+	if err != nil && !errors.Is(err, ErrNoFiles) {
 		return fmt.Errorf("failed to read CSV files: %w", err)
 	}
 
@@ -320,12 +771,12 @@ func (tp *TransactionProcessor) Process() error {
 }
 
 // Run is a convenience function that creates a processor and runs the complete workflow.
-// It's the primary entry point for using this package.
-func Run(vaultDir, ledgerDir string) error {
+// It's the primary entry point for using this package. Cancelling ctx stops reading the vault.
+func Run(ctx context.Context, vaultDir, ledgerDir string) error {
 	processor, err := NewTransactionProcessor(vaultDir, ledgerDir)
 	if err != nil {
 		return fmt.Errorf("failed to initialize processor: %w", err)
 	}
 
-	return processor.Process()
+	return processor.Process(ctx)
 }
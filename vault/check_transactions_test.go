@@ -1,10 +1,26 @@
 package vault
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 // TestNewTransactionProcessor tests the initialization of the transaction processor.
@@ -45,8 +61,42 @@ func TestNewTransactionProcessorInvalidVault(t *testing.T) {
 	ledgerDir := filepath.Join(tmpDir, "ledger")
 
 	_, err := NewTransactionProcessor(vaultDir, ledgerDir)
-	if err == nil {
-		t.Error("Expected error for non-existent vault directory, got nil")
+	if !errors.Is(err, ErrVaultDirMissing) {
+		t.Errorf("Expected ErrVaultDirMissing, got %v", err)
+	}
+}
+
+// TestNewTransactionProcessorOverlappingDirs tests that a ledger directory
+// that is, or is inside, the vault directory is refused before anything is written.
+func TestNewTransactionProcessorOverlappingDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(vaultDir, 0755)
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Symlink(vaultDir, link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	for _, ledgerDir := range []string{
+		vaultDir,
+		vaultDir + string(filepath.Separator),
+		filepath.Join(vaultDir, "ledger"),
+		link,
+		tmpDir,
+	} {
+		if _, err := NewTransactionProcessor(vaultDir, ledgerDir); !errors.Is(err, ErrOverlappingDirs) {
+			t.Errorf("Expected ErrOverlappingDirs for ledger %s, got %v", ledgerDir, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, "ledger")); !os.IsNotExist(err) {
+		t.Error("Ledger directory was created inside the vault")
+	}
+
+	if err := Run(context.Background(), vaultDir, vaultDir); !errors.Is(err, ErrOverlappingDirs) {
+		t.Errorf("Expected Run to refuse a ledger in the vault, got %v", err)
+	}
+	if err := CheckDirs(vaultDir, filepath.Join(tmpDir, "vault-ledger")); err != nil {
+		t.Errorf("Expected sibling directories to be accepted, got %v", err)
 	}
 }
 
@@ -111,6 +161,13 @@ func TestCategorizeTransaction(t *testing.T) {
 			description: "Some income",
 			expected:    PaymentTransaction,
 		},
+		{
+			name:        "Outgoing without indicator",
+			rawType:     "other",
+			amount:      "-42.00",
+			description: "Office supplies",
+			expected:    UncategorizedTransaction,
+		},
 	}
 
 	for _, tt := range tests {
@@ -149,7 +206,7 @@ func TestReadCSVFiles(t *testing.T) {
 		t.Fatalf("Failed to create processor: %v", err)
 	}
 
-	transactions, err := processor.ReadCSVFiles()
+	transactions, err := processor.ReadCSVFiles(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to read CSV files: %v", err)
 	}
@@ -182,9 +239,9 @@ func TestReadCSVFilesNoFiles(t *testing.T) {
 		t.Fatalf("Failed to create processor: %v", err)
 	}
 
-	transactions, err := processor.ReadCSVFiles()
-	if err != nil {
-		t.Fatalf("Unexpected error: %v", err)
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if !errors.Is(err, ErrNoFiles) {
+		t.Fatalf("Expected ErrNoFiles, got %v", err)
 	}
 
 	if len(transactions) != 0 {
@@ -212,21 +269,21 @@ func TestGenerateLedger(t *testing.T) {
 		{
 			Date:          "2024-01-15",
 			Type:          PaymentTransaction,
-			Amount:        "100.50",
+			Amount:        MoneyFromFloat(100.50),
 			Description:   "Product sale",
 			TransactionID: "TXN001",
 		},
 		{
 			Date:          "2024-01-16",
 			Type:          TransferTransaction,
-			Amount:        "-50.00",
+			Amount:        MoneyFromFloat(-50.00),
 			Description:   "Bank transfer",
 			TransactionID: "TXN002",
 		},
 		{
 			Date:          "2024-01-17",
 			Type:          FeeTransaction,
-			Amount:        "-2.99",
+			Amount:        MoneyFromFloat(-2.99),
 			Description:   "Processing fee",
 			TransactionID: "TXN003",
 		},
@@ -282,8 +339,8 @@ func TestGenerateLedgerNoTransactions(t *testing.T) {
 	}
 
 	err = processor.GenerateLedger([]Transaction{}, "test_ledger.md")
-	if err == nil {
-		t.Error("Expected error for empty transaction list, got nil")
+	if !errors.Is(err, ErrNoTransactions) {
+		t.Errorf("Expected ErrNoTransactions, got %v", err)
 	}
 }
 
@@ -308,10 +365,22 @@ func TestCategorizeTransactions(t *testing.T) {
 		{Type: TransferTransaction, TransactionID: "TXN003"},
 		{Type: FeeTransaction, TransactionID: "TXN004"},
 		{Type: FeeTransaction, TransactionID: "TXN005"},
+		{Type: UncategorizedTransaction, TransactionID: "TXN006"},
+		{Type: "", TransactionID: "TXN007"},
+		{Type: "Snacks", TransactionID: "TXN008"},
 	}
 
 	categorized := processor.CategorizeTransactions(transactions)
 
+	// no transaction is dropped, whatever its type
+	total := 0
+	for _, typ := range TransactionTypes {
+		total += len(categorized[typ])
+	}
+	if total != len(transactions) || len(categorized) != len(TransactionTypes) {
+		t.Errorf("Expected the %d transactions in the %d types, got %d in %d", len(transactions), len(TransactionTypes), total, len(categorized))
+	}
+
 	if len(categorized[PaymentTransaction]) != 2 {
 		t.Errorf("Expected 2 payments, got %d", len(categorized[PaymentTransaction]))
 	}
@@ -321,4 +390,1440 @@ func TestCategorizeTransactions(t *testing.T) {
 	if len(categorized[FeeTransaction]) != 2 {
 		t.Errorf("Expected 2 fees, got %d", len(categorized[FeeTransaction]))
 	}
+	if len(categorized[UncategorizedTransaction]) != 3 {
+		t.Errorf("Expected 3 uncategorized, got %d", len(categorized[UncategorizedTransaction]))
+	}
+}
+
+// TestDefaultType tests that rows matching no rule or heuristic, and
+// transactions without a known type, get the configured default type.
+func TestDefaultType(t *testing.T) {
+	csvContent := "Date,Type,Amount,Description,Transaction ID\n" +
+		"2024-01-15,Payment,100.00,Client payment,TXN001\n" +
+		"2024-01-16,,-12.00,Lunch,TXN002\n" +
+		"2024-01-17,Other,-30.00,Office chair,TXN003\n"
+	rules := []CategoryRule{{Pattern: "^client", Type: PaymentTransaction}}
+
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want TransactionType
+	}{
+		{"default", nil, UncategorizedTransaction},
+		{"configured", []Option{WithDefaultType(FeeTransaction)}, FeeTransaction},
+		{"unknown type ignored", []Option{WithDefaultType("Travel")}, UncategorizedTransaction},
+	} {
+		opts := append([]Option{WithSource(memorySource{"a.csv": []byte(csvContent)}), WithRules(rules)}, tt.opts...)
+		processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir(), opts...)
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		transactions, err := processor.ReadCSVFiles(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to read CSV files: %v", err)
+		}
+		if len(transactions) != 3 || transactions[1].Type != tt.want || transactions[2].Type != tt.want {
+			t.Errorf("%s: Expected the unmatched rows to be %s, got %+v", tt.name, tt.want, transactions)
+		}
+
+		categorized := processor.CategorizeTransactions(append(transactions, Transaction{TransactionID: "TXN004"}, Transaction{Type: "Travel", TransactionID: "TXN005"}))
+		for typ := range categorized {
+			if !typ.Valid() {
+				t.Errorf("%s: Expected only known types, got %q", tt.name, typ)
+			}
+		}
+		if got := categorized[tt.want]; len(got) != 4 || got[3].Type != tt.want {
+			t.Errorf("%s: Expected 4 transactions of type %s, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestParseTransactionType tests matching the names of the transaction types.
+func TestParseTransactionType(t *testing.T) {
+	if typ, err := ParseTransactionType(" fees "); err != nil || typ != FeeTransaction {
+		t.Errorf("ParseTransactionType(fees) = %q, %v", typ, err)
+	}
+	if _, err := ParseTransactionType("Travel"); err == nil {
+		t.Error("Expected an error for an unknown type")
+	}
+}
+
+// TestReadSingleCSVInvalidHeader tests that header problems are reported as a ParseError.
+func TestReadSingleCSVInvalidHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+
+	csvPath := filepath.Join(vaultDir, "short.csv")
+	if err := os.WriteFile(csvPath, []byte("Date,Amount\n2024-01-15,100.50\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test CSV: %v", err)
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	err = processor.readSingleCSV(context.Background(), csvPath, func(Transaction) error { return nil })
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected *ParseError, got %v", err)
+	}
+	if parseErr.File != "short.csv" || parseErr.Line != 1 {
+		t.Errorf("Expected short.csv:1, got %s:%d", parseErr.File, parseErr.Line)
+	}
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected ErrInvalidHeader, got %v", err)
+	}
+}
+
+// TestParseDate tests that dates without an offset are read in the source location.
+func TestParseDate(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+
+	for _, tt := range []struct {
+		date string
+		want time.Time
+	}{
+		{"2024-01-15", time.Date(2024, time.January, 15, 0, 0, 0, 0, loc)},
+		{"2024-01-15 23:30", time.Date(2024, time.January, 15, 23, 30, 0, 0, loc)},
+		{"2024-01-15T23:30:00Z", time.Date(2024, time.January, 15, 23, 30, 0, 0, time.UTC)},
+	} {
+		got, err := ParseDate(tt.date, loc)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", tt.date, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseDate(%q) = %v, want %v", tt.date, got, tt.want)
+		}
+	}
+
+	if _, err := ParseDate("15/01/2024", loc); err == nil {
+		t.Error("Expected an error for an unrecognized date")
+	}
+}
+
+// TestReadCSVFilesCancelled tests that a done context stops reading.
+func TestReadCSVFilesCancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultDir, "a.csv"), []byte("Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,100.50,Sale,TXN001\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test CSV: %v", err)
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := processor.ReadCSVFiles(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if err := processor.Process(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Process to return context.Canceled, got %v", err)
+	}
+}
+
+// TestReadCSVFilesGzip tests that compressed CSV files are read like plain ones,
+// and that corrupt compressed files do not stop the run.
+func TestReadCSVFilesGzip(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+
+	gzipped := func(content string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to compress CSV: %v", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("Failed to compress CSV: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	header := "Date,Type,Amount,Description,Transaction ID\n"
+	archive := gzipped(header + "2023-12-01,Payment,10.00,Old sale,TXN100\n2023-12-02,Fee,-1.00,Old fee,TXN101\n")
+	truncated := gzipped(header + "2023-11-01,Payment,20.00,Older sale,TXN200\n" + strings.Repeat("2023-11-02,Payment,1.00,Filler,TXN201\n", 2000))
+	files := map[string][]byte{
+		"current.csv":      []byte(header + "2024-01-15,Payment,100.50,Product sale,TXN001\n"),
+		"archive.csv.gz":   archive,
+		"plain.gz":         gzipped(header + "2023-10-01,Transfer,-5.00,Bank transfer,TXN300\n"),
+		"truncated.csv.gz": truncated[:len(truncated)/2],
+		"garbage.csv.gz":   []byte("not gzip at all"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(vaultDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+
+	ids := make(map[string]bool)
+	for _, txn := range transactions {
+		ids[txn.TransactionID] = true
+	}
+	for _, id := range []string{"TXN001", "TXN100", "TXN101", "TXN300", "TXN200"} {
+		if !ids[id] {
+			t.Errorf("Expected transaction %s to be read", id)
+		}
+	}
+}
+
+// TestGenerateLedgerHistory tests that regenerating a ledger keeps a bounded
+// number of previous versions.
+func TestGenerateLedgerHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	ledgerDir := filepath.Join(tmpDir, "ledger")
+
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, ledgerDir, WithLedgerHistory(2))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	for i := 1; i <= 4; i++ {
+		transactions := []Transaction{{Date: "2024-01-15", Type: PaymentTransaction, Amount: MoneyFromFloat(10.00), Description: "Sale", TransactionID: fmt.Sprintf("RUN%d", i)}}
+		if err := processor.GenerateLedger(transactions, "ledger.md"); err != nil {
+			t.Fatalf("Failed to generate ledger %d: %v", i, err)
+		}
+	}
+
+	for version, want := range []string{"RUN4", "RUN3", "RUN2"} {
+		content, err := os.ReadFile(LedgerVersionPath(ledgerDir, "ledger.md", version))
+		if err != nil {
+			t.Fatalf("Failed to read ledger version %d: %v", version, err)
+		}
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Expected ledger version %d to contain %s", version, want)
+		}
+	}
+
+	if _, err := os.Stat(LedgerVersionPath(ledgerDir, "ledger.md", 3)); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 previous versions to be kept, got error %v for version 3", err)
+	}
+	if got := filepath.Base(LedgerVersionPath(ledgerDir, "ledger.md", 1)); got != "ledger.1.md" {
+		t.Errorf("Expected previous version to be named ledger.1.md, got %s", got)
+	}
+}
+
+// TestReadCSVFilesRetry tests that transient read errors are retried while
+// permanent ones fail immediately.
+func TestReadCSVFilesRetry(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultDir, "a.csv"), []byte("Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,100.50,Sale,TXN001\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test CSV: %v", err)
+	}
+
+	defer func(orig func(string) (io.ReadCloser, error)) { openFile = orig }(openFile)
+
+	var tests = []struct {
+		name      string
+		err       error
+		failures  int
+		wantOpens int
+		wantRead  bool
+	}{
+		{"no errors", nil, 0, 1, true},
+		{"transient errors", syscall.EIO, 2, 3, true},
+		{"stale handle", &os.PathError{Op: "read", Path: "a.csv", Err: syscall.ESTALE}, 1, 2, true},
+		{"retries exhausted", syscall.EIO, 10, 4, false},
+		{"permission denied", &os.PathError{Op: "open", Path: "a.csv", Err: syscall.EACCES}, 10, 1, false},
+	}
+
+	for _, tt := range tests {
+		opens := 0
+		openFile = func(name string) (io.ReadCloser, error) {
+			opens++
+			if opens <= tt.failures {
+				return nil, tt.err
+			}
+			return os.Open(name)
+		}
+
+		processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"),
+			WithRetryPolicy(RetryPolicy{Retries: 3, Delay: time.Millisecond, MaxDelay: 2 * time.Millisecond}))
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+
+		transactions, err := processor.ReadCSVFiles(context.Background())
+		if err != nil {
+			t.Errorf("%s: Failed to read CSV files: %v", tt.name, err)
+		}
+		if opens != tt.wantOpens {
+			t.Errorf("%s: Expected %d attempts, got %d", tt.name, tt.wantOpens, opens)
+		}
+		if got := len(transactions) == 1; got != tt.wantRead {
+			t.Errorf("%s: Expected transactions read = %v, got %d transactions", tt.name, tt.wantRead, len(transactions))
+		}
+	}
+}
+
+// TestRetryPolicyDelay tests the exponential backoff between retries.
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Retries: 5, Delay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for retry, w := range want {
+		if got := p.delay(retry); got != w {
+			t.Errorf("Expected delay %s before retry %d, got %s", w, retry, got)
+		}
+	}
+}
+
+// failingReader returns err once the first n bytes have been read.
+type failingReader struct {
+	io.ReadCloser
+	n   int
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, r.err
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.n -= n
+	return n, err
+}
+
+// TestStreamCSVFiles tests that streaming sends the same transactions as
+// ReadCSVFiles, without repeating rows sent before a transient error.
+func TestStreamCSVFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	cfg := DefaultGeneratorConfig()
+	if _, err := GenerateTestData(vaultDir, cfg); err != nil {
+		t.Fatalf("Failed to generate test data: %v", err)
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"),
+		WithRetryPolicy(RetryPolicy{Retries: 3, Delay: time.Millisecond}))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	processor.logger.SetOutput(io.Discard)
+
+	want, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+
+	// fail the first read of each file partway through
+	defer func(orig func(string) (io.ReadCloser, error)) { openFile = orig }(openFile)
+	failed := make(map[string]bool)
+	openFile = func(name string) (io.ReadCloser, error) {
+		f, err := os.Open(name)
+		if err != nil || failed[name] {
+			return f, err
+		}
+		failed[name] = true
+		return &failingReader{ReadCloser: f, n: 2000, err: syscall.EIO}, nil
+	}
+
+	out := make(chan Transaction)
+	errc := make(chan error, 1)
+	go func() { errc <- processor.StreamCSVFiles(context.Background(), out) }()
+
+	var got []Transaction
+	for txn := range out {
+		got = append(got, txn)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Failed to stream CSV files: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d streamed transactions, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("Expected transaction %d to be %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+// TestStreamCSVFilesNoFiles tests that streaming an empty vault closes the channel with ErrNoFiles.
+func TestStreamCSVFilesNoFiles(t *testing.T) {
+	processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	out := make(chan Transaction)
+	if err := processor.StreamCSVFiles(context.Background(), out); !errors.Is(err, ErrNoFiles) {
+		t.Errorf("Expected ErrNoFiles, got %v", err)
+	}
+	if _, ok := <-out; ok {
+		t.Error("Expected the channel to be closed")
+	}
+}
+
+// TestPreviewCSVFiles tests that previews parse only the first rows and report the header of each field.
+func TestPreviewCSVFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+
+	files := map[string]string{
+		"a.csv":     "Dagsetning,Tegund,Upphæð,Lýsing,Auðkenni\n2024-01-15,Payment,100.50,Sale,TXN001\n2024-01-16,Fee,-2.99,Fee,TXN002\n2024-01-17,Payment,5.00,Sale,TXN003\n",
+		"b.csv":     "Date,Type,Amount,Description,Transaction ID\n2024-02-01,Payment,10.00,Sale,TXN004\n",
+		"short.csv": "Date,Amount\n2024-01-15,100.50\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(vaultDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test CSV: %v", err)
+		}
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	previews, err := processor.PreviewCSVFiles(context.Background(), "", 2)
+	if err != nil {
+		t.Fatalf("Failed to preview CSV files: %v", err)
+	}
+	if len(previews) != 3 {
+		t.Fatalf("Expected 3 previews, got %d", len(previews))
+	}
+
+	a := previews[0]
+	if a.File != "a.csv" || len(a.Transactions) != 2 || !a.Truncated {
+		t.Errorf("Expected 2 of the transactions of a.csv, truncated, got %+v", a)
+	}
+	if a.Header["amount"] != "Upphæð" || a.Header["transaction_id"] != "Auðkenni" {
+		t.Errorf("Expected the headers of a.csv by field, got %v", a.Header)
+	}
+	if b := previews[1]; len(b.Transactions) != 1 || b.Truncated || b.Error != "" {
+		t.Errorf("Expected all of b.csv, got %+v", b)
+	}
+	if short := previews[2]; !strings.Contains(short.Error, ErrInvalidHeader.Error()) {
+		t.Errorf("Expected an invalid header error for short.csv, got %q", short.Error)
+	}
+
+	previews, err = processor.PreviewCSVFiles(context.Background(), "b.csv", 2)
+	if err != nil || len(previews) != 1 || previews[0].File != "b.csv" {
+		t.Errorf("Expected only b.csv, got %+v, %v", previews, err)
+	}
+
+	for _, name := range []string{"missing.csv", "../vault/a.csv"} {
+		if _, err := processor.PreviewCSVFiles(context.Background(), name, 2); !errors.Is(err, ErrUnknownFile) {
+			t.Errorf("Expected ErrUnknownFile for %s, got %v", name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "ledger", "FK_MASTER_LEDGER.md")); !os.IsNotExist(err) {
+		t.Error("Expected no ledger to be written")
+	}
+}
+
+// TestReadCSVFilesWarnings tests that skipped rows, bad dates, duplicate IDs and unreadable files are recorded as warnings.
+func TestReadCSVFilesWarnings(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+
+	files := map[string]string{
+		"a.csv":     "Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,100.50,Sale,TXN001\n2024-01-16,Fee\nyesterday,Fee,-2.99,Fee,TXN002\n",
+		"b.csv":     "Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,100.5,Sale,TXN001\n",
+		"short.csv": "Date,Amount\n2024-01-15,100.50\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(vaultDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test CSV: %v", err)
+		}
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	if _, err := processor.ReadCSVFiles(context.Background()); err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+
+	warnings := processor.Warnings()
+	want := []struct {
+		file   string
+		line   int
+		reason string
+	}{
+		{"a.csv", 3, "wrong number of fields"},
+		{"a.csv", 4, "yesterday"},
+		{"b.csv", 2, "duplicate transaction ID TXN001, first read at a.csv:2"},
+		{"short.csv", 1, ErrInvalidHeader.Error()},
+	}
+	if len(warnings) != len(want) {
+		t.Fatalf("Expected %d warnings, got %v", len(want), warnings)
+	}
+	for i, w := range want {
+		got := warnings[i]
+		if got.File != w.file || got.Line != w.line || !strings.Contains(got.Reason, w.reason) {
+			t.Errorf("Expected warning %s:%d containing %q, got %s", w.file, w.line, w.reason, got)
+		}
+	}
+
+	os.Remove(filepath.Join(vaultDir, "short.csv"))
+	if _, err := processor.ReadCSVFiles(context.Background()); err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if got := len(processor.Warnings()); got != 3 {
+		t.Errorf("Expected the warnings of the last read only, got %v", processor.Warnings())
+	}
+}
+
+// TestReadCSVFilesOverlappingFiles tests that the transactions of overlapping
+// exports are read once, by transaction ID or, without one, by date, amount
+// and description in another file.
+func TestReadCSVFilesOverlappingFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+
+	header := "Date,Type,Amount,Description,Transaction ID\n"
+	files := map[string]string{
+		"2024-01-01_2024-01-15.csv": header +
+			"2024-01-05,Payment,100.50,Sale,TXN001\n" +
+			"2024-01-12,Fee,-2.99,PayPal fee,TXN002\n" +
+			"2024-01-14,Payment,4.50,Coffee,\n" +
+			"2024-01-14,Payment,4.50,Coffee,\n",
+		"2024-01-10_2024-01-31.csv": header +
+			"2024-01-12,Fee,-2.99,PayPal fee,TXN002\n" +
+			"2024-01-14,Payment,4.50,Coffee,\n" +
+			"2024-01-20,Payment,20.00,Sale,TXN003\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(vaultDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test CSV: %v", err)
+		}
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+
+	// both coffees of the first file are kept, as separate purchases
+	var got []string
+	for _, txn := range transactions {
+		got = append(got, txn.Date+" "+txn.Description)
+	}
+	want := []string{"2024-01-05 Sale", "2024-01-12 PayPal fee", "2024-01-14 Coffee", "2024-01-14 Coffee", "2024-01-20 Sale"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	warnings := processor.Warnings()
+	if len(warnings) != 2 || warnings[0].Kind != WarningDuplicate || warnings[0].Line != 2 || warnings[1].Kind != WarningDuplicate || warnings[1].Line != 3 {
+		t.Errorf("Expected duplicate warnings on lines 2 and 3 of the second file, got %v", warnings)
+	}
+	if counts := processor.FileCounts(); counts["2024-01-10_2024-01-31.csv"] != 1 {
+		t.Errorf("Expected 1 new transaction from the second file, got %v", counts)
+	}
+}
+
+// TestReadCSVFilesConflictingIDs tests that records sharing a transaction ID
+// but differing in amount, date or type are reported as conflicts, naming
+// both files, rather than as duplicates.
+func TestReadCSVFilesConflictingIDs(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+
+	files := map[string]string{
+		"a.csv": "Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,100.50,Sale,TXN001\n2024-01-16,Fee,-2.99,Fee,TXN002\n",
+		"b.csv": "Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,10.50,Sale,TXN001\n2024-01-17,Payment,2.99,Refund,TXN002\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(vaultDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test CSV: %v", err)
+		}
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if len(transactions) != 4 {
+		t.Errorf("Expected both records of each conflict to be kept, got %d transactions", len(transactions))
+	}
+
+	want := []string{
+		"conflicting records for transaction ID TXN001 in a.csv:2 and b.csv:2: amount 100.50 vs 10.50",
+		"conflicting records for transaction ID TXN002 in a.csv:3 and b.csv:3: amount -2.99 vs 2.99, date 2024-01-16 vs 2024-01-17, type Fees vs Payments",
+	}
+	warnings := processor.Warnings()
+	if len(warnings) != len(want) {
+		t.Fatalf("Expected %d warnings, got %v", len(want), warnings)
+	}
+	for i, w := range want {
+		if warnings[i].Reason != w {
+			t.Errorf("Expected warning %q, got %q", w, warnings[i].Reason)
+		}
+	}
+}
+
+// TestReadCSVFilesDuplicateAmountFormats tests that amounts are compared in
+// the configured number format, so that a repeat written with thousands
+// separators is a duplicate rather than a conflict.
+func TestReadCSVFilesDuplicateAmountFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+
+	files := map[string]string{
+		"a.csv": "Date;Type;Amount;Description;Transaction ID\n2024-01-15;Payment;1.234,50;Sale;TXN001\n",
+		"b.csv": "Date;Type;Amount;Description;Transaction ID\n2024-01-15;Payment;1234,50;Sale;TXN001\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(vaultDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test CSV: %v", err)
+		}
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"), WithNumberFormat(FormatComma))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if len(transactions) != 1 {
+		t.Errorf("Expected the repeat to be skipped, got %d transactions", len(transactions))
+	}
+	if warnings := processor.Warnings(); len(warnings) != 1 || warnings[0].Kind != WarningDuplicate {
+		t.Errorf("Expected a duplicate warning, got %v", warnings)
+	}
+}
+
+// TestReadCSVFilesS3 tests reading a vault from an S3 prefix, over several
+// pages of listing, on an S3-compatible endpoint.
+func TestReadCSVFilesS3(t *testing.T) {
+	objects := map[string]string{
+		"exports/a.csv":       "Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,100.50,Sale,TXN001\n",
+		"exports/b.csv":       "Date,Type,Amount,Description,Transaction ID\n2024-01-16,Fee,-2.50,Fee,TXN002\n",
+		"exports/notes.txt":   "not a CSV file",
+		"exports/missing.csv": "",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Has("list-type") {
+			// one object per page
+			var keys []string
+			for key := range objects {
+				if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			i := 0
+			if token := r.URL.Query().Get("continuation-token"); token != "" {
+				i, _ = strconv.Atoi(token)
+			}
+			fmt.Fprintf(w, "<ListBucketResult><Contents><Key>%s</Key></Contents><IsTruncated>%v</IsTruncated><NextContinuationToken>%d</NextContinuationToken></ListBucketResult>", keys[i], i+1 < len(keys), i+1)
+			return
+		}
+		content, ok := objects[strings.TrimPrefix(r.URL.Path, "/bank/")]
+		if !ok || content == "" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	processor, err := NewTransactionProcessor("s3://bank/exports", t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if len(transactions) != 2 || transactions[0].TransactionID != "TXN001" || transactions[1].TransactionID != "TXN002" {
+		t.Errorf("Expected TXN001 and TXN002, got %+v", transactions)
+	}
+
+	warnings := processor.Warnings()
+	if len(warnings) != 1 || warnings[0].File != "missing.csv" || !strings.Contains(warnings[0].Reason, "NoSuchKey") {
+		t.Errorf("Expected a warning for the missing object, got %v", warnings)
+	}
+	if isTransient(&s3Error{Status: http.StatusNotFound, Code: "NoSuchKey"}) || !isTransient(&s3Error{Status: http.StatusServiceUnavailable, Code: "SlowDown"}) {
+		t.Error("Expected only server errors to be retried")
+	}
+}
+
+// TestWithRunningBalance tests that balances accumulate from the opening balance
+// in chronological order, with ties broken by transaction ID.
+func TestWithRunningBalance(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"), WithOpeningBalance(MoneyFromFloat(1000)))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	day := func(d int) time.Time { return time.Date(2024, time.January, d, 0, 0, 0, 0, time.UTC) }
+	transactions := []Transaction{
+		{Date: "2024-01-17", Timestamp: day(17), Amount: MoneyFromFloat(-0.10), TransactionID: "TXN004"},
+		{Date: "2024-01-15", Timestamp: day(15), Amount: MoneyFromFloat(0.10), TransactionID: "TXN002"},
+		{Date: "2024-01-15", Timestamp: day(15), Amount: MoneyFromFloat(0.20), TransactionID: "TXN001"},
+		{Date: "someday", TransactionID: "TXN005"},
+		{Date: "2024-01-16", Timestamp: day(16), Amount: MoneyFromFloat(1234.505), TransactionID: "TXN003"},
+	}
+	balanced := processor.WithRunningBalance(transactions)
+
+	var got []string
+	for _, txn := range balanced {
+		got = append(got, txn.TransactionID+" "+txn.Balance.String())
+	}
+	want := []string{"TXN001 1000.20", "TXN002 1000.30", "TXN003 2234.805", "TXN004 2234.705", "TXN005 2234.705"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if transactions[0].TransactionID != "TXN004" {
+		t.Errorf("Expected the transactions passed in to be left as they were, got %+v", transactions[0])
+	}
+}
+
+// TestParseLedger tests that a generated ledger's transactions can be read back.
+func TestParseLedger(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	transactions := []Transaction{
+		{Date: "2024-01-15", Type: PaymentTransaction, Amount: MoneyFromFloat(100.50), AmountText: "$100.50", Description: "Sale | order 7", TransactionID: "TXN001"},
+		{Date: "2024-01-17", Type: FeeTransaction, Amount: MoneyFromFloat(-2.99), Description: "Processing fee", TransactionID: ""},
+	}
+	if err := processor.GenerateLedger(transactions, "ledger.md"); err != nil {
+		t.Fatalf("Failed to generate ledger: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "ledger", "ledger.md"))
+	if err != nil {
+		t.Fatalf("Failed to read ledger: %v", err)
+	}
+	// the pipe is escaped, so that the description stays in its cell
+	if !strings.Contains(string(content), `| 100.50 | Sale \| order 7 | TXN001 |`) || !strings.Contains(string(content), "| -2.99 | 97.51 | Processing fee |") {
+		t.Errorf("Expected the balances, and the pipe of the description escaped:\n%s", content)
+	}
+	got, err := ParseLedger(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to parse ledger: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d: %v", len(got), got)
+	}
+	if got[0].Description != "Sale | order 7" || got[0].TransactionID != "TXN001" || got[0].Type != PaymentTransaction || got[0].AmountText != "$100.50" || got[0].Amount != MoneyFromFloat(100.50) {
+		t.Errorf("Expected the payment with its description and amount as written, got %+v", got[0])
+	}
+	if got[1].Amount != MoneyFromFloat(-2.99) || got[1].TransactionID != "" {
+		t.Errorf("Expected the fee without an ID, got %+v", got[1])
+	}
+}
+
+// TestReadCSVFilesQuoting tests reading quoted fields with commas, line breaks
+// and escaped quotes in each dialect, from the files in testdata.
+func TestReadCSVFilesQuoting(t *testing.T) {
+	tests := []struct {
+		file    string
+		dialect CSVDialect
+		want    []string // descriptions
+		amounts []Money
+	}{
+		{
+			file:    "quoted.csv",
+			want:    []string{"Invoice 12, 13 and 14", `Order for "Acme" Inc.`, "Processing fee for order 17", "Bank transfer"},
+			amounts: []Money{MoneyFromFloat(1250), MoneyFromFloat(80), MoneyFromFloat(-2.99), MoneyFromFloat(-50)},
+		},
+		{
+			file:    "quoted.csv",
+			dialect: CSVDialect{KeepNewlines: true},
+			want:    []string{"Invoice 12, 13 and 14", `Order for "Acme" Inc.`, "Processing fee\n  for order 17", "Bank transfer"},
+		},
+		{
+			file:    "quoted_backslash.csv",
+			dialect: CSVDialect{Escape: EscapeBackslash},
+			want:    []string{`Order for "Acme", Inc.`, `Refund to C:\Users\shop`, `Fee \ unquoted`},
+		},
+		{
+			file:    "lazy_quotes.csv",
+			dialect: CSVDialect{LazyQuotes: true},
+			want:    []string{`12" vinyl record`, `Poster "limited" edition`},
+		},
+	}
+
+	for _, tt := range tests {
+		tmpDir := t.TempDir()
+		vaultDir := filepath.Join(tmpDir, "vault")
+		if err := os.MkdirAll(vaultDir, 0755); err != nil {
+			t.Fatalf("Failed to create vault directory: %v", err)
+		}
+		content, err := os.ReadFile(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(vaultDir, tt.file), content, 0644); err != nil {
+			t.Fatalf("Failed to create test CSV: %v", err)
+		}
+
+		processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"), WithCSVDialect(tt.dialect))
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		transactions, err := processor.ReadCSVFiles(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Failed to read CSV files: %v", tt.file, err)
+		}
+		if w := processor.Warnings(); len(w) != 0 {
+			t.Errorf("%s with %+v: unexpected warnings %v", tt.file, tt.dialect, w)
+		}
+
+		if len(transactions) != len(tt.want) {
+			t.Fatalf("%s with %+v: expected %d transactions, got %d: %+v", tt.file, tt.dialect, len(tt.want), len(transactions), transactions)
+		}
+		for i, txn := range transactions {
+			if txn.Description != tt.want[i] {
+				t.Errorf("%s with %+v: transaction %d description = %q, want %q", tt.file, tt.dialect, i, txn.Description, tt.want[i])
+			}
+			if tt.amounts != nil && txn.Amount != tt.amounts[i] {
+				t.Errorf("%s: transaction %d amount = %s, want %s", tt.file, i, txn.Amount, tt.amounts[i])
+			}
+		}
+	}
+}
+
+// TestReadCSVFilesQuotingWarnings tests that the line of a record after a
+// multi-line field is reported, and that stray quotes are warned about
+// without LazyQuotes.
+func TestReadCSVFilesQuotingWarnings(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+	csvContent := "Date,Type,Amount,Description,Transaction ID\n" +
+		"2024-01-15,Payment,80.00,\"Two\nlines\",TXN001\n" +
+		"2024-01-16,Payment,20.00,12\" vinyl record,TXN002\n"
+	if err := os.WriteFile(filepath.Join(vaultDir, "a.csv"), []byte(csvContent), 0644); err != nil {
+		t.Fatalf("Failed to create test CSV: %v", err)
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if len(transactions) != 1 || transactions[0].Description != "Two lines" {
+		t.Errorf("Expected the multi-line transaction only, got %+v", transactions)
+	}
+
+	warnings := processor.Warnings()
+	if len(warnings) != 1 || warnings[0].Line != 4 || !strings.Contains(warnings[0].Reason, "bare \"") {
+		t.Errorf("Expected a bare quote warning on line 4, got %v", warnings)
+	}
+}
+
+// TestReadCSVFilesDelimiters tests that the delimiter of each file is detected
+// from its header, so that comma, semicolon and tab separated files can share
+// a vault, and that an explicit delimiter applies to every file.
+func TestReadCSVFilesDelimiters(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+	files := map[string]string{
+		"a-comma.csv": "Date,Type,Amount,Description,Transaction ID\n" +
+			"2024-01-15,Payment,100.50,\"Invoice 12; 13\",TXN001\n",
+		"b-semicolon.csv": "Datum;Typ;Betrag;Beschreibung;Transaktions-ID\n" +
+			"2024-01-16;Payment;1.234,56;Rechnung 14, 15;TXN002\n",
+		"c-tab.csv": "Date\tType\tAmount\tDescription\tTransaction ID\n" +
+			"2024-01-17\t\t-2.99\tPayPal fee, monthly\tTXN003\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(vaultDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test CSV: %v", err)
+		}
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if w := processor.Warnings(); len(w) != 0 {
+		t.Errorf("Unexpected warnings %v", w)
+	}
+	want := []Transaction{
+		{Date: "2024-01-15", Amount: MoneyFromFloat(100.50), Description: "Invoice 12; 13", TransactionID: "TXN001"},
+		{Date: "2024-01-16", Amount: MoneyFromFloat(1234.56), Description: "Rechnung 14, 15", TransactionID: "TXN002"},
+		{Date: "2024-01-17", Amount: MoneyFromFloat(-2.99), Description: "PayPal fee, monthly", TransactionID: "TXN003"},
+	}
+	if len(transactions) != len(want) {
+		t.Fatalf("Expected %d transactions, got %d: %+v", len(want), len(transactions), transactions)
+	}
+	for i, w := range want {
+		got := transactions[i]
+		if got.Date != w.Date || got.Amount != w.Amount || got.Description != w.Description || got.TransactionID != w.TransactionID {
+			t.Errorf("Transaction %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	// with an explicit comma, the semicolon file has a single column
+	processor, err = NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"), WithCSVDialect(CSVDialect{Delimiter: ','}))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	if err := processor.readSingleCSV(context.Background(), filepath.Join(vaultDir, "b-semicolon.csv"), func(Transaction) error { return nil }); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected the semicolon file to have an invalid header with a comma delimiter, got %v", err)
+	}
+
+	for s, want := range map[string]rune{"": 0, "auto": 0, "semicolon": ';', "TAB": '\t', "|": '|'} {
+		if got, err := ParseDelimiter(s); err != nil || got != want {
+			t.Errorf("ParseDelimiter(%q) = %q, %v, want %q", s, got, err, want)
+		}
+	}
+	for _, s := range []string{";;", `"`, "space bar"} {
+		if _, err := ParseDelimiter(s); err == nil {
+			t.Errorf("Expected an error parsing the delimiter %q", s)
+		}
+	}
+}
+
+// TestParseQuoteEscape tests parsing the names of the quote escapes.
+func TestParseQuoteEscape(t *testing.T) {
+	if e, err := ParseQuoteEscape("backslash"); err != nil || e != EscapeBackslash {
+		t.Errorf("ParseQuoteEscape(backslash) = %q, %v", e, err)
+	}
+	if _, err := ParseQuoteEscape("single"); err == nil {
+		t.Error("Expected an error for an unknown escape")
+	}
+}
+
+// TestReadCSVFilesSignPolicy tests that amounts with the wrong sign for their
+// type are warned about, and dropped in strict mode.
+func TestReadCSVFilesSignPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+	csvContent := `Date,Type,Amount,Description,Transaction ID
+2024-01-15,Payment,100.50,Product sale,TXN001
+2024-01-16,Fee,2.99,Processing fee,TXN002
+2024-01-17,Fee,-1.00,Processing fee,TXN003
+2024-01-18,Fee,0.00,Waived fee,TXN004
+`
+	if err := os.WriteFile(filepath.Join(vaultDir, "a.csv"), []byte(csvContent), 0644); err != nil {
+		t.Fatalf("Failed to create test CSV: %v", err)
+	}
+
+	expect, err := ParseSignExpectations("fees=outflow, Payments=inflow")
+	if err != nil {
+		t.Fatalf("Failed to parse sign expectations: %v", err)
+	}
+
+	for _, strict := range []bool{false, true} {
+		processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"), WithSignPolicy(SignPolicy{Expect: expect, Strict: strict}))
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		transactions, err := processor.ReadCSVFiles(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to read CSV files: %v", err)
+		}
+
+		want := 4
+		if strict {
+			want = 3
+		}
+		if len(transactions) != want {
+			t.Errorf("strict %v: expected %d transactions, got %d", strict, want, len(transactions))
+		}
+		warnings := processor.Warnings()
+		if len(warnings) != 1 || warnings[0].Line != 3 || !strings.Contains(warnings[0].Reason, "amount 2.99 is an inflow, but Fees are expected to be outflows") {
+			t.Errorf("strict %v: expected a warning for the positive fee on line 3, got %v", strict, warnings)
+		}
+		if strict != strings.HasSuffix(warnings[0].Reason, "skipping") {
+			t.Errorf("strict %v: warning %q", strict, warnings[0].Reason)
+		}
+	}
+}
+
+// TestParseSignExpectations tests the errors of invalid sign expectations.
+func TestParseSignExpectations(t *testing.T) {
+	for _, spec := range []string{"Fees", "Refunds=inflow", "Fees=negative"} {
+		if _, err := ParseSignExpectations(spec); err == nil {
+			t.Errorf("ParseSignExpectations(%q): expected an error", spec)
+		}
+	}
+}
+
+// TestReadCSVFilesNonFiniteAmounts tests that NaN and out of range amounts are
+// warned about.
+func TestReadCSVFilesNonFiniteAmounts(t *testing.T) {
+	csvContent := "Date,Type,Amount,Description,Transaction ID\n" +
+		"2024-01-15,Payment,NaN,Odd,TXN001\n" +
+		"2024-01-16,Payment,1e400,Huge,TXN002\n" +
+		"2024-01-17,Payment,10.00,Fine,TXN003\n"
+	processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir(), WithSource(memorySource{"a.csv": []byte(csvContent)}))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if len(transactions) != 3 {
+		t.Errorf("Expected all 3 transactions to be kept, got %d", len(transactions))
+	}
+
+	warnings := processor.Warnings()
+	if len(warnings) != 2 || warnings[0].Line != 2 || warnings[1].Line != 3 || !strings.Contains(warnings[0].Reason, "not a finite number") || !strings.Contains(warnings[1].Reason, "not a finite number") {
+		t.Errorf("Expected warnings on lines 2 and 3, got %v", warnings)
+	}
+}
+
+// TestReadCSVFilesStrictness tests that malformed rows are warned about and
+// kept or dropped when lenient, and stop the read when strict.
+func TestReadCSVFilesStrictness(t *testing.T) {
+	valid := "Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,10.00,Sale,TXN001\n"
+	source := memorySource{
+		"a.csv": []byte(valid),
+		"b.csv": []byte("Date,Type,Amount,Description,Transaction ID\n" +
+			"2024-01-16,Payment,ten,Sale,TXN002\n" +
+			"2024-01-17,Payment\n" +
+			"someday,Payment,5.00,Sale,TXN003\n" +
+			"2024-01-18,Fee,2.99,PayPal fee,TXN004\n"),
+		"c.csv": []byte("Date,Amount\n2024-01-19,1.00\n"),
+	}
+	signs := SignPolicy{Expect: map[TransactionType]Sign{FeeTransaction: SignOutflow}}
+
+	processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir(), WithSource(source), WithSignPolicy(signs))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if len(transactions) != 4 {
+		t.Errorf("Expected 4 transactions when lenient, without the short row and c.csv, got %d", len(transactions))
+	}
+	kinds := make(map[WarningKind]int)
+	for _, w := range processor.Warnings() {
+		kinds[w.Kind]++
+	}
+	if kinds[WarningParse] != 3 || kinds[WarningSign] != 1 || kinds[WarningSchema] != 1 {
+		t.Errorf("Expected 3 parse, 1 sign and 1 schema warnings, got %v", processor.Warnings())
+	}
+
+	for _, tt := range []struct {
+		file string
+		line int
+		want error
+	}{
+		{"b.csv", 2, ErrMalformedRow},
+		{"c.csv", 1, ErrInvalidHeader},
+	} {
+		strict := memorySource{"a.csv": []byte(valid), tt.file: source[tt.file]}
+		processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir(), WithSource(strict), WithSignPolicy(signs), WithStrictness(StrictnessStrict))
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		transactions, err := processor.ReadCSVFiles(context.Background())
+		var parseErr *ParseError
+		if !errors.Is(err, tt.want) || !errors.As(err, &parseErr) || parseErr.File != tt.file || parseErr.Line != tt.line {
+			t.Errorf("%s: expected %v at line %d when strict, got %v", tt.file, tt.want, tt.line, err)
+		}
+		if transactions != nil {
+			t.Errorf("%s: expected no transactions when strict, got %d", tt.file, len(transactions))
+		}
+	}
+
+	// a sign mismatch also stops a strict read, even with SignPolicy.Strict
+	strict := memorySource{"a.csv": []byte("Date,Type,Amount,Description,Transaction ID\n2024-01-18,Fee,2.99,PayPal fee,TXN004\n")}
+	signs.Strict = true
+	processor, err = NewTransactionProcessor(t.TempDir(), t.TempDir(), WithSource(strict), WithSignPolicy(signs), WithStrictness(StrictnessStrict))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	if _, err := processor.ReadCSVFiles(context.Background()); !errors.Is(err, ErrMalformedRow) || !strings.Contains(err.Error(), "expected to be outflows") {
+		t.Errorf("Expected the sign mismatch to stop the read, got %v", err)
+	}
+
+	if _, err := ParseStrictness("pedantic"); err == nil {
+		t.Error("Expected an error parsing an unknown strictness")
+	}
+}
+
+// TestFileChecksums tests that each file read is checksummed as stored and
+// that its warnings have a kind.
+func TestFileChecksums(t *testing.T) {
+	csvContent := "Date,Type,Amount,Description,Transaction ID\n" +
+		"someday,Payment,10.00,Sale,TXN001\n"
+	processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir(), WithSource(memorySource{"a.csv": []byte(csvContent)}))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	if _, err := processor.ReadCSVFiles(context.Background()); err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(csvContent))
+	if got := processor.FileChecksums(); len(got) != 1 || got["a.csv"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the SHA-256 of a.csv, got %v", got)
+	}
+	if warnings := processor.Warnings(); len(warnings) != 1 || warnings[0].Kind != WarningParse {
+		t.Errorf("Expected a parse warning, got %+v", warnings)
+	}
+}
+
+// TestWithIgnore tests that ignored files are not read, listed or warned about.
+func TestWithIgnore(t *testing.T) {
+	csvContent := "Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,10.00,Sale,TXN001\n"
+	source := memorySource{
+		"a.csv":         []byte(csvContent),
+		"notes.csv":     []byte("remember to file taxes\n"),
+		"export-old.gz": []byte("not gzip"),
+	}
+	patterns, err := ParseIgnorePatterns("# not statements\nnotes*\n*.gz, ")
+	if err != nil {
+		t.Fatalf("Failed to parse ignore patterns: %v", err)
+	}
+	processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir(), WithSource(source), WithIgnore(patterns))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if len(transactions) != 1 || len(processor.Warnings()) != 0 {
+		t.Errorf("Expected 1 transaction and no warnings, got %d and %v", len(transactions), processor.Warnings())
+	}
+	files, err := processor.ListCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list CSV files: %v", err)
+	}
+	if len(files) != 1 || files[0].Name != "a.csv" {
+		t.Errorf("Expected only a.csv to be listed, got %+v", files)
+	}
+	if _, _, err := processor.OpenCSVFile(context.Background(), "notes.csv"); !errors.Is(err, ErrUnknownFile) {
+		t.Errorf("Expected ErrUnknownFile opening an ignored file, got %v", err)
+	}
+
+	if _, err := ParseIgnorePatterns("[unclosed"); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+// memorySource is a vault of CSV files held in memory.
+type memorySource map[string][]byte
+
+func (m memorySource) List(context.Context) ([]string, error) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m memorySource) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m memorySource) String() string {
+	return "memory"
+}
+
+// FuzzReadCSVFiles checks that arbitrary file contents are either read or
+// rejected with an error, whatever the dialect, and never cause a panic.
+func FuzzReadCSVFiles(f *testing.F) {
+	for _, seed := range []string{
+		"Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,150.00,Client payment,TXN001\n",
+		"Date,Type,Amount,Description,Transaction ID\n2024-01-15,Fee,-2.50,\"Fee, \"\"monthly\"\"\",TXN002\n",
+		"Date,Type,Amount,Description,Transaction ID\n\"2024-01-15\",Payment,\"1e400\",\"line\nbreak\",\n",
+		"Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,NaN,\x00,TXN003\n",
+		"Date,Type,Amount,Description,Transaction ID\n\"unterminated,Payment,1,x,y\n",
+		"Date,Type,Amount,Description,Transaction ID\n2024-13-45T25:61,Transfer,-0,‮�\U0001F600,\\\"x\\\"\n",
+		"Date,Type\n",
+		"",
+	} {
+		f.Add([]byte(seed), false, false, false)
+		f.Add([]byte(seed), true, true, true)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, backslash, lazyQuotes, keepNewlines bool) {
+		dialect := CSVDialect{LazyQuotes: lazyQuotes, KeepNewlines: keepNewlines}
+		if backslash {
+			dialect.Escape = EscapeBackslash
+		}
+		processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir(),
+			WithSource(memorySource{"fuzz.csv": data}),
+			WithCSVDialect(dialect),
+			WithSignPolicy(SignPolicy{Expect: map[TransactionType]Sign{FeeTransaction: SignOutflow}}),
+			WithLogger(log.New(io.Discard, "", 0)))
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+
+		transactions, err := processor.ReadCSVFiles(context.Background())
+		if err != nil {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Expected a *ParseError, got %T: %v", err, err)
+			}
+			return
+		}
+		for _, txn := range transactions {
+			if txn.Description != strings.TrimSpace(txn.Description) {
+				t.Errorf("Expected trimmed fields, got %+v", txn)
+			}
+		}
+	})
+}
+
+// TestReadCSVFilesDebitCredit tests that separate debit and credit columns
+// are read as signed amounts, detected from the header or configured.
+func TestReadCSVFilesDebitCredit(t *testing.T) {
+	csvContent := "Date,Type,Description,Transaction ID,Debit,Credit\n" +
+		"2024-01-15,Payment,Product sale,TXN001,,100.50\n" +
+		"2024-01-16,Transfer,Bank transfer,TXN002,50.00,\n" +
+		"2024-01-17,Other,Refunded order,TXN003,12.5,20.00\n" +
+		"2024-01-18,Fee,Waived fee,TXN004,0.00,\n"
+
+	tests := []struct {
+		name    string
+		columns AmountColumns
+		csv     string
+	}{
+		{"auto", AmountColumns{}, csvContent},
+		{"configured", AmountColumns{Mode: AmountDebitCredit, Debit: "Paid out", Credit: "paid in"},
+			strings.Replace(csvContent, "Debit,Credit", "Paid Out,Paid In", 1)},
+	}
+	for _, tt := range tests {
+		processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir(),
+			WithSource(memorySource{"a.csv": []byte(tt.csv)}), WithAmountColumns(tt.columns))
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		transactions, err := processor.ReadCSVFiles(context.Background())
+		if err != nil {
+			t.Fatalf("%s: failed to read CSV files: %v", tt.name, err)
+		}
+
+		want := []struct{ amount, id string }{{"100.50", "TXN001"}, {"-50.00", "TXN002"}, {"7.50", "TXN003"}, {"0.00", "TXN004"}}
+		if len(transactions) != len(want) {
+			t.Fatalf("%s: expected %d transactions, got %d", tt.name, len(want), len(transactions))
+		}
+		for i, w := range want {
+			if transactions[i].Amount.String() != w.amount || transactions[i].TransactionID != w.id {
+				t.Errorf("%s: expected %s with amount %s, got %s with %s", tt.name, w.id, w.amount, transactions[i].TransactionID, transactions[i].Amount)
+			}
+		}
+		if transactions[1].Type != TransferTransaction || transactions[1].Description != "Bank transfer" {
+			t.Errorf("%s: expected the other columns to be read by position, got %+v", tt.name, transactions[1])
+		}
+
+		warnings := processor.Warnings()
+		if len(warnings) != 1 || warnings[0].Line != 4 || !strings.Contains(warnings[0].Reason, "both debit") {
+			t.Errorf("%s: expected a warning for the row with both a debit and a credit, got %v", tt.name, warnings)
+		}
+	}
+}
+
+// TestReadCSVFilesAmountModes tests that a signed amount is read as before in
+// signed mode, and that debit-credit mode rejects files without the columns.
+func TestReadCSVFilesAmountModes(t *testing.T) {
+	csvContent := "Date,Type,Amount,Description,Transaction ID,Debit,Credit\n" +
+		"2024-01-15,Payment,100.50,Product sale,TXN001,,\n"
+	processor, err := NewTransactionProcessor(t.TempDir(), t.TempDir(),
+		WithSource(memorySource{"a.csv": []byte(csvContent)}), WithAmountColumns(AmountColumns{Mode: AmountSigned}))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if len(transactions) != 1 || transactions[0].Amount != MoneyFromFloat(100.50) {
+		t.Errorf("Expected the signed amount 100.50, got %v", transactions)
+	}
+
+	signed := "Date,Type,Amount,Description,Transaction ID\n2024-01-15,Payment,100.50,Product sale,TXN001\n"
+	processor, err = NewTransactionProcessor(t.TempDir(), t.TempDir(),
+		WithSource(memorySource{"a.csv": []byte(signed)}), WithAmountColumns(AmountColumns{Mode: AmountDebitCredit}))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	err = processor.readSingleCSV(context.Background(), "a.csv", func(Transaction) error { return nil })
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected ErrInvalidHeader without debit and credit columns, got %v", err)
+	}
+
+	if _, err := ParseAmountMode("both"); err == nil {
+		t.Error("Expected an error for an unknown amount mode")
+	}
+}
+
+// TestParseAmount tests amounts with currency symbols and thousands
+// separators in the different number formats.
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in       string
+		format   NumberFormat
+		want     float64
+		currency string
+	}{
+		// US
+		{"1234.56", FormatAuto, 1234.56, ""},
+		{"$1,234.56", FormatAuto, 1234.56, "USD"},
+		{"-$1,234.56", FormatPoint, -1234.56, "USD"},
+		{"$-1,234,567.89", FormatAuto, -1234567.89, "USD"},
+		{"1,234", FormatAuto, 1234, ""},
+		{"(12.50)", FormatAuto, -12.5, ""},
+		{"USD 1,000", FormatPoint, 1000, "USD"},
+		// EU
+		{"1.234,56 €", FormatAuto, 1234.56, "EUR"},
+		{"-1.234,56€", FormatComma, -1234.56, "EUR"},
+		{"1 234,56 kr", FormatAuto, 1234.56, ""},
+		{"1 234,56 kr", FormatComma, 1234.56, ""},
+		{"- 12,00 kr", FormatAuto, -12, ""},
+		{"1.234.567", FormatAuto, 1234567, ""},
+		{"1,234", FormatComma, 1.234, ""},
+		{"0,5", FormatAuto, 0.5, ""},
+		// Swiss
+		{"CHF 1'234.50", FormatAuto, 1234.5, "CHF"},
+		{"Fr. 1’234.50", FormatPoint, 1234.5, "CHF"},
+		{"-1'234.50 CHF", FormatAuto, -1234.5, "CHF"},
+		// suffixed and plain
+		{"£12", FormatAuto, 12, "GBP"},
+		{"12.00 USD", FormatAuto, 12, "USD"},
+		{".5", FormatAuto, 0.5, ""},
+		{"+3", FormatAuto, 3, ""},
+	}
+	for _, tt := range tests {
+		got, currency, err := ParseAmount(tt.in, tt.format)
+		if err != nil {
+			t.Errorf("ParseAmount(%q, %s): %v", tt.in, tt.format, err)
+			continue
+		}
+		if got != MoneyFromFloat(tt.want) || currency != tt.currency {
+			t.Errorf("ParseAmount(%q, %s) = %v %q, want %v %q", tt.in, tt.format, got, currency, tt.want, tt.currency)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "NaN", "1e400", "$12 €", "12 #", "10000000000000",
+		"--5", "+-5", "-5-", "(-5)", "+(5)", "(5", "5+", "0x1p4"} {
+		if _, _, err := ParseAmount(in, FormatAuto); err == nil {
+			t.Errorf("ParseAmount(%q): expected an error", in)
+		}
+	}
+
+	// the error says why, quoting the amount as written
+	for in, want := range map[string]string{
+		"0x1p4":          `amount "0x1p4" has unexpected characters`,
+		"٣٤":             `amount "٣٤" has no digits`,
+		"--5":            `amount "--5" has more than one sign`,
+		"10000000000000": `amount "10000000000000" is too large`,
+	} {
+		if _, _, err := ParseAmount(in, FormatAuto); err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("ParseAmount(%q) error = %v, want %s", in, err, want)
+		}
+	}
+
+	if f, err := ParseNumberFormat("CH"); err != nil || f != FormatPoint {
+		t.Errorf("ParseNumberFormat(CH) = %s, %v, want %s", f, err, FormatPoint)
+	}
+	if _, err := ParseNumberFormat("roman"); err == nil {
+		t.Error("Expected an error for an unknown number format")
+	}
 }
@@ -0,0 +1,44 @@
+package vault
+
+import (
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// teeFile is a file whose reads are also written elsewhere.
+type teeFile struct {
+	io.Reader
+	io.Closer
+}
+
+// drainChecksum reads what is left of r, so that sum has seen the whole
+// file, and returns sum in hex.
+func drainChecksum(r io.Reader, sum hash.Hash) (string, error) {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// recordChecksum records the checksum of a file read to its end.
+func (tp *TransactionProcessor) recordChecksum(file string, r io.Reader, sum hash.Hash) {
+	if tp.fileChecksums == nil {
+		return
+	}
+	if checksum, err := drainChecksum(r, sum); err == nil {
+		tp.fileChecksums[file] = checksum
+	}
+}
+
+// FileChecksums returns the SHA-256, in hex, of each file read in full the
+// last time the vault was read, by base name. The checksum is of the file as
+// stored, before decompression, so it can be compared with ListCSVFiles to
+// find files that changed since.
+func (tp *TransactionProcessor) FileChecksums() map[string]string {
+	checksums := make(map[string]string, len(tp.fileChecksums))
+	for file, sum := range tp.fileChecksums {
+		checksums[file] = sum
+	}
+	return checksums
+}
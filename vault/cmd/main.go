@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -14,7 +15,7 @@ import (
 
 func main() {
 	// Define command-line flags
-	vaultDir := flag.String("vault", "vault", "Directory containing PayPal CSV transaction files")
+	vaultDir := flag.String("vault", "vault", "Directory containing PayPal CSV transaction files, or an s3://bucket/prefix URL")
 	ledgerDir := flag.String("ledger", "ledger", "Directory for generated ledger reports")
 	help := flag.Bool("help", false, "Show usage information")
 
@@ -30,9 +31,12 @@ func main() {
 	}
 
 	// Convert to absolute paths
-	absVaultDir, err := filepath.Abs(*vaultDir)
-	if err != nil {
-		log.Fatalf("Invalid vault directory path: %v", err)
+	absVaultDir := *vaultDir
+	if !vault.IsRemote(absVaultDir) {
+		var err error
+		if absVaultDir, err = filepath.Abs(*vaultDir); err != nil {
+			log.Fatalf("Invalid vault directory path: %v", err)
+		}
 	}
 
 	absLedgerDir, err := filepath.Abs(*ledgerDir)
@@ -45,7 +49,7 @@ func main() {
 	fmt.Printf("Ledger Directory: %s\n\n", absLedgerDir)
 
 	// Run the transaction processor
-	if err := vault.Run(absVaultDir, absLedgerDir); err != nil {
+	if err := vault.Run(context.Background(), absVaultDir, absLedgerDir); err != nil {
 		log.Fatalf("Error processing transactions: %v", err)
 	}
 
@@ -0,0 +1,186 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QuoteEscape is how a quote inside a quoted CSV field is escaped.
+type QuoteEscape string
+
+const (
+	// EscapeDoubled is the RFC 4180 escape, a doubled quote: "say ""hi""".
+	EscapeDoubled QuoteEscape = "doubled"
+	// EscapeBackslash is a backslash before the quote: "say \"hi\"". A
+	// doubled backslash stands for a single one.
+	EscapeBackslash QuoteEscape = "backslash"
+)
+
+// ParseQuoteEscape parses the name of a QuoteEscape.
+func ParseQuoteEscape(s string) (QuoteEscape, error) {
+	switch e := QuoteEscape(s); e {
+	case EscapeDoubled, EscapeBackslash:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown quote escape %q, expected %s or %s", s, EscapeDoubled, EscapeBackslash)
+}
+
+// delimiterNames are the names of the field separators accepted by
+// ParseDelimiter, besides the separator itself
+var delimiterNames = map[string]rune{"comma": ',', "semicolon": ';', "tab": '\t', "pipe": '|'}
+
+// ParseDelimiter parses a field separator, such as "semicolon", "tab" or ";".
+// An empty one, or "auto", is 0, detecting the separator of each file.
+func ParseDelimiter(s string) (rune, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "" || name == "auto" {
+		return 0, nil
+	}
+	if r, ok := delimiterNames[name]; ok {
+		return r, nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == len(s) && r != utf8.RuneError && r != '"' && r != '\r' && r != '\n' {
+		return r, nil
+	}
+	return 0, fmt.Errorf("invalid delimiter %q, expected auto, comma, semicolon, tab, pipe or a single character", s)
+}
+
+// detectedDelimiters are the field separators detected from the header, the
+// first preferred on a tie
+var detectedDelimiters = []rune{',', ';', '\t'}
+
+// detectDelimiter returns the separator of the header line: the one of
+// detectedDelimiters occurring most often outside quotes, or a comma
+func detectDelimiter(header []byte) rune {
+	counts := make(map[rune]int)
+	quoted := false
+	for _, r := range string(header) {
+		if r == '"' {
+			quoted = !quoted
+		} else if !quoted {
+			counts[r]++
+		}
+	}
+	best := detectedDelimiters[0]
+	for _, r := range detectedDelimiters[1:] {
+		if counts[r] > counts[best] {
+			best = r
+		}
+	}
+	return best
+}
+
+// headerSample is the number of bytes read ahead to find the header line
+const headerSample = 4096
+
+// CSVDialect controls how fields are separated and how quotes and line breaks
+// inside them are read. The zero value reads RFC 4180 files, detecting a
+// comma, semicolon or tab separator from each file's header, and replacing
+// line breaks in quoted fields with a space so that a multi-line description
+// stays on one ledger row.
+type CSVDialect struct {
+	Delimiter    rune        // Separator of the fields, detected from each file's header when 0
+	Escape       QuoteEscape // Escape of quotes inside quoted fields, EscapeDoubled when empty
+	LazyQuotes   bool        // Accept quotes in unquoted fields and stray quotes in quoted ones
+	KeepNewlines bool        // Keep line breaks inside quoted fields as they are
+}
+
+// WithCSVDialect sets how quotes and line breaks inside CSV fields are read.
+func WithCSVDialect(d CSVDialect) Option {
+	return func(tp *TransactionProcessor) {
+		tp.dialect = d
+	}
+}
+
+// newReader returns a CSV reader for r in the dialect.
+func (d CSVDialect) newReader(r io.Reader) *csv.Reader {
+	br := bufio.NewReaderSize(r, headerSample)
+	comma := d.Delimiter
+	if comma == 0 {
+		sample, _ := br.Peek(headerSample)
+		if i := bytes.IndexByte(sample, '\n'); i >= 0 {
+			sample = sample[:i]
+		}
+		comma = detectDelimiter(sample)
+	}
+
+	r = br
+	if d.Escape == EscapeBackslash {
+		r = &backslashReader{r: br}
+	}
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	// leading spaces would swallow the empty fields of tab-separated files
+	reader.TrimLeadingSpace = !unicode.IsSpace(comma)
+	reader.LazyQuotes = d.LazyQuotes
+	return reader
+}
+
+// lineBreak matches a line break inside a field and the spaces around it.
+var lineBreak = regexp.MustCompile(`[ \t]*\r?\n[ \t]*`)
+
+// field returns a field as read in the dialect.
+func (d CSVDialect) field(s string) string {
+	if d.KeepNewlines {
+		return s
+	}
+	return lineBreak.ReplaceAllString(s, " ")
+}
+
+// backslashReader rewrites the backslash escapes inside quoted fields, \" and
+// \\, as the doubled quotes encoding/csv reads. Backslashes outside quoted
+// fields, and before any other character, are left alone.
+type backslashReader struct {
+	r       *bufio.Reader
+	quoted  bool   // inside a quoted field
+	pending []byte // rewritten bytes not yet returned
+}
+
+func (b *backslashReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(b.pending) > 0 {
+			c := copy(p[n:], b.pending)
+			b.pending = b.pending[c:]
+			n += c
+			continue
+		}
+
+		c, err := b.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		switch {
+		case c == '"':
+			b.quoted = !b.quoted
+		case c == '\\' && b.quoted:
+			next, err := b.r.ReadByte()
+			if err != nil {
+				break
+			}
+			switch next {
+			case '"':
+				b.pending = append(b.pending, '"', '"')
+				continue
+			case '\\':
+				b.pending = append(b.pending, '\\')
+				continue
+			}
+			b.r.UnreadByte()
+		}
+		p[n] = c
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,34 @@
+package vault
+
+import (
+	"fmt"
+	"time"
+)
+
+// dateLayouts are the date formats accepted in the Date column, tried in order.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// WithSourceLocation sets the time zone of dates in the CSV files that carry no
+// UTC offset of their own. The default is UTC.
+func WithSourceLocation(loc *time.Location) Option {
+	return func(tp *TransactionProcessor) {
+		tp.sourceLocation = loc
+	}
+}
+
+// ParseDate parses a transaction date. Dates without an explicit UTC offset
+// are interpreted in loc.
+func ParseDate(date string, loc *time.Location) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, date, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", date)
+}
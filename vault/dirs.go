@@ -0,0 +1,59 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckDirs returns ErrOverlappingDirs if the vault and ledger directories
+// are the same directory, or one is inside the other. A ledger written into
+// the vault could overwrite the source CSV files or be read back as input.
+// Symbolic links are resolved for the directories that exist.
+func CheckDirs(vaultDir, ledgerDir string) error {
+	v, err := resolveDir(vaultDir)
+	if err != nil {
+		return err
+	}
+	l, err := resolveDir(ledgerDir)
+	if err != nil {
+		return err
+	}
+
+	if v == l || within(v, l) || within(l, v) {
+		return fmt.Errorf("%w: vault %s, ledger %s", ErrOverlappingDirs, vaultDir, ledgerDir)
+	}
+	return nil
+}
+
+// resolveDir returns the absolute path of dir, with symbolic links resolved
+// in the part of the path that exists.
+func resolveDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid directory %s: %w", dir, err)
+	}
+
+	existing, rest := abs, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("invalid directory %s: %w", dir, err)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// within reports whether path is inside dir; both must be clean and absolute.
+func within(path, dir string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrVaultDirMissing is returned when the vault directory does not exist.
+	ErrVaultDirMissing = errors.New("vault directory does not exist")
+	// ErrNoFiles is returned when the vault directory contains no CSV files.
+	ErrNoFiles = errors.New("no CSV files found")
+	// ErrNoTransactions is returned when there are no transactions to write to a ledger.
+	ErrNoTransactions = errors.New("no transactions to write to ledger")
+	// ErrOverlappingDirs is returned when the vault and ledger directories are the same, or one holds the other.
+	ErrOverlappingDirs = errors.New("vault and ledger directories overlap")
+	// ErrUnknownFile is returned when a file is not one of the vault directory's CSV files.
+	ErrUnknownFile = errors.New("no such CSV file in the vault")
+	// ErrInvalidHeader is returned when a CSV file's header does not have the expected columns.
+	ErrInvalidHeader = errors.New("invalid CSV header")
+	// ErrMalformedRow is returned in strict mode for a row that cannot be read or parsed; see StrictnessStrict.
+	ErrMalformedRow = errors.New("malformed row")
+	// ErrFileTooLarge is returned when a compressed file decompresses to more than the limit; see ValidateCSV.
+	ErrFileTooLarge = errors.New("decompressed file is too large")
+	// ErrAmountOverflow is returned when a sum of amounts is too large for Money; see Money.Add.
+	ErrAmountOverflow = errors.New("sum of amounts is too large")
+)
+
+// ParseError describes a problem parsing a specific file, and line when known.
+type ParseError struct {
+	File string // Base name of the file being parsed
+	Line int    // Line number of the problem, or 0 if it concerns the whole file
+	Err  error  // Underlying error
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+// Unwrap returns the underlying error so errors.Is and errors.As can inspect it.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,125 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileInfo describes one of the vault's CSV files.
+type FileInfo struct {
+	Name     string    `json:"name"`               // Base name of the file
+	Size     int64     `json:"size"`               // Size in bytes, as stored; 0 for remote vaults
+	Modified time.Time `json:"modified,omitempty"` // Modification time; zero for remote vaults
+	Rows     int       `json:"rows"`               // Data rows, not counting the header
+	SHA256   string    `json:"sha256,omitempty"`   // Checksum of the file as stored, empty if it could not be read
+	Error    string    `json:"error,omitempty"`    // Why the rows could not be counted
+}
+
+// ListCSVFiles describes each of the vault's CSV files, counting their rows.
+// ErrNoFiles is returned if there are none.
+func (tp *TransactionProcessor) ListCSVFiles(ctx context.Context) ([]FileInfo, error) {
+	files, err := tp.listFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrNoFiles
+	}
+
+	infos := make([]FileInfo, 0, len(files))
+	for _, filename := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("listing CSV files cancelled: %w", err)
+		}
+
+		info := FileInfo{Name: filepath.Base(filename)}
+		if _, local := tp.source.(dirSource); local {
+			fi, err := os.Stat(filename)
+			if err != nil {
+				return nil, err
+			}
+			info.Size, info.Modified = fi.Size(), fi.ModTime()
+		}
+		if info.Rows, info.SHA256, err = tp.countRows(ctx, filename); err != nil {
+			info.Error = err.Error()
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// countRows returns the number of records after the header of a CSV file,
+// and the SHA-256 of the file as stored. Records that cannot be parsed are
+// counted too.
+func (tp *TransactionProcessor) countRows(ctx context.Context, filename string) (int, string, error) {
+	sum := sha256.New()
+	r, err := tp.openCSV(ctx, filename, sum)
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+
+	reader := tp.dialect.newReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	rows := -1 // the header
+	for {
+		_, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var csvErr *csv.ParseError
+		if err != nil && !errors.As(err, &csvErr) {
+			return max(rows, 0), "", err
+		}
+		rows++
+	}
+	checksum, err := drainChecksum(r, sum)
+	return max(rows, 0), checksum, err
+}
+
+// OpenCSVFile opens the vault's CSV file with the given base name for reading
+// as stored, without decompressing it. Only the files the vault lists can be
+// opened: ErrUnknownFile is returned for any other name, including paths.
+func (tp *TransactionProcessor) OpenCSVFile(ctx context.Context, name string) (io.ReadCloser, FileInfo, error) {
+	if name == "" || name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, FileInfo{}, fmt.Errorf("%w: %s", ErrUnknownFile, name)
+	}
+
+	files, err := tp.listFiles(ctx)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+	for _, filename := range files {
+		if filepath.Base(filename) != name {
+			continue
+		}
+
+		info := FileInfo{Name: name}
+		if _, local := tp.source.(dirSource); local {
+			// the listed file itself, not a link out of the vault
+			fi, err := os.Lstat(filename)
+			if err != nil {
+				return nil, FileInfo{}, err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil, FileInfo{}, fmt.Errorf("%w: %s is not a regular file", ErrUnknownFile, name)
+			}
+			info.Size, info.Modified = fi.Size(), fi.ModTime()
+		}
+		f, err := tp.source.Open(ctx, filename)
+		if err != nil {
+			return nil, FileInfo{}, err
+		}
+		return f, info, nil
+	}
+	return nil, FileInfo{}, fmt.Errorf("%w: %s", ErrUnknownFile, name)
+}
@@ -0,0 +1,159 @@
+package vault
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TypeWeight sets how often a transaction type appears in generated data.
+type TypeWeight struct {
+	Type   TransactionType
+	Weight int
+}
+
+// GeneratorConfig controls the synthetic data produced by GenerateTestData.
+type GeneratorConfig struct {
+	Files       int          // Number of CSV files to write
+	RowsPerFile int          // Number of transactions in each file
+	Seed        int64        // Seed for the random source; equal seeds produce identical files
+	Start       time.Time    // Earliest transaction date
+	Days        int          // Number of days after Start that transactions are spread over
+	Currencies  []string     // Currencies written to the Currency column
+	Types       []TypeWeight // Distribution of transaction types
+}
+
+// DefaultGeneratorConfig returns a configuration producing a small, realistic vault.
+func DefaultGeneratorConfig() GeneratorConfig {
+	return GeneratorConfig{
+		Files:       3,
+		RowsPerFile: 100,
+		Seed:        1,
+		Start:       time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Days:        365,
+		Currencies:  []string{"USD"},
+		Types: []TypeWeight{
+			{PaymentTransaction, 60},
+			{TransferTransaction, 15},
+			{FeeTransaction, 20},
+			{UncategorizedTransaction, 5},
+		},
+	}
+}
+
+// sample rows per type: raw type column, description, and amount range in cents
+var generatorSamples = map[TransactionType][]struct {
+	rawType     string
+	description string
+	min, max    int
+}{
+	PaymentTransaction: {
+		{"Payment", "Product sale payment", 500, 50000},
+		{"Payment", "Subscription payment", 500, 5000},
+		{"Payment", "Service payment", 10000, 200000},
+	},
+	TransferTransaction: {
+		{"Transfer", "Bank transfer", -500000, -1000},
+		{"Transfer", "Transfer to savings", -100000, -1000},
+	},
+	FeeTransaction: {
+		{"Fee", "PayPal processing fee", -1000, -10},
+		{"Fee", "International fee", -2000, -100},
+	},
+	UncategorizedTransaction: {
+		{"Other", "Office supplies", -20000, -500},
+		{"Other", "Hosting invoice", -5000, -1000},
+	},
+}
+
+// GenerateTestData writes cfg.Files CSV files of synthetic transactions to dir,
+// in the format expected by ReadCSVFiles, and returns their paths. The output
+// is deterministic for a given configuration.
+func GenerateTestData(dir string, cfg GeneratorConfig) ([]string, error) {
+	if cfg.Days <= 0 {
+		return nil, fmt.Errorf("generator days must be positive, got %d", cfg.Days)
+	}
+	if len(cfg.Currencies) == 0 {
+		return nil, fmt.Errorf("generator needs at least one currency")
+	}
+
+	totalWeight := 0
+	for _, tw := range cfg.Types {
+		if _, ok := generatorSamples[tw.Type]; !ok {
+			return nil, fmt.Errorf("cannot generate transactions of type %q", tw.Type)
+		}
+		totalWeight += tw.Weight
+	}
+	if totalWeight <= 0 {
+		return nil, fmt.Errorf("generator type weights must add up to more than zero")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	pickType := func() TransactionType {
+		n := rng.Intn(totalWeight)
+		for _, tw := range cfg.Types {
+			if n < tw.Weight {
+				return tw.Type
+			}
+			n -= tw.Weight
+		}
+		return cfg.Types[len(cfg.Types)-1].Type
+	}
+
+	var paths []string
+	id := 0
+	for f := 0; f < cfg.Files; f++ {
+		path := filepath.Join(dir, fmt.Sprintf("generated_%03d.csv", f+1))
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file: %w", err)
+		}
+
+		w := csv.NewWriter(file)
+		w.Write([]string{"Date", "Type", "Amount", "Description", "Transaction ID", "Currency"})
+		for i := 0; i < cfg.RowsPerFile; i++ {
+			id++
+			samples := generatorSamples[pickType()]
+			sample := samples[rng.Intn(len(samples))]
+			cents := sample.min + rng.Intn(sample.max-sample.min+1)
+
+			w.Write([]string{
+				cfg.Start.AddDate(0, 0, rng.Intn(cfg.Days)).Format("2006-01-02"),
+				sample.rawType,
+				formatCents(cents),
+				sample.description,
+				fmt.Sprintf("GEN%06d", id),
+				cfg.Currencies[rng.Intn(len(cfg.Currencies))],
+			})
+		}
+		w.Flush()
+
+		if err := w.Error(); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+		}
+		if err := file.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close %s: %w", filepath.Base(path), err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// formatCents formats an amount in cents as a decimal string, e.g. -1234 as -12.34.
+func formatCents(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
@@ -0,0 +1,93 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGenerateTestData tests that generated files are deterministic and parse cleanly.
+func TestGenerateTestData(t *testing.T) {
+	cfg := DefaultGeneratorConfig()
+	cfg.Files = 2
+	cfg.RowsPerFile = 50
+	cfg.Currencies = []string{"USD", "EUR", "ISK"}
+
+	first, err := GenerateTestData(filepath.Join(t.TempDir(), "a"), cfg)
+	if err != nil {
+		t.Fatalf("Failed to generate test data: %v", err)
+	}
+	second, err := GenerateTestData(filepath.Join(t.TempDir(), "b"), cfg)
+	if err != nil {
+		t.Fatalf("Failed to generate test data: %v", err)
+	}
+
+	if len(first) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(first))
+	}
+	for i := range first {
+		a, _ := os.ReadFile(first[i])
+		b, _ := os.ReadFile(second[i])
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s differs between runs with the same seed", filepath.Base(first[i]))
+		}
+	}
+
+	processor, err := NewTransactionProcessor(filepath.Dir(first[0]), filepath.Join(t.TempDir(), "ledger"))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read generated files: %v", err)
+	}
+	if len(transactions) != 100 {
+		t.Errorf("Expected 100 transactions, got %d", len(transactions))
+	}
+
+	categorized := processor.CategorizeTransactions(transactions)
+	for _, txnType := range TransactionTypes {
+		if len(categorized[txnType]) == 0 {
+			t.Errorf("Expected some %s in generated data", txnType)
+		}
+	}
+}
+
+// TestFormatCents tests conversion of cents to decimal strings.
+func TestFormatCents(t *testing.T) {
+	tests := map[int]string{0: "0.00", 5: "0.05", 1234: "12.34", -1234: "-12.34", -7: "-0.07"}
+	for cents, expected := range tests {
+		if got := formatCents(cents); got != expected {
+			t.Errorf("formatCents(%d) = %q, want %q", cents, got, expected)
+		}
+	}
+}
+
+// BenchmarkReadCSVFiles measures parsing a vault of generated files.
+func BenchmarkReadCSVFiles(b *testing.B) {
+	cfg := DefaultGeneratorConfig()
+	cfg.Files = 10
+	cfg.RowsPerFile = 1000
+
+	dir := b.TempDir()
+	if _, err := GenerateTestData(dir, cfg); err != nil {
+		b.Fatalf("Failed to generate test data: %v", err)
+	}
+
+	processor, err := NewTransactionProcessor(dir, filepath.Join(b.TempDir(), "ledger"))
+	if err != nil {
+		b.Fatalf("Failed to create processor: %v", err)
+	}
+	processor.logger.SetOutput(io.Discard)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := processor.ReadCSVFiles(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithIgnore skips the vault's files whose base name matches any of the
+// filepath.Match patterns, such as notes or stray exports. Ignored files are
+// not read, listed or warned about.
+func WithIgnore(patterns []string) Option {
+	return func(tp *TransactionProcessor) {
+		tp.ignore = patterns
+	}
+}
+
+// ParseIgnorePatterns parses a list of file patterns separated by commas or
+// newlines. Blank lines and lines starting with # are skipped.
+func ParseIgnorePatterns(content string) ([]string, error) {
+	var patterns []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, p := range strings.Split(line, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			if _, err := filepath.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid ignore pattern %q: %w", p, err)
+			}
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, nil
+}
+
+// LoadIgnorePatterns reads the patterns of an ignore file, one per line.
+// A missing file is not an error and ignores nothing.
+func LoadIgnorePatterns(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+
+	patterns, err := ParseIgnorePatterns(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return patterns, nil
+}
+
+// ignored reports whether the base name of a vault file matches an ignore pattern
+func (tp *TransactionProcessor) ignored(filename string) bool {
+	base := filepath.Base(filename)
+	for _, p := range tp.ignore {
+		if ok, _ := filepath.Match(p, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles returns the vault's CSV files, leaving out the ignored ones
+func (tp *TransactionProcessor) listFiles(ctx context.Context) ([]string, error) {
+	files, err := tp.source.List(ctx)
+	if err != nil || len(tp.ignore) == 0 {
+		return files, err
+	}
+
+	kept := make([]string, 0, len(files))
+	for _, f := range files {
+		if !tp.ignored(f) {
+			kept = append(kept, f)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,51 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultLedgerHistory is the number of previous ledger versions kept when a
+// ledger is regenerated.
+const DefaultLedgerHistory = 3
+
+// WithLedgerHistory sets how many previous versions of a ledger are kept when
+// it is regenerated. Zero keeps none.
+func WithLedgerHistory(versions int) Option {
+	return func(tp *TransactionProcessor) {
+		tp.ledgerHistory = versions
+	}
+}
+
+// LedgerVersionPath returns the path of a version of the ledger in dir:
+// version 0 is the current ledger, 1 the one it replaced, and so on. Older
+// versions carry their number before the extension, as in LEDGER.1.md.
+func LedgerVersionPath(dir, filename string, version int) string {
+	if version == 0 {
+		return filepath.Join(dir, filename)
+	}
+	ext := filepath.Ext(filename)
+	return filepath.Join(dir, fmt.Sprintf("%s.%d%s", strings.TrimSuffix(filename, ext), version, ext))
+}
+
+// rotateLedger shifts the existing versions of a ledger up by one, dropping
+// the oldest, so that the current ledger can be rewritten.
+func (tp *TransactionProcessor) rotateLedger(filename string) error {
+	if tp.ledgerHistory <= 0 {
+		return nil
+	}
+
+	for v := tp.ledgerHistory; v > 0; v-- {
+		from := LedgerVersionPath(tp.ledgerDir, filename, v-1)
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Rename(from, LedgerVersionPath(tp.ledgerDir, filename, v)); err != nil {
+			return fmt.Errorf("failed to keep previous ledger: %w", err)
+		}
+	}
+
+	return nil
+}
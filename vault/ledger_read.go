@@ -0,0 +1,59 @@
+package vault
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseLedger reads the transactions listed in a ledger written by
+// GenerateLedger. Only the columns of the ledger tables are recovered: the
+// date, type, amount, description and transaction ID; the balance column of
+// ledgers that have it is skipped, since it follows from the amounts. Pipes escaped in a description are unescaped, and a
+// description containing " | " in a ledger written before they were escaped
+// is kept whole, since the transaction ID is always the last column.
+func ParseLedger(r io.Reader) ([]Transaction, error) {
+	var transactions []Transaction
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	balance := false // whether the current table has a balance column
+	for scanner.Scan() {
+		line++
+		row := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(row, "| ") || strings.HasPrefix(row, "|--") {
+			continue
+		}
+
+		cells := strings.Split(strings.TrimSuffix(strings.TrimPrefix(row, "| "), " |"), " | ")
+		if len(cells) < 5 {
+			return nil, fmt.Errorf("ledger line %d: expected 5 columns, got %d", line, len(cells))
+		}
+		if cells[0] == "Dagsetning" {
+			balance = cells[3] == "Staða"
+			continue // table header
+		}
+
+		// amounts are kept as they were written; those that cannot be
+		// parsed read as 0
+		amount, _, _ := ParseAmount(cells[2], FormatAuto)
+		txn := Transaction{
+			Date:       cells[0],
+			Type:       TransactionType(cells[1]),
+			Amount:     amount,
+			AmountText: cells[2],
+		}
+		description := cells[3 : len(cells)-1]
+		if balance {
+			if len(cells) < 6 {
+				return nil, fmt.Errorf("ledger line %d: expected 6 columns, got %d", line, len(cells))
+			}
+			description = cells[4 : len(cells)-1]
+		}
+		txn.Description = strings.ReplaceAll(strings.Join(description, " | "), `\|`, "|")
+		txn.TransactionID = cells[len(cells)-1]
+		transactions = append(transactions, txn)
+	}
+	return transactions, scanner.Err()
+}
@@ -0,0 +1,214 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// moneyPlaces is the number of decimal places a Money holds exactly
+const moneyPlaces = 6
+
+// moneyScale is the number of units of a Money in one unit of currency
+const moneyScale = 1_000_000
+
+// Money is a monetary amount held exactly in millionths, so that summing many
+// amounts does not accumulate the rounding errors of float64, as 0.1 + 0.2
+// does; totals are exact up to about 9 trillion. The value is only rounded
+// when formatted with Format.
+type Money int64
+
+// MoneyFromFloat returns the Money nearest to f, for amounts that are not
+// read from a transaction, such as averages and thresholds
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * moneyScale))
+}
+
+// errNotDecimal and errTooLarge are the reasons a plain decimal amount
+// cannot be read, for the errors of ParseMoney and ParseAmount
+var (
+	errNotDecimal = errors.New("is not a decimal number")
+	errTooLarge   = errors.New("is too large")
+)
+
+// ParseMoney parses a plain decimal amount, such as "-1234.5678", exactly.
+// Digits past the sixth decimal place are rounded half away from zero. See
+// ParseAmount for amounts with currency symbols and thousands separators.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	v, err := parseDecimal(s)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q %w", s, err)
+	}
+	return v, nil
+}
+
+// parseDecimal parses like ParseMoney, but returns errNotDecimal or
+// errTooLarge alone, for callers that quote the amount themselves
+func parseDecimal(s string) (Money, error) {
+	if strings.ContainsAny(s, "eE") {
+		// strconv.ParseFloat also reads hexadecimal, such as "0x1.8p1e", and NaN
+		if strings.ContainsAny(s, "xXpPnN") {
+			return 0, errNotDecimal
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if errors.Is(err, strconv.ErrRange) || math.Abs(f) >= math.MaxInt64/moneyScale {
+			return 0, errTooLarge
+		}
+		if err != nil {
+			return 0, errNotDecimal
+		}
+		return MoneyFromFloat(f), nil
+	}
+
+	// a single optional sign
+	unsigned := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	negative := len(unsigned) < len(s) && s[0] == '-'
+	if len(s)-len(unsigned) > 1 {
+		return 0, errNotDecimal
+	}
+	whole, frac, _ := strings.Cut(unsigned, ".")
+	if whole == "" && frac == "" {
+		return 0, errNotDecimal
+	}
+	round := false
+	if len(frac) > moneyPlaces {
+		if strings.Trim(frac, "0123456789") != "" {
+			return 0, errNotDecimal
+		}
+		round = frac[moneyPlaces] >= '5'
+		frac = frac[:moneyPlaces]
+	}
+	digits := whole + frac + strings.Repeat("0", moneyPlaces-len(frac))
+	if strings.Trim(digits, "0123456789") != "" {
+		return 0, errNotDecimal
+	}
+	v, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, errTooLarge
+	}
+	if round {
+		if v == math.MaxInt64 {
+			return 0, errTooLarge
+		}
+		v++
+	}
+	if negative {
+		v = -v
+	}
+	return Money(v), nil
+}
+
+// Float returns the amount as a float64, for ratios and statistics
+func (m Money) Float() float64 {
+	return float64(m) / moneyScale
+}
+
+// Abs returns the absolute value of the amount
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Add returns the sum of the amounts. A sum beyond the largest amount Money
+// holds is capped at it, or at its negative, and returned with
+// ErrAmountOverflow, rather than wrapped around to the opposite sign.
+func (m Money) Add(n Money) (Money, error) {
+	switch {
+	case n > 0 && m > math.MaxInt64-n:
+		return math.MaxInt64, ErrAmountOverflow
+	case n < 0 && m < -math.MaxInt64-n:
+		return -math.MaxInt64, ErrAmountOverflow
+	}
+	return m + n, nil
+}
+
+// Div divides the amount by n, rounding half away from zero
+func (m Money) Div(n int) Money {
+	q, r := m/Money(n), m%Money(n)
+	if 2*r.Abs() >= Money(n).Abs() {
+		if (m < 0) != (n < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+// Round returns the amount rounded to the given number of decimal places,
+// half away from zero
+func (m Money) Round(places int) Money {
+	if places >= moneyPlaces {
+		return m
+	}
+	unit := Money(math.Pow10(moneyPlaces - places))
+	return m.Div(int(unit)) * unit
+}
+
+// String formats the amount with as many decimal places as it has, and at
+// least two, such as "-1234.50" or "0.125"
+func (m Money) String() string {
+	decimals := moneyPlaces
+	for v := m; decimals > 2 && v%10 == 0; v /= 10 {
+		decimals--
+	}
+	return m.Format(decimals)
+}
+
+// Format formats the amount rounded to the given number of decimal places,
+// half away from zero
+func (m Money) Format(decimals int) string {
+	sign := ""
+	v := uint64(m)
+	if m < 0 {
+		sign, v = "-", uint64(-m)
+	}
+	places := min(decimals, moneyPlaces)
+	unit := uint64(math.Pow10(moneyPlaces - places))
+	v = (v + unit/2) / unit
+
+	s := strconv.FormatUint(v, 10)
+	if places > 0 {
+		if len(s) <= places {
+			s = strings.Repeat("0", places-len(s)+1) + s
+		}
+		s = s[:len(s)-places] + "." + s[len(s)-places:]
+	}
+	if decimals > moneyPlaces {
+		s += strings.Repeat("0", decimals-moneyPlaces)
+	}
+	if strings.Trim(s, "0.") == "" {
+		sign = ""
+	}
+	return sign + s
+}
+
+// MarshalJSON encodes the amount as a JSON string with all of its decimal
+// places, see String, so that it reads back exactly
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON decodes an amount from a JSON number or a string such as
+// MarshalJSON writes, with ParseMoney
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
@@ -0,0 +1,139 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestMoneyFormat(t *testing.T) {
+	for _, tt := range []struct {
+		decimals int
+		amount   string
+		want     string
+	}{
+		{2, "1234.56", "1234.56"},
+		{2, "-2.999", "-3.00"},
+		{2, "-0.001", "0.00"},
+		{0, "99.5", "100"},
+		{3, "1.5", "1.500"},
+		{8, "0.12345678", "0.12345700"},
+	} {
+		amount, err := ParseMoney(tt.amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := amount.Format(tt.decimals); got != tt.want {
+			t.Errorf("%s.Format(%d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+// TestMoneyMarshalJSON tests that amounts are encoded with all of their
+// decimal places and read back exactly.
+func TestMoneyMarshalJSON(t *testing.T) {
+	for amount, want := range map[string]string{
+		"1234.5":    "1234.50",
+		"-0.125":    "-0.125",
+		"0.000001":  "0.000001",
+		"-12":       "-12.00",
+		"1e3":       "1000.00",
+		"0.1234565": "0.123457",
+	} {
+		m, err := ParseMoney(amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != strconv.Quote(want) {
+			t.Errorf("json.Marshal(%s) = %s, want %q", amount, b, want)
+		}
+
+		var decoded Money
+		if err := json.Unmarshal(b, &decoded); err != nil || decoded != m {
+			t.Errorf("json.Unmarshal(%s) = %v, %v, want %v", b, decoded, err, m)
+		}
+	}
+
+	// stored amounts are canonical decimals, not read in a number format
+	var m Money
+	if err := json.Unmarshal([]byte(`"0,500"`), &m); err == nil {
+		t.Errorf(`json.Unmarshal("0,500") = %v, want an error`, m)
+	}
+	if err := json.Unmarshal([]byte(`12.5`), &m); err != nil || m != 12500000 {
+		t.Errorf("json.Unmarshal(12.5) = %d, %v, want 12500000", m, err)
+	}
+}
+
+func TestMoneyAdd(t *testing.T) {
+	tests := []struct {
+		a, b     Money
+		want     Money
+		overflow bool
+	}{
+		{MoneyFromFloat(1.5), MoneyFromFloat(-2.25), MoneyFromFloat(-0.75), false},
+		{math.MaxInt64 - 1, 1, math.MaxInt64, false},
+		{math.MaxInt64, 1, math.MaxInt64, true},
+		{-math.MaxInt64 + 1, -1, -math.MaxInt64, false},
+		{-math.MaxInt64, -1, -math.MaxInt64, true},
+		{math.MaxInt64, -math.MaxInt64, 0, false},
+		// two amounts of 9e12 do not fit, and are not wrapped around
+		{MoneyFromFloat(9e12), MoneyFromFloat(9e12), math.MaxInt64, true},
+		{MoneyFromFloat(-9e12), MoneyFromFloat(-9e12), -math.MaxInt64, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.a.Add(tt.b)
+		if got != tt.want || errors.Is(err, ErrAmountOverflow) != tt.overflow {
+			t.Errorf("Money(%d).Add(%d) = %d, %v, want %d, overflow %t", tt.a, tt.b, got, err, tt.want, tt.overflow)
+		}
+	}
+}
+
+func TestParseMoneyInvalid(t *testing.T) {
+	for _, amount := range []string{"", "-", "+-5", "--5", "-+5", "++5", "1.2.3", "12a", "9223372036854.7758075"} {
+		if m, err := ParseMoney(amount); err == nil {
+			t.Errorf("ParseMoney(%q) = %v, want an error", amount, m)
+		}
+	}
+	for amount, want := range map[string]string{"+5": "5.00", "-5": "-5.00", "9223372036854.775807": "9223372036854.775807"} {
+		if m, err := ParseMoney(amount); err != nil || m.String() != want {
+			t.Errorf("ParseMoney(%q) = %v, %v, want %s", amount, m, err, want)
+		}
+	}
+}
+
+// TestParseMoney tests that amounts are parsed and divided exactly.
+func TestParseMoney(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want Money
+	}{
+		{"0.1", 100000},
+		{"-12.5", -12500000},
+		{"1.0000005", 1000001},
+		{"-1.0000005", -1000001},
+		{".5", 500000},
+		{"1e3", 1000000000},
+	} {
+		if got, err := ParseMoney(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "abc", "1.2.3", "99999999999999999999"} {
+		if _, err := ParseMoney(in); err == nil {
+			t.Errorf("ParseMoney(%q) succeeded, want an error", in)
+		}
+	}
+
+	if got := MoneyFromFloat(10).Div(3); got != 3333333 {
+		t.Errorf("10 / 3 = %d, want 3333333", got)
+	}
+	if got := MoneyFromFloat(-0.000005).Div(2); got != -3 {
+		t.Errorf("-0.000005 / 2 = %d, want -3", got)
+	}
+}
@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Normalizer cleans up noisy bank descriptions, such as
+// "POS 1234 *AMZN MKTP DE*12/03", before they are matched against the
+// categorization rules and compared for suggestions. The steps run in the
+// order of the fields.
+type Normalizer struct {
+	Lowercase          bool     `json:"lowercase"`           // Lowercase the description
+	Strip              []string `json:"strip"`               // Regular expressions whose matches are replaced by a space, in order
+	CollapseWhitespace bool     `json:"collapse_whitespace"` // Trim and collapse runs of whitespace into a single space
+
+	strip []*regexp.Regexp
+}
+
+// defaultStrip removes everything but letters, including reference numbers and dates.
+var defaultStrip = []string{`[^\p{L}]+`}
+
+// DefaultNormalizer returns the normalizer used unless one is configured: it
+// lowercases descriptions and keeps only their letters, so that
+// "POS 1234 *AMZN MKTP DE*12/03" becomes "pos amzn mktp de".
+func DefaultNormalizer() Normalizer {
+	n, err := NewNormalizer(true, append([]string(nil), defaultStrip...), true)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+var defaultNormalizer = DefaultNormalizer()
+
+// NewNormalizer creates a validated normalizer with the given steps.
+func NewNormalizer(lowercase bool, strip []string, collapseWhitespace bool) (Normalizer, error) {
+	n := Normalizer{Lowercase: lowercase, Strip: strip, CollapseWhitespace: collapseWhitespace}
+	if err := n.compile(); err != nil {
+		return Normalizer{}, err
+	}
+	return n, nil
+}
+
+// compile validates the strip patterns and prepares their regular expressions.
+func (n *Normalizer) compile() error {
+	n.strip = make([]*regexp.Regexp, 0, len(n.Strip))
+	for _, pattern := range n.Strip {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid strip pattern %q: %w", pattern, err)
+		}
+		n.strip = append(n.strip, re)
+	}
+	return nil
+}
+
+// Normalize returns the normalized form of a description.
+func (n Normalizer) Normalize(description string) string {
+	if n.Lowercase {
+		description = strings.ToLower(description)
+	}
+	for _, re := range n.strip {
+		description = re.ReplaceAllString(description, " ")
+	}
+	if n.CollapseWhitespace {
+		description = strings.Join(strings.Fields(description), " ")
+	}
+	return description
+}
+
+// WithNormalizer sets how descriptions are normalized before categorization.
+func WithNormalizer(n Normalizer) Option {
+	return func(tp *TransactionProcessor) {
+		tp.normalizer = n
+	}
+}
+
+// ParseNormalizer decodes and validates a normalizer in the JSON format of the
+// normalization file. Fields left out keep their default, so
+// {"strip": ["\\d+"]} only replaces the strip patterns.
+func ParseNormalizer(content []byte) (Normalizer, error) {
+	n := DefaultNormalizer()
+	if err := json.Unmarshal(content, &n); err != nil {
+		return Normalizer{}, fmt.Errorf("failed to parse normalization: %w", err)
+	}
+	if err := n.compile(); err != nil {
+		return Normalizer{}, err
+	}
+	return n, nil
+}
+
+// LoadNormalizer reads a normalizer from a JSON file.
+// A missing file is not an error and yields the default normalizer.
+func LoadNormalizer(path string) (Normalizer, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultNormalizer(), nil
+	}
+	if err != nil {
+		return Normalizer{}, fmt.Errorf("failed to read normalization file: %w", err)
+	}
+
+	n, err := ParseNormalizer(content)
+	if err != nil {
+		return Normalizer{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return n, nil
+}
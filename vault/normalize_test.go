@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// messyNormalizer strips the card prefixes, reference numbers and dates seen in real bank exports.
+func messyNormalizer(t *testing.T) Normalizer {
+	t.Helper()
+	n, err := NewNormalizer(true, []string{`\b(pos|visa|card)\b`, `[*#]`, `[\d/.-]*\d[\d/.-]*`}, true)
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	return n
+}
+
+// TestNormalizer tests the default and a configured normalization of messy descriptions.
+func TestNormalizer(t *testing.T) {
+	tests := []struct {
+		input, defaults, configured string
+	}{
+		{"POS 1234 *AMZN MKTP DE*12/03", "pos amzn mktp de", "amzn mktp de"},
+		{"VISA 4921 SQ *BLUE BOTTLE COF  San Francisco CA", "visa sq blue bottle cof san francisco ca", "sq blue bottle cof san francisco ca"},
+		{"PAYPAL *NETFLIX.COM 402-935-7733", "paypal netflix com", "paypal netflix.com"},
+		{"ÁTVR Kringlan 12.03.2024 ref#88812", "átvr kringlan ref", "átvr kringlan ref"},
+	}
+
+	configured := messyNormalizer(t)
+	for _, tt := range tests {
+		if got := DefaultNormalizer().Normalize(tt.input); got != tt.defaults {
+			t.Errorf("Default normalization of %q = %q, want %q", tt.input, got, tt.defaults)
+		}
+		if got := configured.Normalize(tt.input); got != tt.configured {
+			t.Errorf("Configured normalization of %q = %q, want %q", tt.input, got, tt.configured)
+		}
+	}
+
+	if got := (Normalizer{}).Normalize(" Kept  As Is "); got != " Kept  As Is " {
+		t.Errorf("Expected the zero normalizer to change nothing, got %q", got)
+	}
+}
+
+// TestParseNormalizer tests that unset fields keep their defaults and invalid patterns are rejected.
+func TestParseNormalizer(t *testing.T) {
+	n, err := ParseNormalizer([]byte(`{"strip": ["\\d+"]}`))
+	if err != nil {
+		t.Fatalf("Failed to parse normalizer: %v", err)
+	}
+	if got := n.Normalize("  Hosting  INV-2024 "); got != "hosting inv-" {
+		t.Errorf("Expected lowercasing and whitespace collapsing to be kept, got %q", got)
+	}
+
+	if _, err := ParseNormalizer([]byte(`{"strip": ["("]}`)); err == nil {
+		t.Error("Expected an error for an invalid strip pattern")
+	}
+
+	n, err = LoadNormalizer(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("Expected a missing file to yield the default normalizer, got %v", err)
+	}
+	if got := n.Normalize("POS 1234 *AMZN"); got != "pos amzn" {
+		t.Errorf("Expected the default normalization, got %q", got)
+	}
+}
+
+// TestReadCSVFilesNormalizer tests that rules match the normalized description while the raw one is kept.
+func TestReadCSVFilesNormalizer(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.MkdirAll(vaultDir, 0755); err != nil {
+		t.Fatalf("Failed to create vault directory: %v", err)
+	}
+	csv := "Date,Type,Amount,Description,Transaction ID\n" +
+		"2024-03-12,Other,-23.99,POS 1234 *AMZN MKTP DE*12/03,TXN001\n" +
+		"2024-03-14,Other,-50.00,Office supplies,TXN002\n"
+	if err := os.WriteFile(filepath.Join(vaultDir, "a.csv"), []byte(csv), 0644); err != nil {
+		t.Fatalf("Failed to create test CSV: %v", err)
+	}
+
+	rule, err := NewCategoryRule("^amzn mktp", FeeTransaction)
+	if err != nil {
+		t.Fatalf("Failed to create rule: %v", err)
+	}
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"),
+		WithRules([]CategoryRule{rule}), WithNormalizer(messyNormalizer(t)))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	transactions, err := processor.ReadCSVFiles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read CSV files: %v", err)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(transactions))
+	}
+
+	amzn := transactions[0]
+	if amzn.Description != "POS 1234 *AMZN MKTP DE*12/03" || amzn.NormalizedDescription != "amzn mktp de" {
+		t.Errorf("Expected the raw and normalized descriptions, got %q and %q", amzn.Description, amzn.NormalizedDescription)
+	}
+	if amzn.Type != FeeTransaction {
+		t.Errorf("Expected the rule to match the normalized description, got %s", amzn.Type)
+	}
+	if transactions[1].Type != UncategorizedTransaction {
+		t.Errorf("Expected %s, got %s", UncategorizedTransaction, transactions[1].Type)
+	}
+}
+
+// TestSuggestCategoriesNormalized tests that suggestions group descriptions by their normalized form.
+func TestSuggestCategoriesNormalized(t *testing.T) {
+	n := messyNormalizer(t)
+	txn := func(typ TransactionType, description, id string) Transaction {
+		return Transaction{Type: typ, Description: description, NormalizedDescription: n.Normalize(description), TransactionID: id}
+	}
+	transactions := []Transaction{
+		txn(FeeTransaction, "PAYPAL *NETFLIX.COM 402-935-7733", "TXN001"),
+		txn(UncategorizedTransaction, "PAYPAL *NETFLIX.COM 866-579-7172", "TXN002"),
+	}
+
+	suggestions := SuggestCategories(transactions)
+	if len(suggestions) != 1 {
+		t.Fatalf("Expected 1 suggestion, got %d", len(suggestions))
+	}
+	if s := suggestions[0]; s.Score != 1 || s.Pattern != `^paypal netflix\.com$` {
+		t.Errorf("Expected an exact match with pattern %q, got score %v and pattern %q", `^paypal netflix\.com$`, s.Score, s.Pattern)
+	}
+}
@@ -0,0 +1,85 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Columns lists, in order, the transaction fields read from the columns of
+// a CSV file. Columns are matched by position, not by header name.
+var Columns = []string{"date", "type", "amount", "description", "transaction_id"}
+
+// FilePreview holds the first rows of a CSV file, parsed as they would be
+// when the vault is processed.
+type FilePreview struct {
+	File         string            `json:"file"`         // Base name of the file
+	Header       map[string]string `json:"header"`       // Header of the column each field is read from
+	Transactions []Transaction     `json:"transactions"` // Parsed transactions, at most the requested number
+	Truncated    bool              `json:"truncated"`    // The file has more rows than were parsed
+	Error        string            `json:"error,omitempty"`
+}
+
+// errPreviewDone stops reading a file once enough rows have been previewed.
+var errPreviewDone = errors.New("preview complete")
+
+// PreviewCSVFiles parses at most rows transactions of each CSV file in the
+// vault directory, or only of the file with the given base name if file is
+// not empty, without writing anything. A file that cannot be parsed is
+// reported in its preview's Error. ErrUnknownFile is returned if file is not
+// one of the vault's CSV files, and ErrNoFiles if there are none.
+func (tp *TransactionProcessor) PreviewCSVFiles(ctx context.Context, file string, rows int) ([]FilePreview, error) {
+	files, err := tp.listFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrNoFiles
+	}
+
+	if file != "" {
+		var found []string
+		for _, f := range files {
+			if filepath.Base(f) == file {
+				found = append(found, f)
+			}
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownFile, file)
+		}
+		files = found
+	}
+
+	previews := make([]FilePreview, 0, len(files))
+	for _, filename := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("previewing CSV files cancelled: %w", err)
+		}
+
+		p := FilePreview{File: filepath.Base(filename), Transactions: []Transaction{}}
+		err := tp.readCSV(ctx, filename, func(headers []string) {
+			p.Header = make(map[string]string, len(Columns))
+			for i, field := range Columns {
+				p.Header[field] = strings.TrimSpace(headers[i])
+			}
+		}, func(txn Transaction) error {
+			if len(p.Transactions) == rows {
+				p.Truncated = true
+				return errPreviewDone
+			}
+			p.Transactions = append(p.Transactions, txn)
+			return nil
+		})
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("previewing CSV files cancelled: %w", ctxErr)
+		}
+		if err != nil && !errors.Is(err, errPreviewDone) {
+			p.Error = err.Error()
+		}
+		previews = append(previews, p)
+	}
+
+	return previews, nil
+}
@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how reading a CSV file is retried after a transient
+// error, such as EIO or a stale NFS file handle. Delays double after every
+// attempt, up to MaxDelay.
+type RetryPolicy struct {
+	Retries  int           // Retries after the first attempt; 0 disables retrying
+	Delay    time.Duration // Delay before the first retry
+	MaxDelay time.Duration // Upper bound on the delay between retries
+}
+
+// DefaultRetryPolicy retries a file three times, waiting 100ms, 200ms and 400ms.
+var DefaultRetryPolicy = RetryPolicy{Retries: 3, Delay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+// WithRetryPolicy sets how reading a CSV file is retried after transient errors.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(tp *TransactionProcessor) {
+		tp.retry = p
+	}
+}
+
+// delay returns the delay before the given retry, counting from 0.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.Delay
+	for i := 0; i < retry && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// transientErrors are the errors worth retrying a read for; anything else,
+// such as a missing file or denied permission, fails immediately.
+var transientErrors = []error{syscall.EIO, syscall.ESTALE, syscall.EAGAIN, syscall.EINTR, syscall.ETIMEDOUT}
+
+// isTransient reports whether err may go away when the read is retried.
+func isTransient(err error) bool {
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+		return false
+	}
+	var t interface{ transient() bool }
+	if errors.As(err, &t) {
+		return t.transient()
+	}
+	for _, t := range transientErrors {
+		if errors.Is(err, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// openFile opens a vault file for reading; tests replace it to simulate
+// unreliable storage.
+var openFile = func(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// readCSVWithRetry reads a single CSV file like readSingleCSV, retrying
+// transient errors according to the processor's retry policy. Transactions
+// emitted before a retry are not emitted again.
+func (tp *TransactionProcessor) readCSVWithRetry(ctx context.Context, filename string, emit func(Transaction) error) error {
+	emitted := 0
+	for retry := 0; ; retry++ {
+		seen := 0
+		err := tp.readSingleCSV(ctx, filename, func(txn Transaction) error {
+			seen++
+			if seen <= emitted {
+				return nil
+			}
+			emitted++
+			return emit(txn)
+		})
+		if err == nil || retry >= tp.retry.Retries || !isTransient(err) {
+			return err
+		}
+
+		delay := tp.retry.delay(retry)
+		tp.logger.Printf("Warning: Transient error reading %s, retrying in %s (%d/%d): %v", filepath.Base(filename), delay, retry+1, tp.retry.Retries, err)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package vault
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// CategoryRule assigns a transaction type, and optionally a category under
+// it, to every transaction whose normalized description matches Pattern and
+// whose amount meets the Amount condition, if the rule has one.
+type CategoryRule struct {
+	Pattern     string          `json:"pattern"`                // Regular expression matched against the normalized description
+	Amount      string          `json:"amount,omitempty"`       // Condition on the signed amount, such as "< 0", ">= 100" or "= 12.00"
+	Priority    int             `json:"priority,omitempty"`     // Rules with a higher priority are checked first, those of equal priority in order
+	Type        TransactionType `json:"type"`                   // Category assigned when the pattern matches
+	Category    string          `json:"category,omitempty"`     // Full category path, such as "Fees > BankFees > WireFee"; its first level is Type, which may then be left out
+	Internal    bool            `json:"internal,omitempty"`     // Marks matches as transfers between the user's own accounts
+	TaxCategory string          `json:"tax_category,omitempty"` // Tax treatment of matches, such as "Deductible", independent of their type and category
+
+	re       *regexp.Regexp
+	amountOp string // comparison of the Amount condition, "" without one
+	amount   Money  // value the amount is compared to
+}
+
+// amountOperators are the comparisons of an amount condition, longest first
+var amountOperators = []string{"<=", ">=", "!=", "<", ">", "="}
+
+// parseAmountCondition parses an amount condition: a comparison followed by
+// a plain decimal, such as "<= -50.00". A bare number compares with "=".
+func parseAmountCondition(s string) (string, Money, error) {
+	s = strings.TrimSpace(s)
+	op := "="
+	for _, o := range amountOperators {
+		if rest, ok := strings.CutPrefix(s, o); ok {
+			op, s = o, strings.TrimSpace(rest)
+			break
+		}
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid amount condition %q, expected a comparison such as \"< 0\" or \">= 100\"", s)
+	}
+	return op, v, nil
+}
+
+// compile validates the rule and prepares its regular expression.
+func (r *CategoryRule) compile() error {
+	r.TaxCategory = strings.TrimSpace(r.TaxCategory)
+	if r.Category != "" {
+		levels, err := ParseCategory(r.Category)
+		if err != nil {
+			return err
+		}
+		if r.Type == "" {
+			r.Type = TransactionType(levels[0])
+		}
+		if string(r.Type) != levels[0] {
+			return fmt.Errorf("category %q is not under type %q", r.Category, r.Type)
+		}
+		r.Category = strings.Join(levels, CategorySeparator)
+	}
+
+	if !r.Type.Valid() {
+		return fmt.Errorf("unknown transaction type %q", r.Type)
+	}
+
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", r.Pattern, err)
+	}
+	r.re = re
+
+	r.amountOp = ""
+	if strings.TrimSpace(r.Amount) != "" {
+		if r.amountOp, r.amount, err = parseAmountCondition(r.Amount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether the rule applies to the given raw description,
+// normalized with NormalizeDescription.
+func (r CategoryRule) Matches(description string) bool {
+	return r.MatchesNormalized(NormalizeDescription(description))
+}
+
+// MatchesNormalized reports whether the rule applies to an already normalized description.
+func (r CategoryRule) MatchesNormalized(normalized string) bool {
+	if r.re == nil {
+		if err := r.compile(); err != nil {
+			return false
+		}
+	}
+	return r.re.MatchString(normalized)
+}
+
+// MatchesAmount reports whether amount meets the rule's amount condition,
+// which every amount meets when the rule has none.
+func (r CategoryRule) MatchesAmount(amount Money) bool {
+	if strings.TrimSpace(r.Amount) == "" {
+		return true
+	}
+	if r.re == nil {
+		if err := r.compile(); err != nil {
+			return false
+		}
+	}
+	switch r.amountOp {
+	case "<":
+		return amount < r.amount
+	case "<=":
+		return amount <= r.amount
+	case ">":
+		return amount > r.amount
+	case ">=":
+		return amount >= r.amount
+	case "!=":
+		return amount != r.amount
+	}
+	return amount == r.amount
+}
+
+// NewCategoryRule creates a validated rule for the given pattern and type.
+func NewCategoryRule(pattern string, transactionType TransactionType) (CategoryRule, error) {
+	rule := CategoryRule{Pattern: pattern, Type: transactionType}
+	if err := rule.compile(); err != nil {
+		return CategoryRule{}, err
+	}
+	return rule, nil
+}
+
+// MatchRules returns the index of the first rule matching description, by
+// priority, and false if no rule matches. Rules with an amount condition
+// never match, as the amount is unknown; see MatchTransactionRules.
+func MatchRules(rules []CategoryRule, description string) (int, bool) {
+	return MatchNormalizedRules(rules, NormalizeDescription(description))
+}
+
+// MatchNormalizedRules is MatchRules for an already normalized description.
+func MatchNormalizedRules(rules []CategoryRule, normalized string) (int, bool) {
+	return MatchTransactionRules(rules, normalized, nil)
+}
+
+// MatchTransactionRules returns the index of the first rule, by priority,
+// matching a normalized description and a signed amount, and false if no
+// rule matches. A nil amount is unknown, and meets no amount condition.
+func MatchTransactionRules(rules []CategoryRule, normalized string, amount *Money) (int, bool) {
+	order := priorityOrder(rules)
+	for n := range rules {
+		i := n
+		if order != nil {
+			i = order[n]
+		}
+		if !rules[i].MatchesNormalized(normalized) {
+			continue
+		}
+		if amount == nil && strings.TrimSpace(rules[i].Amount) == "" || amount != nil && rules[i].MatchesAmount(*amount) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// priorityOrder returns the indexes of rules from the highest priority to the
+// lowest, keeping the order of the rules of equal priority, or nil when the
+// rules are already in that order, as when none has a priority.
+func priorityOrder(rules []CategoryRule) []int {
+	sorted := slices.IsSortedFunc(rules, func(a, b CategoryRule) int { return cmp.Compare(b.Priority, a.Priority) })
+	if sorted {
+		return nil
+	}
+	order := make([]int, len(rules))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(rules[b].Priority, rules[a].Priority) })
+	return order
+}
+
+// matchRule returns the first rule matching a normalized description and a
+// signed amount, nil when it is unknown.
+func matchRule(rules []CategoryRule, normalized string, amount *Money) (CategoryRule, bool) {
+	if i, ok := MatchTransactionRules(rules, normalized, amount); ok {
+		return rules[i], true
+	}
+	return CategoryRule{}, false
+}
+
+// ParseRules decodes and validates categorization rules in the JSON format of the rules file.
+func ParseRules(content []byte) ([]CategoryRule, error) {
+	var rules []CategoryRule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// ParseRulesYAML decodes and validates categorization rules written in YAML,
+// with the same fields as the JSON format of ParseRules.
+func ParseRulesYAML(content []byte) ([]CategoryRule, error) {
+	content, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	return ParseRules(content)
+}
+
+// isYAML reports whether a rules file is written in YAML, by its extension
+func isYAML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// LoadRules reads categorization rules from a JSON file, or a YAML file if
+// its name ends in .yaml or .yml.
+// A missing file is not an error and yields no rules.
+func LoadRules(path string) ([]CategoryRule, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	parse := ParseRules
+	if isYAML(path) {
+		parse = ParseRulesYAML
+	}
+	rules, err := parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+// SaveRules writes categorization rules to a JSON file, or a YAML file as
+// LoadRules reads them, replacing its contents.
+func SaveRules(path string, rules []CategoryRule) error {
+	content, err := json.MarshalIndent(rules, "", "  ")
+	if err == nil && isYAML(path) {
+		content, err = yaml.JSONToYAML(content)
+		content = bytes.TrimSuffix(content, []byte("\n"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode rules: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write rules file: %w", err)
+	}
+
+	return nil
+}
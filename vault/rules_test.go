@@ -0,0 +1,228 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCategorizeTransactionWithRules tests that rules take precedence over the heuristics.
+func TestCategorizeTransactionWithRules(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(vaultDir, 0755)
+
+	rule, err := NewCategoryRule("office supplies", FeeTransaction)
+	if err != nil {
+		t.Fatalf("Failed to create rule: %v", err)
+	}
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"), WithRules([]CategoryRule{rule}))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	if got := processor.categorizeTransaction("other", "-42.00", "OFFICE SUPPLIES #1234"); got != FeeTransaction {
+		t.Errorf("Expected %s, got %s", FeeTransaction, got)
+	}
+	if got := processor.categorizeTransaction("other", "-42.00", "Lunch"); got != UncategorizedTransaction {
+		t.Errorf("Expected %s, got %s", UncategorizedTransaction, got)
+	}
+}
+
+// TestSaveAndLoadRules tests that rules survive a round trip through the rules file.
+func TestSaveAndLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("Unexpected error for missing rules file: %v", err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("Expected no rules, got %d", len(rules))
+	}
+
+	rule, err := NewCategoryRule("^office supplies$", FeeTransaction)
+	if err != nil {
+		t.Fatalf("Failed to create rule: %v", err)
+	}
+	if err := SaveRules(path, []CategoryRule{rule}); err != nil {
+		t.Fatalf("Failed to save rules: %v", err)
+	}
+
+	rules, err = LoadRules(path)
+	if err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Pattern != rule.Pattern || rules[0].Type != FeeTransaction {
+		t.Errorf("Unexpected rules after round trip: %+v", rules)
+	}
+}
+
+// TestLoadRulesYAML tests that rules files ending in .yaml or .yml are read
+// and written as YAML.
+func TestLoadRulesYAML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.yaml")
+	content := `# fees first
+- pattern: "^wire fee"
+  type: Fees
+  category: Fees > BankFees
+  amount: "< 0"
+  priority: 10
+- pattern: transfer
+  type: Transfers
+  internal: true
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+	if len(rules) != 2 || rules[0].Category != "Fees > BankFees" || rules[0].Priority != 10 || rules[0].Amount != "< 0" || !rules[1].Internal {
+		t.Fatalf("Unexpected rules: %+v", rules)
+	}
+	if i, ok := MatchTransactionRules(rules, "wire fee", nil); ok {
+		t.Errorf("Expected the amount condition to need an amount, matched rule %d", i)
+	}
+
+	// saved as YAML, not JSON, and read back the same
+	yml := filepath.Join(dir, "rules.yml")
+	if err := SaveRules(yml, rules); err != nil {
+		t.Fatalf("Failed to save rules: %v", err)
+	}
+	saved, err := os.ReadFile(yml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(saved), "pattern: ^wire fee") {
+		t.Errorf("Expected YAML, got:\n%s", saved)
+	}
+	again, err := LoadRules(yml)
+	if err != nil || len(again) != 2 || again[0].Pattern != "^wire fee" || again[1].Type != TransferTransaction {
+		t.Errorf("Unexpected rules after round trip: %+v, %v", again, err)
+	}
+
+	// YAML is not read from a .json file
+	if _, err := ParseRules([]byte(content)); err == nil {
+		t.Error("Expected an error parsing YAML as JSON")
+	}
+}
+
+// TestLoadRulesInvalid tests that invalid rules are rejected.
+func TestLoadRulesInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(`[{"pattern": "fee", "type": "Snacks"}]`), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+
+	if _, err := LoadRules(path); err == nil {
+		t.Error("Expected error for unknown transaction type, got nil")
+	}
+}
+
+// TestCategoryPaths tests rules assigning categories under a transaction type.
+func TestCategoryPaths(t *testing.T) {
+	rules, err := ParseRules([]byte(`[
+		{"pattern": "wire", "category": "fees>BankFees >  WireFee"},
+		{"pattern": "hosting", "type": "Fees", "category": "Fees > Services"}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	if rules[0].Type != FeeTransaction || rules[0].Category != "Fees > BankFees > WireFee" {
+		t.Errorf("Unexpected rule: %+v", rules[0])
+	}
+
+	for _, content := range []string{
+		`[{"pattern": "x", "category": "Fees > > WireFee"}]`,
+		`[{"pattern": "x", "category": "Costs > WireFee"}]`,
+		`[{"pattern": "x", "type": "Payments", "category": "Fees > WireFee"}]`,
+	} {
+		if _, err := ParseRules([]byte(content)); err == nil {
+			t.Errorf("Expected an error for %s", content)
+		}
+	}
+
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(vaultDir, 0755)
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"), WithRules(rules))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	got := processor.CategorizeTransactions([]Transaction{
+		{Type: FeeTransaction, Category: "Fees > BankFees > WireFee"},
+		{Type: PaymentTransaction, Category: "Fees > BankFees"}, // recategorized since
+		{Type: TransferTransaction},
+	})
+	if c := got[FeeTransaction][0].Category; c != "Fees > BankFees > WireFee" {
+		t.Errorf("Expected the full path, got %q", c)
+	}
+	if c := got[PaymentTransaction][0].Category; c != "Payments" {
+		t.Errorf("Expected the path of the new type, got %q", c)
+	}
+	if c := got[TransferTransaction][0].Category; c != "Transfers" {
+		t.Errorf("Expected the type alone, got %q", c)
+	}
+
+	for level, want := range map[int]string{0: "Fees > BankFees > WireFee", 1: "Fees", 2: "Fees > BankFees", 5: "Fees > BankFees > WireFee"} {
+		if got := CategoryAt("Fees > BankFees > WireFee", level); got != want {
+			t.Errorf("CategoryAt(%d) = %q, want %q", level, got, want)
+		}
+	}
+}
+
+// TestRulesAmountAndPriority tests rules with an amount condition and a
+// priority, and that the heuristics remain the fallback.
+func TestRulesAmountAndPriority(t *testing.T) {
+	rules, err := ParseRules([]byte(`[
+		{"pattern": "atm|cash", "type": "Transfers"},
+		{"pattern": "atm|cash", "amount": "< -200", "type": "Payments", "priority": 5},
+		{"pattern": "atm|cash", "amount": "<0", "type": "Fees", "priority": 1}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(vaultDir, 0755)
+
+	processor, err := NewTransactionProcessor(vaultDir, filepath.Join(tmpDir, "ledger"), WithRules(rules))
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	for _, tt := range []struct {
+		rawType, amount, description string
+		want                         TransactionType
+	}{
+		{"other", "-500.00", "ATM 1234", PaymentTransaction},
+		{"other", "-20.00", "ATM 1234", FeeTransaction},
+		{"other", "20.00", "Cash deposit", TransferTransaction},
+		{"other", "n/a", "Cash", TransferTransaction},
+		{"other", "-20.00", "PayPal fee", FeeTransaction},
+		{"payment", "-20.00", "Lunch", PaymentTransaction},
+	} {
+		if got := processor.categorizeTransaction(tt.rawType, tt.amount, tt.description); got != tt.want {
+			t.Errorf("%s %s: expected %s, got %s", tt.description, tt.amount, tt.want, got)
+		}
+	}
+
+	if i, ok := MatchRules(rules, "ATM 1234"); !ok || i != 0 {
+		t.Errorf("Expected the rule without an amount condition, got %d, %v", i, ok)
+	}
+
+	for _, content := range []string{
+		`[{"pattern": "x", "type": "Fees", "amount": "about 5"}]`,
+		`[{"pattern": "x", "type": "Fees", "amount": "<"}]`,
+	} {
+		if _, err := ParseRules([]byte(content)); err == nil {
+			t.Errorf("Expected an error for %s", content)
+		}
+	}
+}
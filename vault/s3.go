@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// s3Source is an S3 bucket, or a prefix within one, read with the AWS SDK.
+// Like a vault directory, only the objects directly under the prefix are
+// listed.
+type s3Source struct {
+	bucket string
+	prefix string // empty, or ending in a slash
+	client *s3.Client
+}
+
+// newS3Source returns the source of an s3://bucket/prefix URL. Credentials,
+// the region and the endpoint are loaded like the AWS CLI does, from the
+// environment, such as AWS_REGION and AWS_ENDPOINT_URL_S3, and the shared
+// config files; the region is AWS_DEFAULT_REGION or us-east-1 if none is
+// set. A custom endpoint is addressed path-style, as S3-compatible services
+// expect.
+func newS3Source(location string) (*s3Source, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 location %q, expected s3://bucket/prefix", location)
+	}
+
+	region := os.Getenv("AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithDefaultRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the AWS configuration: %w", err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = o.BaseEndpoint != nil
+		// reads are retried by ReadCSVFiles, see WithRetry
+		o.Retryer = aws.NopRetryer{}
+	})
+
+	s := &s3Source{bucket: u.Host, prefix: strings.Trim(u.Path, "/"), client: client}
+	if s.prefix != "" {
+		s.prefix += "/"
+	}
+	return s, nil
+}
+
+func (s *s3Source) String() string {
+	return "s3://" + s.bucket + "/" + s.prefix
+}
+
+func (s *s3Source) List(ctx context.Context) ([]string, error) {
+	var files []string
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(s.prefix),
+		Delimiter: aws.String("/"),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", s, newS3Error(err))
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if strings.HasSuffix(key, ".csv") || strings.HasSuffix(key, ".gz") {
+				files = append(files, key)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func (s *s3Source) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(name)})
+	if err != nil {
+		return nil, newS3Error(err)
+	}
+	return out.Body, nil
+}
+
+// s3Error is an error response from S3.
+type s3Error struct {
+	Status  int
+	Code    string
+	Message string
+	err     error // the error of the SDK
+}
+
+// newS3Error returns the error of an S3 request as an *s3Error if S3
+// responded, and as it is otherwise, such as when S3 cannot be reached.
+func newS3Error(err error) error {
+	var resp *awshttp.ResponseError
+	if !errors.As(err, &resp) {
+		return err
+	}
+	e := &s3Error{Status: resp.HTTPStatusCode(), err: err}
+	var api smithy.APIError
+	if errors.As(err, &api) {
+		e.Code, e.Message = api.ErrorCode(), api.ErrorMessage()
+	}
+	if e.Code == "" {
+		e.Code = http.StatusText(e.Status)
+	}
+	return e
+}
+
+func (e *s3Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("S3 %s (%d)", e.Code, e.Status)
+	}
+	return fmt.Sprintf("S3 %s (%d): %s", e.Code, e.Status, e.Message)
+}
+
+func (e *s3Error) Unwrap() error {
+	return e.err
+}
+
+// Is makes missing buckets and objects and denied access match the
+// corresponding errors of a local vault directory.
+func (e *s3Error) Is(target error) bool {
+	switch target {
+	case ErrVaultDirMissing:
+		return e.Code == "NoSuchBucket"
+	case os.ErrNotExist:
+		return e.Code == "NoSuchBucket" || e.Code == "NoSuchKey" || e.Status == http.StatusNotFound
+	case os.ErrPermission:
+		return e.Status == http.StatusForbidden
+	}
+	return false
+}
+
+// transient reports whether the request may succeed when retried.
+func (e *s3Error) transient() bool {
+	return e.Status >= 500 || e.Status == http.StatusTooManyRequests || e.Code == "SlowDown"
+}
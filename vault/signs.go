@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sign is the expected sign of the amounts of a transaction type.
+type Sign string
+
+const (
+	// SignInflow expects positive amounts, money received.
+	SignInflow Sign = "inflow"
+	// SignOutflow expects negative amounts, money paid out.
+	SignOutflow Sign = "outflow"
+)
+
+// SignPolicy declares the sign each transaction type's amounts must have.
+// Transactions whose amount has the wrong sign, such as a fee with a positive
+// amount, are warned about, and dropped when Strict is set. Zero and
+// unparseable amounts, and types without an expectation, are not checked.
+type SignPolicy struct {
+	Expect map[TransactionType]Sign // Expected sign by transaction type
+	Strict bool                     // Drop violating transactions instead of keeping them
+}
+
+// WithSignPolicy sets the signs transaction amounts are checked against.
+func WithSignPolicy(p SignPolicy) Option {
+	return func(tp *TransactionProcessor) {
+		tp.signs = p
+	}
+}
+
+// ParseSignExpectations parses a comma-separated list of type=sign pairs,
+// such as "Fees=outflow,Payments=inflow". Types are matched
+// case-insensitively.
+func ParseSignExpectations(spec string) (map[TransactionType]Sign, error) {
+	expect := make(map[TransactionType]Sign)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, sign, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid sign expectation %q, expected type=inflow or type=outflow", item)
+		}
+
+		t, err := ParseTransactionType(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sign expectation %q: %v", item, err)
+		}
+
+		switch s := Sign(strings.ToLower(strings.TrimSpace(sign))); s {
+		case SignInflow, SignOutflow:
+			expect[t] = s
+		default:
+			return nil, fmt.Errorf("invalid sign expectation %q: sign must be inflow or outflow", item)
+		}
+	}
+	return expect, nil
+}
+
+// violation describes how txn breaks the policy, or returns "" if it does
+// not.
+func (p SignPolicy) violation(txn Transaction) string {
+	want, ok := p.Expect[txn.Type]
+	if !ok || txn.Amount == 0 {
+		return ""
+	}
+	got := SignInflow
+	if txn.Amount < 0 {
+		got = SignOutflow
+	}
+	if got == want {
+		return ""
+	}
+	return fmt.Sprintf("amount %s is an %s, but %s are expected to be %ss", txn.Amount, got, txn.Type, want)
+}
@@ -0,0 +1,55 @@
+package vault
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Source lists and opens the CSV files of a vault, wherever they are stored.
+type Source interface {
+	// List returns the names of the vault's CSV files, plain or
+	// gzip-compressed, sorted. The base name of each identifies the file.
+	List(ctx context.Context) ([]string, error)
+	// Open opens one of the listed files for reading.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// String describes the source in messages.
+	String() string
+}
+
+// IsRemote reports whether a vault location is a URL, such as
+// s3://bucket/prefix, rather than a local directory.
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "s3://")
+}
+
+// NewSource returns the source of the CSV files at a vault location: an
+// s3://bucket/prefix URL, or otherwise a local directory.
+func NewSource(location string) (Source, error) {
+	if strings.HasPrefix(location, "s3://") {
+		return newS3Source(location)
+	}
+	return dirSource(location), nil
+}
+
+// WithSource reads the CSV files from the given source instead of the vault directory.
+func WithSource(s Source) Option {
+	return func(tp *TransactionProcessor) {
+		tp.source = s
+	}
+}
+
+// dirSource is a local vault directory.
+type dirSource string
+
+func (d dirSource) List(context.Context) ([]string, error) {
+	return CSVFiles(string(d))
+}
+
+func (d dirSource) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	return openFile(name)
+}
+
+func (d dirSource) String() string {
+	return string(d)
+}
@@ -0,0 +1,62 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Strictness is how malformed input is handled when the vault is read.
+type Strictness string
+
+const (
+	// StrictnessLenient reads as much as it can. A file with an invalid header
+	// is skipped and a row that cannot be read is dropped; an unparseable
+	// amount counts as 0, an unparseable date leaves the transaction undated,
+	// and an amount with the wrong sign is kept, unless SignPolicy.Strict is
+	// set. All of them are recorded as warnings. This is the default.
+	StrictnessLenient Strictness = "lenient"
+	// StrictnessStrict stops reading the vault at the first invalid header,
+	// row that cannot be read, unparseable amount or date, or amount with the
+	// wrong sign, returning it as a *ParseError.
+	StrictnessStrict Strictness = "strict"
+)
+
+// ParseStrictness parses the name of a Strictness.
+func ParseStrictness(s string) (Strictness, error) {
+	switch st := Strictness(strings.ToLower(strings.TrimSpace(s))); st {
+	case StrictnessLenient, StrictnessStrict:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown strictness %q, expected %s or %s", s, StrictnessLenient, StrictnessStrict)
+}
+
+// WithStrictness sets how malformed input is handled, StrictnessLenient by
+// default.
+func WithStrictness(s Strictness) Option {
+	return func(tp *TransactionProcessor) {
+		tp.strictness = s
+	}
+}
+
+// malformed handles a problem with the row at line of file: in strict mode it
+// returns a *ParseError wrapping ErrMalformedRow, stopping the read, and
+// otherwise it is warned about, with what was done about it if consequence
+// is set, and nil is returned.
+func (tp *TransactionProcessor) malformed(kind WarningKind, file string, line int, problem, consequence string) error {
+	if tp.strictness == StrictnessStrict {
+		return &ParseError{File: file, Line: line, Err: fmt.Errorf("%w: %s", ErrMalformedRow, problem)}
+	}
+	if consequence != "" {
+		problem += ", " + consequence
+	}
+	tp.warn(kind, file, line, "%s", problem)
+	return nil
+}
+
+// aborts reports whether an error reading a file stops reading the vault,
+// as invalid headers and malformed rows do in strict mode, rather than the
+// file being skipped.
+func (tp *TransactionProcessor) aborts(err error) bool {
+	return tp.strictness == StrictnessStrict && (errors.Is(err, ErrInvalidHeader) || errors.Is(err, ErrMalformedRow))
+}
@@ -0,0 +1,90 @@
+package vault
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Suggestion proposes a category for an uncategorized transaction based on
+// the most similar previously-categorized description.
+type Suggestion struct {
+	Transaction Transaction     `json:"transaction"`
+	Suggested   TransactionType `json:"suggested_type"`
+	MatchedWith Transaction     `json:"matched_with"`
+	Score       float64         `json:"score"`   // Similarity between 0 and 1
+	Pattern     string          `json:"pattern"` // Rule pattern that would categorize this description
+}
+
+// NormalizeDescription lowercases a description and strips digits, punctuation,
+// and repeated whitespace so that similar descriptions compare equal.
+// It applies DefaultNormalizer; see Normalizer for a configurable pipeline.
+func NormalizeDescription(description string) string {
+	return defaultNormalizer.Normalize(description)
+}
+
+// SuggestCategories proposes a category for each uncategorized transaction by
+// finding the categorized transaction with the most similar normalized
+// description. Transactions with no similar match are omitted. The suggested
+// pattern matches the transaction's normalized description.
+func SuggestCategories(transactions []Transaction) []Suggestion {
+	var categorized, uncategorized []Transaction
+	for _, txn := range transactions {
+		if txn.Type == UncategorizedTransaction {
+			uncategorized = append(uncategorized, txn)
+		} else {
+			categorized = append(categorized, txn)
+		}
+	}
+
+	var suggestions []Suggestion
+	for _, txn := range uncategorized {
+		tokens := tokenSet(txn.Normalized())
+
+		var best Suggestion
+		for _, candidate := range categorized {
+			score := jaccard(tokens, tokenSet(candidate.Normalized()))
+			if score > best.Score {
+				best = Suggestion{
+					Transaction: txn,
+					Suggested:   candidate.Type,
+					MatchedWith: candidate,
+					Score:       score,
+				}
+			}
+		}
+
+		if best.Score == 0 {
+			continue
+		}
+
+		best.Pattern = "^" + regexp.QuoteMeta(txn.Normalized()) + "$"
+		suggestions = append(suggestions, best)
+	}
+
+	return suggestions
+}
+
+// tokenSet returns the set of words in a normalized description.
+func tokenSet(normalized string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(normalized) {
+		set[word] = true
+	}
+	return set
+}
+
+// jaccard returns the Jaccard similarity of two word sets.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,52 @@
+package vault
+
+import "testing"
+
+// TestNormalizeDescription tests that noise is stripped from descriptions.
+func TestNormalizeDescription(t *testing.T) {
+	tests := map[string]string{
+		"POS 1234 *AMZN MKTP*":  "pos amzn mktp",
+		"  Office   Supplies  ": "office supplies",
+		"Kaffi ehf. 12/03":      "kaffi ehf",
+	}
+
+	for input, expected := range tests {
+		if got := NormalizeDescription(input); got != expected {
+			t.Errorf("NormalizeDescription(%q) = %q, want %q", input, got, expected)
+		}
+	}
+}
+
+// TestSuggestCategories tests that uncategorized transactions are matched to the most similar description.
+func TestSuggestCategories(t *testing.T) {
+	transactions := []Transaction{
+		{Type: FeeTransaction, Description: "Monthly hosting charge", TransactionID: "TXN001"},
+		{Type: TransferTransaction, Description: "Bank transfer", TransactionID: "TXN002"},
+		{Type: UncategorizedTransaction, Description: "Hosting 2024-03", TransactionID: "TXN003"},
+		{Type: UncategorizedTransaction, Description: "Lunch", TransactionID: "TXN004"},
+	}
+
+	suggestions := SuggestCategories(transactions)
+	if len(suggestions) != 1 {
+		t.Fatalf("Expected 1 suggestion, got %d", len(suggestions))
+	}
+
+	s := suggestions[0]
+	if s.Transaction.TransactionID != "TXN003" {
+		t.Errorf("Expected suggestion for TXN003, got %s", s.Transaction.TransactionID)
+	}
+	if s.Suggested != FeeTransaction {
+		t.Errorf("Expected %s, got %s", FeeTransaction, s.Suggested)
+	}
+	if s.MatchedWith.TransactionID != "TXN001" {
+		t.Errorf("Expected match with TXN001, got %s", s.MatchedWith.TransactionID)
+	}
+
+	rule, err := NewCategoryRule(s.Pattern, s.Suggested)
+	if err != nil {
+		t.Fatalf("Suggested pattern is not a valid rule: %v", err)
+	}
+	if !rule.Matches("Hosting 2024-03") {
+		t.Errorf("Suggested pattern %q does not match its own description", s.Pattern)
+	}
+}
@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// FileValidation is the result of parsing a CSV file that is not in the
+// vault, as it would be parsed once added to it.
+type FileValidation struct {
+	File         string            `json:"file"`             // Base name of the file
+	Header       map[string]string `json:"header,omitempty"` // Header of the column each field is read from
+	Transactions int               `json:"transactions"`     // Number of transactions it would add
+	Warnings     []Warning         `json:"warnings"`         // Problems that would not stop it being read
+	Error        string            `json:"error,omitempty"`  // Why the file could not be read at all
+	Valid        bool              `json:"valid"`            // The file can be read without warnings
+}
+
+// ValidateCSV parses the CSV file named name from r, as the vault's files are
+// parsed, without writing anything. It is decompressed if its name ends in
+// .gz, to at most maxBytes. Duplicate transaction IDs are only looked for
+// within the file. A file that cannot be read at all is reported in the
+// result's Error; only a cancelled context, and ErrFileTooLarge when the file
+// decompresses to more than maxBytes, are returned as errors.
+func (tp *TransactionProcessor) ValidateCSV(ctx context.Context, name string, r io.Reader, maxBytes int64) (FileValidation, error) {
+	base := filepath.Base(name)
+	v := FileValidation{File: base, Warnings: []Warning{}}
+
+	tp.resetWarnings()
+	defer tp.resetWarnings()
+
+	err := func() error {
+		if !strings.HasSuffix(strings.ToLower(base), ".gz") {
+			return tp.parseCSV(ctx, base, r, v.setHeader, v.count, nil)
+		}
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return &ParseError{File: base, Err: fmt.Errorf("failed to decompress file: %w", err)}
+		}
+		defer gz.Close()
+		// one byte past the limit tells a file of exactly maxBytes from a
+		// larger one
+		limited := &io.LimitedReader{R: gz, N: maxBytes + 1}
+		err = tp.parseCSV(ctx, base, limited, v.setHeader, v.count, nil)
+		if limited.N == 0 {
+			return fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, maxBytes)
+		}
+		return err
+	}()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return FileValidation{}, fmt.Errorf("validating CSV file cancelled: %w", ctxErr)
+	}
+	if errors.Is(err, ErrFileTooLarge) {
+		return FileValidation{}, err
+	}
+	if err != nil {
+		v.Error = err.Error()
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			v.Error = parseErr.Err.Error()
+		}
+	}
+
+	v.Warnings = append(v.Warnings, tp.warnings...)
+	v.Valid = v.Error == "" && len(v.Warnings) == 0
+	return v, nil
+}
+
+func (v *FileValidation) setHeader(headers []string) {
+	v.Header = make(map[string]string, len(Columns))
+	for i, field := range Columns {
+		v.Header[field] = strings.TrimSpace(headers[i])
+	}
+}
+
+func (v *FileValidation) count(Transaction) error {
+	v.Transactions++
+	return nil
+}
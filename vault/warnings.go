@@ -0,0 +1,172 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WarningKind classifies warnings, so that they can be counted and checked
+// separately.
+type WarningKind string
+
+const (
+	// WarningFile is a file that could not be read, or a vault without files.
+	WarningFile WarningKind = "file"
+	// WarningSchema is a file whose header is missing the expected columns.
+	WarningSchema WarningKind = "schema"
+	// WarningParse is a row, date or amount that could not be parsed.
+	WarningParse WarningKind = "parse"
+	// WarningDuplicate is a transaction read again, by ID or, without one, by
+	// date, amount and description in another file, and skipped.
+	WarningDuplicate WarningKind = "duplicate"
+	// WarningConflict is a transaction ID read again with a different record.
+	WarningConflict WarningKind = "conflict"
+	// WarningSign is an amount whose sign breaks the SignPolicy.
+	WarningSign WarningKind = "sign"
+)
+
+// Warning is a problem found reading the vault that did not stop it, such as
+// a skipped row, an unparseable date or a duplicate transaction ID.
+type Warning struct {
+	File   string      `json:"file"`           // Base name of the file, empty if the warning concerns the vault
+	Line   int         `json:"line,omitempty"` // Line number of the problem, or 0 if it concerns the whole file
+	Reason string      `json:"reason"`
+	Kind   WarningKind `json:"kind,omitempty"`
+}
+
+// String formats the warning like a ParseError.
+func (w Warning) String() string {
+	switch {
+	case w.File == "":
+		return w.Reason
+	case w.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", w.File, w.Line, w.Reason)
+	default:
+		return fmt.Sprintf("%s: %s", w.File, w.Reason)
+	}
+}
+
+// Warnings returns the warnings of the last time the vault was read with
+// ReadCSVFiles or StreamCSVFiles, in the order they were found.
+func (tp *TransactionProcessor) Warnings() []Warning {
+	return append([]Warning{}, tp.warnings...)
+}
+
+// resetWarnings forgets the warnings of the previous read.
+func (tp *TransactionProcessor) resetWarnings() {
+	tp.warnings = nil
+	tp.warned = make(map[Warning]bool)
+	tp.seenIDs = make(map[string]seenTransaction)
+	tp.seenRows = make(map[string]Warning)
+	tp.duplicates = 0
+}
+
+// warn logs and records a warning. A warning found again, when a file is
+// retried, is only recorded once.
+func (tp *TransactionProcessor) warn(kind WarningKind, file string, line int, format string, args ...interface{}) {
+	w := Warning{File: file, Line: line, Reason: fmt.Sprintf(format, args...), Kind: kind}
+	tp.logger.Printf("Warning: %s", w)
+	tp.record(w)
+}
+
+// record records a warning unless it has already been recorded.
+func (tp *TransactionProcessor) record(w Warning) {
+	if tp.warned == nil {
+		tp.resetWarnings()
+	}
+	if tp.warned[w] {
+		return
+	}
+	tp.warned[w] = true
+	tp.warnings = append(tp.warnings, w)
+}
+
+// seenTransaction is where a transaction ID was first read, and the
+// transaction read there.
+type seenTransaction struct {
+	at  Warning
+	txn Transaction
+}
+
+// skipDuplicate reports whether a transaction repeats one already read, so
+// that a statement exported twice, or overlapping downloads, are not counted
+// twice: the first record is kept and the repeat warned about and skipped.
+// Transactions are the same when they share a transaction ID and record.
+// Records with the same ID but a different amount, date or type conflict
+// instead, and are both kept and reported as a conflict, naming both records,
+// so that one of them is not silently lost before it has been reviewed.
+// Transactions without an ID are the same when they have the same date,
+// amount and description in different files; within a file, such rows are
+// taken to be separate transactions, such as two identical purchases.
+func (tp *TransactionProcessor) skipDuplicate(file string, line int, txn Transaction) bool {
+	if tp.seenIDs == nil {
+		tp.resetWarnings()
+	}
+	at := Warning{File: file, Line: line}
+	id := txn.TransactionID
+	if id == "" {
+		key := strings.Join([]string{txn.Date, txn.Amount.String(), txn.Description}, "\x00")
+		first, ok := tp.seenRows[key]
+		if !ok {
+			tp.seenRows[key] = at
+			return false
+		}
+		if first.File == file {
+			return false
+		}
+		tp.duplicates++
+		tp.warn(WarningDuplicate, file, line, "duplicate of the transaction without an ID at %s:%d, with the same date, amount and description, skipping", first.File, first.Line)
+		return true
+	}
+
+	first, ok := tp.seenIDs[id]
+	if !ok {
+		tp.seenIDs[id] = seenTransaction{at: at, txn: txn}
+		return false
+	}
+	if first.at == at {
+		return false
+	}
+	if diffs := conflicts(first.txn, txn); len(diffs) > 0 {
+		tp.warn(WarningConflict, file, line, "conflicting records for transaction ID %s in %s:%d and %s:%d: %s",
+			id, first.at.File, first.at.Line, file, line, strings.Join(diffs, ", "))
+		return false
+	}
+	tp.duplicates++
+	tp.warn(WarningDuplicate, file, line, "duplicate transaction ID %s, first read at %s:%d, skipping", id, first.at.File, first.at.Line)
+	return true
+}
+
+// forgetFile forgets the transactions read from file, when none of them are
+// returned because reading it failed, so that their repeats in other files
+// are kept.
+func (tp *TransactionProcessor) forgetFile(file string) {
+	for id, seen := range tp.seenIDs {
+		if seen.at.File == file {
+			delete(tp.seenIDs, id)
+		}
+	}
+	for key, at := range tp.seenRows {
+		if at.File == file {
+			delete(tp.seenRows, key)
+		}
+	}
+}
+
+// conflicts describes how two records of the same transaction differ in
+// amount, date or type. Amounts are compared by value, so "10.0" and "10.00"
+// are the same amount, as are "1.234,50" and "1234,50" with a decimal comma,
+// and dates when they parse.
+func conflicts(a, b Transaction) []string {
+	var diffs []string
+	if a.Amount != b.Amount {
+		diffs = append(diffs, fmt.Sprintf("amount %s vs %s", a.Amount.String(), b.Amount.String()))
+	}
+	if sameDate := a.Date == b.Date || (!a.Timestamp.IsZero() && a.Timestamp.Equal(b.Timestamp)); !sameDate {
+		diffs = append(diffs, fmt.Sprintf("date %s vs %s", a.Date, b.Date))
+	}
+	if a.Type != b.Type {
+		diffs = append(diffs, fmt.Sprintf("type %s vs %s", a.Type, b.Type))
+	}
+	return diffs
+}